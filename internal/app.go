@@ -16,9 +16,11 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 
+	"github.com/shurco/litecart/internal/jobs"
 	"github.com/shurco/litecart/internal/middleware"
 	"github.com/shurco/litecart/internal/queries"
 	"github.com/shurco/litecart/internal/routes"
+	"github.com/shurco/litecart/internal/storage"
 	"github.com/shurco/litecart/migrations"
 	"github.com/shurco/litecart/pkg/logging"
 	"github.com/shurco/litecart/pkg/webutil"
@@ -48,6 +50,11 @@ func NewApp(httpAddr, httpsAddr string, noSite, appDev bool) error {
 		return err
 	}
 
+	if err := setupStorage(); err != nil {
+		log.Err(err).Send()
+		return err
+	}
+
 	app, err := setupFiberApp(noSite)
 	if err != nil {
 		return err
@@ -58,6 +65,15 @@ func NewApp(httpAddr, httpsAddr string, noSite, appDev bool) error {
 		os.Exit(1)
 	}
 
+	// background delivery of letters and webhooks
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	if err := jobs.Start(jobsCtx, jobs.DefaultWorkers); err != nil {
+		log.Err(err).Send()
+		return err
+	}
+	go cleanupUploads(jobsCtx)
+
 	setupRoutes(app, noSite)
 	printStartupInfo(schema, mainAddr, noSite)
 
@@ -76,6 +92,45 @@ func determineSchemaAndAddr(httpAddr, httpsAddr string) (schema, mainAddr string
 	return "http", httpAddr
 }
 
+// setupStorage selects the storage of uploaded images and digital files
+// from the environment.
+func setupStorage() error {
+	cfg, err := storage.ConfigFromEnv()
+	if err != nil {
+		return err
+	}
+
+	files, err := storage.New(cfg)
+	if err != nil {
+		return err
+	}
+	storage.Set(files)
+
+	return nil
+}
+
+// cleanupUploads removes abandoned chunked uploads of digital files once an
+// hour until ctx is cancelled.
+func cleanupUploads(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		removed, err := queries.DB().CleanupDigitalUploads(ctx, time.Now().Add(-queries.DigitalUploadLifetime))
+		if err != nil && ctx.Err() == nil {
+			log.Err(err).Send()
+		} else if removed > 0 {
+			log.Info().Msgf("removed %d abandoned uploads", removed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 // setupFiberApp configures and returns a Fiber application instance.
 func setupFiberApp(noSite bool) (*fiber.App, error) {
 	config := fiber.Config{
@@ -93,8 +148,7 @@ func setupFiberApp(noSite bool) (*fiber.App, error) {
 
 // setupRoutes configures application routes.
 func setupRoutes(app *fiber.App, noSite bool) {
-	app.Static("/uploads", "./lc_uploads")
-	app.Static("/secrets", "./lc_digitals")
+	routes.UploadRoutes(app)
 
 	// Register API routes before SPA routes to ensure they are processed first
 	routes.ApiPrivateRoutes(app)
@@ -0,0 +1,199 @@
+package fulfillment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/shurco/litecart/internal/jobs"
+	"github.com/shurco/litecart/internal/mailer"
+	"github.com/shurco/litecart/internal/queries"
+	"github.com/shurco/litecart/internal/webhook"
+	"github.com/shurco/litecart/pkg/litepay"
+)
+
+// JobFulfill is the job kind that fulfills the "api" products of a paid cart.
+const JobFulfill = "fulfillment.cart"
+
+type fulfillJob struct {
+	CartID string `json:"cart_id"`
+}
+
+func init() {
+	jobs.Register(JobFulfill, func(ctx context.Context, payload []byte) error {
+		job := &fulfillJob{}
+		if err := json.Unmarshal(payload, job); err != nil {
+			return err
+		}
+		return run(ctx, job.CartID)
+	})
+}
+
+// Queue schedules the fulfillment of a paid cart. It runs apart from the
+// purchase letter, so the buyer does not wait for a fulfillment URL to get
+// the rest of the cart.
+func Queue(cartID string) error {
+	return jobs.Enqueue(JobFulfill, &fulfillJob{CartID: cartID})
+}
+
+// run fulfills a cart and queues the access letter with what was fulfilled
+// and is not in the purchase letter. Failed products fail the job, so they
+// are tried again.
+func run(ctx context.Context, cartID string) error {
+	err := Fulfill(ctx, cartID)
+
+	fulfillments, dbErr := queries.DB().Fulfillments(ctx, cartID)
+	if dbErr != nil {
+		return errors.Join(err, dbErr)
+	}
+	for _, fulfillment := range fulfillments {
+		if fulfillment.Done() && fulfillment.Letter == "" {
+			return errors.Join(err, mailer.QueueAccessLetter(cartID))
+		}
+	}
+	return err
+}
+
+// Request is the JSON body sent to the fulfillment URL of an "api" product.
+// It is signed like a webhook, and the X-Litecart-Event-Id header is
+// "<cart_id>.<product_id>", so the receiver can recognize a repeated request.
+type Request struct {
+	Email   string  `json:"email"`
+	Cart    Cart    `json:"cart"`
+	Product Product `json:"product"`
+}
+
+// Cart is the paid cart in a fulfillment request.
+type Cart struct {
+	ID          string `json:"id"`
+	AmountTotal int    `json:"amount_total"`
+	Currency    string `json:"currency"`
+}
+
+// Product is the bought product in a fulfillment request. Quantity is the
+// total of all cart lines of the product, Variants splits it by variant.
+type Product struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Slug     string    `json:"slug"`
+	Quantity int       `json:"quantity"`
+	Variants []Variant `json:"variants,omitempty"`
+}
+
+// Variant is a bought variant of the product in a fulfillment request.
+type Variant struct {
+	ID       string `json:"id"`
+	Quantity int    `json:"quantity"`
+}
+
+// Fulfill calls the fulfillment URL once for every "api" product of a paid
+// cart that has not been fulfilled yet and stores the responses. The response body,
+// such as a key, an activation URL or any text, is given to the buyer as is.
+// Failed products are recorded with their error and returned together, so the
+// caller can try again later.
+func Fulfill(ctx context.Context, cartID string) error {
+	db := queries.DB()
+
+	cart, err := db.Cart(ctx, cartID)
+	if err != nil {
+		return err
+	}
+	if cart.PaymentStatus != litepay.PAID {
+		return nil
+	}
+
+	fulfillments, err := db.Fulfillments(ctx, cartID)
+	if err != nil {
+		return err
+	}
+	done := map[string]bool{}
+	for _, fulfillment := range fulfillments {
+		done[fulfillment.ProductID] = fulfillment.Done()
+	}
+
+	// a product can be in several cart lines, one per variant, but it is
+	// fulfilled once, so the lines are put together
+	var productIDs []string
+	quantities := map[string]int{}
+	variants := map[string][]Variant{}
+	for _, item := range cart.Cart {
+		if _, ok := quantities[item.ProductID]; !ok {
+			productIDs = append(productIDs, item.ProductID)
+		}
+		quantities[item.ProductID] += item.Quantity
+		if item.VariantID != "" {
+			variants[item.ProductID] = append(variants[item.ProductID], Variant{ID: item.VariantID, Quantity: item.Quantity})
+		}
+	}
+
+	var errs []error
+	for _, productID := range productIDs {
+		if done[productID] {
+			continue
+		}
+
+		product, err := db.Product(ctx, true, productID)
+		if err != nil {
+			return err
+		}
+		if product.Digital.Type != "api" {
+			continue
+		}
+
+		content, err := call(ctx, product.Digital.FulfillmentURL, product.Digital.FulfillmentSecret, &Request{
+			Email: cart.Email,
+			Cart: Cart{
+				ID:          cart.ID,
+				AmountTotal: cart.AmountTotal,
+				Currency:    cart.Currency,
+			},
+			Product: Product{
+				ID:       product.ID,
+				Name:     product.Name,
+				Slug:     product.Slug,
+				Quantity: quantities[productID],
+				Variants: variants[productID],
+			},
+		})
+
+		lastError := ""
+		if err != nil {
+			lastError = err.Error()
+			errs = append(errs, fmt.Errorf("product %s: %w", product.ID, err))
+		}
+		if err := db.SaveFulfillment(ctx, cart.ID, product.ID, content, lastError); err != nil {
+			return err
+		}
+		done[product.ID] = lastError == ""
+	}
+
+	return errors.Join(errs...)
+}
+
+// call sends a fulfillment request and returns the response body.
+func call(ctx context.Context, url, secret string, request *Request) (string, error) {
+	if url == "" {
+		return "", errors.New("fulfillment URL is not configured")
+	}
+
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	status, body, err := webhook.Send(ctx, url, request.Cart.ID+"."+request.Product.ID, secret, payload)
+	if err != nil {
+		return "", err
+	}
+	if status < 200 || status > 299 {
+		return "", fmt.Errorf("fulfillment URL answered with status %d", status)
+	}
+
+	content := strings.TrimSpace(string(body))
+	if content == "" {
+		return "", errors.New("fulfillment URL answered with an empty body")
+	}
+	return content, nil
+}
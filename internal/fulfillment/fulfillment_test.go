@@ -0,0 +1,129 @@
+package fulfillment
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/internal/queries"
+	"github.com/shurco/litecart/internal/testutil"
+	"github.com/shurco/litecart/internal/webhook"
+	"github.com/shurco/litecart/migrations"
+	"github.com/shurco/litecart/pkg/litepay"
+)
+
+func Test_fulfill(t *testing.T) {
+	const secret = "0123456789abcdef0123456789abcdef"
+
+	calls := 0
+	status := http.StatusBadGateway
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(webhook.HeaderTimestamp), 10, 64)
+		if r.Header.Get(webhook.HeaderSignature) != webhook.Sign(secret, timestamp, body) {
+			t.Errorf("bad signature")
+		}
+
+		request := &Request{}
+		if err := json.Unmarshal(body, request); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		if request.Email != "buyer@mail.com" || request.Cart.ID != "cartapi00000001" || request.Product.Quantity != 2 ||
+			len(request.Product.Variants) != 1 || request.Product.Variants[0].ID != "variant000000001" {
+			t.Errorf("unexpected request %+v", request)
+		}
+		if r.Header.Get(webhook.HeaderEventID) != request.Cart.ID+"."+request.Product.ID {
+			t.Errorf("unexpected event id %q", r.Header.Get(webhook.HeaderEventID))
+		}
+
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("  SEAT-KEY-42\n"))
+	}))
+	defer srv.Close()
+
+	defer testutil.WithCmdTestDir(t)()
+	if err := queries.New(migrations.Embed()); err != nil {
+		t.Fatal(err)
+	}
+	db := queries.DB()
+	ctx := context.Background()
+
+	product, err := db.AddProduct(ctx, &models.Product{Name: "Seats", Slug: "seats", Amount: 100, Digital: models.Digital{
+		Type:              "api",
+		FulfillmentURL:    srv.URL,
+		FulfillmentSecret: secret,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cart := &models.Cart{
+		Core:  models.Core{ID: "cartapi00000001"},
+		Email: "buyer@mail.com",
+		Cart: []models.CartProduct{
+			{ProductID: product.ID, VariantID: "variant000000001", Quantity: 1},
+			{ProductID: product.ID, Quantity: 1},
+		},
+		AmountTotal:   200,
+		Currency:      "USD",
+		PaymentStatus: litepay.PAID,
+	}
+	if err := db.AddCart(ctx, cart); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Fulfill(ctx, cart.ID); err == nil {
+		t.Fatalf("a 502 response must fail the fulfillment")
+	}
+	letter, err := db.CartLetterPurchase(ctx, cart.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(letter.Data["Purchases"], "Seats - in a separate letter") {
+		t.Fatalf("the letter must not wait for the fulfillment: %q", letter.Data["Purchases"])
+	}
+
+	status = http.StatusOK
+	if err := Fulfill(ctx, cart.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := Fulfill(ctx, cart.ID); err != nil || calls != 2 {
+		t.Fatalf("a fulfilled product was requested again: %d calls, %v", calls, err)
+	}
+
+	fulfillments, err := db.Fulfillments(ctx, cart.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fulfillments) != 1 || fulfillments[0].Content != "SEAT-KEY-42" || fulfillments[0].Error != "" || fulfillments[0].Attempts != 2 {
+		t.Fatalf("unexpected fulfillments %+v", fulfillments)
+	}
+
+	access, productIDs, err := db.CartLetterAccess(ctx, cart.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if access == nil || !strings.Contains(access.Data["Purchases"], "SEAT-KEY-42") || len(productIDs) != 1 {
+		t.Fatalf("the access letter misses the fulfillment: %+v", access)
+	}
+	if err := db.MarkFulfillmentsSent(ctx, cart.ID, productIDs...); err != nil {
+		t.Fatal(err)
+	}
+	if access, _, err := db.CartLetterAccess(ctx, cart.ID); err != nil || access != nil {
+		t.Fatalf("the content was sent again: %+v, %v", access, err)
+	}
+
+	letter, err = db.CartLetterPurchase(ctx, cart.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(letter.Data["Purchases"], "SEAT-KEY-42") {
+		t.Fatalf("a resent letter misses the fulfillment: %q", letter.Data["Purchases"])
+	}
+}
@@ -1,10 +1,17 @@
 package handlers
 
 import (
+	"sync"
+	"time"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/shurco/litecart/internal/fulfillment"
 	"github.com/shurco/litecart/internal/mailer"
+	"github.com/shurco/litecart/internal/models"
 	"github.com/shurco/litecart/internal/queries"
+	"github.com/shurco/litecart/internal/webhook"
 	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/litepay"
 	"github.com/shurco/litecart/pkg/logging"
 	"github.com/shurco/litecart/pkg/webutil"
 )
@@ -56,7 +63,7 @@ func Cart(c *fiber.Ctx) error {
 	cart, err := db.Cart(c.Context(), cartID)
 	if err != nil {
 		log.ErrorStack(err)
-		if err == errors.ErrProductNotFound {
+		if err == errors.ErrCartNotFound {
 			return webutil.StatusNotFound(c)
 		}
 		return webutil.StatusInternalServerError(c)
@@ -66,7 +73,7 @@ func Cart(c *fiber.Ctx) error {
 	// Pass cartID to include digital products purchased in this cart
 	var cartItems []map[string]interface{}
 	if len(cart.Cart) > 0 {
-		products, err := db.ListProducts(c.Context(), false, 0, 0, cartID, cart.Cart...)
+		products, err := db.ListProducts(c.Context(), false, nil, 0, 0, cartID, cart.Cart...)
 		if err != nil {
 			log.ErrorStack(err)
 			return webutil.StatusInternalServerError(c)
@@ -74,30 +81,213 @@ func Cart(c *fiber.Ctx) error {
 		cartItems = queries.BuildCartItems(cart, products)
 	}
 
+	downloads, err := db.Downloads(c.Context(), cartID)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	fulfillments, err := db.Fulfillments(c.Context(), cartID)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
 	return webutil.Response(c, fiber.StatusOK, "Cart", map[string]interface{}{
-		"id":             cart.ID,
-		"email":          cart.Email,
-		"amount_total":   cart.AmountTotal,
-		"currency":       cart.Currency,
-		"payment_status": cart.PaymentStatus,
-		"payment_system": cart.PaymentSystem,
-		"payment_id":     cart.PaymentID,
-		"created":        cart.Created,
-		"updated":        cart.Updated,
-		"items":          cartItems,
+		"id":              cart.ID,
+		"email":           cart.Email,
+		"amount_total":    cart.AmountTotal,
+		"amount_refunded": cart.AmountRefunded,
+		"currency":        cart.Currency,
+		"payment_status":  cart.PaymentStatus,
+		"payment_system":  cart.PaymentSystem,
+		"payment_id":      cart.PaymentID,
+		"created":         cart.Created,
+		"updated":         cart.Updated,
+		"items":           cartItems,
+		"downloads":       downloads,
+		"fulfillments":    fulfillments,
+		"shipping":        cart.Shipping,
 	})
 }
 
-// CartSendMail sends an email notification for a cart.
+// CartSendMail sends an email notification for a cart. The "api" products
+// that are not fulfilled yet are tried again in the background.
 // [post] /api/_/carts/:cart_id/mail
 func CartSendMail(c *fiber.Ctx) error {
 	cartID := c.Params("cart_id")
 	log := logging.New()
 
-	if err := mailer.SendCartLetter(cartID); err != nil {
+	if err := mailer.SendCartLetter(c.Context(), cartID); err != nil {
 		log.ErrorStack(err)
 		return webutil.StatusInternalServerError(c)
 	}
+	if err := fulfillment.Queue(cartID); err != nil {
+		log.ErrorStack(err)
+	}
 
 	return webutil.Response(c, fiber.StatusOK, "Mail sended", nil)
 }
+
+// refundLocks holds a mutex per cart, so two refunds of a cart can not both
+// pass the check of the amount left to refund.
+var refundLocks sync.Map
+
+// CartRefund refunds a paid cart in full or in part through its payment system.
+// [post] /api/_/carts/:cart_id/refund
+func CartRefund(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+	cartID := c.Params("cart_id")
+	request := &models.CartRefund{}
+
+	lock, _ := refundLocks.LoadOrStore(cartID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(request); err != nil {
+			log.ErrorStack(err)
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+	}
+
+	if err := request.Validate(); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	cart, err := db.Cart(c.Context(), cartID)
+	if err != nil {
+		if err == errors.ErrCartNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	if cart.PaymentStatus != litepay.PAID && cart.PaymentStatus != litepay.PARTIALLY_REFUNDED {
+		return webutil.StatusBadRequest(c, "cart is not paid")
+	}
+
+	if request.Amount > cart.AmountTotal-cart.AmountRefunded {
+		return webutil.StatusBadRequest(c, "refund amount exceeds the paid amount")
+	}
+
+	provider, providerSetting, err := db.PaymentProvider(c.Context(), cart.PaymentSystem)
+	if err != nil {
+		if err == errors.ErrProviderNotFound {
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	payment, err := provider.New(litepay.New("", "", ""), providerSetting).Refund(&litepay.Payment{
+		PaymentSystem:  cart.PaymentSystem,
+		MerchantID:     cart.PaymentID,
+		CartID:         cart.ID,
+		AmountTotal:    cart.AmountTotal,
+		AmountRefunded: cart.AmountRefunded,
+		Currency:       cart.Currency,
+	}, request.Amount)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	// the money is already returned: a refund notification of the provider
+	// may have recorded it first, and only a failing base leaves it unrecorded
+	_, err = db.UpdateCart(c.Context(), &models.Cart{
+		Core: models.Core{
+			ID: cart.ID,
+		},
+		AmountRefunded: payment.AmountRefunded,
+		PaymentStatus:  payment.Status,
+	}, models.CartSourceAdmin)
+	if _, ok := err.(*queries.CartTransitionError); err != nil && !ok {
+		log.Error().Err(err).Str("cart_id", cart.ID).Int("amount_refunded", payment.AmountRefunded).Str("payment_status", string(payment.Status)).Msg("refund is not recorded")
+		return webutil.StatusInternalServerError(c)
+	}
+
+	stored, err := db.Cart(c.Context(), cart.ID)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	// a failed hook does not fail the request
+	hook := &webhook.Payment{
+		Event:     webhook.PAYMENT_REFUND,
+		TimeStamp: time.Now().Unix(),
+		Data: webhook.Data{
+			PaymentSystem: cart.PaymentSystem,
+			PaymentStatus: payment.Status,
+			CartID:        cart.ID,
+			TotalAmount:   cart.AmountTotal,
+			RefundAmount:  payment.AmountRefunded - cart.AmountRefunded,
+			Currency:      cart.Currency,
+		},
+	}
+	if err := webhook.QueuePaymentHook(hook); err != nil {
+		log.ErrorStack(err)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Cart refunded", map[string]any{
+		"id":              stored.ID,
+		"amount_total":    stored.AmountTotal,
+		"amount_refunded": stored.AmountRefunded,
+		"currency":        stored.Currency,
+		"payment_status":  stored.PaymentStatus,
+	})
+}
+
+// CartStatusHistory returns the status transitions of a cart.
+// [get] /api/_/carts/:cart_id/history
+func CartStatusHistory(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+	cartID := c.Params("cart_id")
+
+	if _, err := db.Cart(c.Context(), cartID); err != nil {
+		if err == errors.ErrCartNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	history, err := db.CartStatusHistory(c.Context(), cartID)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Cart status history", history)
+}
+
+// CartResetDownloads resets the download counter of a cart, so the buyer can
+// download the files again up to the product limit.
+// [post] /api/_/carts/:cart_id/downloads/reset
+func CartResetDownloads(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+	cartID := c.Params("cart_id")
+
+	if _, err := db.Cart(c.Context(), cartID); err != nil {
+		if err == errors.ErrCartNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	reset, err := db.ResetDownloads(c.Context(), cartID)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Downloads reset", map[string]any{
+		"reset": reset,
+	})
+}
@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,6 +15,7 @@ import (
 	"github.com/shurco/litecart/internal/queries"
 	"github.com/shurco/litecart/internal/testutil"
 	"github.com/shurco/litecart/migrations"
+	"github.com/shurco/litecart/pkg/litepay"
 )
 
 func setupCartApp(t *testing.T) (*fiber.App, func()) {
@@ -54,3 +57,152 @@ func Test_cart_send_mail_status(t *testing.T) {
 		t.Fatalf("unexpected status %d", resp.StatusCode)
 	}
 }
+
+func Test_cart_refund(t *testing.T) {
+	app, cleanup := setupCartApp(t)
+	defer cleanup()
+
+	db := queries.DB()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = db.AddCart(ctx, &models.Cart{Core: models.Core{ID: "cartpaid0000001"}, AmountTotal: 1000, Currency: "USD", PaymentStatus: litepay.PAID, PaymentSystem: litepay.DUMMY})
+	_ = db.AddCart(ctx, &models.Cart{Core: models.Core{ID: "cartnew00000001"}, AmountTotal: 1000, Currency: "USD", PaymentStatus: litepay.NEW, PaymentSystem: litepay.DUMMY})
+	_ = db.AddCart(ctx, &models.Cart{Core: models.Core{ID: "cartcoin0000001"}, AmountTotal: 1000, Currency: "USD", PaymentStatus: litepay.PAID, PaymentSystem: litepay.SPECTROCOIN})
+
+	app.Post("/api/_/carts/:cart_id/refund", CartRefund)
+
+	cases := []struct {
+		cartID string
+		body   string
+		status int
+		cart   litepay.Status
+		amount int
+	}{
+		{"cartpaid0000001", `{"amount":1500}`, http.StatusBadRequest, litepay.PAID, 0},
+		{"cartpaid0000001", `{"amount":-1}`, http.StatusBadRequest, litepay.PAID, 0},
+		{"cartpaid0000001", `{"amount":400}`, http.StatusOK, litepay.PARTIALLY_REFUNDED, 400},
+		{"cartpaid0000001", ``, http.StatusOK, litepay.REFUNDED, 1000},
+		{"cartpaid0000001", ``, http.StatusBadRequest, litepay.REFUNDED, 1000},
+		{"cartnew00000001", ``, http.StatusBadRequest, litepay.NEW, 0},
+		{"cartcoin0000001", ``, http.StatusBadRequest, litepay.PAID, 0},
+		{"cartnone0000001", ``, http.StatusNotFound, "", 0},
+	}
+
+	for _, tt := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/api/_/carts/"+tt.cartID+"/refund", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, _ := app.Test(req)
+		if resp.StatusCode != tt.status {
+			t.Fatalf("%s %s: status %d, want %d", tt.cartID, tt.body, resp.StatusCode, tt.status)
+		}
+
+		if tt.cart == "" {
+			continue
+		}
+		cart, err := db.Cart(ctx, tt.cartID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cart.PaymentStatus != tt.cart || cart.AmountRefunded != tt.amount {
+			t.Fatalf("%s %s: cart %s/%d, want %s/%d", tt.cartID, tt.body, cart.PaymentStatus, cart.AmountRefunded, tt.cart, tt.amount)
+		}
+	}
+}
+
+func Test_cart_status_history(t *testing.T) {
+	app, cleanup := setupCartApp(t)
+	defer cleanup()
+
+	db := queries.DB()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = db.AddCart(ctx, &models.Cart{Core: models.Core{ID: "carthist0000001"}, AmountTotal: 1000, Currency: "USD", PaymentStatus: litepay.PAID, PaymentSystem: litepay.DUMMY})
+
+	app.Post("/api/_/carts/:cart_id/refund", CartRefund)
+	app.Get("/api/_/carts/:cart_id/history", CartStatusHistory)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/_/carts/carthist0000001/refund", nil)
+	if resp, _ := app.Test(req); resp.StatusCode != http.StatusOK {
+		t.Fatalf("refund status %d", resp.StatusCode)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/_/carts/carthist0000001/history", nil)
+	resp, _ := app.Test(req)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Result []models.CartStatusHistory `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Result) != 1 || body.Result[0].To != litepay.REFUNDED || body.Result[0].Source != models.CartSourceAdmin {
+		t.Fatalf("unexpected history %+v", body.Result)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/_/carts/cartnone0000001/history", nil)
+	if resp, _ := app.Test(req); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+}
+
+func Test_cart_downloads(t *testing.T) {
+	app, cleanup := setupCartApp(t)
+	defer cleanup()
+
+	db := queries.DB()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	product, err := db.AddProduct(ctx, &models.Product{Name: "Guide", Slug: "guide", Amount: 100, Digital: models.Digital{Type: "file", DownloadLimit: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := db.AddDigitalFile(ctx, product.ID, "", "uuid-guide", "pdf", "guide.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = db.AddCart(ctx, &models.Cart{Core: models.Core{ID: "cartdown0000001"}, Cart: []models.CartProduct{{ProductID: product.ID, Quantity: 1}}, AmountTotal: 100, Currency: "USD", PaymentStatus: litepay.PAID, PaymentSystem: litepay.DUMMY})
+
+	settings, _ := db.GetSettingByKey(ctx, "download_secret")
+	url := queries.DownloadURL("example.com", settings["download_secret"].Value.(string), "cartdown0000001", file.ID, time.Now().Add(time.Hour))
+	token := url[strings.LastIndex(url, "/")+1:]
+	if _, _, err := db.DownloadFile(ctx, token, "127.0.0.1", "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	app.Get("/api/_/carts/:cart_id", Cart)
+	app.Post("/api/_/carts/:cart_id/downloads/reset", CartResetDownloads)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/_/carts/cartdown0000001", nil)
+	resp, _ := app.Test(req)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	var cart struct {
+		Result struct {
+			Downloads []models.Download `json:"downloads"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&cart); err != nil {
+		t.Fatal(err)
+	}
+	if len(cart.Result.Downloads) != 1 || cart.Result.Downloads[0].FileName != "guide.pdf" {
+		t.Fatalf("unexpected downloads %+v", cart.Result.Downloads)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/_/carts/cartdown0000001/downloads/reset", nil)
+	if resp, _ := app.Test(req); resp.StatusCode != http.StatusOK {
+		t.Fatalf("reset status %d", resp.StatusCode)
+	}
+	if _, _, err := db.DownloadFile(ctx, token, "127.0.0.1", "test"); err != nil {
+		t.Fatalf("download after reset: %v", err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/_/carts/cartnone0000001/downloads/reset", nil)
+	if resp, _ := app.Test(req); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+}
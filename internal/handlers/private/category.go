@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/internal/queries"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/logging"
+	"github.com/shurco/litecart/pkg/webutil"
+)
+
+// Categories returns all categories, parents before their children.
+// [get] /api/_/categories
+func Categories(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	categories, err := db.Categories(c.Context(), true)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Categories", categories)
+}
+
+// parseCategory reads and validates a category from the request body.
+func parseCategory(c *fiber.Ctx) (*models.Category, error) {
+	request := &models.Category{}
+	if err := c.BodyParser(request); err != nil {
+		return nil, err
+	}
+
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
+
+// AddCategory creates a category.
+// [post] /api/_/categories
+func AddCategory(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	request, err := parseCategory(c)
+	if err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	category, err := db.AddCategory(c.Context(), request)
+	if err != nil {
+		switch err {
+		case errors.ErrCategorySlugExists, errors.ErrCategoryParent:
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Category added", category)
+}
+
+// UpdateCategory updates a category.
+// [patch] /api/_/categories/:category_id
+func UpdateCategory(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	request, err := parseCategory(c)
+	if err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+	request.ID = c.Params("category_id")
+
+	if err := db.UpdateCategory(c.Context(), request); err != nil {
+		switch err {
+		case errors.ErrCategoryNotFound:
+			return webutil.StatusNotFound(c)
+		case errors.ErrCategorySlugExists, errors.ErrCategoryParent, errors.ErrCategoryCycle:
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	category, err := db.Category(c.Context(), request.ID)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Category updated", category)
+}
+
+// DeleteCategory deletes a category, its subcategories move up to its parent.
+// [delete] /api/_/categories/:category_id
+func DeleteCategory(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	if err := db.DeleteCategory(c.Context(), c.Params("category_id")); err != nil {
+		if err == errors.ErrCategoryNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Category deleted", nil)
+}
+
+// UpdateProductCategories files a product under the listed categories.
+// [patch] /api/_/products/:product_id/categories
+func UpdateProductCategories(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+	request := struct {
+		Categories []string `json:"categories"`
+	}{}
+
+	if err := c.BodyParser(&request); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	if err := db.SetProductCategories(c.Context(), c.Params("product_id"), request.Categories); err != nil {
+		switch err {
+		case errors.ErrProductNotFound:
+			return webutil.StatusNotFound(c)
+		case errors.ErrCategoryNotFound:
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Product categories updated", nil)
+}
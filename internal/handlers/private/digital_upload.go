@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/internal/queries"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/logging"
+	"github.com/shurco/litecart/pkg/webutil"
+)
+
+// AddProductDigitalUpload starts a resumable upload of a digital file. The
+// file is then sent in chunks of at most chunk_size bytes.
+// [post] /api/_/products/:product_id/digital/uploads
+func AddProductDigitalUpload(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+	request := &models.DigitalUpload{ProductID: c.Params("product_id")}
+
+	if err := c.BodyParser(request); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+	request.ProductID = c.Params("product_id")
+	request.SHA256 = strings.ToLower(request.SHA256)
+
+	if err := request.Validate(); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	upload, err := db.AddDigitalUpload(c.Context(), request)
+	if err != nil {
+		switch err {
+		case errors.ErrProductNotFound, errors.ErrVersionNotFound:
+			return webutil.StatusNotFound(c)
+		case errors.ErrProductNoFile:
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusCreated, "Upload started", upload)
+}
+
+// ProductDigitalUpload returns the progress of an upload, so that an
+// interrupted upload can go on from the received offset.
+// [get] /api/_/products/:product_id/digital/uploads/:upload_id
+func ProductDigitalUpload(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	upload, err := db.DigitalUpload(c.Context(), c.Params("product_id"), c.Params("upload_id"))
+	if err != nil {
+		if err == errors.ErrUploadNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Upload", upload)
+}
+
+// AddProductDigitalUploadPart receives the next chunk of an upload as the raw
+// request body. The Upload-Offset header must match the received offset, and
+// the optional Upload-Checksum header ("sha256 <base64 digest>") is checked
+// against the chunk. The digital file is added once the last chunk arrives.
+// [patch] /api/_/products/:product_id/digital/uploads/:upload_id
+func AddProductDigitalUploadPart(c *fiber.Ctx) error {
+	productID := c.Params("product_id")
+	uploadID := c.Params("upload_id")
+	db := queries.DB()
+	log := logging.New()
+
+	offset, err := strconv.ParseInt(c.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return webutil.StatusBadRequest(c, "Upload-Offset header is required")
+	}
+
+	chunk := c.Body()
+	if len(chunk) > queries.DigitalUploadChunkSize {
+		return webutil.Response(c, fiber.StatusRequestEntityTooLarge, "Chunk is too large", nil)
+	}
+
+	if checksum := c.Get("Upload-Checksum"); checksum != "" {
+		algorithm, digest, _ := strings.Cut(checksum, " ")
+		if !strings.EqualFold(algorithm, "sha256") {
+			return webutil.StatusBadRequest(c, "Upload-Checksum must use sha256")
+		}
+		want, err := base64.StdEncoding.DecodeString(digest)
+		if err != nil {
+			return webutil.StatusBadRequest(c, "Upload-Checksum digest must be base64")
+		}
+		if got := sha256.Sum256(chunk); !bytes.Equal(got[:], want) {
+			return webutil.Response(c, fiber.StatusUnprocessableEntity, errors.MsgUploadChecksum, nil)
+		}
+	}
+
+	upload, err := db.AddDigitalUploadPart(c.Context(), productID, uploadID, offset, chunk)
+	if err != nil {
+		switch err {
+		case errors.ErrUploadNotFound:
+			return webutil.StatusNotFound(c)
+		case errors.ErrUploadOffset:
+			return webutil.Response(c, fiber.StatusConflict, err.Error(), upload)
+		case errors.ErrUploadTooLarge:
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	if upload.Offset < upload.Size {
+		return webutil.Response(c, fiber.StatusOK, "Chunk received", upload)
+	}
+
+	fileUUID, fileExt, _ := generateFileName(upload.Name)
+	file, err := db.CompleteDigitalUpload(c.Context(), productID, uploadID, fileUUID, fileExt)
+	if err != nil {
+		switch err {
+		case errors.ErrUploadNotFound:
+			return webutil.StatusNotFound(c)
+		case errors.ErrUploadChecksum:
+			return webutil.Response(c, fiber.StatusUnprocessableEntity, err.Error(), nil)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	upload.File = file
+	return webutil.Response(c, fiber.StatusOK, "Digital added", upload)
+}
+
+// DeleteProductDigitalUpload aborts an upload and removes the received chunks.
+// [delete] /api/_/products/:product_id/digital/uploads/:upload_id
+func DeleteProductDigitalUpload(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	if err := db.DeleteDigitalUpload(c.Context(), c.Params("product_id"), c.Params("upload_id")); err != nil {
+		if err == errors.ErrUploadNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Upload deleted", nil)
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/shurco/litecart/internal/mailer"
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/internal/queries"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/logging"
+	"github.com/shurco/litecart/pkg/webutil"
+)
+
+// AddProductDigitalVersion adds a draft version to a product that sells
+// files. The first version of a product is current right away.
+// [post] /api/_/products/:product_id/digital/versions
+func AddProductDigitalVersion(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+	request := new(models.Version)
+
+	if err := c.BodyParser(request); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	if err := request.Validate(); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	version, err := db.AddDigitalVersion(c.Context(), c.Params("product_id"), request)
+	if err != nil {
+		switch err {
+		case errors.ErrProductNotFound:
+			return webutil.StatusNotFound(c)
+		case errors.ErrProductNoFile:
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Version added", version)
+}
+
+// UpdateProductDigitalVersion changes the name and the changelog of a version.
+// [patch] /api/_/products/:product_id/digital/versions/:version_id
+func UpdateProductDigitalVersion(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+	request := new(models.Version)
+
+	if err := c.BodyParser(request); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+	request.ID = c.Params("version_id")
+
+	if err := request.Validate(); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	if err := db.UpdateDigitalVersion(c.Context(), c.Params("product_id"), request); err != nil {
+		if err == errors.ErrVersionNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Version updated", nil)
+}
+
+// ReleaseProductDigitalVersion makes a version the current one, so buyers
+// get its files from now on.
+// [post] /api/_/products/:product_id/digital/versions/:version_id/release
+func ReleaseProductDigitalVersion(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	if err := db.ReleaseDigitalVersion(c.Context(), c.Params("product_id"), c.Params("version_id")); err != nil {
+		switch err {
+		case errors.ErrVersionNotFound:
+			return webutil.StatusNotFound(c)
+		case errors.ErrVersionNoFiles:
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Version released", nil)
+}
+
+// NotifyProductDigitalVersion mails every paid buyer of the product a link to
+// the files of the current version. It works only when buyers get free updates.
+// [post] /api/_/products/:product_id/digital/versions/:version_id/notify
+func NotifyProductDigitalVersion(c *fiber.Ctx) error {
+	productID := c.Params("product_id")
+	db := queries.DB()
+	log := logging.New()
+
+	carts, err := db.MarkDigitalVersionNotified(c.Context(), productID, c.Params("version_id"))
+	if err != nil {
+		switch err {
+		case errors.ErrVersionNotFound:
+			return webutil.StatusNotFound(c)
+		case errors.ErrVersionNotCurrent, errors.ErrFreeUpdatesOff:
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	for _, cartID := range carts {
+		if err := mailer.QueueUpdateLetter(cartID, productID); err != nil {
+			log.ErrorStack(err)
+			return webutil.StatusInternalServerError(c)
+		}
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Buyers notified", map[string]int{"notified": len(carts)})
+}
+
+// DeleteProductDigitalVersion removes a version that is not current with its files.
+// [delete] /api/_/products/:product_id/digital/versions/:version_id
+func DeleteProductDigitalVersion(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	if err := db.DeleteDigitalVersion(c.Context(), c.Params("product_id"), c.Params("version_id")); err != nil {
+		switch err {
+		case errors.ErrVersionNotFound:
+			return webutil.StatusNotFound(c)
+		case errors.ErrVersionCurrent:
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Version deleted", nil)
+}
@@ -1,56 +1,48 @@
 package handlers
 
 import (
+	"bufio"
+	"context"
+	"encoding/csv"
 	"fmt"
 	"io"
 	"mime/multipart"
-	"os"
-	"path/filepath"
+	"strings"
 
+	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/internal/storage"
+	"github.com/shurco/litecart/internal/webhook"
 	"github.com/shurco/litecart/pkg/fsutil"
-)
-
-const (
-	dirUploads  = "./lc_uploads"
-	dirDigitals = "./lc_digitals"
+	"github.com/shurco/litecart/pkg/logging"
 )
 
 var (
 	validImageMIMETypes = []string{"image/png", "image/jpeg"}
 )
 
-// saveFile atomically saves the uploaded file to a temporary file, then renames it.
-func saveFile(file *multipart.FileHeader, filePath string) error {
+// storeFile saves an uploaded file in the storage under the key.
+func storeFile(ctx context.Context, file *multipart.FileHeader, key string) error {
 	src, err := file.Open()
 	if err != nil {
 		return err
 	}
 	defer func() { _ = src.Close() }()
 
-	tmpPath := filePath + ".tmp"
-	if err := os.MkdirAll(filepath.Dir(filePath), 0o775); err != nil {
-		return err
-	}
+	return storage.Files().Put(ctx, key, src, file.Size, file.Header.Get("Content-Type"))
+}
 
-	dst, err := os.Create(tmpPath)
+// sendFile sends a file from the storage as an attachment with the given name.
+func sendFile(c *fiber.Ctx, key, name string) error {
+	object, err := storage.Files().Get(c.Context(), key)
 	if err != nil {
 		return err
 	}
 
-	if _, err := io.Copy(dst, src); err != nil {
-		_ = dst.Close()
-		_ = os.Remove(tmpPath)
-		return err
-	}
-
-	if err := dst.Close(); err != nil {
-		_ = os.Remove(tmpPath)
-		return err
-	}
-
-	return os.Rename(tmpPath, filePath)
+	c.Attachment(name)
+	return c.SendStream(object.Body, int(object.Size))
 }
 
 // validateImageMIME checks if the file MIME type is a valid image.
@@ -70,3 +62,68 @@ func generateFileName(originalName string) (fileUUID, fileExt, fileName string)
 	fileName = fmt.Sprintf("%s.%s", fileUUID, fileExt)
 	return fileUUID, fileExt, fileName
 }
+
+// queueWebhook schedules a webhook event. The change it reports is already
+// saved, so a failure is only logged.
+func queueWebhook(event webhook.Event, data any, log *logging.Log) {
+	if err := webhook.Queue(event, data); err != nil {
+		log.ErrorStack(err)
+	}
+}
+
+// readDataLines reads the keys of an import file. A text file holds one key
+// per line. A CSV file takes its keys from the "content" or "key" column when
+// the first row is a header, and from the first column otherwise. Blank keys
+// are left out.
+func readDataLines(r io.Reader, isCSV bool) ([]models.DataLine, error) {
+	lines := []models.DataLine{}
+
+	if !isCSV {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for number := 1; scanner.Scan(); number++ {
+			if content := strings.TrimSpace(scanner.Text()); content != "" {
+				lines = append(lines, models.DataLine{Line: number, Content: content})
+			}
+		}
+		return lines, scanner.Err()
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	column := 0
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if first {
+			header := false
+			for i, field := range record {
+				if name := strings.ToLower(strings.TrimSpace(field)); name == "content" || name == "key" {
+					column, header = i, true
+					break
+				}
+			}
+			if header {
+				continue
+			}
+		}
+
+		if column >= len(record) {
+			continue
+		}
+		if content := strings.TrimSpace(record[column]); content != "" {
+			number, _ := reader.FieldPos(column)
+			lines = append(lines, models.DataLine{Line: number, Content: content})
+		}
+	}
+
+	return lines, nil
+}
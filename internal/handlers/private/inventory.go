@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/internal/queries"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/logging"
+	"github.com/shurco/litecart/pkg/webutil"
+)
+
+// ProductInventory returns the stock of a product and its variants with the
+// latest stock movements.
+// [get] /api/_/products/:product_id/stock
+func ProductInventory(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	inventory, err := db.Inventory(c.Context(), c.Params("product_id"))
+	if err != nil {
+		if err == errors.ErrProductNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Product inventory", inventory)
+}
+
+// AdjustProductStock adds units to the stock of a product or of one of its
+// variants, or takes them out with a negative change.
+// [post] /api/_/products/:product_id/stock
+func AdjustProductStock(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+	request := new(models.StockAdjustment)
+
+	if err := c.BodyParser(request); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	if err := request.Validate(); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	movement, err := db.AdjustStock(c.Context(), c.Params("product_id"), request)
+	if err != nil {
+		switch err {
+		case errors.ErrProductNotFound, errors.ErrVariantNotFound:
+			return webutil.StatusNotFound(c)
+		case errors.ErrStockNegative:
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Stock adjusted", movement)
+}
+
+// UntrackProductStock stops tracking the stock of a product, or of the
+// variant named by the variant_id query parameter.
+// [delete] /api/_/products/:product_id/stock
+func UntrackProductStock(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	if err := db.UntrackStock(c.Context(), c.Params("product_id"), c.Query("variant_id")); err != nil {
+		switch err {
+		case errors.ErrProductNotFound, errors.ErrVariantNotFound:
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Stock is not tracked", nil)
+}
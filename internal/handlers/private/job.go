@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/internal/queries"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/logging"
+	"github.com/shurco/litecart/pkg/webutil"
+)
+
+// Jobs returns a list of background jobs, optionally filtered by status.
+// [get] /api/_/jobs
+func Jobs(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	status := models.JobStatus(c.Query("status"))
+	switch status {
+	case "", models.JobPending, models.JobRunning, models.JobDone, models.JobDead:
+	default:
+		return webutil.StatusBadRequest(c, "unknown job status")
+	}
+
+	page := c.QueryInt("page", 1)
+	limit := c.QueryInt("limit", 20)
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	offset := (page - 1) * limit
+
+	jobs, total, err := db.Jobs(c.Context(), status, limit, offset)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Jobs", map[string]any{
+		"jobs":  jobs,
+		"total": total,
+		"page":  page,
+		"limit": limit,
+	})
+}
+
+// Job returns a background job by job_id.
+// [get] /api/_/jobs/:job_id
+func Job(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	job, err := db.Job(c.Context(), c.Params("job_id"))
+	if err != nil {
+		if err == errors.ErrJobNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Job", job)
+}
+
+// RetryJob schedules a pending or dead job to run now with a fresh set of attempts.
+// [post] /api/_/jobs/:job_id/retry
+func RetryJob(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	job, err := db.RetryJob(c.Context(), c.Params("job_id"))
+	if err != nil {
+		switch err {
+		case errors.ErrJobNotFound:
+			return webutil.StatusNotFound(c)
+		case errors.ErrJobNotRetryable:
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Job retried", job)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/internal/queries"
+)
+
+func Test_jobs(t *testing.T) {
+	app, cleanup := setupCartApp(t)
+	defer cleanup()
+
+	db := queries.DB()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	job := &models.Job{Kind: "mail.cart", Payload: `{"cart_id":"cart00000000001"}`, MaxAttempts: 1}
+	if err := db.AddJob(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+
+	app.Get("/api/_/jobs", Jobs)
+	app.Get("/api/_/jobs/:job_id", Job)
+	app.Post("/api/_/jobs/:job_id/retry", RetryJob)
+
+	cases := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodGet, "/api/_/jobs", http.StatusOK},
+		{http.MethodGet, "/api/_/jobs?status=dead", http.StatusOK},
+		{http.MethodGet, "/api/_/jobs?status=lost", http.StatusBadRequest},
+		{http.MethodGet, "/api/_/jobs/" + job.ID, http.StatusOK},
+		{http.MethodGet, "/api/_/jobs/job000000000000", http.StatusNotFound},
+		{http.MethodPost, "/api/_/jobs/" + job.ID + "/retry", http.StatusOK},
+		{http.MethodPost, "/api/_/jobs/job000000000000/retry", http.StatusNotFound},
+	}
+
+	for _, tt := range cases {
+		resp, _ := app.Test(httptest.NewRequest(tt.method, tt.path, nil))
+		if resp.StatusCode != tt.status {
+			t.Fatalf("%s %s: status %d, want %d", tt.method, tt.path, resp.StatusCode, tt.status)
+		}
+	}
+
+	// a finished job is not run twice by accident
+	if _, err := db.ClaimJob(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CompleteJob(ctx, job.ID); err != nil {
+		t.Fatal(err)
+	}
+	resp, _ := app.Test(httptest.NewRequest(http.MethodPost, "/api/_/jobs/"+job.ID+"/retry", nil))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("retry done job: status %d", resp.StatusCode)
+	}
+}
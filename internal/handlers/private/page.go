@@ -5,6 +5,7 @@ import (
 
 	"github.com/shurco/litecart/internal/models"
 	"github.com/shurco/litecart/internal/queries"
+	"github.com/shurco/litecart/internal/webhook"
 	"github.com/shurco/litecart/pkg/errors"
 	"github.com/shurco/litecart/pkg/logging"
 	"github.com/shurco/litecart/pkg/webutil"
@@ -102,6 +103,10 @@ func UpdatePage(c *fiber.Ctx) error {
 		return webutil.StatusInternalServerError(c)
 	}
 
+	if page, err := db.PageByID(c.Context(), pageID); err == nil {
+		queueWebhook(webhook.PAGE_UPDATED, page, log)
+	}
+
 	return webutil.Response(c, fiber.StatusOK, "Page updated", nil)
 }
 
@@ -143,6 +148,10 @@ func UpdatePageContent(c *fiber.Ctx) error {
 		return webutil.StatusInternalServerError(c)
 	}
 
+	if page, err := db.PageByID(c.Context(), pageID); err == nil {
+		queueWebhook(webhook.PAGE_UPDATED, page, log)
+	}
+
 	return webutil.Response(c, fiber.StatusOK, "Page content updated", nil)
 }
 
@@ -164,6 +173,7 @@ func UpdatePageActive(c *fiber.Ctx) error {
 		log.ErrorStack(err)
 		return webutil.StatusInternalServerError(c)
 	}
+	queueWebhook(webhook.PAGE_UPDATED, page, log)
 
 	return webutil.Response(c, fiber.StatusOK, "Page active updated", page)
 }
@@ -1,19 +1,27 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/csv"
 	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/disintegration/imaging"
 	"github.com/gofiber/fiber/v2"
 
 	"github.com/shurco/litecart/internal/models"
 	"github.com/shurco/litecart/internal/queries"
+	"github.com/shurco/litecart/internal/storage"
+	"github.com/shurco/litecart/internal/webhook"
 	"github.com/shurco/litecart/pkg/errors"
 	"github.com/shurco/litecart/pkg/logging"
 	"github.com/shurco/litecart/pkg/webutil"
 )
 
-// Products returns a list of all products.
+// Products returns a list of all products, optionally narrowed to a
+// category, a tag or a price range.
 // [get] /api/_/products
 func Products(c *fiber.Ctx) error {
 	db := queries.DB()
@@ -32,8 +40,50 @@ func Products(c *fiber.Ctx) error {
 	}
 	offset := (page - 1) * limit
 
-	products, err := db.ListProducts(c.Context(), true, limit, offset, "")
+	filter := &models.ProductFilter{
+		Category:  c.Query("category"),
+		Tag:       c.Query("tag"),
+		MinAmount: c.QueryInt("min_amount"),
+		MaxAmount: c.QueryInt("max_amount"),
+	}
+	if err := filter.Validate(); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	products, err := db.ListProducts(c.Context(), true, filter, limit, offset, "")
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Products", products)
+}
+
+// SearchProducts returns the products, inactive ones included, matching the query, best match first,
+// each with a snippet of the matching text.
+// [get] /api/_/products/search
+func SearchProducts(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	page := c.QueryInt("page", 1)
+	limit := c.QueryInt("limit", 20)
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	offset := (page - 1) * limit
+
+	products, err := db.SearchProducts(c.Context(), true, c.Query("q"), limit, offset)
 	if err != nil {
+		if err == errors.ErrSearchQueryEmpty {
+			return webutil.StatusBadRequest(c, err.Error())
+		}
 		log.ErrorStack(err)
 		return webutil.StatusInternalServerError(c)
 	}
@@ -53,8 +103,9 @@ func AddProduct(c *fiber.Ctx) error {
 		return webutil.StatusBadRequest(c, err.Error())
 	}
 
-	// Validation: digital.type field is required when creating a product
-	if request.Digital.Type == "" {
+	// Validation: digital.type field is required when creating a product,
+	// physical products may come without digital content
+	if request.Digital.Type == "" && !request.Physical {
 		return webutil.StatusBadRequest(c, "digital type is required")
 	}
 
@@ -69,6 +120,7 @@ func AddProduct(c *fiber.Ctx) error {
 		log.ErrorStack(err)
 		return webutil.StatusBadRequest(c, err.Error())
 	}
+	queueWebhook(webhook.PRODUCT_CREATED, product, log)
 
 	return webutil.Response(c, fiber.StatusOK, "Product added", product)
 }
@@ -114,6 +166,7 @@ func UpdateProduct(c *fiber.Ctx) error {
 		log.ErrorStack(err)
 		return webutil.StatusInternalServerError(c)
 	}
+	queueWebhook(webhook.PRODUCT_UPDATED, product, log)
 
 	return webutil.Response(c, fiber.StatusOK, "Product updated", product)
 }
@@ -129,6 +182,7 @@ func DeleteProduct(c *fiber.Ctx) error {
 		log.ErrorStack(err)
 		return webutil.StatusInternalServerError(c)
 	}
+	queueWebhook(webhook.PRODUCT_DELETED, map[string]string{"id": productID}, log)
 
 	return webutil.Response(c, fiber.StatusOK, "Product deleted", nil)
 }
@@ -145,6 +199,10 @@ func UpdateProductActive(c *fiber.Ctx) error {
 		return webutil.StatusInternalServerError(c)
 	}
 
+	if product, err := db.Product(c.Context(), true, productID); err == nil {
+		queueWebhook(webhook.PRODUCT_UPDATED, product, log)
+	}
+
 	return webutil.Response(c, fiber.StatusOK, "Product active updated", nil)
 }
 
@@ -183,19 +241,31 @@ func AddProductImage(c *fiber.Ctx) error {
 	}
 
 	fileUUID, fileExt, fileName := generateFileName(file.Filename)
-	filePath := fmt.Sprintf("%s/%s", dirUploads, fileName)
 	fileOrigName := file.Filename
 
-	if err := saveFile(file, filePath); err != nil {
+	if err := storeFile(c.Context(), file, storage.UploadKey(fileName)); err != nil {
 		log.ErrorStack(err)
 		return webutil.StatusInternalServerError(c)
 	}
 
-	fileSource, err := imaging.Open(filePath)
+	src, err := file.Open()
 	if err != nil {
 		log.ErrorStack(err)
 		return webutil.StatusInternalServerError(c)
 	}
+	defer func() { _ = src.Close() }()
+
+	fileSource, err := imaging.Decode(src)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	format, err := imaging.FormatFromExtension(fileExt)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusBadRequest(c, "file format not supported")
+	}
 
 	sizes := []struct {
 		size string
@@ -207,8 +277,13 @@ func AddProductImage(c *fiber.Ctx) error {
 
 	for _, s := range sizes {
 		resizedImage := imaging.Fill(fileSource, s.dim, s.dim, imaging.Center, imaging.Lanczos)
-		resizedPath := fmt.Sprintf("%s/%s_%s.%s", dirUploads, fileUUID, s.size, fileExt)
-		if err := imaging.Save(resizedImage, resizedPath); err != nil {
+		var resized bytes.Buffer
+		if err := imaging.Encode(&resized, resizedImage, format); err != nil {
+			log.ErrorStack(err)
+			return webutil.StatusInternalServerError(c)
+		}
+		resizedKey := storage.UploadKey(fmt.Sprintf("%s_%s.%s", fileUUID, s.size, fileExt))
+		if err := storage.Files().Put(c.Context(), resizedKey, &resized, int64(resized.Len()), mimeType); err != nil {
 			log.ErrorStack(err)
 			return webutil.StatusInternalServerError(c)
 		}
@@ -258,6 +333,33 @@ func ProductDigital(c *fiber.Ctx) error {
 	return webutil.Response(c, fiber.StatusOK, "Product digital", digital)
 }
 
+// ProductDigitalFile sends a digital file of a product to the admin.
+// [get] /api/_/products/:product_id/digital/:digital_id
+func ProductDigitalFile(c *fiber.Ctx) error {
+	productID := c.Params("product_id")
+	digitalID := c.Params("digital_id")
+	db := queries.DB()
+	log := logging.New()
+
+	file, err := db.DigitalFile(c.Context(), productID, digitalID)
+	if err != nil {
+		if err == errors.ErrFileNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	if err := sendFile(c, storage.DigitalKey(file.Name+"."+file.Ext), file.OrigName); err != nil {
+		if err == storage.ErrNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+	return nil
+}
+
 // AddProductDigital adds digital content (file or data) to a product.
 // [post] /api/_/products/:product_id/digital
 func AddProductDigital(c *fiber.Ctx) error {
@@ -268,16 +370,19 @@ func AddProductDigital(c *fiber.Ctx) error {
 	fileTmp, _ := c.FormFile("document")
 	if fileTmp != nil {
 		fileUUID, fileExt, fileName := generateFileName(fileTmp.Filename)
-		filePath := fmt.Sprintf("%s/%s", dirDigitals, fileName)
 		fileOrigName := fileTmp.Filename
 
-		if err := saveFile(fileTmp, filePath); err != nil {
+		if err := storeFile(c.Context(), fileTmp, storage.DigitalKey(fileName)); err != nil {
 			log.ErrorStack(err)
 			return webutil.StatusInternalServerError(c)
 		}
 
-		file, err := db.AddDigitalFile(c.Context(), productID, fileUUID, fileExt, fileOrigName)
+		file, err := db.AddDigitalFile(c.Context(), productID, c.FormValue("version_id"), fileUUID, fileExt, fileOrigName)
 		if err != nil {
+			_ = storage.Files().Delete(c.Context(), storage.DigitalKey(fileName))
+			if err == errors.ErrVersionNotFound {
+				return webutil.StatusNotFound(c)
+			}
 			log.ErrorStack(err)
 			return webutil.StatusInternalServerError(c)
 		}
@@ -294,6 +399,129 @@ func AddProductDigital(c *fiber.Ctx) error {
 	return webutil.Response(c, fiber.StatusOK, "Digital added", data)
 }
 
+// ImportProductDigital adds keys to a "data" product from a CSV or
+// newline-delimited text file. A variant_id form field ties the keys to a
+// variant of the product. With dry_run=true nothing is stored and only the
+// report is returned.
+// [post] /api/_/products/:product_id/digital/import
+func ImportProductDigital(c *fiber.Ctx) error {
+	productID := c.Params("product_id")
+	db := queries.DB()
+	log := logging.New()
+
+	fileTmp, err := c.FormFile("document")
+	if err != nil {
+		return webutil.StatusBadRequest(c, "document is required")
+	}
+
+	file, err := fileTmp.Open()
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+	defer func() { _ = file.Close() }()
+
+	lines, err := readDataLines(file, strings.EqualFold(filepath.Ext(fileTmp.Filename), ".csv"))
+	if err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	dryRun := c.QueryBool("dry_run", c.FormValue("dry_run") == "true")
+	report, err := db.ImportDigitalData(c.Context(), productID, c.FormValue("variant_id"), lines, dryRun)
+	if err != nil {
+		switch err {
+		case errors.ErrProductNotFound, errors.ErrVariantNotFound:
+			return webutil.StatusNotFound(c)
+		case errors.ErrProductNoKey:
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Digital imported", report)
+}
+
+// ExportProductDigital sends the keys of a "data" product as a CSV file with
+// the cart each sold key went to. The status query keeps only the unused,
+// reserved or sold keys.
+// [get] /api/_/products/:product_id/digital/export
+func ExportProductDigital(c *fiber.Ctx) error {
+	productID := c.Params("product_id")
+	status := c.Query("status")
+	db := queries.DB()
+	log := logging.New()
+
+	if status != "" && !slices.Contains([]string{"unused", "reserved", "sold"}, status) {
+		return webutil.StatusBadRequest(c, "status must be unused, reserved or sold")
+	}
+
+	keys, err := db.ExportDigitalData(c.Context(), productID, status)
+	if err != nil {
+		switch err {
+		case errors.ErrProductNotFound:
+			return webutil.StatusNotFound(c)
+		case errors.ErrProductNoKey:
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	_ = writer.Write([]string{"content", "status", "cart_id", "email"})
+	for _, key := range keys {
+		_ = writer.Write([]string{key.Content, key.Status, key.CartID, key.Email})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	c.Attachment(fmt.Sprintf("keys-%s.csv", productID))
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	return c.Send(buf.Bytes())
+}
+
+// ProductDigitalActivations returns the machines a key of a product is activated on.
+// [get] /api/_/products/:product_id/digital/:digital_id/activations
+func ProductDigitalActivations(c *fiber.Ctx) error {
+	productID := c.Params("product_id")
+	digitalID := c.Params("digital_id")
+	db := queries.DB()
+	log := logging.New()
+
+	activations, err := db.LicenseActivations(c.Context(), productID, digitalID)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "License activations", activations)
+}
+
+// RevokeProductDigitalActivation removes an activation of a key of a product.
+// [delete] /api/_/products/:product_id/digital/:digital_id/activations/:activation_id
+func RevokeProductDigitalActivation(c *fiber.Ctx) error {
+	productID := c.Params("product_id")
+	digitalID := c.Params("digital_id")
+	activationID := c.Params("activation_id")
+	db := queries.DB()
+	log := logging.New()
+
+	if err := db.RevokeActivation(c.Context(), productID, digitalID, activationID); err != nil {
+		if err == errors.ErrActivationNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "License activation revoked", nil)
+}
+
 // UpdateProductDigital updates digital content for a product.
 // [patch] /api/_/products/:product_id/digital/:digital_id
 func UpdateProductDigital(c *fiber.Ctx) error {
@@ -3,15 +3,22 @@ package handlers
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"image"
 	"image/color"
 	"image/png"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/textproto"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -21,6 +28,7 @@ import (
 	"github.com/shurco/litecart/internal/queries"
 	"github.com/shurco/litecart/internal/testutil"
 	"github.com/shurco/litecart/migrations"
+	"github.com/shurco/litecart/pkg/litepay"
 )
 
 func setupProductEnv(t *testing.T) (*fiber.App, func()) {
@@ -111,3 +119,212 @@ func Test_add_product_image_upload_and_resize(t *testing.T) {
 		t.Fatalf("expected original+sm+md images")
 	}
 }
+
+func Test_product_digital_import_export(t *testing.T) {
+	app, cleanup := setupProductEnv(t)
+	defer cleanup()
+
+	db := queries.DB()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p, err := db.AddProduct(ctx, &models.Product{Name: "keys", Amount: 100, Slug: "keys", Digital: models.Digital{Type: "data"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.AddDigitalData(ctx, p.ID, "AAA"); err != nil {
+		t.Fatal(err)
+	}
+
+	app.Post("/api/_/products/:product_id/digital/import", ImportProductDigital)
+	app.Get("/api/_/products/:product_id/digital/export", ExportProductDigital)
+
+	upload := func(query string) *models.DataImport {
+		t.Helper()
+		var body bytes.Buffer
+		w := multipart.NewWriter(&body)
+		fw, err := w.CreateFormFile("document", "keys.csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = fw.Write([]byte("id,key\n1,AAA\n2,BBB\n3,BBB\n4,\n5,CCC\n"))
+		_ = w.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/_/products/"+p.ID+"/digital/import"+query, &body)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("import status %d", resp.StatusCode)
+		}
+		var out struct {
+			Result models.DataImport `json:"result"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			t.Fatal(err)
+		}
+		return &out.Result
+	}
+
+	report := upload("?dry_run=true")
+	if !report.DryRun || report.Total != 4 || report.Added != 2 || report.Duplicates != 2 || len(report.Skipped) != 2 {
+		t.Fatalf("unexpected dry run report %+v", report)
+	}
+	if report.Skipped[0].Line != 2 || report.Skipped[0].Reason != "already exists" || report.Skipped[1].Line != 4 {
+		t.Fatalf("unexpected skipped lines %+v", report.Skipped)
+	}
+	if stock, _ := db.DigitalDataStock(ctx, p.ID); stock[p.ID] != 1 {
+		t.Fatalf("dry run stored keys, stock %d", stock[p.ID])
+	}
+
+	if report := upload(""); report.DryRun || report.Added != 2 {
+		t.Fatalf("unexpected import report %+v", report)
+	}
+
+	cartID := "cartkeys0000001"
+	products := []models.CartProduct{{ProductID: p.ID, Quantity: 1}}
+	if err := db.AddCart(ctx, &models.Cart{Core: models.Core{ID: cartID}, Email: "buyer@mail.com", Cart: products, AmountTotal: 100, Currency: "USD", PaymentStatus: litepay.NEW}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ReserveDigitalData(ctx, cartID, products...); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.UpdateCart(ctx, &models.Cart{Core: models.Core{ID: cartID}, PaymentStatus: litepay.PAID}, models.CartSourceCallback); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/_/products/"+p.ID+"/digital/export", nil)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("export status %d", resp.StatusCode)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	want := "content,status,cart_id,email\nAAA,sold," + cartID + ",buyer@mail.com\nBBB,unused,,\nCCC,unused,,\n"
+	if string(data) != want {
+		t.Fatalf("unexpected export:\n%s", data)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/_/products/"+p.ID+"/digital/export?status=unused", nil)
+	resp, _ = app.Test(req)
+	data, _ = io.ReadAll(resp.Body)
+	if strings.Count(string(data), "\n") != 3 {
+		t.Fatalf("unexpected unused export:\n%s", data)
+	}
+}
+
+func Test_product_digital_chunked_upload(t *testing.T) {
+	app, cleanup := setupProductEnv(t)
+	defer cleanup()
+
+	db := queries.DB()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p, err := db.AddProduct(ctx, &models.Product{Name: "book", Amount: 100, Slug: "book", Digital: models.Digital{Type: "file"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.Post("/api/_/products/:product_id/digital/uploads", AddProductDigitalUpload)
+	app.Get("/api/_/products/:product_id/digital/uploads/:upload_id", ProductDigitalUpload)
+	app.Patch("/api/_/products/:product_id/digital/uploads/:upload_id", AddProductDigitalUploadPart)
+
+	content := []byte(strings.Repeat("0123456789", 10))
+	sum := sha256.Sum256(content)
+
+	send := func(method, path string, body []byte, headers map[string]string) (int, models.DigitalUpload) {
+		t.Helper()
+		req := httptest.NewRequest(method, "/api/_/products/"+p.ID+"/digital/uploads"+path, bytes.NewReader(body))
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out struct {
+			Result models.DigitalUpload `json:"result"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out.Result
+	}
+	chunk := func(uploadID string, offset int, data []byte) (int, models.DigitalUpload) {
+		digest := sha256.Sum256(data)
+		return send(http.MethodPatch, "/"+uploadID, data, map[string]string{
+			"Upload-Offset":   strconv.Itoa(offset),
+			"Upload-Checksum": "sha256 " + base64.StdEncoding.EncodeToString(digest[:]),
+		})
+	}
+	start := func(checksum string) models.DigitalUpload {
+		t.Helper()
+		body, _ := json.Marshal(map[string]any{"name": "book.pdf", "size": len(content), "sha256": checksum})
+		status, upload := send(http.MethodPost, "", body, map[string]string{"Content-Type": "application/json"})
+		if status != http.StatusCreated || upload.ID == "" || upload.ChunkSize != queries.DigitalUploadChunkSize {
+			t.Fatalf("start status %d, upload %+v", status, upload)
+		}
+		return upload
+	}
+
+	upload := start(hex.EncodeToString(sum[:]))
+	if status, got := chunk(upload.ID, 0, content[:40]); status != http.StatusOK || got.Offset != 40 {
+		t.Fatalf("first chunk status %d, offset %d", status, got.Offset)
+	}
+
+	// a repeated chunk is refused with the offset to go on from
+	if status, got := chunk(upload.ID, 0, content[:40]); status != http.StatusConflict || got.Offset != 40 {
+		t.Fatalf("repeated chunk status %d, offset %d", status, got.Offset)
+	}
+
+	// a chunk damaged on the way is refused
+	status, _ := send(http.MethodPatch, "/"+upload.ID, content[40:80], map[string]string{
+		"Upload-Offset":   "40",
+		"Upload-Checksum": "sha256 " + base64.StdEncoding.EncodeToString(sum[:]),
+	})
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("damaged chunk status %d", status)
+	}
+
+	if status, got := send(http.MethodGet, "/"+upload.ID, nil, nil); status != http.StatusOK || got.Offset != 40 {
+		t.Fatalf("progress status %d, offset %d", status, got.Offset)
+	}
+
+	status, got := chunk(upload.ID, 40, content[40:])
+	if status != http.StatusOK || got.File == nil {
+		t.Fatalf("last chunk status %d, upload %+v", status, got)
+	}
+	stored, err := os.ReadFile(filepath.Join("lc_digitals", got.File.Name+"."+got.File.Ext))
+	if err != nil || !bytes.Equal(stored, content) {
+		t.Fatalf("stored file %q, err %v", stored, err)
+	}
+	if status, _ := send(http.MethodGet, "/"+upload.ID, nil, nil); status != http.StatusNotFound {
+		t.Fatalf("finished upload status %d", status)
+	}
+	if parts, _ := os.ReadDir(filepath.Join("lc_parts", upload.ID)); len(parts) != 0 {
+		t.Fatalf("parts left behind: %d", len(parts))
+	}
+
+	// a file that does not match the declared checksum is not added
+	upload = start(strings.Repeat("0", 64))
+	if status, _ := chunk(upload.ID, 0, content); status != http.StatusUnprocessableEntity {
+		t.Fatalf("wrong file checksum status %d", status)
+	}
+	digital, err := db.ProductDigital(ctx, p.ID)
+	if err != nil || len(digital.Files) != 1 {
+		t.Fatalf("digital files %+v, err %v", digital, err)
+	}
+
+	// abandoned uploads are removed with their parts
+	upload = start("")
+	chunk(upload.ID, 0, content[:10])
+	if removed, err := db.CleanupDigitalUploads(ctx, time.Now().Add(time.Minute)); err != nil || removed != 1 {
+		t.Fatalf("cleanup removed %d, err %v", removed, err)
+	}
+	if parts, _ := os.ReadDir(filepath.Join("lc_parts", upload.ID)); len(parts) != 0 {
+		t.Fatalf("abandoned parts left behind: %d", len(parts))
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/internal/queries"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/logging"
+	"github.com/shurco/litecart/pkg/webutil"
+)
+
+// ProductVariants returns the variants of a product.
+// [get] /api/_/products/:product_id/variants
+func ProductVariants(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	variants, err := db.ProductVariants(c.Context(), c.Params("product_id"))
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Product variants", variants)
+}
+
+// AddProductVariant adds a variant with its own price to a product.
+// [post] /api/_/products/:product_id/variants
+func AddProductVariant(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+	request := new(models.Variant)
+
+	if err := c.BodyParser(request); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	if err := request.Validate(); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	variant, err := db.AddProductVariant(c.Context(), c.Params("product_id"), request)
+	if err != nil {
+		switch err {
+		case errors.ErrProductNotFound:
+			return webutil.StatusNotFound(c)
+		case errors.ErrVariantSKUExists:
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Variant added", variant)
+}
+
+// UpdateProductVariant changes the name, price, SKU and position of a variant.
+// [patch] /api/_/products/:product_id/variants/:variant_id
+func UpdateProductVariant(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+	request := new(models.Variant)
+
+	if err := c.BodyParser(request); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+	request.ID = c.Params("variant_id")
+
+	if err := request.Validate(); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	if err := db.UpdateProductVariant(c.Context(), c.Params("product_id"), request); err != nil {
+		switch err {
+		case errors.ErrVariantNotFound:
+			return webutil.StatusNotFound(c)
+		case errors.ErrVariantSKUExists:
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Variant updated", nil)
+}
+
+// DeleteProductVariant deletes a variant with no digital content tied to it.
+// [delete] /api/_/products/:product_id/variants/:variant_id
+func DeleteProductVariant(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	if err := db.DeleteProductVariant(c.Context(), c.Params("product_id"), c.Params("variant_id")); err != nil {
+		switch err {
+		case errors.ErrVariantNotFound:
+			return webutil.StatusNotFound(c)
+		case errors.ErrVariantInUse:
+			return webutil.Response(c, fiber.StatusConflict, err.Error(), nil)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Variant deleted", nil)
+}
+
+// UpdateProductDigitalVariant ties a file or a key of a product to one of its
+// variants. An empty variant_id shares it with every variant.
+// [patch] /api/_/products/:product_id/digital/:digital_id/variant
+func UpdateProductDigitalVariant(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+	request := struct {
+		VariantID string `json:"variant_id"`
+	}{}
+
+	if err := c.BodyParser(&request); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	if err := db.SetDigitalVariant(c.Context(), c.Params("product_id"), c.Params("digital_id"), request.VariantID); err != nil {
+		switch err {
+		case errors.ErrNotFound, errors.ErrVariantNotFound:
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Digital updated", nil)
+}
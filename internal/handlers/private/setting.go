@@ -12,6 +12,7 @@ import (
 	"github.com/shurco/litecart/internal/models"
 	"github.com/shurco/litecart/internal/queries"
 	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/litepay"
 	"github.com/shurco/litecart/pkg/logging"
 	"github.com/shurco/litecart/pkg/update"
 	"github.com/shurco/litecart/pkg/webutil"
@@ -93,21 +94,16 @@ func GetSetting(c *fiber.Ctx) error {
 		section, err = db.GetSettingByGroup(c.Context(), &models.Auth{})
 	case "jwt":
 		section, err = db.GetSettingByGroup(c.Context(), &models.JWT{})
-	case "webhook":
-		section, err = db.GetSettingByGroup(c.Context(), &models.Webhook{})
 	case "payment":
 		section, err = db.GetSettingByGroup(c.Context(), &models.Payment{})
-	case "stripe":
-		section, err = db.GetSettingByGroup(c.Context(), &models.Stripe{})
-	case "paypal":
-		section, err = db.GetSettingByGroup(c.Context(), &models.Paypal{})
-	case "spectrocoin":
-		section, err = db.GetSettingByGroup(c.Context(), &models.Spectrocoin{})
-	case "dummy":
-		section, err = db.GetSettingByGroup(c.Context(), &models.Dummy{})
 	case "mail":
 		section, err = db.GetSettingByGroup(c.Context(), &models.Mail{})
 	default:
+		// payment providers keep their settings models in the litepay registry
+		if provider, ok := litepay.Lookup(litepay.PaymentSystem(settingKey)); ok {
+			section, err = db.GetSettingByGroup(c.Context(), provider.Settings())
+			break
+		}
 		section, err = db.GetSettingByKey(c.Context(), settingKey)
 	}
 
@@ -142,19 +138,14 @@ func UpdateSetting(c *fiber.Ctx) error {
 		request = &models.Social{}
 	case "payment":
 		request = &models.Payment{}
-	case "stripe":
-		request = &models.Stripe{}
-	case "paypal":
-		request = &models.Paypal{}
-	case "spectrocoin":
-		request = &models.Spectrocoin{}
-	case "dummy":
-		request = &models.Dummy{}
-	case "webhook":
-		request = &models.Webhook{}
 	case "mail":
 		request = &models.Mail{}
 	default:
+		// payment providers keep their settings models in the litepay registry
+		if provider, ok := litepay.Lookup(litepay.PaymentSystem(settingKey)); ok {
+			request = provider.Settings()
+			break
+		}
 		request = &models.SettingName{}
 	}
 
@@ -200,7 +191,7 @@ func TestLetter(c *fiber.Ctx) error {
 	letter := c.Params("letter_name")
 	log := logging.New()
 
-	if err := mailer.SendTestLetter(letter); err != nil {
+	if err := mailer.SendTestLetter(c.Context(), letter); err != nil {
 		log.ErrorStack(err)
 		return webutil.StatusBadRequest(c, err.Error())
 	}
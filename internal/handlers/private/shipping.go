@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/shurco/litecart/internal/mailer"
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/internal/queries"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/logging"
+	"github.com/shurco/litecart/pkg/webutil"
+)
+
+// ShippingRates returns all shipping rates.
+// [get] /api/_/shipping
+func ShippingRates(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	rates, err := db.ShippingRates(c.Context())
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Shipping rates", rates)
+}
+
+// parseShippingRate reads and validates a shipping rate from the request body.
+func parseShippingRate(c *fiber.Ctx) (*models.ShippingRate, error) {
+	request := &models.ShippingRate{}
+	if err := c.BodyParser(request); err != nil {
+		return nil, err
+	}
+
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+
+	return request, nil
+}
+
+// AddShippingRate creates a shipping rate.
+// [post] /api/_/shipping
+func AddShippingRate(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	request, err := parseShippingRate(c)
+	if err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	rate, err := db.AddShippingRate(c.Context(), request)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Shipping rate added", rate)
+}
+
+// UpdateShippingRate updates a shipping rate.
+// [patch] /api/_/shipping/:rate_id
+func UpdateShippingRate(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	request, err := parseShippingRate(c)
+	if err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+	request.ID = c.Params("rate_id")
+
+	if err := db.UpdateShippingRate(c.Context(), request); err != nil {
+		if err == errors.ErrShippingRateNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	rate, err := db.ShippingRate(c.Context(), request.ID)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Shipping rate updated", rate)
+}
+
+// DeleteShippingRate deletes a shipping rate.
+// [delete] /api/_/shipping/:rate_id
+func DeleteShippingRate(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	if err := db.DeleteShippingRate(c.Context(), c.Params("rate_id")); err != nil {
+		if err == errors.ErrShippingRateNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Shipping rate deleted", nil)
+}
+
+// UpdateCartShipment sets the shipment status and tracking of a paid cart.
+// The buyer gets the shipped letter when the cart is first marked as shipped.
+// [patch] /api/_/carts/:cart_id/shipment
+func UpdateCartShipment(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+	cartID := c.Params("cart_id")
+
+	request := &models.CartShipment{}
+	if err := c.BodyParser(request); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+	if err := request.Validate(); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	shipped, err := db.UpdateCartShipment(c.Context(), cartID, request)
+	if err != nil {
+		switch err {
+		case errors.ErrProductNotFound:
+			return webutil.StatusNotFound(c)
+		case errors.ErrCartNotShippable, errors.ErrCartNotPaid:
+			return webutil.Response(c, fiber.StatusConflict, err.Error(), nil)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	if shipped {
+		if err := mailer.QueueShippedLetter(cartID); err != nil {
+			log.ErrorStack(err)
+		}
+	}
+
+	cart, err := db.Cart(c.Context(), cartID)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Cart shipment updated", cart.Shipping)
+}
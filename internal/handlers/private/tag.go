@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/internal/queries"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/logging"
+	"github.com/shurco/litecart/pkg/webutil"
+)
+
+// Tags returns all tags with the number of products they label.
+// [get] /api/_/tags
+func Tags(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	tags, err := db.Tags(c.Context())
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Tags", tags)
+}
+
+// AddTag creates a tag.
+// [post] /api/_/tags
+func AddTag(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+	request := &models.Tag{}
+
+	if err := c.BodyParser(request); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+	if err := request.Validate(); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	tag, err := db.AddTag(c.Context(), request)
+	if err != nil {
+		if err == errors.ErrTagExists {
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Tag added", tag)
+}
+
+// UpdateTag renames a tag.
+// [patch] /api/_/tags/:tag_id
+func UpdateTag(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+	request := &models.Tag{}
+
+	if err := c.BodyParser(request); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+	request.ID = c.Params("tag_id")
+	if err := request.Validate(); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	if err := db.UpdateTag(c.Context(), request); err != nil {
+		switch err {
+		case errors.ErrTagNotFound:
+			return webutil.StatusNotFound(c)
+		case errors.ErrTagExists:
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Tag updated", request)
+}
+
+// DeleteTag deletes a tag and takes it off every product.
+// [delete] /api/_/tags/:tag_id
+func DeleteTag(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	if err := db.DeleteTag(c.Context(), c.Params("tag_id")); err != nil {
+		if err == errors.ErrTagNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Tag deleted", nil)
+}
+
+// UpdateProductTags labels a product with the listed tags, creating the ones
+// that do not exist yet.
+// [patch] /api/_/products/:product_id/tags
+func UpdateProductTags(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+	request := struct {
+		Tags []string `json:"tags"`
+	}{}
+
+	if err := c.BodyParser(&request); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+	for _, name := range request.Tags {
+		if err := (models.Tag{Name: name}).Validate(); err != nil {
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+	}
+
+	if err := db.SetProductTags(c.Context(), c.Params("product_id"), request.Tags); err != nil {
+		if err == errors.ErrProductNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Product tags updated", nil)
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/internal/queries"
+	"github.com/shurco/litecart/internal/webhook"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/logging"
+	"github.com/shurco/litecart/pkg/webutil"
+)
+
+// WebhookEndpoints returns all webhook endpoints.
+// [get] /api/_/webhooks
+func WebhookEndpoints(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	endpoints, err := db.WebhookEndpoints(c.Context())
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Webhook endpoints", map[string]any{
+		"endpoints": endpoints,
+		"events":    webhook.Events,
+	})
+}
+
+// WebhookEndpoint returns a webhook endpoint by webhook_id.
+// [get] /api/_/webhooks/:webhook_id
+func WebhookEndpoint(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	endpoint, err := db.WebhookEndpoint(c.Context(), c.Params("webhook_id"))
+	if err != nil {
+		if err == errors.ErrWebhookEndpointNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Webhook endpoint", endpoint)
+}
+
+// parseWebhookEndpoint reads and validates an endpoint from the request body.
+func parseWebhookEndpoint(c *fiber.Ctx) (*models.WebhookEndpoint, error) {
+	request := &models.WebhookEndpoint{}
+	if err := c.BodyParser(request); err != nil {
+		return nil, err
+	}
+
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+	for _, event := range request.Events {
+		if !webhook.KnownEvent(event) {
+			return nil, fmt.Errorf("unknown event %q", event)
+		}
+	}
+
+	return request, nil
+}
+
+// AddWebhookEndpoint creates a webhook endpoint. A signing secret is
+// generated unless one is given.
+// [post] /api/_/webhooks
+func AddWebhookEndpoint(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	request, err := parseWebhookEndpoint(c)
+	if err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+	if request.Secret == "" {
+		request.Secret = webhook.NewSecret()
+	}
+
+	endpoint, err := db.AddWebhookEndpoint(c.Context(), request)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Webhook endpoint added", endpoint)
+}
+
+// UpdateWebhookEndpoint updates a webhook endpoint. An empty secret keeps the current one.
+// [patch] /api/_/webhooks/:webhook_id
+func UpdateWebhookEndpoint(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	request, err := parseWebhookEndpoint(c)
+	if err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+	request.ID = c.Params("webhook_id")
+
+	if err := db.UpdateWebhookEndpoint(c.Context(), request); err != nil {
+		if err == errors.ErrWebhookEndpointNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	endpoint, err := db.WebhookEndpoint(c.Context(), request.ID)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Webhook endpoint updated", endpoint)
+}
+
+// DeleteWebhookEndpoint deletes a webhook endpoint. Queued deliveries to it are dropped.
+// [delete] /api/_/webhooks/:webhook_id
+func DeleteWebhookEndpoint(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	if err := db.DeleteWebhookEndpoint(c.Context(), c.Params("webhook_id")); err != nil {
+		if err == errors.ErrWebhookEndpointNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Webhook endpoint deleted", nil)
+}
+
+// WebhookDeliveries returns the log of webhook delivery attempts,
+// optionally limited to one event or endpoint.
+// [get] /api/_/webhooks/deliveries
+func WebhookDeliveries(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	page := c.QueryInt("page", 1)
+	limit := c.QueryInt("limit", 20)
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	offset := (page - 1) * limit
+
+	deliveries, total, err := db.WebhookDeliveries(c.Context(), c.Query("event_id"), c.Query("webhook_id"), limit, offset)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Webhook deliveries", map[string]any{
+		"deliveries": deliveries,
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+	})
+}
+
+// WebhookDelivery returns a webhook delivery attempt by delivery_id.
+// [get] /api/_/webhooks/deliveries/:delivery_id
+func WebhookDelivery(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	delivery, err := db.WebhookDelivery(c.Context(), c.Params("delivery_id"))
+	if err != nil {
+		if err == errors.ErrWebhookDeliveryNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Webhook delivery", delivery)
+}
+
+// RedeliverWebhook sends the event of a delivery attempt again.
+// [post] /api/_/webhooks/deliveries/:delivery_id/redeliver
+func RedeliverWebhook(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	delivery, err := db.WebhookDelivery(c.Context(), c.Params("delivery_id"))
+	if err != nil {
+		if err == errors.ErrWebhookDeliveryNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	if err := webhook.Redeliver(delivery); err != nil {
+		if err == errors.ErrWebhookEndpointNotFound {
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Webhook redelivery queued", nil)
+}
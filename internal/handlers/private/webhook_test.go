@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shurco/litecart/internal/models"
+)
+
+func Test_webhook_endpoints(t *testing.T) {
+	app, cleanup := setupCartApp(t)
+	defer cleanup()
+
+	app.Get("/api/_/webhooks", WebhookEndpoints)
+	app.Post("/api/_/webhooks", AddWebhookEndpoint)
+	app.Get("/api/_/webhooks/:webhook_id", WebhookEndpoint)
+	app.Patch("/api/_/webhooks/:webhook_id", UpdateWebhookEndpoint)
+	app.Delete("/api/_/webhooks/:webhook_id", DeleteWebhookEndpoint)
+
+	request := func(method, path, body string) (int, *models.WebhookEndpoint) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, _ := app.Test(req)
+		data, _ := io.ReadAll(resp.Body)
+		var res struct {
+			Result *models.WebhookEndpoint `json:"result"`
+		}
+		_ = json.Unmarshal(data, &res)
+		return resp.StatusCode, res.Result
+	}
+
+	cases := []struct {
+		body   string
+		status int
+	}{
+		{`{"url":"https://example.com/hook","active":true,"events":["product.created"]}`, http.StatusOK},
+		{`{"url":"https://example.com/hook","active":true,"events":["product.exploded"]}`, http.StatusBadRequest},
+		{`{"url":"https://example.com/hook","active":true,"events":[]}`, http.StatusBadRequest},
+		{`{"url":"not a url","active":true,"events":["*"]}`, http.StatusBadRequest},
+		{`{"url":"https://example.com/hook","secret":"short","events":["*"]}`, http.StatusBadRequest},
+	}
+	for _, tt := range cases {
+		if status, _ := request(http.MethodPost, "/api/_/webhooks", tt.body); status != tt.status {
+			t.Fatalf("add %s: status %d, want %d", tt.body, status, tt.status)
+		}
+	}
+
+	_, endpoint := request(http.MethodPost, "/api/_/webhooks", `{"url":"https://example.com/all","active":true,"events":["*"]}`)
+	if endpoint == nil || len(endpoint.Secret) != 64 {
+		t.Fatalf("endpoint without a generated secret: %+v", endpoint)
+	}
+
+	// an empty secret keeps the current one
+	status, updated := request(http.MethodPatch, "/api/_/webhooks/"+endpoint.ID, `{"url":"https://example.com/pages","active":false,"events":["page.updated"]}`)
+	if status != http.StatusOK || updated.Secret != endpoint.Secret || updated.Active || updated.Events[0] != "page.updated" {
+		t.Fatalf("update: %d, %+v", status, updated)
+	}
+
+	if status, _ := request(http.MethodPatch, "/api/_/webhooks/webhook00000000", `{"url":"https://example.com","events":["*"]}`); status != http.StatusNotFound {
+		t.Fatalf("update unknown endpoint: status %d", status)
+	}
+	if status, _ := request(http.MethodDelete, "/api/_/webhooks/"+endpoint.ID, ""); status != http.StatusOK {
+		t.Fatalf("delete: status %d", status)
+	}
+	if status, _ := request(http.MethodGet, "/api/_/webhooks/"+endpoint.ID, ""); status != http.StatusNotFound {
+		t.Fatalf("get deleted endpoint: status %d", status)
+	}
+}
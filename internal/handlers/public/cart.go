@@ -1,11 +1,19 @@
 package handlers
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 
+	"github.com/shurco/litecart/internal/fulfillment"
 	"github.com/shurco/litecart/internal/mailer"
 	"github.com/shurco/litecart/internal/models"
 	"github.com/shurco/litecart/internal/queries"
@@ -17,10 +25,26 @@ import (
 	"github.com/shurco/litecart/pkg/webutil"
 )
 
-// sendPaymentWebhook sends a payment webhook notification.
-// If blockOnError is true, returns error on webhook failure (for API endpoints).
-// If blockOnError is false, logs error but doesn't block (for user-facing pages).
-func sendPaymentWebhook(event webhook.Event, paymentSystem litepay.PaymentSystem, paymentStatus litepay.Status, cartID string, log *logging.Log, blockOnError bool) error {
+// queuePaidCart schedules the purchase letter of a paid cart and the
+// fulfillment of its "api" products, which run apart so a slow fulfillment
+// URL does not hold the rest of the cart back, and checks the keys it sold
+// against the low stock threshold. Errors are logged only.
+func queuePaidCart(ctx context.Context, cartID string, log *logging.Log) {
+	if err := mailer.QueueCartLetter(cartID); err != nil {
+		log.ErrorStack(err)
+	}
+	if err := fulfillment.Queue(cartID); err != nil {
+		log.ErrorStack(err)
+	}
+	if err := mailer.QueueStockLow(ctx, cartID); err != nil {
+		log.ErrorStack(err)
+	}
+}
+
+// queuePaymentWebhook schedules a payment webhook notification.
+// Errors are logged only: by now the cart is already updated, so failing
+// the request would not bring the notification back.
+func queuePaymentWebhook(event webhook.Event, paymentSystem litepay.PaymentSystem, paymentStatus litepay.Status, cartID string, log *logging.Log) {
 	hook := &webhook.Payment{
 		Event:     event,
 		TimeStamp: time.Now().Unix(),
@@ -31,13 +55,97 @@ func sendPaymentWebhook(event webhook.Event, paymentSystem litepay.PaymentSystem
 		},
 	}
 
-	if err := webhook.SendPaymentHook(hook); err != nil {
+	if err := webhook.QueuePaymentHook(hook); err != nil {
+		log.ErrorStack(err)
+	}
+}
+
+// notification converts the request into a provider notification.
+func notification(c *fiber.Ctx) *litepay.Notification {
+	header := http.Header{}
+	for key, values := range c.GetReqHeaders() {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+
+	return &litepay.Notification{
+		Query:  queryValues(c),
+		Header: header,
+		Body:   c.Body(),
+	}
+}
+
+// queryValues returns the request query parameters.
+func queryValues(c *fiber.Ctx) url.Values {
+	query := url.Values{}
+	for key, value := range c.Queries() {
+		query.Set(key, value)
+	}
+	return query
+}
+
+// physicalItems returns the weight in grams of the physical products of the
+// cart lines and whether there are any.
+func physicalItems(lines []models.CartProduct, products map[string]models.Product) (int, bool) {
+	weight := 0
+	physical := false
+	for _, line := range lines {
+		product, ok := products[line.ProductID]
+		if !ok || !product.Physical {
+			continue
+		}
+		weight += product.Weight * line.Quantity
+		physical = true
+	}
+	return weight, physical
+}
+
+// ShippingRates returns the shipping rates the buyer can pick for the
+// physical products of a cart sent to a country.
+// [post] /api/cart/shipping
+func ShippingRates(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+	request := &models.CartShippingQuote{}
+
+	if err := c.BodyParser(request); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+	if err := request.Validate(); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	products, err := db.ListProducts(c.Context(), false, nil, 0, 0, "", request.Products...)
+	if err != nil {
 		log.ErrorStack(err)
-		if blockOnError {
-			return err
+		return webutil.StatusInternalServerError(c)
+	}
+	productMap := make(map[string]models.Product, len(products.Products))
+	for _, product := range products.Products {
+		productMap[product.ID] = product
+	}
+
+	weight, physical := physicalItems(request.Products, productMap)
+	rates := []*models.ShippingRate{}
+	if physical {
+		rates, err = db.ShippingRatesFor(c.Context(), request.Country, weight)
+		if err != nil {
+			log.ErrorStack(err)
+			return webutil.StatusInternalServerError(c)
 		}
 	}
-	return nil
+
+	quote := make([]map[string]any, len(rates))
+	for i, rate := range rates {
+		quote[i] = map[string]any{"id": rate.ID, "name": rate.Name, "amount": rate.Amount}
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Shipping rates", map[string]any{
+		"weight":   weight,
+		"currency": products.Currency,
+		"rates":    quote,
+	})
 }
 
 // PaymentList returns a list of available payment systems.
@@ -54,7 +162,8 @@ func PaymentList(c *fiber.Ctx) error {
 	return webutil.Response(c, fiber.StatusOK, "Payment list", paymentList)
 }
 
-// GetCart returns cart information by cart_id.
+// GetCart returns the public summary of a cart. The buyer signed in to the
+// customer portal also gets the email and what was delivered for a paid cart.
 // [get] /api/cart/:cart_id
 func GetCart(c *fiber.Ctx) error {
 	db := queries.DB()
@@ -68,17 +177,17 @@ func GetCart(c *fiber.Ctx) error {
 	cart, err := db.Cart(c.Context(), cartID)
 	if err != nil {
 		log.ErrorStack(err)
-		if err == errors.ErrProductNotFound {
+		if err == errors.ErrCartNotFound {
 			return webutil.StatusNotFound(c)
 		}
 		return webutil.StatusInternalServerError(c)
 	}
 
-	// Load full product information for cart items
-	// Pass cartID to include digital products purchased in this cart
+	// Load public product information for cart items, without the digital content
+	// Pass cartID to include products whose last keys were sold to this cart
 	var cartItems []map[string]interface{}
 	if len(cart.Cart) > 0 {
-		products, err := db.ListProducts(c.Context(), false, 0, 0, cartID, cart.Cart...)
+		products, err := db.ListProducts(c.Context(), false, nil, 0, 0, cartID, cart.Cart...)
 		if err != nil {
 			log.ErrorStack(err)
 			return webutil.StatusInternalServerError(c)
@@ -86,15 +195,41 @@ func GetCart(c *fiber.Ctx) error {
 		cartItems = queries.BuildCartItems(cart, products)
 	}
 
-	return webutil.Response(c, fiber.StatusOK, "Cart", map[string]interface{}{
+	response := map[string]interface{}{
 		"id":             cart.ID,
-		"email":          cart.Email,
 		"amount_total":   cart.AmountTotal,
 		"currency":       cart.Currency,
 		"payment_status": cart.PaymentStatus,
 		"payment_system": cart.PaymentSystem,
 		"items":          cartItems,
-	})
+	}
+
+	// the address and the tracking are only shown to the buyer
+	if cart.Shipping != nil {
+		response["shipping"] = map[string]any{"rate": cart.Shipping.Rate, "amount": cart.Shipping.Amount}
+	}
+
+	email, err := customerEmail(c)
+	if err != nil && err != errors.ErrTokenInvalid {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+	if email != "" && strings.EqualFold(email, cart.Email) {
+		response["email"] = cart.Email
+		order, err := db.CustomerOrder(c.Context(), email, cart.ID)
+		if err != nil && err != errors.ErrNotFound {
+			log.ErrorStack(err)
+			return webutil.StatusInternalServerError(c)
+		}
+		if order != nil {
+			response["purchases"] = order.Items
+		}
+		if cart.Shipping != nil {
+			response["shipping"] = cart.Shipping
+		}
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Cart", response)
 }
 
 // Payment initiates a payment process for a cart.
@@ -108,6 +243,46 @@ func Payment(c *fiber.Ctx) error {
 		log.ErrorStack(err)
 		return webutil.StatusBadRequest(c, err.Error())
 	}
+	// every line is priced and reserved at its quantity
+	if err := payment.Validate(); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	// a retried request with the same Idempotency-Key gets the first result
+	// instead of creating another cart and provider session
+	idempotencyKey := c.Get("Idempotency-Key")
+	cartCreated := false
+	if len(idempotencyKey) > 255 {
+		return webutil.StatusBadRequest(c, "Idempotency-Key is too long")
+	}
+	if idempotencyKey != "" {
+		sum := sha256.Sum256(c.Body())
+		requestHash := hex.EncodeToString(sum[:])
+		stored, err := db.ReserveIdempotencyKey(c.Context(), idempotencyKey, requestHash)
+		if err != nil {
+			log.ErrorStack(err)
+			return webutil.StatusInternalServerError(c)
+		}
+		if stored != nil {
+			switch {
+			case stored.RequestHash != requestHash:
+				return webutil.Response(c, fiber.StatusUnprocessableEntity, "Idempotency-Key was used with a different request", nil)
+			case stored.CartID == "":
+				return webutil.Response(c, fiber.StatusConflict, "A request with this Idempotency-Key is in progress", nil)
+			}
+			return webutil.Response(c, fiber.StatusOK, "Payment url", map[string]string{"url": stored.PaymentURL})
+		}
+
+		// free the key if no cart gets created, so the client can retry
+		defer func() {
+			if cartCreated {
+				return
+			}
+			if err := db.ReleaseIdempotencyKey(context.Background(), idempotencyKey); err != nil {
+				log.ErrorStack(err)
+			}
+		}()
+	}
 
 	setting, err := db.GetSettingByKey(c.Context(), "domain", "currency")
 	if err != nil {
@@ -117,40 +292,98 @@ func Payment(c *fiber.Ctx) error {
 	domain := setting["domain"].Value.(string)
 	currency := setting["currency"].Value.(string)
 
-	products, err := db.ListProducts(c.Context(), false, 0, 0, "", payment.Products...)
+	products, err := db.ListProducts(c.Context(), false, nil, 0, 0, "", payment.Products...)
 	if err != nil {
 		log.ErrorStack(err)
 		return webutil.StatusInternalServerError(c)
 	}
 
-	items := make([]litepay.Item, len(products.Products))
-	for i, product := range products.Products {
+	productMap := make(map[string]models.Product, len(products.Products))
+	for _, product := range products.Products {
+		productMap[product.ID] = product
+	}
+
+	// each cart line is an item, so a product bought as two variants is
+	// paid at the price of each one
+	items := []litepay.Item{}
+	for _, cartProduct := range payment.Products {
+		product, ok := productMap[cartProduct.ProductID]
+		if !ok {
+			continue
+		}
+
+		name := product.Name
+		amount := product.Amount
+		switch {
+		case cartProduct.VariantID != "":
+			i := slices.IndexFunc(product.Variants, func(v models.Variant) bool { return v.ID == cartProduct.VariantID })
+			if i < 0 {
+				return webutil.StatusBadRequest(c, errors.MsgVariantNotFound)
+			}
+			name = fmt.Sprintf("%s (%s)", product.Name, product.Variants[i].Name)
+			amount = product.Variants[i].Amount
+		case len(product.Variants) > 0:
+			return webutil.StatusBadRequest(c, errors.MsgVariantRequired)
+		}
+
 		images := []string{}
 		for _, image := range product.Images {
 			path := fmt.Sprintf("https://%s/uploads/%s_md.%s", domain, image.Name, image.Ext)
 			images = append(images, path)
 		}
 
-		quantity := 1
-		for _, cartProduct := range payment.Products {
-			if cartProduct.ProductID == product.ID {
-				quantity = cartProduct.Quantity
-			}
-		}
-
-		items[i] = litepay.Item{
+		item := litepay.Item{
 			PriceData: litepay.Price{
-				UnitAmount: product.Amount,
+				UnitAmount: amount,
 				Product: litepay.Product{
-					Name:   product.Name,
+					Name:   name,
 					Images: images,
 				},
 			},
-			Quantity: quantity,
+			Quantity: cartProduct.Quantity,
 		}
 
 		if product.Description != "" {
-			items[i].PriceData.Product.Description = product.Description
+			item.PriceData.Product.Description = product.Description
+		}
+		items = append(items, item)
+	}
+
+	// physical products are shipped, so the cart needs an address and one of
+	// the rates that ship its weight there
+	var shipping *models.CartShipping
+	if weight, physical := physicalItems(payment.Products, productMap); physical {
+		if payment.ShippingAddress == nil {
+			return webutil.StatusBadRequest(c, errors.MsgShippingAddressMissing)
+		}
+		if err := payment.ShippingAddress.Validate(); err != nil {
+			return webutil.StatusBadRequest(c, err.Error())
+		}
+
+		rate, err := db.ShippingRateFor(c.Context(), payment.ShippingRateID, payment.ShippingAddress.Country, weight)
+		if err != nil {
+			switch err {
+			case errors.ErrShippingRateNotFound, errors.ErrShippingRateNotApplies:
+				return webutil.StatusBadRequest(c, err.Error())
+			}
+			log.ErrorStack(err)
+			return webutil.StatusInternalServerError(c)
+		}
+
+		shipping = &models.CartShipping{
+			Address: *payment.ShippingAddress,
+			Rate:    rate.Name,
+			Amount:  rate.Amount,
+			Status:  models.ShipmentPending,
+		}
+		if rate.Amount > 0 {
+			items = append(items, litepay.Item{
+				PriceData: litepay.Price{
+					UnitAmount: rate.Amount,
+					Product:    litepay.Product{Name: fmt.Sprintf("Shipping (%s)", rate.Name)},
+				},
+				Quantity: 1,
+			})
 		}
 	}
 
@@ -178,72 +411,58 @@ func Payment(c *fiber.Ctx) error {
 	cancelURL := fmt.Sprintf("https://%s/cart/payment/cancel", domain)
 	pay := litepay.New(callbackURL, successURL, cancelURL)
 
-	paymentURL := fmt.Sprintf("https://%s/cart", domain)
-	switch paymentSystem {
-	case litepay.STRIPE:
-		setting, err := queries.GetSettingByGroup[models.Stripe](c.Context(), db)
-		if err != nil {
-			log.ErrorStack(err)
-			return webutil.StatusInternalServerError(c)
-		}
-
-		if !setting.Active {
-			return webutil.Response(c, fiber.StatusOK, "Payment url", paymentURL)
-		}
-		session := pay.Stripe(setting.SecretKey)
-		response, err := session.Pay(cart)
-		if err != nil {
-			log.ErrorStack(err)
-			return webutil.StatusInternalServerError(c)
+	provider, providerSetting, err := db.PaymentProvider(c.Context(), paymentSystem)
+	if err != nil {
+		log.ErrorStack(err)
+		if err == errors.ErrProviderNotFound {
+			return webutil.StatusBadRequest(c, err.Error())
 		}
-		paymentURL = response.URL
+		return webutil.StatusInternalServerError(c)
+	}
 
-	case litepay.PAYPAL:
-		setting, err := queries.GetSettingByGroup[models.Paypal](c.Context(), db)
-		if err != nil {
-			log.ErrorStack(err)
-			return webutil.StatusInternalServerError(c)
-		}
+	paymentURL := fmt.Sprintf("https://%s/cart", domain)
+	if !providerSetting.Enabled() {
+		return webutil.Response(c, fiber.StatusOK, "Payment url", paymentURL)
+	}
 
-		if !setting.Active {
-			return webutil.Response(c, fiber.StatusOK, "Payment url", paymentURL)
+	// tracked stock and keys of "data" products are held for this cart, so
+	// two buyers can not pay for the last one; they go back to the stock if
+	// no cart gets created
+	defer func() {
+		if cartCreated {
+			return
 		}
-		session := pay.Paypal(setting.ClientID, setting.SecretKey)
-		response, err := session.Pay(cart)
-		if err != nil {
+		if err := db.ReleaseStock(context.Background(), cart.ID); err != nil {
 			log.ErrorStack(err)
-			return webutil.StatusInternalServerError(c)
 		}
-		paymentURL = response.URL
-
-	case litepay.SPECTROCOIN:
-		setting, err := queries.GetSettingByGroup[models.Spectrocoin](c.Context(), db)
-		if err != nil {
+		if err := db.ReleaseDigitalData(context.Background(), cart.ID); err != nil {
 			log.ErrorStack(err)
-			return webutil.StatusInternalServerError(c)
 		}
-
-		if !setting.Active {
-			return webutil.Response(c, fiber.StatusOK, "Payment url", paymentURL)
+	}()
+	if err := db.ReserveStock(c.Context(), cart.ID, payment.Products...); err != nil {
+		if err == errors.ErrItemsOutOfStock {
+			return webutil.Response(c, fiber.StatusConflict, err.Error(), nil)
 		}
-		session := pay.Spectrocoin(setting.MerchantID, setting.ProjectID, setting.PrivateKey)
-		response, err := session.Pay(cart)
-		if err != nil {
-			log.ErrorStack(err)
-			return webutil.StatusInternalServerError(c)
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+	if err := db.ReserveDigitalData(c.Context(), cart.ID, payment.Products...); err != nil {
+		switch err {
+		case errors.ErrOutOfStock:
+			return webutil.Response(c, fiber.StatusConflict, err.Error(), nil)
+		case errors.ErrProductNotFound:
+			return webutil.StatusNotFound(c)
 		}
-		paymentURL = response.URL
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
 
-	case litepay.DUMMY:
-		// Dummy provider is always active and only for free carts (already validated above)
-		session := pay.Dummy()
-		response, err := session.Pay(cart)
-		if err != nil {
-			log.ErrorStack(err)
-			return webutil.StatusInternalServerError(c)
-		}
-		paymentURL = response.URL
+	response, err := provider.New(pay, providerSetting).Pay(cart)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
 	}
+	paymentURL = response.URL
 
 	if err := db.AddCart(c.Context(), &models.Cart{
 		Core: models.Core{
@@ -255,18 +474,31 @@ func Payment(c *fiber.Ctx) error {
 		Currency:      cart.Currency,
 		PaymentStatus: litepay.NEW,
 		PaymentSystem: paymentSystem,
+		Shipping:      shipping,
 	}); err != nil {
 		log.ErrorStack(err)
 		return webutil.StatusInternalServerError(c)
 	}
+	// from here on the cart can be paid, what it holds must stay held
+	cartCreated = true
 
-	// send email
-	if err := mailer.SendPrepaymentLetter(payment.Email, fmt.Sprintf("%.2f %s", float64(amountTotal)/100, cart.Currency), paymentURL); err != nil {
+	if err := mailer.QueueStockLow(c.Context(), cart.ID); err != nil {
+		log.ErrorStack(err)
+	}
+
+	// a key that is not saved stays in progress until it expires, which
+	// still keeps a retry from opening a second cart
+	if idempotencyKey != "" {
+		if err := db.SaveIdempotencyKey(c.Context(), idempotencyKey, cart.ID, paymentURL); err != nil {
+			log.ErrorStack(err)
+		}
+	}
+
+	// the provider session exists, so delivery problems must not fail the checkout
+	if err := mailer.QueuePrepaymentLetter(payment.Email, fmt.Sprintf("%.2f %s", float64(amountTotal)/100, cart.Currency), paymentURL); err != nil {
 		log.ErrorStack(err)
-		return webutil.StatusInternalServerError(c)
 	}
 
-	// send hook
 	hook := &webhook.Payment{
 		Event:     webhook.PAYMENT_INITIATION,
 		TimeStamp: time.Now().Unix(),
@@ -279,9 +511,8 @@ func Payment(c *fiber.Ctx) error {
 			CartItems:     items,
 		},
 	}
-	if err := webhook.SendPaymentHook(hook); err != nil {
+	if err := webhook.QueuePaymentHook(hook); err != nil {
 		log.ErrorStack(err)
-		return webutil.StatusInternalServerError(c)
 	}
 
 	return webutil.Response(c, fiber.StatusOK, "Payment url", map[string]string{"url": paymentURL})
@@ -289,56 +520,110 @@ func Payment(c *fiber.Ctx) error {
 
 // PaymentCallback handles payment callback from payment providers.
 // [post] /cart/payment/callback
+// [post] /cart/payment/callback/:payment_system
 func PaymentCallback(c *fiber.Ctx) error {
+	db := queries.DB()
 	log := logging.New()
-	payment := &litepay.Payment{
-		CartID:        c.Query("cart_id"),
-		PaymentSystem: litepay.PaymentSystem(c.Query("payment_system")),
+	paymentSystem := c.Params("payment_system", c.Query("payment_system"))
+
+	provider, setting, err := db.PaymentProvider(c.Context(), litepay.PaymentSystem(paymentSystem))
+	if err != nil {
+		if err == errors.ErrProviderNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	if provider.Callback == nil || !setting.Enabled() {
+		return webutil.StatusNotFound(c)
+	}
+
+	payment, err := provider.Callback(setting, notification(c))
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusBadRequest(c, err.Error())
 	}
 
-	switch payment.PaymentSystem {
-	// case litepay.STRIPE:
-	//	return webutil.Response(c, fiber.StatusOK, "Callback", payment)
-	case litepay.SPECTROCOIN:
-		response := new(litepay.CallbackSpectrocoin)
-		if err := c.BodyParser(response); err != nil {
+	// event is acknowledged but does not change the cart
+	if payment == nil {
+		return c.Status(fiber.StatusOK).SendString("*ok*")
+	}
+
+	payment.PaymentSystem = provider.Name
+	if payment.CartID == "" {
+		payment.CartID = c.Query("cart_id")
+	}
+	if payment.CartID == "" && payment.MerchantID != "" {
+		cartID, err := db.CartIDByPaymentID(c.Context(), payment.MerchantID)
+		if err != nil {
+			if err == errors.ErrCartNotFound {
+				return webutil.StatusNotFound(c)
+			}
 			log.ErrorStack(err)
-			return webutil.StatusBadRequest(c, err.Error())
+			return webutil.StatusInternalServerError(c)
 		}
-		payment.Status = litepay.StatusPayment(litepay.SPECTROCOIN, string(rune(response.Status)))
-		payment.MerchantID = response.MerchantApiID
-		payment.Coin = &litepay.Coin{
-			AmountTotal: response.ReceiveAmount,
-			Currency:    response.ReceiveCurrency,
+		payment.CartID = cartID
+	}
+
+	// a notification for another amount or currency did not pay this cart
+	if payment.Status == litepay.PAID {
+		if err := db.CheckCartPayment(c.Context(), payment); err != nil {
+			switch err {
+			case errors.ErrCartNotFound:
+				return webutil.StatusNotFound(c)
+			case errors.ErrPaymentMismatch:
+				log.Error().Str("cart_id", payment.CartID).Int("amount", payment.AmountTotal).Str("currency", payment.Currency).Msg("payment does not match the cart")
+				return webutil.StatusBadRequest(c, err.Error())
+			}
+			log.ErrorStack(err)
+			return webutil.StatusInternalServerError(c)
 		}
 	}
 
-	db := queries.DB()
-	err := db.UpdateCart(c.Context(), &models.Cart{
+	changed, err := db.UpdateCart(c.Context(), &models.Cart{
 		Core: models.Core{
 			ID: payment.CartID,
 		},
-		PaymentID:     payment.MerchantID,
-		PaymentStatus: payment.Status,
-		PaymentSystem: payment.PaymentSystem,
-	})
+		PaymentID:      payment.MerchantID,
+		PaymentStatus:  payment.Status,
+		PaymentSystem:  payment.PaymentSystem,
+		AmountRefunded: payment.AmountRefunded,
+	}, models.CartSourceCallback)
 	if err != nil {
+		if err == errors.ErrCartNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		if transition, ok := err.(*queries.CartTransitionError); ok {
+			// money taken for a cart that can not be paid any more is not
+			// acknowledged, the admin has to settle it with the buyer
+			if transition.To == litepay.PAID && transition.From != litepay.REFUNDED && transition.From != litepay.PARTIALLY_REFUNDED {
+				log.Error().Err(err).Str("cart_id", payment.CartID).Str("payment_id", payment.MerchantID).Msg("payment received for a closed cart")
+				queuePaymentWebhook(webhook.PAYMENT_ERROR, payment.PaymentSystem, payment.Status, payment.CartID, log)
+				return webutil.Response(c, fiber.StatusConflict, err.Error(), nil)
+			}
+			// late or repeated notification, acknowledged so the provider stops retrying
+			log.Warn().Err(err).Str("cart_id", payment.CartID).Msg("payment notification ignored")
+			return c.Status(fiber.StatusOK).SendString("*ok*")
+		}
 		log.ErrorStack(err)
 		return webutil.StatusInternalServerError(c)
 	}
 
-	// send email
+	// the status was already set by the success redirect or an earlier notification
+	if !changed {
+		return c.Status(fiber.StatusOK).SendString("*ok*")
+	}
+
 	if payment.Status == litepay.PAID {
-		if err := mailer.SendCartLetter(payment.CartID); err != nil {
-			log.ErrorStack(err)
-			return webutil.StatusInternalServerError(c)
-		}
+		queuePaidCart(c.Context(), payment.CartID, log)
 	}
 
-	// send hook
-	if err := sendPaymentWebhook(webhook.PAYMENT_CALLBACK, payment.PaymentSystem, payment.Status, payment.CartID, log, true); err != nil {
-		return webutil.StatusInternalServerError(c)
+	event := webhook.PAYMENT_CALLBACK
+	if payment.Status == litepay.REFUNDED || payment.Status == litepay.PARTIALLY_REFUNDED {
+		event = webhook.PAYMENT_REFUND
 	}
+	queuePaymentWebhook(event, payment.PaymentSystem, payment.Status, payment.CartID, log)
 
 	return c.Status(fiber.StatusOK).SendString("*ok*")
 }
@@ -383,51 +668,23 @@ func PaymentSuccess(c *fiber.Ctx) error {
 		return c.Next()
 	}
 
-	switch payment.PaymentSystem {
-	case litepay.STRIPE:
-		sessionStripe := c.Query("session")
-		setting, err := queries.GetSettingByGroup[models.Stripe](c.Context(), db)
-		if err != nil {
-			log.ErrorStack(err)
-			return webutil.StatusInternalServerError(c)
-		}
-
-		if !setting.Active {
-			return webutil.StatusNotFound(c)
-		}
-		response, err := litepay.New("", "", "").Stripe(setting.SecretKey).Checkout(payment, sessionStripe)
-		if err != nil {
-			log.ErrorStack(err)
-			return webutil.StatusInternalServerError(c)
-		}
-		payment.MerchantID = response.MerchantID
-		payment.Status = response.Status
-
-	case litepay.PAYPAL:
-		tokenPaypal := c.Query("token")
-		setting, err := queries.GetSettingByGroup[models.Paypal](c.Context(), db)
-		if err != nil {
-			log.ErrorStack(err)
-			return webutil.StatusInternalServerError(c)
-		}
-
-		if !setting.Active {
+	provider, setting, err := db.PaymentProvider(c.Context(), payment.PaymentSystem)
+	if err != nil {
+		if err == errors.ErrProviderNotFound {
 			return webutil.StatusNotFound(c)
 		}
-		response, err := litepay.New("", "", "").Paypal(setting.ClientID, setting.SecretKey).Checkout(payment, tokenPaypal)
-		if err != nil {
-			log.ErrorStack(err)
-			return webutil.StatusInternalServerError(c)
-		}
-		payment.MerchantID = response.MerchantID
-		payment.Status = response.Status
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
 
-	case litepay.SPECTROCOIN:
-		// Spectrocoin payment processing handled in callback
+	if !setting.Enabled() {
+		return webutil.StatusNotFound(c)
+	}
 
-	case litepay.DUMMY:
-		// Dummy provider is always active and only for free carts (already validated above)
-		response, err := litepay.New("", "", "").Dummy().Checkout(payment, "")
+	// Providers without checkout confirm the payment in the callback
+	if provider.Checkout != nil {
+		session := provider.New(litepay.New("", "", ""), setting)
+		response, err := provider.Checkout(session, payment, queryValues(c))
 		if err != nil {
 			log.ErrorStack(err)
 			return webutil.StatusInternalServerError(c)
@@ -436,29 +693,32 @@ func PaymentSuccess(c *fiber.Ctx) error {
 		payment.Status = response.Status
 	}
 
-	err = db.UpdateCart(c.Context(), &models.Cart{
+	changed, err := db.UpdateCart(c.Context(), &models.Cart{
 		Core: models.Core{
 			ID: payment.CartID,
 		},
 		PaymentID:     payment.MerchantID,
 		PaymentStatus: payment.Status,
 		PaymentSystem: payment.PaymentSystem,
-	})
+	}, models.CartSourceSuccess)
 	if err != nil {
+		// the cart has already moved on, e.g. it was refunded
+		if _, ok := err.(*queries.CartTransitionError); ok {
+			return c.Next()
+		}
 		log.ErrorStack(err)
 		return webutil.StatusInternalServerError(c)
 	}
 
-	// send email
-	if payment.Status == litepay.PAID {
-		if err := mailer.SendCartLetter(payment.CartID); err != nil {
-			log.ErrorStack(err)
-			return webutil.StatusInternalServerError(c)
-		}
+	// reloaded page or the payment was confirmed by a notification first
+	if !changed {
+		return c.Next()
 	}
 
-	// send hook (don't block process on webhook error)
-	sendPaymentWebhook(webhook.PAYMENT_SUCCESS, payment.PaymentSystem, payment.Status, payment.CartID, log, false)
+	if payment.Status == litepay.PAID {
+		queuePaidCart(c.Context(), payment.CartID, log)
+	}
+	queuePaymentWebhook(webhook.PAYMENT_SUCCESS, payment.PaymentSystem, payment.Status, payment.CartID, log)
 
 	// After processing payment, pass control to SPA handler
 	// The SPA will display the success page with cart information
@@ -480,21 +740,27 @@ func PaymentCancel(c *fiber.Ctx) error {
 	}
 
 	db := queries.DB()
-	err := db.UpdateCart(c.Context(), &models.Cart{
+	changed, err := db.UpdateCart(c.Context(), &models.Cart{
 		Core: models.Core{
 			ID: payment.CartID,
 		},
 		PaymentStatus: litepay.CANCELED,
 		PaymentSystem: payment.PaymentSystem,
-	})
-	if err != nil {
-		log.ErrorStack(err)
-		return webutil.StatusInternalServerError(c)
+	}, models.CartSourceCancel)
+	switch err.(type) {
+	case nil:
+		if changed {
+			queuePaymentWebhook(webhook.PAYMENT_CANCEL, payment.PaymentSystem, litepay.CANCELED, payment.CartID, log)
+		}
+	case *queries.CartTransitionError:
+		// paid or already closed carts are not canceled
+	default:
+		if err != errors.ErrCartNotFound {
+			log.ErrorStack(err)
+			return webutil.StatusInternalServerError(c)
+		}
 	}
 
-	// send hook (don't block process on webhook error)
-	sendPaymentWebhook(webhook.PAYMENT_CANCEL, payment.PaymentSystem, litepay.CANCELED, payment.CartID, log, false)
-
 	// Redirect to SPA cancel page with query parameters
 	redirectURL := "/cart/payment/cancel"
 	if payment.CartID != "" {
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/shurco/litecart/internal/mailer"
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/internal/queries"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/logging"
+	"github.com/shurco/litecart/pkg/webutil"
+)
+
+// customerCookie holds the session token of a buyer signed in to the portal.
+const customerCookie = "customer"
+
+// customerEmail returns the email of the buyer signed in with the request,
+// or errors.ErrTokenInvalid if there is no valid session.
+func customerEmail(c *fiber.Ctx) (string, error) {
+	token := c.Cookies(customerCookie)
+	if token == "" {
+		return "", errors.ErrTokenInvalid
+	}
+	return queries.DB().CustomerEmail(c.Context(), token)
+}
+
+// setCustomerCookie stores the session token of a buyer, or removes it when
+// expires is in the past.
+func setCustomerCookie(c *fiber.Ctx, token string, expires time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     customerCookie,
+		Value:    token,
+		Expires:  expires,
+		HTTPOnly: true,
+		Secure:   c.Protocol() == "https",
+		SameSite: fiber.CookieSameSiteStrictMode,
+	})
+}
+
+// CustomerSignIn mails a one-time sign-in link to a buyer with paid carts.
+// The answer is the same for any email, so it does not tell who bought what.
+// [post] /api/customer/sign-in
+func CustomerSignIn(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+	request := new(models.CustomerSignIn)
+
+	if err := c.BodyParser(request); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	if err := request.Validate(); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	token, err := db.AddSignInLink(c.Context(), request.Email)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	if token != "" {
+		if err := mailer.QueueSignInLetter(request.Email, token); err != nil {
+			log.ErrorStack(err)
+			return webutil.StatusInternalServerError(c)
+		}
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "If there are orders for this email, a sign-in link was sent to it", nil)
+}
+
+// CustomerSession signs a buyer in with the token of the sign-in link.
+// [post] /api/customer/session
+func CustomerSession(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+	request := new(models.CustomerSession)
+
+	if err := c.BodyParser(request); err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	if err := request.Validate(); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	token, expires, err := db.AddCustomerSession(c.Context(), request.Token)
+	if err != nil {
+		if err == errors.ErrTokenInvalid {
+			return webutil.Response(c, fiber.StatusUnauthorized, "The sign-in link is invalid or has expired", nil)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	setCustomerCookie(c, token, time.Unix(expires, 0))
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// CustomerOrders returns the paid carts of the signed in buyer.
+// [get] /api/customer/orders
+func CustomerOrders(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	email, err := customerEmail(c)
+	if err != nil {
+		if err == errors.ErrTokenInvalid {
+			return webutil.Response(c, fiber.StatusUnauthorized, "Sign in to see your orders", nil)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	orders, err := db.CustomerOrders(c.Context(), email)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Orders", map[string]any{
+		"email":  email,
+		"orders": orders,
+	})
+}
+
+// CustomerSignOut ends the session of the buyer.
+// [post] /api/customer/sign-out
+func CustomerSignOut(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	if token := c.Cookies(customerCookie); token != "" {
+		if err := db.DeleteCustomerSession(c.Context(), token); err != nil {
+			log.ErrorStack(err)
+			return webutil.StatusInternalServerError(c)
+		}
+	}
+
+	setCustomerCookie(c, "", time.Now().Add(-(time.Hour * 2)))
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/shurco/litecart/internal/queries"
+	"github.com/shurco/litecart/internal/storage"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/logging"
+	"github.com/shurco/litecart/pkg/webutil"
+)
+
+// Download serves a purchased file by the signed token from the purchase letter
+// and records the download. A file that cannot be opened is not counted.
+// [get] /download/:token
+func Download(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	file, downloadID, err := db.DownloadFile(c.Context(), c.Params("token"), c.IP(), c.Get(fiber.HeaderUserAgent))
+	if err != nil {
+		switch err {
+		case errors.ErrTokenExpired:
+			return webutil.Response(c, fiber.StatusGone, "Download link has expired", nil)
+		case errors.ErrDownloadLimitReached:
+			return webutil.Response(c, fiber.StatusForbidden, "Download limit reached", nil)
+		case errors.ErrTokenInvalid, errors.ErrFileNotFound:
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	object, err := storage.Files().Get(c.Context(), storage.DigitalKey(file.Name+"."+file.Ext))
+	if err != nil {
+		if err := db.CancelDownload(c.Context(), downloadID); err != nil {
+			log.ErrorStack(err)
+		}
+		if err == storage.ErrNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	c.Attachment(file.OrigName)
+	return c.SendStream(object.Body, int(object.Size))
+}
+
+// Upload serves an uploaded product image.
+// [get] /uploads/:file_name
+func Upload(c *fiber.Ctx) error {
+	log := logging.New()
+
+	object, err := storage.Files().Get(c.Context(), storage.UploadKey(c.Params("file_name")))
+	if err != nil {
+		if err == storage.ErrNotFound {
+			return webutil.StatusNotFound(c)
+		}
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	if object.ContentType != "" {
+		c.Set(fiber.HeaderContentType, object.ContentType)
+	}
+	// image names are unique, so an image never changes
+	c.Set(fiber.HeaderCacheControl, "public, max-age=86400")
+	return c.SendStream(object.Body, int(object.Size))
+}
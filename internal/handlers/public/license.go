@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/internal/queries"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/logging"
+	"github.com/shurco/litecart/pkg/webutil"
+)
+
+// parseLicenseRequest reads and validates the body of a licensing request.
+func parseLicenseRequest(c *fiber.Ctx) (*models.LicenseRequest, error) {
+	request := &models.LicenseRequest{}
+	if err := c.BodyParser(request); err != nil {
+		return nil, err
+	}
+	if err := request.Validate(); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// licenseError answers a failed licensing request.
+func licenseError(c *fiber.Ctx, err error, log *logging.Log) error {
+	switch err {
+	case errors.ErrLicenseNotFound, errors.ErrActivationNotFound:
+		return webutil.Response(c, fiber.StatusNotFound, err.Error(), nil)
+	case errors.ErrActivationLimitReached:
+		return webutil.Response(c, fiber.StatusForbidden, err.Error(), nil)
+	}
+	log.ErrorStack(err)
+	return webutil.StatusInternalServerError(c)
+}
+
+// signedLicense answers with the license signed by the store key.
+func signedLicense(c *fiber.Ctx, msg string, license *models.License, log *logging.Log) error {
+	signed, err := queries.DB().SignLicense(c.Context(), license)
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+	return webutil.Response(c, fiber.StatusOK, msg, signed)
+}
+
+// LicensePublicKey returns the public key that verifies signed licenses.
+// [get] /api/license/public-key
+func LicensePublicKey(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	key, err := db.LicensePublicKey(c.Context())
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "License public key", map[string]string{"public_key": key})
+}
+
+// ActivateLicense activates a sold key on a machine.
+// [post] /api/license/activate
+func ActivateLicense(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	request, err := parseLicenseRequest(c)
+	if err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	license, err := db.ActivateLicense(c.Context(), request, c.IP())
+	if err != nil {
+		return licenseError(c, err, log)
+	}
+
+	return signedLicense(c, "License activated", license, log)
+}
+
+// ValidateLicense checks that a key is activated on a machine.
+// [post] /api/license/validate
+func ValidateLicense(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	request, err := parseLicenseRequest(c)
+	if err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	license, err := db.ValidateLicense(c.Context(), request)
+	if err != nil {
+		return licenseError(c, err, log)
+	}
+
+	return signedLicense(c, "License valid", license, log)
+}
+
+// DeactivateLicense frees the activation of a key on a machine.
+// [post] /api/license/deactivate
+func DeactivateLicense(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	request, err := parseLicenseRequest(c)
+	if err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	if err := db.DeactivateLicense(c.Context(), request); err != nil {
+		return licenseError(c, err, log)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "License deactivated", nil)
+}
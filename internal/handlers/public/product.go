@@ -3,12 +3,15 @@ package handlers
 import (
 	"github.com/gofiber/fiber/v2"
 
+	"github.com/shurco/litecart/internal/models"
 	"github.com/shurco/litecart/internal/queries"
+	"github.com/shurco/litecart/pkg/errors"
 	"github.com/shurco/litecart/pkg/logging"
 	"github.com/shurco/litecart/pkg/webutil"
 )
 
-// Products returns a list of all active products for public access.
+// Products returns a list of all active products for public access,
+// optionally narrowed to a category, a tag or a price range.
 // [get] /api/products
 func Products(c *fiber.Ctx) error {
 	db := queries.DB()
@@ -27,8 +30,50 @@ func Products(c *fiber.Ctx) error {
 	}
 	offset := (page - 1) * limit
 
-	products, err := db.ListProducts(c.Context(), false, limit, offset, "")
+	filter := &models.ProductFilter{
+		Category:  c.Query("category"),
+		Tag:       c.Query("tag"),
+		MinAmount: c.QueryInt("min_amount"),
+		MaxAmount: c.QueryInt("max_amount"),
+	}
+	if err := filter.Validate(); err != nil {
+		return webutil.StatusBadRequest(c, err.Error())
+	}
+
+	products, err := db.ListProducts(c.Context(), false, filter, limit, offset, "")
+	if err != nil {
+		log.ErrorStack(err)
+		return webutil.StatusInternalServerError(c)
+	}
+
+	return webutil.Response(c, fiber.StatusOK, "Products", products)
+}
+
+// SearchProducts returns the active products matching the query, best match first,
+// each with a snippet of the matching text.
+// [get] /api/products/search
+func SearchProducts(c *fiber.Ctx) error {
+	db := queries.DB()
+	log := logging.New()
+
+	page := c.QueryInt("page", 1)
+	limit := c.QueryInt("limit", 20)
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	offset := (page - 1) * limit
+
+	products, err := db.SearchProducts(c.Context(), false, c.Query("q"), limit, offset)
 	if err != nil {
+		if err == errors.ErrSearchQueryEmpty {
+			return webutil.StatusBadRequest(c, err.Error())
+		}
 		log.ErrorStack(err)
 		return webutil.StatusInternalServerError(c)
 	}
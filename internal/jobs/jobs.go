@@ -0,0 +1,186 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/internal/queries"
+	"github.com/shurco/litecart/pkg/logging"
+)
+
+const (
+	// DefaultWorkers is the number of workers started by the application
+	DefaultWorkers = 2
+	// MaxAttempts is how many times a job runs before it becomes dead
+	MaxAttempts = 8
+
+	pollInterval = 5 * time.Second
+	runTimeout   = time.Minute
+)
+
+// Handler runs one job with its JSON payload.
+type Handler func(ctx context.Context, payload []byte) error
+
+type attemptKey struct{}
+
+// Attempt returns which run of its job a handler is in, starting at 1.
+// It is 0 when ctx does not come from a job.
+func Attempt(ctx context.Context) int {
+	attempt, _ := ctx.Value(attemptKey{}).(int)
+	return attempt
+}
+
+var (
+	mu       sync.RWMutex
+	handlers = map[string]Handler{}
+
+	// wake lets a new job start without waiting for the next poll
+	wake = make(chan struct{}, 1)
+
+	// backoff is the delay before the next attempt of a failed job
+	backoff = func(attempt int) time.Duration {
+		delay := 30 * time.Second << (attempt - 1)
+		if attempt > 8 || delay > time.Hour {
+			return time.Hour
+		}
+		return delay
+	}
+)
+
+// Register adds the handler for a job kind. It is meant to be called from init.
+func Register(kind string, handler Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	handlers[kind] = handler
+}
+
+// Enqueue stores a job of the given kind to be run by the workers.
+func Enqueue(kind string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := queries.DB().AddJob(ctx, &models.Job{
+		Kind:        kind,
+		Payload:     string(data),
+		MaxAttempts: MaxAttempts,
+	}); err != nil {
+		return err
+	}
+
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Start returns jobs interrupted by a previous run to the queue and starts
+// the workers. They stop when ctx is canceled.
+func Start(ctx context.Context, workers int) error {
+	if err := queries.DB().ResetRunningJobs(ctx); err != nil {
+		return err
+	}
+
+	for range workers {
+		go work(ctx)
+	}
+	go cleanup(ctx)
+	return nil
+}
+
+// cleanup removes done jobs older than queries.JobRetention once an hour
+// until ctx is cancelled.
+func cleanup(ctx context.Context) {
+	log := logging.New()
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		removed, err := queries.DB().CleanupJobs(ctx, time.Now().Add(-queries.JobRetention))
+		if err != nil && ctx.Err() == nil {
+			log.ErrorStack(err)
+		} else if removed > 0 {
+			log.Info().Msgf("removed %d done jobs", removed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// work runs due jobs until the queue is empty, then waits for a new job or the next poll.
+func work(ctx context.Context) {
+	log := logging.New()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			ran, err := RunNext(ctx)
+			if err != nil {
+				log.ErrorStack(err)
+			}
+			if !ran || err != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunNext claims and runs the next due job. It reports whether there was one.
+func RunNext(ctx context.Context) (bool, error) {
+	db := queries.DB()
+	log := logging.New()
+
+	job, err := db.ClaimJob(ctx)
+	if err != nil || job == nil {
+		return false, err
+	}
+
+	if err := run(ctx, job); err != nil {
+		log.Error().Str("job", job.ID).Str("kind", job.Kind).Int("attempt", job.Attempts).Err(err).Msg("job failed")
+		return true, db.FailJob(context.Background(), job.ID, err.Error(), backoff(job.Attempts))
+	}
+
+	return true, db.CompleteJob(context.Background(), job.ID)
+}
+
+// run calls the handler of the job kind.
+func run(ctx context.Context, job *models.Job) (err error) {
+	mu.RLock()
+	handler, ok := handlers[job.Kind]
+	mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("no handler for job kind %q", job.Kind)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.WithValue(ctx, attemptKey{}, job.Attempts), runTimeout)
+	defer cancel()
+
+	return handler(ctx, []byte(job.Payload))
+}
@@ -0,0 +1,173 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/internal/queries"
+	"github.com/shurco/litecart/internal/testutil"
+	"github.com/shurco/litecart/migrations"
+)
+
+func setupQueue(t *testing.T) func() {
+	cleanup := testutil.WithCmdTestDir(t)
+	if err := queries.New(migrations.Embed()); err != nil {
+		t.Fatal(err)
+	}
+
+	// failed jobs are due again at once
+	saved := backoff
+	backoff = func(int) time.Duration { return 0 }
+	return func() {
+		backoff = saved
+		cleanup()
+	}
+}
+
+func onlyJob(t *testing.T) *models.Job {
+	t.Helper()
+	jobs, total, err := queries.DB().Jobs(context.Background(), "", 0, 0)
+	if err != nil || total != 1 {
+		t.Fatalf("jobs: %d, %v", total, err)
+	}
+	return jobs[0]
+}
+
+func Test_job_retries_until_done(t *testing.T) {
+	defer setupQueue(t)()
+	ctx := context.Background()
+
+	calls := 0
+	Register("test.flaky", func(_ context.Context, payload []byte) error {
+		calls++
+		if string(payload) != `{"n":1}` {
+			t.Fatalf("unexpected payload %s", payload)
+		}
+		if calls < 3 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	})
+
+	if err := Enqueue("test.flaky", map[string]int{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 3 {
+		if ran, err := RunNext(ctx); err != nil || !ran {
+			t.Fatalf("run: %t, %v", ran, err)
+		}
+	}
+	if ran, _ := RunNext(ctx); ran {
+		t.Fatalf("a done job ran again")
+	}
+
+	job := onlyJob(t)
+	if job.Status != models.JobDone || job.Attempts != 3 || job.LastError != "" {
+		t.Fatalf("unexpected job %+v", job)
+	}
+}
+
+func Test_job_dead_and_retry(t *testing.T) {
+	defer setupQueue(t)()
+	ctx := context.Background()
+
+	fail := true
+	Register("test.broken", func(context.Context, []byte) error {
+		if fail {
+			return errors.New("smtp is down")
+		}
+		return nil
+	})
+
+	if err := Enqueue("test.broken", nil); err != nil {
+		t.Fatal(err)
+	}
+	for range MaxAttempts {
+		if _, err := RunNext(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if ran, _ := RunNext(ctx); ran {
+		t.Fatalf("a dead job ran again")
+	}
+
+	job := onlyJob(t)
+	if job.Status != models.JobDead || job.Attempts != MaxAttempts || job.LastError != "smtp is down" {
+		t.Fatalf("unexpected job %+v", job)
+	}
+
+	fail = false
+	if _, err := queries.DB().RetryJob(ctx, job.ID); err != nil {
+		t.Fatal(err)
+	}
+	if ran, err := RunNext(ctx); err != nil || !ran {
+		t.Fatalf("run after retry: %t, %v", ran, err)
+	}
+	if job := onlyJob(t); job.Status != models.JobDone || job.Attempts != 1 {
+		t.Fatalf("unexpected job %+v", job)
+	}
+}
+
+func Test_job_unknown_kind(t *testing.T) {
+	defer setupQueue(t)()
+
+	if err := Enqueue("test.unknown", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RunNext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if job := onlyJob(t); job.Status != models.JobPending || job.LastError == "" {
+		t.Fatalf("unexpected job %+v", job)
+	}
+}
+
+func Test_job_cleanup_keeps_unfinished(t *testing.T) {
+	defer setupQueue(t)()
+	ctx := context.Background()
+
+	Register("test.ok", func(context.Context, []byte) error { return nil })
+	if err := Enqueue("test.ok", nil); err != nil {
+		t.Fatal(err)
+	}
+	if ran, err := RunNext(ctx); err != nil || !ran {
+		t.Fatalf("run: %t, %v", ran, err)
+	}
+	if err := Enqueue("test.unknown", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	db := queries.DB()
+	if removed, err := db.CleanupJobs(ctx, time.Now().Add(-time.Hour)); err != nil || removed != 0 {
+		t.Fatalf("cleanup of recent jobs: %d, %v", removed, err)
+	}
+	if removed, err := db.CleanupJobs(ctx, time.Now().Add(time.Hour)); err != nil || removed != 1 {
+		t.Fatalf("cleanup: %d, %v", removed, err)
+	}
+	if job := onlyJob(t); job.Kind != "test.unknown" || job.Status != models.JobPending {
+		t.Fatalf("unexpected job %+v", job)
+	}
+}
+
+func Test_backoff(t *testing.T) {
+	cases := []struct {
+		attempt int
+		delay   time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{5, 8 * time.Minute},
+		{8, time.Hour},
+		{40, time.Hour},
+	}
+
+	for _, tt := range cases {
+		if got := backoff(tt.attempt); got != tt.delay {
+			t.Fatalf("backoff(%d) = %s, want %s", tt.attempt, got, tt.delay)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/shurco/litecart/internal/jobs"
+	"github.com/shurco/litecart/internal/models"
+)
+
+const (
+	JobPrepaymentLetter = "mail.prepayment"
+	JobCartLetter       = "mail.cart"
+	JobAccessLetter     = "mail.access"
+	JobStockLowLetter   = "mail.stock_low"
+	JobSignInLetter     = "mail.sign_in"
+	JobUpdateLetter     = "mail.update"
+	JobShippedLetter    = "mail.shipped"
+)
+
+type prepaymentLetterJob struct {
+	Email         string `json:"email"`
+	AmountPayment string `json:"amount_payment"`
+	PaymentURL    string `json:"payment_url"`
+}
+
+type cartLetterJob struct {
+	CartID string `json:"cart_id"`
+}
+
+type updateLetterJob struct {
+	CartID    string `json:"cart_id"`
+	ProductID string `json:"product_id"`
+}
+
+type signInLetterJob struct {
+	Email string `json:"email"`
+	Token string `json:"token"`
+}
+
+func init() {
+	jobs.Register(JobPrepaymentLetter, func(ctx context.Context, payload []byte) error {
+		job := &prepaymentLetterJob{}
+		if err := json.Unmarshal(payload, job); err != nil {
+			return err
+		}
+		return SendPrepaymentLetter(ctx, job.Email, job.AmountPayment, job.PaymentURL)
+	})
+
+	jobs.Register(JobCartLetter, func(ctx context.Context, payload []byte) error {
+		job := &cartLetterJob{}
+		if err := json.Unmarshal(payload, job); err != nil {
+			return err
+		}
+		return SendCartLetter(ctx, job.CartID)
+	})
+
+	jobs.Register(JobAccessLetter, func(ctx context.Context, payload []byte) error {
+		job := &cartLetterJob{}
+		if err := json.Unmarshal(payload, job); err != nil {
+			return err
+		}
+		return SendAccessLetter(ctx, job.CartID)
+	})
+
+	jobs.Register(JobStockLowLetter, func(ctx context.Context, payload []byte) error {
+		stock := &models.DigitalStock{}
+		if err := json.Unmarshal(payload, stock); err != nil {
+			return err
+		}
+		return SendStockLowLetter(ctx, stock)
+	})
+
+	jobs.Register(JobSignInLetter, func(ctx context.Context, payload []byte) error {
+		job := &signInLetterJob{}
+		if err := json.Unmarshal(payload, job); err != nil {
+			return err
+		}
+		return SendSignInLetter(ctx, job.Email, job.Token)
+	})
+
+	jobs.Register(JobUpdateLetter, func(ctx context.Context, payload []byte) error {
+		job := &updateLetterJob{}
+		if err := json.Unmarshal(payload, job); err != nil {
+			return err
+		}
+		return SendUpdateLetter(ctx, job.CartID, job.ProductID)
+	})
+
+	jobs.Register(JobShippedLetter, func(ctx context.Context, payload []byte) error {
+		job := &cartLetterJob{}
+		if err := json.Unmarshal(payload, job); err != nil {
+			return err
+		}
+		return SendShippedLetter(ctx, job.CartID)
+	})
+}
+
+// QueuePrepaymentLetter schedules the letter sent before payment is completed.
+func QueuePrepaymentLetter(email, amountPayment, paymentURL string) error {
+	return jobs.Enqueue(JobPrepaymentLetter, &prepaymentLetterJob{
+		Email:         email,
+		AmountPayment: amountPayment,
+		PaymentURL:    paymentURL,
+	})
+}
+
+// QueueCartLetter schedules the letter sent after a cart purchase is completed.
+func QueueCartLetter(cartID string) error {
+	return jobs.Enqueue(JobCartLetter, &cartLetterJob{CartID: cartID})
+}
+
+// QueueAccessLetter schedules the letter with the content of "api" products
+// that was fulfilled after the purchase letter went out.
+func QueueAccessLetter(cartID string) error {
+	return jobs.Enqueue(JobAccessLetter, &cartLetterJob{CartID: cartID})
+}
+
+// QueueStockLowLetter schedules the letter that tells the admin a product is
+// running out of keys.
+func QueueStockLowLetter(stock *models.DigitalStock) error {
+	return jobs.Enqueue(JobStockLowLetter, stock)
+}
+
+// QueueSignInLetter schedules the letter with the link a buyer signs in to
+// the customer portal with.
+func QueueSignInLetter(email, token string) error {
+	return jobs.Enqueue(JobSignInLetter, &signInLetterJob{Email: email, Token: token})
+}
+
+// QueueUpdateLetter schedules the letter that tells the buyer of a paid cart
+// about a new version of a product.
+func QueueUpdateLetter(cartID, productID string) error {
+	return jobs.Enqueue(JobUpdateLetter, &updateLetterJob{CartID: cartID, ProductID: productID})
+}
+
+// QueueShippedLetter schedules the letter that tells the buyer the physical
+// products of a cart have been shipped.
+func QueueShippedLetter(cartID string) error {
+	return jobs.Enqueue(JobShippedLetter, &cartLetterJob{CartID: cartID})
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"time"
+	"strconv"
 
+	"github.com/shurco/litecart/internal/jobs"
 	"github.com/shurco/litecart/internal/models"
 	"github.com/shurco/litecart/internal/queries"
+	"github.com/shurco/litecart/internal/webhook"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/logging"
 )
 
 // ensureSenderEmail ensures that sender email is set, using user email from Settings as fallback.
@@ -39,12 +43,9 @@ func ensureSenderEmail(ctx context.Context, db *queries.Base, mailSetting *model
 }
 
 // SendTestLetter sends a test email letter to verify SMTP configuration.
-func SendTestLetter(letterName string) error {
+func SendTestLetter(ctx context.Context, letterName string) error {
 	db := queries.DB()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
 	mailSetting, err := queries.GetSettingByGroup[models.Mail](ctx, db)
 	if err != nil {
 		return err
@@ -72,10 +73,20 @@ func SendTestLetter(letterName string) error {
 			Text:    "test message",
 		},
 		Data: map[string]string{
-			"Payment_URL":    "https://payment.com/order/1234567890",
-			"Admin_Email":    "Admin Name <admin@mail.com>",
-			"Site_Name":      "Site name",
-			"Amount_Payment": "21.00 USD",
+			"Payment_URL":      "https://payment.com/order/1234567890",
+			"Admin_Email":      "Admin Name <admin@mail.com>",
+			"Site_Name":        "Site name",
+			"Amount_Payment":   "21.00 USD",
+			"Product_Name":     "Product name",
+			"Remaining":        "3",
+			"Sign_In_URL":      "https://shop.com/orders?token=1234567890",
+			"Version":          "2.0",
+			"Changelog":        "New chapters",
+			"Files":            "1: guide.pdf - https://shop.com/download/1234567890\n",
+			"Shipping_Address": "John Doe\n1 Main St\nSpringfield\n12345\nUS\n",
+			"Shipping_Rate":    "Standard",
+			"Tracking_Number":  "1Z999AA10123456784",
+			"Tracking_URL":     "https://tracking.example.com/1Z999AA10123456784",
 		},
 	}
 
@@ -85,7 +96,7 @@ func SendTestLetter(letterName string) error {
 		}
 	}
 
-	if err := SendMail(mailSetting, letter); err != nil {
+	if err := SendMail(ctx, mailSetting, letter); err != nil {
 		return err
 	}
 
@@ -93,12 +104,9 @@ func SendTestLetter(letterName string) error {
 }
 
 // SendPrepaymentLetter sends an email notification before payment is completed.
-func SendPrepaymentLetter(email, amountPayment, paymentURL string) error {
+func SendPrepaymentLetter(ctx context.Context, email, amountPayment, paymentURL string) error {
 	db := queries.DB()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
 	letter, err := db.CartLetterPayment(ctx, email, amountPayment, paymentURL)
 	if err != nil {
 		return err
@@ -114,7 +122,7 @@ func SendPrepaymentLetter(email, amountPayment, paymentURL string) error {
 		return err
 	}
 
-	if err := SendMail(mailSetting, letter); err != nil {
+	if err := SendMail(ctx, mailSetting, letter); err != nil {
 		return err
 	}
 
@@ -122,14 +130,20 @@ func SendPrepaymentLetter(email, amountPayment, paymentURL string) error {
 }
 
 // SendCartLetter sends an email notification after a cart purchase is completed.
-func SendCartLetter(cartID string) error {
+// The content of "api" products that are not fulfilled yet follows in the
+// access letter.
+func SendCartLetter(ctx context.Context, cartID string) error {
 	db := queries.DB()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
 	letter, err := db.CartLetterPurchase(ctx, cartID)
 	if err != nil {
+		// the keys ran out while the buyer was paying, the admin is told on
+		// the first attempt and the retries deliver once keys are added
+		if err == errors.ErrOutOfStock && jobs.Attempt(ctx) <= 1 {
+			if err := queueStockShort(ctx, cartID); err != nil {
+				logging.New().ErrorStack(err)
+			}
+		}
 		return err
 	}
 
@@ -143,9 +157,201 @@ func SendCartLetter(cartID string) error {
 		return err
 	}
 
-	if err := SendMail(mailSetting, letter); err != nil {
+	if err := SendMail(ctx, mailSetting, letter); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// SendAccessLetter sends the buyer the content of "api" products that was
+// fulfilled after the purchase letter went out.
+func SendAccessLetter(ctx context.Context, cartID string) error {
+	db := queries.DB()
+
+	letter, productIDs, err := db.CartLetterAccess(ctx, cartID)
+	if err != nil || letter == nil {
+		return err
+	}
+
+	mailSetting, err := queries.GetSettingByGroup[models.Mail](ctx, db)
+	if err != nil {
+		return err
+	}
+
+	// Ensure sender email is set (use user email as fallback if not configured)
+	if err := ensureSenderEmail(ctx, db, mailSetting); err != nil {
+		return err
+	}
+
+	if err := SendMail(ctx, mailSetting, letter); err != nil {
+		return err
+	}
+
+	// marked once sent, a failed attempt builds the same letter again
+	return db.MarkFulfillmentsSent(ctx, cartID, productIDs...)
+}
+
+// QueueStockLow alerts the admin by mail and webhook about the products of
+// the cart that its keys have left running out. A product is reported once
+// until new keys are added to it.
+func QueueStockLow(ctx context.Context, cartID string) error {
+	db := queries.DB()
+
+	cart, err := db.Cart(ctx, cartID)
+	if err != nil {
+		return err
+	}
+
+	productIDs := make([]string, 0, len(cart.Cart))
+	for _, product := range cart.Cart {
+		productIDs = append(productIDs, product.ProductID)
+	}
+
+	stock, err := db.ClaimLowDigitalDataStock(ctx, productIDs...)
+	if err != nil {
+		return err
+	}
+
+	if err := webhook.QueueDigitalStockLow(stock...); err != nil {
+		return err
+	}
+	for _, item := range stock {
+		if err := QueueStockLowLetter(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueStockShort alerts the admin by mail and webhook about the products a
+// paid cart is still missing keys of.
+func queueStockShort(ctx context.Context, cartID string) error {
+	shortage, err := queries.DB().DigitalDataShortage(ctx, cartID)
+	if err != nil {
+		return err
+	}
+
+	logging.New().Error().Str("cart", cartID).Int("products", len(shortage)).Msg("paid cart is missing keys")
+	if err := webhook.QueueDigitalStockShort(shortage...); err != nil {
+		return err
+	}
+	for _, item := range shortage {
+		if err := QueueStockLowLetter(&models.DigitalStock{ProductID: item.ProductID, Name: item.Name}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendStockLowLetter tells the admin that a product is running out of keys.
+func SendStockLowLetter(ctx context.Context, stock *models.DigitalStock) error {
+	db := queries.DB()
+
+	setting, err := db.GetSettingByKey(ctx, "site_name", "email", "mail_letter_stock_low")
+	if err != nil {
+		return err
+	}
+
+	letter := &models.MessageMail{
+		To: setting["email"].Value.(string),
+		Data: map[string]string{
+			"Site_Name":    setting["site_name"].Value.(string),
+			"Product_Name": stock.Name,
+			"Remaining":    strconv.Itoa(stock.Remaining),
+		},
+	}
+	if err := json.Unmarshal([]byte(setting["mail_letter_stock_low"].Value.(string)), &letter.Letter); err != nil {
+		return err
+	}
+
+	mailSetting, err := queries.GetSettingByGroup[models.Mail](ctx, db)
+	if err != nil {
+		return err
+	}
+
+	// Ensure sender email is set (use user email as fallback if not configured)
+	if err := ensureSenderEmail(ctx, db, mailSetting); err != nil {
+		return err
+	}
+
+	return SendMail(ctx, mailSetting, letter)
+}
+
+// SendSignInLetter sends a buyer the one-time link to the customer portal.
+func SendSignInLetter(ctx context.Context, email, token string) error {
+	db := queries.DB()
+
+	setting, err := db.GetSettingByKey(ctx, "site_name", "domain", "mail_letter_sign_in")
+	if err != nil {
+		return err
+	}
+
+	letter := &models.MessageMail{
+		To: email,
+		Data: map[string]string{
+			"Site_Name":   setting["site_name"].Value.(string),
+			"Sign_In_URL": fmt.Sprintf("https://%s/orders?token=%s", setting["domain"].Value.(string), token),
+		},
+	}
+	if err := json.Unmarshal([]byte(setting["mail_letter_sign_in"].Value.(string)), &letter.Letter); err != nil {
+		return err
+	}
+
+	mailSetting, err := queries.GetSettingByGroup[models.Mail](ctx, db)
+	if err != nil {
+		return err
+	}
+
+	// Ensure sender email is set (use user email as fallback if not configured)
+	if err := ensureSenderEmail(ctx, db, mailSetting); err != nil {
+		return err
+	}
+
+	return SendMail(ctx, mailSetting, letter)
+}
+
+// SendUpdateLetter tells the buyer of a paid cart about the current version
+// of a product, with fresh links to its files.
+func SendUpdateLetter(ctx context.Context, cartID, productID string) error {
+	db := queries.DB()
+
+	letter, err := db.CartLetterUpdate(ctx, cartID, productID)
+	if err != nil {
+		return err
+	}
+
+	mailSetting, err := queries.GetSettingByGroup[models.Mail](ctx, db)
+	if err != nil {
+		return err
+	}
+
+	// Ensure sender email is set (use user email as fallback if not configured)
+	if err := ensureSenderEmail(ctx, db, mailSetting); err != nil {
+		return err
+	}
+
+	return SendMail(ctx, mailSetting, letter)
+}
+
+// SendShippedLetter sends the buyer the shipped letter with the tracking of a cart.
+func SendShippedLetter(ctx context.Context, cartID string) error {
+	db := queries.DB()
+
+	letter, err := db.CartLetterShipped(ctx, cartID)
+	if err != nil {
+		return err
+	}
+
+	mailSetting, err := queries.GetSettingByGroup[models.Mail](ctx, db)
+	if err != nil {
+		return err
+	}
+
+	// Ensure sender email is set (use user email as fallback if not configured)
+	if err := ensureSenderEmail(ctx, db, mailSetting); err != nil {
+		return err
+	}
+
+	return SendMail(ctx, mailSetting, letter)
+}
@@ -2,6 +2,7 @@ package mailer
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"text/template"
 	"time"
@@ -18,7 +19,8 @@ var EncryptionTypes = map[string]mailer.Encryption{
 }
 
 // SendMail sends an email using the provided SMTP settings and message data.
-func SendMail(smtp *models.Mail, mail *models.MessageMail) error {
+// The SMTP timeouts are cut to what is left of the ctx deadline.
+func SendMail(ctx context.Context, smtp *models.Mail, mail *models.MessageMail) error {
 	// Validate SMTP settings before attempting connection
 	if smtp.SMTP.Host == "" || smtp.SMTP.Port <= 0 || smtp.SMTP.Username == "" || smtp.SMTP.Password == "" {
 		return fmt.Errorf("invalid SMTP settings: host, port, username, and password are required")
@@ -36,9 +38,17 @@ func SendMail(smtp *models.Mail, mail *models.MessageMail) error {
 	server.Password = smtp.SMTP.Password
 	server.Encryption = EncryptionTypes[smtp.SMTP.Encryption]
 
+	timeout := 10 * time.Second
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	server.KeepAlive = false
-	server.ConnectTimeout = 10 * time.Second
-	server.SendTimeout = 10 * time.Second
+	server.ConnectTimeout = timeout
+	server.SendTimeout = timeout
 
 	smtpClient, err := server.Connect()
 	if err != nil {
@@ -65,15 +75,6 @@ func SendMail(smtp *models.Mail, mail *models.MessageMail) error {
 	email.SetBodyData(mailer.TextPlain, bodyText)
 	// email.AddAlternativeData(mail.TextPlain, "Hello Gophers!")
 
-	if len(mail.Files) > 0 {
-		for _, file := range mail.Files {
-			email.Attach(&mailer.File{
-				FilePath: fmt.Sprintf("./lc_digitals/%s.%s", file.Name, file.Ext),
-				Name:     file.OrigName,
-			})
-		}
-	}
-
 	if err := email.Send(smtpClient); err != nil {
 		return err
 	}
@@ -1,28 +1,106 @@
 package models
 
-import "github.com/shurco/litecart/pkg/litepay"
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+
+	"github.com/shurco/litecart/pkg/litepay"
+)
 
 // Cart is ...
 type Cart struct {
 	Core
-	Email         string                `json:"email"`
-	Cart          []CartProduct         `json:"cart,omitempty"`
-	AmountTotal   int                   `json:"amount_total"`
-	Currency      string                `json:"currency"`
-	PaymentID     string                `json:"payment_id"`
-	PaymentStatus litepay.Status        `json:"payment_status"`
-	PaymentSystem litepay.PaymentSystem `json:"payment_system"`
+	Email          string                `json:"email"`
+	Cart           []CartProduct         `json:"cart,omitempty"`
+	AmountTotal    int                   `json:"amount_total"`
+	AmountRefunded int                   `json:"amount_refunded"`
+	Currency       string                `json:"currency"`
+	PaymentID      string                `json:"payment_id"`
+	PaymentStatus  litepay.Status        `json:"payment_status"`
+	PaymentSystem  litepay.PaymentSystem `json:"payment_system"`
+	Shipping       *CartShipping         `json:"shipping,omitempty"` // only for carts with physical products
+}
+
+// CartStatusSource is ...
+type CartStatusSource string
+
+const (
+	CartSourceCallback CartStatusSource = "callback" // provider notification
+	CartSourceSuccess  CartStatusSource = "success"  // success redirect
+	CartSourceCancel   CartStatusSource = "cancel"   // cancel redirect
+	CartSourceAdmin    CartStatusSource = "admin"    // admin panel
+)
+
+// CartStatusHistory is ...
+type CartStatusHistory struct {
+	ID      string           `json:"id"`
+	From    litepay.Status   `json:"from"`
+	To      litepay.Status   `json:"to"`
+	Source  CartStatusSource `json:"source"`
+	Created int64            `json:"created"`
 }
 
 // CartProduct is ...
 type CartProduct struct {
 	ProductID string `json:"id"`
+	VariantID string `json:"variant_id,omitempty"`
 	Quantity  int    `json:"quantity"`
 }
 
+// Validate is ...
+func (v CartProduct) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.ProductID, validation.Required),
+		validation.Field(&v.Quantity, validation.Required, validation.Min(1)),
+	)
+}
+
 // CartPayment is ...
 type CartPayment struct {
-	Email    string                `json:"email"`
-	Provider litepay.PaymentSystem `json:"provider"`
-	Products []CartProduct         `json:"products"`
+	Email           string                `json:"email"`
+	Provider        litepay.PaymentSystem `json:"provider"`
+	Products        []CartProduct         `json:"products"`
+	ShippingAddress *Address              `json:"shipping_address,omitempty"` // required if a product is physical
+	ShippingRateID  string                `json:"shipping_rate_id,omitempty"`
+}
+
+// Validate is ...
+func (v CartPayment) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.Products, validation.Required, validation.Each(validation.Required)),
+	)
+}
+
+// CartShippingQuote asks for the shipping rates of a cart.
+type CartShippingQuote struct {
+	Country  string        `json:"country"`
+	Products []CartProduct `json:"products"`
+}
+
+// Validate is ...
+func (v CartShippingQuote) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.Country, validation.Required, is.CountryCode2, is.UpperCase),
+		validation.Field(&v.Products, validation.Required, validation.Each(validation.Required)),
+	)
+}
+
+// IdempotencyKey is ...
+type IdempotencyKey struct {
+	Key         string `json:"key"`
+	RequestHash string `json:"request_hash"`
+	CartID      string `json:"cart_id"`
+	PaymentURL  string `json:"payment_url"`
+}
+
+// CartRefund is ...
+type CartRefund struct {
+	Amount int `json:"amount"` // 0 refunds the remaining amount
+}
+
+// Validate is ...
+func (v CartRefund) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.Amount, validation.Min(0)),
+	)
 }
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"errors"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+
+	"github.com/shurco/litecart/pkg/strutil"
+)
+
+// Category groups products in the catalogue. Categories nest under a
+// parent, and a product filed under a category is also listed in all of
+// the categories above it.
+type Category struct {
+	ID          string      `json:"id"`
+	ParentID    string      `json:"parent_id,omitempty"`
+	Name        string      `json:"name"`
+	Slug        string      `json:"slug"`
+	Description string      `json:"description,omitempty"`
+	Seo         *Seo        `json:"seo,omitempty"`
+	Position    int         `json:"position"`
+	Products    int         `json:"products"` // products filed directly under the category
+	Children    []*Category `json:"children,omitempty"`
+	Created     int64       `json:"created,omitempty"`
+	Updated     int64       `json:"updated,omitempty"`
+}
+
+// Validate is ...
+func (v Category) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.ParentID, validation.Length(15, 15)),
+		validation.Field(&v.Name, validation.Required, validation.Length(1, 50)),
+		validation.Field(&v.Slug, validation.Required, validation.Length(2, 50)),
+		validation.Field(&v.Description, validation.Length(0, 1000)),
+		validation.Field(&v.Position, validation.Min(0)),
+		validation.Field(&v.Seo),
+	)
+}
+
+// CategoryTree nests a flat list of categories under their parents. The
+// order of the list is kept on every level.
+func CategoryTree(categories []*Category) []*Category {
+	byID := make(map[string]*Category, len(categories))
+	for _, category := range categories {
+		byID[category.ID] = category
+	}
+
+	tree := []*Category{}
+	for _, category := range categories {
+		if parent, ok := byID[category.ParentID]; ok {
+			parent.Children = append(parent.Children, category)
+			continue
+		}
+		tree = append(tree, category)
+	}
+	return tree
+}
+
+// Tag is a free-form label of products. Its slug is made from the name.
+type Tag struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Slug     string `json:"slug"`
+	Products int    `json:"products,omitempty"`
+	Created  int64  `json:"created,omitempty"`
+}
+
+// Validate is ...
+func (v Tag) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.Name, validation.Required, validation.Length(1, 30), validation.By(func(any) error {
+			if strutil.Slugify(v.Name) == "" {
+				return errors.New("must contain a letter or a digit")
+			}
+			return nil
+		})),
+	)
+}
+
+// ProductFilter narrows a list of products. Empty fields do not filter.
+type ProductFilter struct {
+	Category  string // slug, subcategories are included
+	Tag       string // slug
+	MinAmount int    // the product or one of its variants costs at least this
+	MaxAmount int    // and at most this, 0 is no limit
+}
+
+// Validate is ...
+func (v ProductFilter) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.MinAmount, validation.Min(0)),
+		validation.Field(&v.MaxAmount, validation.Min(0), validation.When(v.MaxAmount > 0, validation.Min(v.MinAmount))),
+	)
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+)
+
+// CustomerSignIn is what a buyer sends to get a sign-in link by mail.
+type CustomerSignIn struct {
+	Email string `json:"email"`
+}
+
+// Validate is ...
+func (v CustomerSignIn) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.Email, validation.Required, is.Email),
+	)
+}
+
+// CustomerSession is what a buyer sends to exchange the sign-in link for a session.
+type CustomerSession struct {
+	Token string `json:"token"`
+}
+
+// Validate is ...
+func (v CustomerSession) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.Token, validation.Required, validation.Length(1, 255)),
+	)
+}
+
+// CustomerOrder is a paid cart as the buyer sees it in the portal.
+type CustomerOrder struct {
+	ID            string          `json:"id"`
+	AmountTotal   int             `json:"amount_total"`
+	Currency      string          `json:"currency"`
+	PaymentSystem string          `json:"payment_system"`
+	Created       int64           `json:"created"`
+	Items         []*CustomerItem `json:"items"`
+	Shipping      *CartShipping   `json:"shipping,omitempty"`
+}
+
+// CustomerItem is a product of a paid cart with what the buyer got for it.
+type CustomerItem struct {
+	ProductID string          `json:"product_id"`
+	Name      string          `json:"name"`
+	Slug      string          `json:"slug"`
+	Quantity  int             `json:"quantity"`
+	Variants  []string        `json:"variants,omitempty"` // names of the variants bought
+	Digital   string          `json:"digital"`
+	Keys      []string        `json:"keys,omitempty"`
+	Files     []*CustomerFile `json:"files,omitempty"`
+	Access    string          `json:"access,omitempty"`
+}
+
+// CustomerFile is a purchased file with a fresh download link.
+type CustomerFile struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
@@ -0,0 +1,13 @@
+package models
+
+// Download is ...
+type Download struct {
+	ID        string `json:"id"`
+	CartID    string `json:"cart_id"`
+	FileID    string `json:"file_id"`
+	FileName  string `json:"file_name"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Counted   bool   `json:"counted"` // false once the counter of the cart is reset
+	Created   int64  `json:"created"`
+}
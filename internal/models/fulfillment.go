@@ -0,0 +1,25 @@
+package models
+
+// Fulfillment is ...
+type Fulfillment struct {
+	ID        string `json:"id"`
+	CartID    string `json:"cart_id"`
+	ProductID string `json:"product_id"`
+	Content   string `json:"content"`         // response of the fulfillment URL, empty until it succeeds
+	Error     string `json:"error,omitempty"` // error of the last failed attempt
+	Attempts  int    `json:"attempts"`
+	Letter    string `json:"letter,omitempty"` // letter the content went out in: "purchase" or "access", empty until it is sent
+	Created   int64  `json:"created"`
+	Updated   int64  `json:"updated,omitempty"`
+}
+
+// Letters the content of a fulfillment is sent to the buyer in.
+const (
+	FulfillmentLetterPurchase = "purchase" // the purchase letter, when the content was there in time
+	FulfillmentLetterAccess   = "access"   // the follow-up letter, when it came later
+)
+
+// Done reports whether the fulfillment URL has answered.
+func (v Fulfillment) Done() bool {
+	return v.Content != ""
+}
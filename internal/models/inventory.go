@@ -0,0 +1,58 @@
+package models
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// Reasons for a stock movement.
+const (
+	StockMovementSale       = "sale"
+	StockMovementAdjustment = "adjustment"
+)
+
+// StockLevel is the stock of a product, or of one of its variants if
+// VariantID is set.
+type StockLevel struct {
+	VariantID string `json:"variant_id,omitempty"`
+	Name      string `json:"name"`
+	Stock     *int   `json:"stock"`    // nil is not tracked
+	Reserved  int    `json:"reserved"` // held by carts that are not paid yet
+}
+
+// StockMovement is a change of the stock of a product or of one of its
+// variants.
+type StockMovement struct {
+	ID        string `json:"id"`
+	ProductID string `json:"product_id"`
+	VariantID string `json:"variant_id,omitempty"`
+	Change    int    `json:"change"`
+	Stock     int    `json:"stock"` // after the change
+	Reason    string `json:"reason"`
+	CartID    string `json:"cart_id,omitempty"`
+	Note      string `json:"note,omitempty"`
+	Created   int64  `json:"created"`
+}
+
+// Inventory is the stock of a product and its variants with the latest
+// movements.
+type Inventory struct {
+	Levels    []StockLevel    `json:"levels"` // the product first, then its variants
+	Movements []StockMovement `json:"movements"`
+}
+
+// StockAdjustment is a manual change of the stock made in the admin panel.
+// Stock that is not tracked yet starts from 0.
+type StockAdjustment struct {
+	VariantID string `json:"variant_id"`
+	Change    int    `json:"change"`
+	Note      string `json:"note"`
+}
+
+// Validate is ...
+func (v StockAdjustment) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.VariantID, validation.Length(15, 15)),
+		validation.Field(&v.Change, validation.Required),
+		validation.Field(&v.Note, validation.Length(0, 200)),
+	)
+}
@@ -0,0 +1,23 @@
+package models
+
+// JobStatus is ...
+type JobStatus string
+
+const (
+	JobPending JobStatus = "pending" // waiting for run_at
+	JobRunning JobStatus = "running" // claimed by a worker
+	JobDone    JobStatus = "done"
+	JobDead    JobStatus = "dead" // out of attempts, waits for a manual retry
+)
+
+// Job is ...
+type Job struct {
+	Core
+	Kind        string    `json:"kind"`
+	Payload     string    `json:"payload"`
+	Status      JobStatus `json:"status"`
+	Attempts    int       `json:"attempts"`
+	MaxAttempts int       `json:"max_attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+	RunAt       int64     `json:"run_at"`
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// LicenseRequest is what a client sends to activate, validate or deactivate a key.
+type LicenseRequest struct {
+	Key         string `json:"key"`
+	ProductID   string `json:"product_id,omitempty"` // needed only if several products sell the same key
+	Fingerprint string `json:"fingerprint"`          // identifies the machine
+	Name        string `json:"name,omitempty"`       // machine name shown to the admin
+}
+
+// Validate is ...
+func (v LicenseRequest) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.Key, validation.Required, validation.Length(1, DataContentMaxLength)),
+		validation.Field(&v.ProductID, validation.Length(15, 15)),
+		validation.Field(&v.Fingerprint, validation.Required, validation.Length(1, 255)),
+		validation.Field(&v.Name, validation.Length(0, 255)),
+	)
+}
+
+// License is the state of a key on one machine, signed for the client.
+type License struct {
+	Key             string `json:"key"`
+	ProductID       string `json:"product_id"`
+	Fingerprint     string `json:"fingerprint"`
+	Activations     int    `json:"activations"`      // machines the key is active on
+	ActivationLimit int    `json:"activation_limit"` // 0 is unlimited
+	Activated       int64  `json:"activated"`
+	Issued          int64  `json:"issued"`
+}
+
+// SignedLicense carries a license with its Ed25519 signature. The signature
+// covers the payload bytes, which are the license encoded as JSON.
+type SignedLicense struct {
+	License   *License `json:"license"`
+	Payload   string   `json:"payload"`   // base64 of the signed JSON
+	Signature string   `json:"signature"` // base64 Ed25519 signature of the payload bytes
+}
+
+// LicenseActivation is a machine a key is activated on.
+type LicenseActivation struct {
+	ID          string `json:"id"`
+	DataID      string `json:"data_id"`
+	Fingerprint string `json:"fingerprint"`
+	Name        string `json:"name"`
+	IP          string `json:"ip"`
+	Created     int64  `json:"created"`
+	Validated   int64  `json:"validated"`
+}
@@ -12,6 +12,20 @@ type Products struct {
 	Products []Product `json:"products"`
 }
 
+// ProductMatches is a page of products found by a search, best match first.
+type ProductMatches struct {
+	Total    int            `json:"total"`
+	Currency string         `json:"currency"`
+	Products []ProductMatch `json:"products"`
+}
+
+// ProductMatch is a product found by a search. Snippet is the matching text
+// as escaped HTML, the matched words wrapped in <mark>.
+type ProductMatch struct {
+	Product
+	Snippet string `json:"snippet"`
+}
+
 // Product is ...
 type Product struct {
 	Core
@@ -23,7 +37,14 @@ type Product struct {
 	Amount      int        `json:"amount"`
 	Metadata    []Metadata `json:"metadata,omitempty"`
 	Attributes  []string   `json:"attributes,omitempty"`
+	Variants    []Variant  `json:"variants,omitempty"`
+	Categories  []Category `json:"categories,omitempty"`
+	Tags        []Tag      `json:"tags,omitempty"`
 	Digital     Digital    `json:"digital,omitempty"`
+	Physical    bool       `json:"physical"`         // shipped to the buyer, digital content is optional
+	Weight      int        `json:"weight,omitempty"` // grams, used to pick a shipping rate
+	Stock       *int       `json:"stock,omitempty"`  // units left to buy, capped by the unused keys of "data" products, nil is not tracked
+	InStock     bool       `json:"in_stock"`
 	Active      bool       `json:"active"`
 	Seo         *Seo       `json:"seo,omitempty"`
 }
@@ -39,11 +60,38 @@ func (v Product) Validate() error {
 		validation.Field(&v.Amount, validation.Required, validation.Min(0)),
 		validation.Field(&v.Metadata),
 		validation.Field(&v.Attributes, validation.Each(validation.Length(3, 254))),
-		validation.Field(&v.Digital),
+		validation.Field(&v.Variants),
+		validation.Field(&v.Digital, validation.Skip.When(v.Physical && v.Digital.Type == "")),
+		validation.Field(&v.Weight, validation.Min(0)),
+		validation.Field(&v.Stock, validation.Min(0)),
 		validation.Field(&v.Seo),
 	)
 }
 
+// Variant is an option of a product with its own price. Digital files and
+// keys can be tied to a variant, the ones that are not are shared by all
+// variants of the product.
+type Variant struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Amount   int    `json:"amount"`
+	SKU      string `json:"sku,omitempty"`
+	Position int    `json:"position"`
+	Stock    *int   `json:"stock,omitempty"` // units left to buy, capped by the stock of the product and the keys of "data" products
+	Created  int64  `json:"created,omitempty"`
+}
+
+// Validate is ...
+func (v Variant) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.ID, validation.Length(15, 15)),
+		validation.Field(&v.Name, validation.Required, validation.Length(1, 50)),
+		validation.Field(&v.Amount, validation.Min(0)),
+		validation.Field(&v.SKU, validation.Length(0, 64)),
+		validation.Field(&v.Position, validation.Min(0)),
+	)
+}
+
 // Metadata is ...
 type Metadata struct {
 	Key   string `json:"key"`
@@ -60,10 +108,18 @@ func (v Metadata) Validate() error {
 
 // Digital is ...
 type Digital struct {
-	Type   string `json:"type"`
-	Filled bool   `json:"filled,omitempty"`
-	Files  []File `json:"files,omitempty"`
-	Data   []Data `json:"data,omitempty"`
+	Type             string    `json:"type"`
+	Filled           bool      `json:"filled,omitempty"`
+	Files            []File    `json:"files,omitempty"`
+	Versions         []Version `json:"versions,omitempty"`
+	Data             []Data    `json:"data,omitempty"`
+	DownloadLimit    int       `json:"download_limit"`    // downloads of each file per cart, 0 is unlimited
+	DownloadLifetime int       `json:"download_lifetime"` // hours a download link is valid, 0 is the default
+	StockThreshold   int       `json:"stock_threshold"`   // unused keys at or below which the admin is alerted, 0 is the default
+	ActivationLimit  int       `json:"activation_limit"`  // machines each key can be activated on, 0 is unlimited
+
+	FulfillmentURL    string `json:"fulfillment_url,omitempty"`    // called for "api" products after payment
+	FulfillmentSecret string `json:"fulfillment_secret,omitempty"` // signs fulfillment requests, empty keeps the current one
 }
 
 // Validate is ...
@@ -71,16 +127,24 @@ func (v Digital) Validate() error {
 	return validation.ValidateStruct(&v,
 		validation.Field(&v.Type, validation.Required, validation.In("file", "data", "api")),
 		validation.Field(&v.Files),
-		validation.Field(&v.Data, validation.Each(validation.Length(1, 254))),
+		validation.Field(&v.Data, validation.Each(validation.Length(1, DataContentMaxLength))),
+		validation.Field(&v.DownloadLimit, validation.Min(0)),
+		validation.Field(&v.DownloadLifetime, validation.Min(0)),
+		validation.Field(&v.StockThreshold, validation.Min(0)),
+		validation.Field(&v.ActivationLimit, validation.Min(0)),
+		validation.Field(&v.FulfillmentURL, is.URL),
+		validation.Field(&v.FulfillmentSecret, validation.Length(32, 128)),
 	)
 }
 
 // File is ...
 type File struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	Ext      string `json:"ext"`
-	OrigName string `json:"orig_name,omitempty"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Ext       string `json:"ext"`
+	OrigName  string `json:"orig_name,omitempty"`
+	VersionID string `json:"version_id,omitempty"`
+	VariantID string `json:"variant_id,omitempty"`
 }
 
 // Validate is ...
@@ -92,18 +156,85 @@ func (v File) Validate() error {
 	)
 }
 
+// Version is a release of the files of a product. A version is a draft until
+// it is released, and buyers get the files of the current version.
+type Version struct {
+	ID        string `json:"id"`
+	Version   string `json:"version"`
+	Changelog string `json:"changelog"`
+	Current   bool   `json:"current"`
+	Released  int64  `json:"released,omitempty"`
+	Notified  int64  `json:"notified,omitempty"`
+	Created   int64  `json:"created"`
+}
+
+// Validate is ...
+func (v Version) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.Version, validation.Required, validation.Length(1, 50)),
+		validation.Field(&v.Changelog, validation.Length(0, 10000)),
+	)
+}
+
+// DataContentMaxLength is the longest key a "data" product can hold.
+const DataContentMaxLength = 1024
+
 // Data is ...
 type Data struct {
-	ID      string `json:"id"`
-	Content string `json:"content"`
-	CartID  string `json:"cart_id"`
+	ID          string `json:"id"`
+	Content     string `json:"content"`
+	CartID      string `json:"cart_id"`
+	VariantID   string `json:"variant_id,omitempty"`
+	Activations int    `json:"activations,omitempty"` // machines the key is activated on
 }
 
 // Validate is ...
 func (v Data) Validate() error {
 	return validation.ValidateStruct(&v,
 		validation.Field(&v.ID, validation.Length(15, 15)),
-		validation.Field(&v.Content, validation.Length(1, 254)),
+		validation.Field(&v.Content, validation.Length(1, DataContentMaxLength)),
 		// validation.Field(&v.Ext, validation.In("jpeg", "png")),
 	)
 }
+
+// DataLine is a key read from an import file with its line number.
+type DataLine struct {
+	Line    int    `json:"line"`
+	Content string `json:"content"`
+	Reason  string `json:"reason,omitempty"` // why the key was skipped
+}
+
+// DataImport is the report of a bulk key import.
+type DataImport struct {
+	DryRun     bool       `json:"dry_run"`
+	Total      int        `json:"total"`
+	Added      int        `json:"added"` // keys added, or that would be added on a dry run
+	Duplicates int        `json:"duplicates"`
+	Invalid    int        `json:"invalid"`
+	Skipped    []DataLine `json:"skipped"`
+}
+
+// DataExport is a key of a "data" product with the cart it went to.
+type DataExport struct {
+	Content string `json:"content"`
+	Status  string `json:"status"` // unused, reserved or sold
+	CartID  string `json:"cart_id"`
+	Email   string `json:"email"`
+}
+
+// DigitalShortage is a "data" product of a paid cart that is still missing
+// keys, because they were sold to another cart after its reservation expired.
+type DigitalShortage struct {
+	CartID    string `json:"cart_id"`
+	ProductID string `json:"product_id"`
+	Name      string `json:"name"`
+	Missing   int    `json:"missing"`
+}
+
+// DigitalStock is the number of unused keys left for a product.
+type DigitalStock struct {
+	ProductID string `json:"product_id"`
+	Name      string `json:"name"`
+	Remaining int    `json:"remaining"`
+	Threshold int    `json:"threshold"`
+}
@@ -7,9 +7,10 @@ import (
 
 // Main is ...
 type Main struct {
-	SiteName string `json:"site_name"`
-	Domain   string `json:"domain"`
-	Email    string `json:"email"`
+	SiteName    string `json:"site_name"`
+	Domain      string `json:"domain"`
+	Email       string `json:"email"`
+	FreeUpdates bool   `json:"free_updates"` // buyers of files get every new version, not only the one they paid for
 }
 
 // Validate is ...
@@ -50,33 +51,43 @@ func (v Password) Validate() error {
 
 // Payment is ...
 type Payment struct {
-	Currency string `json:"currency"`
+	Currency         string `json:"currency"`
+	StockReservation int    `json:"stock_reservation"` // minutes the stock and keys are held for a cart that is not paid yet
 }
 
 // Validate is ...
 func (v Payment) Validate() error {
 	return validation.ValidateStruct(&v,
 		validation.Field(&v.Currency, is.CurrencyCode),
+		validation.Field(&v.StockReservation, validation.Required, validation.Min(1), validation.Max(10080)),
 	)
 }
 
 // Stripe is ...
 type Stripe struct {
-	SecretKey string `json:"secret_key"`
-	Active    bool   `json:"active"`
+	SecretKey     string `json:"secret_key"`
+	WebhookSecret string `json:"webhook_secret_key"`
+	Active        bool   `json:"active"`
 }
 
 // Validate is ...
 func (v Stripe) Validate() error {
 	return validation.ValidateStruct(&v,
 		validation.Field(&v.SecretKey, validation.Length(100, 130)),
+		validation.Field(&v.WebhookSecret, validation.Length(30, 130)),
 	)
 }
 
+// Enabled is ...
+func (v Stripe) Enabled() bool {
+	return v.Active
+}
+
 // Paypal is ...
 type Paypal struct {
 	ClientID  string `json:"client_id"`
 	SecretKey string `json:"secret_key"`
+	WebhookID string `json:"webhook_id"`
 	Active    bool   `json:"active"`
 }
 
@@ -88,11 +99,17 @@ func (v Paypal) Validate() error {
 	)
 }
 
+// Enabled is ...
+func (v Paypal) Enabled() bool {
+	return v.Active
+}
+
 // Spectrocoin is ...
 type Spectrocoin struct {
 	MerchantID string `json:"merchant_id"`
 	ProjectID  string `json:"project_id"`
 	PrivateKey string `json:"private_key"`
+	PublicKey  string `json:"public_key"`
 	Active     bool   `json:"active"`
 }
 
@@ -105,11 +122,22 @@ func (v Spectrocoin) Validate() error {
 	)
 }
 
+// Enabled is ...
+func (v Spectrocoin) Enabled() bool {
+	return v.Active
+}
+
 // Dummy is ...
 type Dummy struct {
 	Active bool `json:"active"`
 }
 
+// Enabled reports that the dummy provider is always available.
+// It is only allowed for free carts, which is checked at checkout.
+func (v Dummy) Enabled() bool {
+	return true
+}
+
 // PaymentSystem is ...
 type PaymentSystem struct {
 	Active      []string    `json:"active"`
@@ -128,16 +156,6 @@ func (v PaymentSystem) Validate() error {
 	)
 }
 
-type Webhook struct {
-	Url string `json:"url"`
-}
-
-// Validate is ...
-func (v Webhook) Validate() error {
-	return validation.ValidateStruct(&v,
-		validation.Field(&v.Url, is.URL))
-}
-
 type Social struct {
 	Facebook  string `json:"facebook,omitempty"`
 	Instagram string `json:"instagram,omitempty"`
@@ -230,7 +248,6 @@ type MessageMail struct {
 	To     string            `json:"to"`
 	Letter Letter            `json:"letter"`
 	Data   map[string]string `json:"data"`
-	Files  []File            `json:"files,omitempty"`
 }
 
 // Validate is ...
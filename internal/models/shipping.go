@@ -0,0 +1,122 @@
+package models
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+)
+
+// ShippingRate is a price for shipping the physical products of a cart.
+// A rate applies to the listed countries, or to every country if there are
+// none, and to carts weighing from MinWeight up to MaxWeight grams. A flat
+// rate leaves both weights at 0.
+type ShippingRate struct {
+	Core
+	Name      string   `json:"name"`
+	Countries []string `json:"countries"` // ISO 3166-1 alpha-2 codes
+	MinWeight int      `json:"min_weight"`
+	MaxWeight int      `json:"max_weight"` // 0 is no limit
+	Amount    int      `json:"amount"`
+	Position  int      `json:"position"`
+	Active    bool     `json:"active"`
+}
+
+// Validate is ...
+func (v ShippingRate) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.Name, validation.Required, validation.Length(1, 50)),
+		validation.Field(&v.Countries, validation.Each(validation.Required, is.CountryCode2, is.UpperCase)),
+		validation.Field(&v.MinWeight, validation.Min(0)),
+		validation.Field(&v.MaxWeight, validation.Min(0), validation.When(v.MaxWeight > 0, validation.Min(v.MinWeight))),
+		validation.Field(&v.Amount, validation.Min(0)),
+		validation.Field(&v.Position, validation.Min(0)),
+	)
+}
+
+// Applies reports whether the rate can ship a cart of the given weight to
+// the country.
+func (v ShippingRate) Applies(country string, weight int) bool {
+	if !v.Active || weight < v.MinWeight || (v.MaxWeight > 0 && weight > v.MaxWeight) {
+		return false
+	}
+	if len(v.Countries) == 0 {
+		return true
+	}
+	for _, code := range v.Countries {
+		if code == country {
+			return true
+		}
+	}
+	return false
+}
+
+// Address is ...
+type Address struct {
+	Name       string `json:"name"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2,omitempty"`
+	City       string `json:"city"`
+	State      string `json:"state,omitempty"`
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country"` // ISO 3166-1 alpha-2 code
+	Phone      string `json:"phone,omitempty"`
+}
+
+// Validate is ...
+func (v Address) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.Name, validation.Required, validation.Length(1, 100)),
+		validation.Field(&v.Line1, validation.Required, validation.Length(1, 200)),
+		validation.Field(&v.Line2, validation.Length(0, 200)),
+		validation.Field(&v.City, validation.Required, validation.Length(1, 100)),
+		validation.Field(&v.State, validation.Length(0, 100)),
+		validation.Field(&v.PostalCode, validation.Required, validation.Length(1, 20)),
+		validation.Field(&v.Country, validation.Required, is.CountryCode2, is.UpperCase),
+		validation.Field(&v.Phone, validation.Length(0, 30)),
+	)
+}
+
+// String returns the address as it is written on a parcel.
+func (v Address) String() string {
+	lines := []string{v.Name, v.Line1, v.Line2, v.City, v.State, v.PostalCode, v.Country, v.Phone}
+	out := ""
+	for _, line := range lines {
+		if line != "" {
+			out += line + "\n"
+		}
+	}
+	return out
+}
+
+// Shipment statuses of a cart with physical products.
+const (
+	ShipmentPending   = "pending"
+	ShipmentShipped   = "shipped"
+	ShipmentDelivered = "delivered"
+)
+
+// CartShipping is where and how the physical products of a cart are shipped.
+type CartShipping struct {
+	Address        Address `json:"address"`
+	Rate           string  `json:"rate"`
+	Amount         int     `json:"amount"`
+	Status         string  `json:"status"`
+	TrackingNumber string  `json:"tracking_number,omitempty"`
+	TrackingURL    string  `json:"tracking_url,omitempty"`
+	Shipped        int64   `json:"shipped,omitempty"`
+}
+
+// CartShipment is the fulfillment of a cart set in the admin panel.
+type CartShipment struct {
+	Status         string `json:"status"`
+	TrackingNumber string `json:"tracking_number"`
+	TrackingURL    string `json:"tracking_url"`
+}
+
+// Validate is ...
+func (v CartShipment) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.Status, validation.Required, validation.In(ShipmentPending, ShipmentShipped, ShipmentDelivered)),
+		validation.Field(&v.TrackingNumber, validation.Length(0, 100)),
+		validation.Field(&v.TrackingURL, is.URL),
+	)
+}
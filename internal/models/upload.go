@@ -0,0 +1,34 @@
+package models
+
+import (
+	"regexp"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+var sha256Hex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// DigitalUpload is a digital file that is uploaded in chunks.
+type DigitalUpload struct {
+	ID        string `json:"id"`
+	ProductID string `json:"product_id"`
+	VersionID string `json:"version_id,omitempty"` // version the file is added to, the current one if empty
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256,omitempty"` // hex checksum of the whole file, checked when the last chunk arrives
+	Offset    int64  `json:"offset"`           // bytes received so far
+	ChunkSize int64  `json:"chunk_size"`       // largest chunk the server accepts
+	Created   int64  `json:"created"`
+	Updated   int64  `json:"updated"`
+	File      *File  `json:"file,omitempty"` // the digital file, once the upload is complete
+}
+
+// Validate is ...
+func (v DigitalUpload) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.VersionID, validation.When(v.VersionID != "", validation.Length(15, 15))),
+		validation.Field(&v.Name, validation.Required, validation.Length(1, 255)),
+		validation.Field(&v.Size, validation.Required, validation.Min(int64(1))),
+		validation.Field(&v.SHA256, validation.Match(sha256Hex).Error("must be a lowercase hex SHA-256 checksum")),
+	)
+}
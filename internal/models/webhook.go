@@ -0,0 +1,48 @@
+package models
+
+import (
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+)
+
+// WebhookEndpoint is ...
+type WebhookEndpoint struct {
+	Core
+	Url    string   `json:"url"`
+	Secret string   `json:"secret"` // signs deliveries with HMAC-SHA256
+	Active bool     `json:"active"`
+	Events []string `json:"events"` // "*" subscribes to every event
+}
+
+// Validate is ...
+func (v WebhookEndpoint) Validate() error {
+	return validation.ValidateStruct(&v,
+		validation.Field(&v.Url, validation.Required, is.URL),
+		validation.Field(&v.Secret, validation.Length(32, 128)),
+		validation.Field(&v.Events, validation.Required),
+	)
+}
+
+// Subscribed reports whether the endpoint receives the event.
+func (v WebhookEndpoint) Subscribed(event string) bool {
+	for _, e := range v.Events {
+		if e == "*" || e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is ...
+type WebhookDelivery struct {
+	ID           string `json:"id"`
+	EventID      string `json:"event_id"`
+	Event        string `json:"event"`
+	EndpointID   string `json:"endpoint_id"`
+	Url          string `json:"url"`
+	Request      string `json:"request"`
+	ResponseCode int    `json:"response_code"`
+	ResponseBody string `json:"response_body"`
+	Error        string `json:"error,omitempty"`
+	Created      int64  `json:"created"`
+}
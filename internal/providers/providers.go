@@ -0,0 +1,69 @@
+// Package providers registers the built-in litepay payment providers together
+// with the settings models litecart stores for them.
+//
+// Custom providers register themselves the same way from their own package,
+// which is then imported for its side effects.
+package providers
+
+import (
+	"net/url"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/pkg/litepay"
+)
+
+func init() {
+	litepay.Register(litepay.Provider{
+		Name:     litepay.STRIPE,
+		Settings: func() litepay.Settings { return &models.Stripe{} },
+		New: func(cfg litepay.Cfg, s litepay.Settings) litepay.LitePay {
+			return cfg.Stripe(s.(*models.Stripe).SecretKey)
+		},
+		Callback: func(s litepay.Settings, n *litepay.Notification) (*litepay.Payment, error) {
+			return litepay.StripeWebhook(n, s.(*models.Stripe).WebhookSecret)
+		},
+		Checkout: func(session litepay.LitePay, payment *litepay.Payment, query url.Values) (*litepay.Payment, error) {
+			return session.Checkout(payment, query.Get("session"))
+		},
+	})
+
+	litepay.Register(litepay.Provider{
+		Name:     litepay.PAYPAL,
+		Settings: func() litepay.Settings { return &models.Paypal{} },
+		New: func(cfg litepay.Cfg, s litepay.Settings) litepay.LitePay {
+			setting := s.(*models.Paypal)
+			return cfg.Paypal(setting.ClientID, setting.SecretKey)
+		},
+		Callback: func(s litepay.Settings, n *litepay.Notification) (*litepay.Payment, error) {
+			setting := s.(*models.Paypal)
+			return litepay.PaypalWebhook(n, setting.ClientID, setting.SecretKey, setting.WebhookID)
+		},
+		Checkout: func(session litepay.LitePay, payment *litepay.Payment, query url.Values) (*litepay.Payment, error) {
+			return session.Checkout(payment, query.Get("token"))
+		},
+	})
+
+	litepay.Register(litepay.Provider{
+		Name:     litepay.SPECTROCOIN,
+		Settings: func() litepay.Settings { return &models.Spectrocoin{} },
+		New: func(cfg litepay.Cfg, s litepay.Settings) litepay.LitePay {
+			setting := s.(*models.Spectrocoin)
+			return cfg.Spectrocoin(setting.MerchantID, setting.ProjectID, setting.PrivateKey)
+		},
+		Callback: func(s litepay.Settings, n *litepay.Notification) (*litepay.Payment, error) {
+			setting := s.(*models.Spectrocoin)
+			return litepay.SpectrocoinCallback(n, setting.MerchantID, setting.ProjectID, setting.PublicKey)
+		},
+	})
+
+	litepay.Register(litepay.Provider{
+		Name:     litepay.DUMMY,
+		Settings: func() litepay.Settings { return &models.Dummy{} },
+		New: func(cfg litepay.Cfg, _ litepay.Settings) litepay.LitePay {
+			return cfg.Dummy()
+		},
+		Checkout: func(session litepay.LitePay, payment *litepay.Payment, _ url.Values) (*litepay.Payment, error) {
+			return session.Checkout(payment, "")
+		},
+	})
+}
@@ -5,12 +5,13 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/shurco/litecart/internal/models"
 	"github.com/shurco/litecart/pkg/errors"
 	"github.com/shurco/litecart/pkg/litepay"
+	"github.com/shurco/litecart/pkg/security"
 )
 
 // CartQueries is a struct that embeds a pointer to an sql.DB.
@@ -19,43 +20,34 @@ type CartQueries struct {
 	*sql.DB
 }
 
-// PaymentList retrieves the status of different payment methods from the database.
+// PaymentList retrieves the status of the registered payment providers from the database.
 func (q *CartQueries) PaymentList(ctx context.Context) (map[string]bool, error) {
 	payments := map[string]bool{}
-	keys := []any{
-		"stripe_active", "paypal_active", "spectrocoin_active",
-	}
 
-	query := fmt.Sprintf("SELECT key, value FROM setting WHERE key IN (%s)", strings.Repeat("?, ", len(keys)-1)+"?")
-	rows, err := q.DB.QueryContext(ctx, query, keys...)
-	if err != nil {
-		return nil, err
-	}
-	defer func() { _ = rows.Close() }()
-
-	for rows.Next() {
-		var key, value string
-		err := rows.Scan(&key, &value)
-		if err != nil {
-			return nil, err
-		}
-
-		vBool, err := strconv.ParseBool(value)
-		if err != nil {
+	for _, provider := range litepay.Providers() {
+		setting := provider.Settings()
+		if _, err := db.GetSettingByGroup(ctx, setting); err != nil {
 			return nil, err
 		}
-		name := strings.ReplaceAll(key, "_active", "")
-		payments[name] = vBool
+		payments[string(provider.Name)] = setting.Enabled()
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
+	return payments, nil
+}
+
+// PaymentProvider returns the registered payment provider with its settings loaded from the database.
+func (q *CartQueries) PaymentProvider(ctx context.Context, name litepay.PaymentSystem) (litepay.Provider, litepay.Settings, error) {
+	provider, ok := litepay.Lookup(name)
+	if !ok {
+		return litepay.Provider{}, nil, errors.ErrProviderNotFound
 	}
 
-	// Dummy provider is always active (no database check needed)
-	payments["dummy"] = true
+	setting := provider.Settings()
+	if _, err := db.GetSettingByGroup(ctx, setting); err != nil {
+		return litepay.Provider{}, nil, err
+	}
 
-	return payments, nil
+	return provider, setting, nil
 }
 
 // Carts retrieves a list of carts from the database.
@@ -67,6 +59,7 @@ func (q *CartQueries) Carts(ctx context.Context, limit, offset int) ([]*models.C
 		id,
 		email,
 		amount_total,
+		amount_refunded,
 		currency,
 		payment_id,
 		payment_status,
@@ -103,6 +96,7 @@ func (q *CartQueries) Carts(ctx context.Context, limit, offset int) ([]*models.C
 			&cart.ID,
 			&email,
 			&cart.AmountTotal,
+			&cart.AmountRefunded,
 			&cart.Currency,
 			&paymentID,
 			&cart.PaymentStatus,
@@ -145,19 +139,28 @@ func (q *CartQueries) Cart(ctx context.Context, cartId string) (*models.Cart, er
     email, 
     cart,
     amount_total,
+    amount_refunded,
     currency,
     payment_id,
     payment_status,
     payment_system,
+    shipping_address,
+    shipping_rate,
+    shipping_amount,
+    shipment_status,
+    tracking_number,
+    tracking_url,
+    strftime('%s', shipped),
     strftime('%s', created),
     strftime('%s', updated)
 	FROM cart
 	WHERE id = ?
 	`
 
-	var email, paymentID, cartJSON sql.NullString
-	var created, updated sql.NullInt64
+	var email, paymentID, cartJSON, shippingAddress sql.NullString
+	var created, updated, shipped sql.NullInt64
 	cart := &models.Cart{}
+	shipping := &models.CartShipping{}
 
 	err := q.DB.QueryRowContext(ctx, query, cartId).
 		Scan(
@@ -165,20 +168,39 @@ func (q *CartQueries) Cart(ctx context.Context, cartId string) (*models.Cart, er
 			&email,
 			&cartJSON,
 			&cart.AmountTotal,
+			&cart.AmountRefunded,
 			&cart.Currency,
 			&paymentID,
 			&cart.PaymentStatus,
 			&cart.PaymentSystem,
+			&shippingAddress,
+			&shipping.Rate,
+			&shipping.Amount,
+			&shipping.Status,
+			&shipping.TrackingNumber,
+			&shipping.TrackingURL,
+			&shipped,
 			&created,
 			&updated,
 		)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.ErrProductNotFound
+			return nil, errors.ErrCartNotFound
 		}
 		return nil, err
 	}
 
+	// only carts with physical products have a shipment
+	if shipping.Status != "" {
+		if shippingAddress.Valid {
+			if err := json.Unmarshal([]byte(shippingAddress.String), &shipping.Address); err != nil {
+				return nil, err
+			}
+		}
+		shipping.Shipped = shipped.Int64
+		cart.Shipping = shipping
+	}
+
 	cart.Email = email.String
 	cart.PaymentID = paymentID.String
 	if created.Valid {
@@ -199,6 +221,43 @@ func (q *CartQueries) Cart(ctx context.Context, cartId string) (*models.Cart, er
 	return cart, nil
 }
 
+// CartIDByPaymentID returns the ID of the cart paid with the given provider payment ID.
+func (q *CartQueries) CartIDByPaymentID(ctx context.Context, paymentID string) (string, error) {
+	var cartID string
+	err := q.DB.QueryRowContext(ctx, `SELECT id FROM cart WHERE payment_id = ?`, paymentID).Scan(&cartID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", errors.ErrCartNotFound
+		}
+		return "", err
+	}
+	return cartID, nil
+}
+
+// CheckCartPayment returns errors.ErrPaymentMismatch when a provider reports
+// another amount or currency than the cart holds. Payments that carry no
+// currency are not checked.
+func (q *CartQueries) CheckCartPayment(ctx context.Context, payment *litepay.Payment) error {
+	if payment.Currency == "" {
+		return nil
+	}
+
+	var amountTotal int
+	var currency string
+	err := q.DB.QueryRowContext(ctx, `SELECT amount_total, currency FROM cart WHERE id = ?`, payment.CartID).Scan(&amountTotal, &currency)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.ErrCartNotFound
+		}
+		return err
+	}
+
+	if payment.AmountTotal != amountTotal || !strings.EqualFold(payment.Currency, currency) {
+		return errors.ErrPaymentMismatch
+	}
+	return nil
+}
+
 // BuildCartItems builds cart items with full product information
 func BuildCartItems(cart *models.Cart, products *models.Products) []map[string]interface{} {
 	if len(cart.Cart) == 0 || len(products.Products) == 0 {
@@ -225,6 +284,14 @@ func BuildCartItems(cart *models.Cart, products *models.Products) []map[string]i
 			"quantity": cartItem.Quantity,
 		}
 
+		for _, variant := range product.Variants {
+			if variant.ID == cartItem.VariantID {
+				item["variant_id"] = variant.ID
+				item["variant"] = variant.Name
+				item["amount"] = variant.Amount
+			}
+		}
+
 		if len(product.Images) > 0 {
 			item["image"] = product.Images[0]
 		}
@@ -242,35 +309,138 @@ func (q *CartQueries) AddCart(ctx context.Context, cart *models.Cart) error {
 		return err
 	}
 
-	query := `INSERT INTO cart (id, email, cart, amount_total, currency, payment_status, payment_system) VALUES (?, ?, ?, ?, ?, ?, ?)`
-	_, err = q.DB.ExecContext(ctx, query, cart.ID, cart.Email, string(byteCart), cart.AmountTotal, cart.Currency, cart.PaymentStatus, cart.PaymentSystem)
+	var shippingAddress any
+	shipping := &models.CartShipping{}
+	if cart.Shipping != nil {
+		shipping = cart.Shipping
+		address, err := json.Marshal(shipping.Address)
+		if err != nil {
+			return err
+		}
+		shippingAddress = string(address)
+	}
+
+	query := `
+		INSERT INTO cart (id, email, cart, amount_total, currency, payment_status, payment_system, shipping_address, shipping_rate, shipping_amount, shipment_status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = q.DB.ExecContext(ctx, query, cart.ID, cart.Email, string(byteCart), cart.AmountTotal, cart.Currency, cart.PaymentStatus, cart.PaymentSystem,
+		shippingAddress, shipping.Rate, shipping.Amount, shipping.Status)
 	return err
 }
 
 // UpdateCart updates the cart details in the database.
-func (q *CartQueries) UpdateCart(ctx context.Context, cart *models.Cart) error {
+// A status change must be allowed by the cart transition table and is
+// recorded in the cart status history together with its source.
+//
+// It reports whether this call changed the status. The change is applied only
+// if the status is still the one that was checked, so of several concurrent
+// updates to the same status exactly one reports true; callers use it to run
+// side effects such as the purchase letter once per cart.
+func (q *CartQueries) UpdateCart(ctx context.Context, cart *models.Cart, source models.CartStatusSource) (bool, error) {
+	var current litepay.Status
+	if cart.PaymentStatus != "" {
+		var status sql.NullString
+		err := q.DB.QueryRowContext(ctx, `SELECT payment_status FROM cart WHERE id = ?`, cart.ID).Scan(&status)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return false, errors.ErrCartNotFound
+			}
+			return false, err
+		}
+
+		current = litepay.Status(status.String)
+		if !cartTransitionAllowed(current, cart.PaymentStatus, source) {
+			return false, &CartTransitionError{From: current, To: cart.PaymentStatus}
+		}
+	}
+
 	var (
-		args []interface{}
-		sql  strings.Builder
+		args  []interface{}
+		query strings.Builder
 	)
 
-	sql.WriteString("UPDATE cart SET ")
+	query.WriteString("UPDATE cart SET ")
 
 	if cart.PaymentID != "" {
-		sql.WriteString("payment_id = ?, ")
+		query.WriteString("payment_id = ?, ")
 		args = append(args, cart.PaymentID)
 	}
 
 	if cart.PaymentStatus != "" {
-		sql.WriteString("payment_status = ?, ")
+		query.WriteString("payment_status = ?, ")
 		args = append(args, cart.PaymentStatus)
 	}
 
-	sql.WriteString("updated = datetime('now') WHERE id = ?")
+	// a late notification does not take back a later refund
+	if cart.AmountRefunded > 0 {
+		query.WriteString("amount_refunded = MAX(amount_refunded, ?), ")
+		args = append(args, cart.AmountRefunded)
+	}
+
+	query.WriteString("updated = datetime('now') WHERE id = ?")
 	args = append(args, cart.ID)
 
-	_, err := q.DB.ExecContext(ctx, sql.String(), args...)
-	return err
+	// the status must not have changed since it was checked
+	if cart.PaymentStatus != "" {
+		query.WriteString(" AND IFNULL(payment_status, '') = ?")
+		args = append(args, current)
+	}
+
+	tx, err := q.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	result, err := tx.ExecContext(ctx, query.String(), args...)
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	if cart.PaymentStatus != "" {
+		updated, err := result.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+
+		// another update changed the status first
+		if updated == 0 {
+			var status sql.NullString
+			if err := tx.QueryRowContext(ctx, `SELECT payment_status FROM cart WHERE id = ?`, cart.ID).Scan(&status); err != nil {
+				return false, err
+			}
+			if litepay.Status(status.String) == cart.PaymentStatus {
+				return false, nil
+			}
+			return false, &CartTransitionError{From: litepay.Status(status.String), To: cart.PaymentStatus}
+		}
+
+		if current != cart.PaymentStatus {
+			changed = true
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO cart_status_history (id, cart_id, from_status, to_status, source) VALUES (?, ?, ?, ?, ?)`,
+				security.RandomString(), cart.ID, current, cart.PaymentStatus, source,
+			)
+			if err != nil {
+				return false, err
+			}
+
+			if err := settleDigitalData(ctx, tx, cart.ID, cart.PaymentStatus); err != nil {
+				return false, err
+			}
+
+			if err := settleStock(ctx, tx, cart.ID, cart.PaymentStatus); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return changed, nil
 }
 
 // CartLetterPayment is ...
@@ -321,6 +491,19 @@ func (q *CartQueries) CartLetterPurchase(ctx context.Context, cartID string) (*m
 		return nil, err
 	}
 
+	// keys needed for each variant of the "data" products
+	lines, err := q.dataQuantities(ctx, products)
+	if err != nil {
+		return nil, err
+	}
+
+	// read before the transaction, so this query on another connection does
+	// not wait on the locks the transaction takes
+	freeUpdates, err := db.FreeUpdates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// Begin a transaction.
 	tx, err := q.DB.BeginTx(ctx, nil)
 	if err != nil {
@@ -330,9 +513,20 @@ func (q *CartQueries) CartLetterPurchase(ctx context.Context, cartID string) (*m
 
 	keys := []models.Data{}
 	files := []models.File{}
+	access := []string{}
+	lifetimes := map[string]time.Duration{}
+	seen := map[string]bool{}
 	for _, cart := range products {
-		var digitalType string
-		err := tx.QueryRowContext(ctx, `SELECT digital FROM product WHERE id = ?`, cart.ProductID).Scan(&digitalType)
+		// a product bought as several variants is delivered once, with
+		// the content of all of them
+		if seen[cart.ProductID] {
+			continue
+		}
+		seen[cart.ProductID] = true
+
+		var digitalType, name string
+		var lifetime int
+		err := tx.QueryRowContext(ctx, `SELECT IFNULL(digital, ''), name, download_lifetime FROM product WHERE id = ?`, cart.ProductID).Scan(&digitalType, &name, &lifetime)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				return nil, errors.ErrPageNotFound
@@ -342,41 +536,78 @@ func (q *CartQueries) CartLetterPurchase(ctx context.Context, cartID string) (*m
 
 		switch digitalType {
 		case "file":
-			rows, err := tx.QueryContext(ctx, `SELECT id, name, ext, orig_name FROM digital_file WHERE product_id = ?`, cart.ProductID)
+			productFiles, err := cartFiles(ctx, tx, cartID, cart.ProductID, freeUpdates)
 			if err != nil {
 				return nil, err
 			}
-			defer func() { _ = rows.Close() }()
-			for rows.Next() {
-				file := models.File{}
-				if err := rows.Scan(&file.ID, &file.Name, &file.Ext, &file.OrigName); err != nil {
+			for _, file := range productFiles {
+				files = append(files, file)
+				lifetimes[file.ID] = DownloadLifetime(lifetime)
+			}
+		case "data":
+			// keys reserved at checkout, topped up from the stock if the
+			// reservation expired and some of them were sold to another cart
+			quantity := 0
+			for _, line := range lines {
+				if line.ProductID == cart.ProductID {
+					quantity += line.Quantity
+				}
+			}
+			var count int
+			if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM digital_data WHERE cart_id = ? AND product_id = ?`, cartID, cart.ProductID).Scan(&count); err != nil {
+				return nil, err
+			}
+			for _, line := range lines {
+				if line.ProductID != cart.ProductID || count >= quantity {
+					continue
+				}
+				reserved, err := reserveKeys(ctx, tx, cartID, cart.ProductID, line.VariantID, min(line.Quantity, quantity-count))
+				if err != nil {
 					return nil, err
 				}
-				files = append(files, file)
+				count += reserved
+			}
+			if count < quantity {
+				return nil, errors.ErrOutOfStock
 			}
-			if err := rows.Err(); err != nil {
+			if _, err := tx.ExecContext(ctx, `UPDATE digital_data SET reserved = NULL WHERE cart_id = ? AND product_id = ?`, cartID, cart.ProductID); err != nil {
 				return nil, err
 			}
-		case "data":
-			key := models.Data{}
-			err := tx.QueryRowContext(ctx, `SELECT id, content FROM digital_data WHERE cart_id = ?`, cartID).Scan(&key.ID, &key.Content)
+
+			rows, err := tx.QueryContext(ctx, `SELECT id, content FROM digital_data WHERE cart_id = ? AND product_id = ? ORDER BY rowid`, cartID, cart.ProductID)
 			if err != nil {
-				if err == sql.ErrNoRows {
-					err = tx.QueryRowContext(ctx, `SELECT id, content FROM digital_data WHERE cart_id IS NULL AND product_id = ? LIMIT 1`, cart.ProductID).Scan(&key.ID, &key.Content)
-					if err != nil {
-						if err == sql.ErrNoRows {
-							return nil, errors.ErrPageNotFound
-						}
-						return nil, err
-					}
-					if _, err := tx.ExecContext(ctx, `UPDATE digital_data SET cart_id = ? WHERE id = ?`, cartID, key.ID); err != nil {
-						return nil, err
-					}
-				} else {
+				return nil, err
+			}
+			for rows.Next() {
+				key := models.Data{}
+				if err := rows.Scan(&key.ID, &key.Content); err != nil {
+					_ = rows.Close()
 					return nil, err
 				}
+				keys = append(keys, key)
+			}
+			err = rows.Err()
+			_ = rows.Close()
+			if err != nil {
+				return nil, err
+			}
+		case "api":
+			// the letter does not wait for the fulfillment URL, content that is
+			// not there yet goes out in the access letter
+			var content string
+			err := tx.QueryRowContext(ctx, `
+				UPDATE fulfillment SET letter = IIF(letter = '', ?, letter)
+				WHERE cart_id = ? AND product_id = ? AND content != ''
+				RETURNING content
+			`, models.FulfillmentLetterPurchase, cartID, cart.ProductID).Scan(&content)
+			switch {
+			case err == sql.ErrNoRows:
+				access = append(access, name+" - in a separate letter")
+			case err != nil:
+				return nil, err
+			default:
+				access = append(access, content)
 			}
-			keys = append(keys, key)
 		}
 	}
 
@@ -394,28 +625,160 @@ func (q *CartQueries) CartLetterPurchase(ctx context.Context, cartID string) (*m
 			count++
 		}
 	}
+
+	if len(access) > 0 {
+		purchases.WriteString("Access:\n")
+		for _, content := range access {
+			purchases.WriteString(fmt.Sprintf("%v: %s\n", count, content))
+			count++
+		}
+	}
+
+	// Fetch the 'mail_letter_purchase' setting value and what download links are built from.
+	mailLetter, err := db.GetSettingByKey(ctx, "email", "mail_letter_purchase", "domain", "download_secret")
+	if err != nil {
+		return nil, err
+	}
+
 	if len(files) > 0 {
+		domain, _ := mailLetter["domain"].Value.(string)
+		secret, _ := mailLetter["download_secret"].Value.(string)
+
 		purchases.WriteString("Files:\n")
 		for _, file := range files {
-			purchases.WriteString(fmt.Sprintf("%v: %s\n", count, file.OrigName))
+			expires := time.Now().Add(lifetimes[file.ID])
+			purchases.WriteString(fmt.Sprintf("%v: %s - %s\n", count, file.OrigName, DownloadURL(domain, secret, cartID, file.ID, expires)))
 			count++
 		}
 	}
+	if err := json.Unmarshal([]byte(mailLetter["mail_letter_purchase"].Value.(string)), &mail.Letter); err != nil {
+		return nil, err
+	}
+
+	mail.Data = map[string]string{
+		"Purchases":   purchases.String(),
+		"Admin_Email": mailLetter["email"].Value.(string),
+	}
 
-	// Fetch the 'mail_letter_purchase' setting value.
+	return mail, nil
+}
+
+// CartLetterAccess builds the follow-up of the purchase letter with the
+// content of the "api" products that was not sent yet. It returns the letter
+// and the products it carries, or a nil letter if there is nothing to send.
+func (q *CartQueries) CartLetterAccess(ctx context.Context, cartID string) (*models.MessageMail, []string, error) {
+	mail := &models.MessageMail{}
+
+	err := q.QueryRowContext(ctx, `SELECT email FROM cart WHERE payment_status = ? AND id = ?`, litepay.PAID, cartID).Scan(&mail.To)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, errors.ErrPageNotFound
+		}
+		return nil, nil, err
+	}
+
+	rows, err := q.QueryContext(ctx, `
+		SELECT product_id, content FROM fulfillment
+		WHERE cart_id = ? AND content != '' AND letter = ''
+		ORDER BY created, rowid
+	`, cartID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var purchases strings.Builder
+	productIDs := []string{}
+	for rows.Next() {
+		var productID, content string
+		if err := rows.Scan(&productID, &content); err != nil {
+			return nil, nil, err
+		}
+		if len(productIDs) == 0 {
+			purchases.WriteString("Access:\n")
+		}
+		productIDs = append(productIDs, productID)
+		purchases.WriteString(fmt.Sprintf("%v: %s\n", len(productIDs), content))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(productIDs) == 0 {
+		return nil, nil, nil
+	}
+
+	// the access letter is the purchase letter with what came later
 	mailLetter, err := db.GetSettingByKey(ctx, "email", "mail_letter_purchase")
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if err := json.Unmarshal([]byte(mailLetter["mail_letter_purchase"].Value.(string)), &mail.Letter); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	mail.Data = map[string]string{
 		"Purchases":   purchases.String(),
 		"Admin_Email": mailLetter["email"].Value.(string),
 	}
-	mail.Files = files
+
+	return mail, productIDs, nil
+}
+
+// CartLetterUpdate builds the letter that tells the buyer of a paid cart
+// about a new version of a product, with links to its files.
+func (q *CartQueries) CartLetterUpdate(ctx context.Context, cartID, productID string) (*models.MessageMail, error) {
+	mail := &models.MessageMail{}
+
+	var productName, versionName, changelog string
+	var lifetime int
+	err := q.QueryRowContext(ctx, `
+		SELECT cart.email, product.name, product.download_lifetime, digital_version.version, digital_version.changelog
+		FROM cart
+		JOIN product ON product.id = ?
+		JOIN digital_version ON digital_version.product_id = product.id AND digital_version.current
+		WHERE cart.id = ? AND cart.payment_status = ?
+	`, productID, cartID, litepay.PAID).Scan(&mail.To, &productName, &lifetime, &versionName, &changelog)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.ErrVersionNotFound
+		}
+		return nil, err
+	}
+
+	freeUpdates, err := db.FreeUpdates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	files, err := cartFiles(ctx, q.DB, cartID, productID, freeUpdates)
+	if err != nil {
+		return nil, err
+	}
+
+	mailLetter, err := db.GetSettingByKey(ctx, "site_name", "email", "mail_letter_update", "domain", "download_secret")
+	if err != nil {
+		return nil, err
+	}
+	domain, _ := mailLetter["domain"].Value.(string)
+	secret, _ := mailLetter["download_secret"].Value.(string)
+
+	var links strings.Builder
+	expires := time.Now().Add(DownloadLifetime(lifetime))
+	for i, file := range files {
+		links.WriteString(fmt.Sprintf("%v: %s - %s\n", i+1, file.OrigName, DownloadURL(domain, secret, cartID, file.ID, expires)))
+	}
+
+	if err := json.Unmarshal([]byte(mailLetter["mail_letter_update"].Value.(string)), &mail.Letter); err != nil {
+		return nil, err
+	}
+
+	mail.Data = map[string]string{
+		"Site_Name":    mailLetter["site_name"].Value.(string),
+		"Admin_Email":  mailLetter["email"].Value.(string),
+		"Product_Name": productName,
+		"Version":      versionName,
+		"Changelog":    changelog,
+		"Files":        links.String(),
+	}
 
 	return mail, nil
 }
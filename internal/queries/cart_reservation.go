@@ -0,0 +1,187 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/litepay"
+)
+
+// DefaultReservationMinutes is how long the stock and the keys reserved at
+// checkout are held for a cart that is not paid yet, unless the
+// "stock_reservation" setting says otherwise.
+const DefaultReservationMinutes = 60
+
+// reservationExpired is the time before which a reservation made at checkout
+// has expired.
+var reservationExpired = fmt.Sprintf(
+	"datetime('now', '-' || IFNULL((SELECT value FROM setting WHERE key = 'stock_reservation'), %d) || ' minutes')",
+	DefaultReservationMinutes,
+)
+
+// availableData matches the digital_data keys that can be sold: keys with no
+// cart, and keys whose reservation has expired. A sold key keeps its cart
+// and has no reservation time.
+var availableData = "(digital_data.cart_id IS NULL OR digital_data.reserved < " + reservationExpired + ")"
+
+// ReserveDigitalData holds keys of the "data" products in the cart until the
+// cart is paid, canceled or the reservation expires. Either every product gets
+// its quantity of keys or nothing is reserved and errors.ErrOutOfStock is returned.
+func (q *CartQueries) ReserveDigitalData(ctx context.Context, cartID string, products ...models.CartProduct) error {
+	lines, err := q.dataQuantities(ctx, products)
+	if err != nil || len(lines) == 0 {
+		return err
+	}
+
+	tx, err := q.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, line := range lines {
+		reserved, err := reserveKeys(ctx, tx, cartID, line.ProductID, line.VariantID, line.Quantity)
+		if err != nil {
+			return err
+		}
+		if reserved < line.Quantity {
+			return errors.ErrOutOfStock
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ReleaseDigitalData returns the keys reserved by a cart to the stock.
+// Keys of a paid cart are sold and stay with it.
+func (q *CartQueries) ReleaseDigitalData(ctx context.Context, cartID string) error {
+	_, err := q.DB.ExecContext(ctx, `UPDATE digital_data SET cart_id = NULL, reserved = NULL WHERE cart_id = ? AND reserved IS NOT NULL`, cartID)
+	return err
+}
+
+// DigitalDataShortage lists the "data" products of a paid cart that hold fewer
+// keys than were bought, which happens when the reservation expired before
+// the payment and the keys went to another cart.
+func (q *CartQueries) DigitalDataShortage(ctx context.Context, cartID string) ([]*models.DigitalShortage, error) {
+	var cartJSON string
+	err := q.DB.QueryRowContext(ctx, `SELECT cart FROM cart WHERE id = ? AND payment_status = ?`, cartID, litepay.PAID).Scan(&cartJSON)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.ErrPageNotFound
+		}
+		return nil, err
+	}
+
+	products := []models.CartProduct{}
+	if err := json.Unmarshal([]byte(cartJSON), &products); err != nil {
+		return nil, err
+	}
+	lines, err := q.dataQuantities(ctx, products)
+	if err != nil {
+		return nil, err
+	}
+
+	shortage := []*models.DigitalShortage{}
+	index := map[string]*models.DigitalShortage{}
+	for _, line := range lines {
+		if item, ok := index[line.ProductID]; ok {
+			item.Missing += line.Quantity
+			continue
+		}
+		item := &models.DigitalShortage{CartID: cartID, ProductID: line.ProductID, Missing: line.Quantity}
+		var held int
+		err := q.DB.QueryRowContext(ctx, `
+			SELECT name, (SELECT COUNT(*) FROM digital_data WHERE cart_id = ? AND product_id = product.id)
+			FROM product WHERE id = ?
+		`, cartID, line.ProductID).Scan(&item.Name, &held)
+		if err != nil {
+			return nil, err
+		}
+		item.Missing -= held
+		index[line.ProductID] = item
+		shortage = append(shortage, item)
+	}
+
+	return slices.DeleteFunc(shortage, func(item *models.DigitalShortage) bool { return item.Missing <= 0 }), nil
+}
+
+// dataQuantities returns the number of keys needed for each variant of the
+// "data" products of the cart, in the order they appear in the cart.
+func (q *CartQueries) dataQuantities(ctx context.Context, products []models.CartProduct) ([]models.CartProduct, error) {
+	digitalTypes := map[string]string{}
+	index := map[models.CartProduct]int{}
+	lines := []models.CartProduct{}
+	for _, product := range products {
+		digitalType, ok := digitalTypes[product.ProductID]
+		if !ok {
+			err := q.DB.QueryRowContext(ctx, `SELECT IFNULL(digital, '') FROM product WHERE id = ?`, product.ProductID).Scan(&digitalType)
+			if err != nil {
+				if err == sql.ErrNoRows {
+					return nil, errors.ErrProductNotFound
+				}
+				return nil, err
+			}
+			digitalTypes[product.ProductID] = digitalType
+		}
+		if digitalType != "data" {
+			continue
+		}
+
+		key := models.CartProduct{ProductID: product.ProductID, VariantID: product.VariantID}
+		i, ok := index[key]
+		if !ok {
+			i = len(lines)
+			index[key] = i
+			lines = append(lines, key)
+		}
+		lines[i].Quantity += product.Quantity
+	}
+
+	return lines, nil
+}
+
+// reserveKeys reserves up to count more available keys of a product variant
+// for the cart and returns how many it got. Keys tied to the variant go
+// first, then the ones shared by all variants.
+func reserveKeys(ctx context.Context, tx *sql.Tx, cartID, productID, variantID string, count int) (int, error) {
+	result, err := tx.ExecContext(ctx, `
+		UPDATE digital_data
+		SET cart_id = ?, reserved = datetime('now')
+		WHERE id IN (
+			SELECT id FROM digital_data
+			WHERE product_id = ? AND (variant_id IS NULL OR variant_id = ?) AND IFNULL(cart_id, '') != ? AND `+availableData+`
+			ORDER BY variant_id IS NULL, rowid
+			LIMIT ?
+		)
+	`, cartID, productID, variantID, cartID, count)
+	if err != nil {
+		return 0, err
+	}
+
+	reserved, err := result.RowsAffected()
+	return int(reserved), err
+}
+
+// settleDigitalData keeps the keys reserved by a cart without an expiry once
+// the cart is paid or its payment is being processed, and returns them to the
+// stock when the cart is canceled or has failed. A cart can only get there
+// before it was paid, so none of its keys are sold yet.
+func settleDigitalData(ctx context.Context, tx *sql.Tx, cartID string, status litepay.Status) error {
+	var query string
+	switch status {
+	case litepay.PAID, litepay.PROCESSED:
+		query = `UPDATE digital_data SET reserved = NULL WHERE cart_id = ?`
+	case litepay.CANCELED, litepay.FAILED:
+		query = `UPDATE digital_data SET cart_id = NULL, reserved = NULL WHERE cart_id = ?`
+	default:
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, query, cartID)
+	return err
+}
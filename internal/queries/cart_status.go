@@ -0,0 +1,84 @@
+package queries
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/pkg/litepay"
+)
+
+// cartTransitions lists the statuses a cart may move to from each status.
+// Statuses missing from the table are final.
+var cartTransitions = map[litepay.Status][]litepay.Status{
+	litepay.NEW:                {litepay.UNPAID, litepay.PROCESSED, litepay.PAID, litepay.FAILED, litepay.CANCELED, litepay.TEST},
+	litepay.UNPAID:             {litepay.PROCESSED, litepay.PAID, litepay.FAILED, litepay.CANCELED},
+	litepay.PROCESSED:          {litepay.UNPAID, litepay.PAID, litepay.FAILED, litepay.CANCELED},
+	litepay.PAID:               {litepay.REFUNDED, litepay.PARTIALLY_REFUNDED},
+	litepay.PARTIALLY_REFUNDED: {litepay.REFUNDED},
+}
+
+// paymentTransitions lists the moves out of a final status that only the
+// payment provider may make: a buyer who backed out of checkout can still
+// pay in the provider session, which stays open.
+var paymentTransitions = map[litepay.Status][]litepay.Status{
+	litepay.CANCELED: {litepay.PAID},
+	litepay.FAILED:   {litepay.PAID},
+}
+
+// CartTransitionError is returned when a cart status change is not allowed.
+type CartTransitionError struct {
+	From litepay.Status
+	To   litepay.Status
+}
+
+func (e *CartTransitionError) Error() string {
+	return fmt.Sprintf("illegal cart status transition from %q to %q", e.From, e.To)
+}
+
+// CartTransitionAllowed reports whether a cart may move from one status to another.
+// Keeping the current status is always allowed.
+func CartTransitionAllowed(from, to litepay.Status) bool {
+	if from == "" {
+		from = litepay.NEW
+	}
+	return from == to || slices.Contains(cartTransitions[from], to)
+}
+
+// cartTransitionAllowed is CartTransitionAllowed with the moves the payment
+// provider may make from the notification or the success check.
+func cartTransitionAllowed(from, to litepay.Status, source models.CartStatusSource) bool {
+	if source == models.CartSourceCallback || source == models.CartSourceSuccess {
+		if slices.Contains(paymentTransitions[from], to) {
+			return true
+		}
+	}
+	return CartTransitionAllowed(from, to)
+}
+
+// CartStatusHistory returns the status transitions of a cart, oldest first.
+func (q *CartQueries) CartStatusHistory(ctx context.Context, cartID string) ([]*models.CartStatusHistory, error) {
+	history := []*models.CartStatusHistory{}
+
+	rows, err := q.DB.QueryContext(ctx, `
+		SELECT id, from_status, to_status, source, strftime('%s', created)
+		FROM cart_status_history
+		WHERE cart_id = ?
+		ORDER BY created, rowid
+	`, cartID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		item := &models.CartStatusHistory{}
+		if err := rows.Scan(&item.ID, &item.From, &item.To, &item.Source, &item.Created); err != nil {
+			return nil, err
+		}
+		history = append(history, item)
+	}
+
+	return history, rows.Err()
+}
@@ -0,0 +1,375 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/security"
+)
+
+// CategoryQueries is a struct that embeds a pointer to an sql.DB.
+// This allows for direct access to all the methods of sql.DB through CategoryQueries.
+type CategoryQueries struct {
+	*sql.DB
+}
+
+// categoryTree selects the category with the given slug and all of the
+// categories nested under it.
+const categoryTree = `
+	WITH RECURSIVE tree(id) AS (
+		SELECT id FROM category WHERE slug = ?
+		UNION
+		SELECT category.id FROM category JOIN tree ON category.parent_id = tree.id
+	)
+	SELECT id FROM tree
+`
+
+const categoryColumns = `
+	category.id,
+	IFNULL(category.parent_id, ''),
+	category.name,
+	category.slug,
+	category.desc,
+	category.seo,
+	category.position,
+	strftime('%s', category.created),
+	IFNULL(strftime('%s', category.updated), 0)
+`
+
+// scanCategory reads a row selected with categoryColumns followed by the
+// number of products.
+func scanCategory(row interface{ Scan(...any) error }) (*models.Category, error) {
+	category := &models.Category{}
+	var seo sql.NullString
+	err := row.Scan(
+		&category.ID,
+		&category.ParentID,
+		&category.Name,
+		&category.Slug,
+		&category.Description,
+		&seo,
+		&category.Position,
+		&category.Created,
+		&category.Updated,
+		&category.Products,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if seo.Valid {
+		if err := json.Unmarshal([]byte(seo.String), &category.Seo); err != nil {
+			return nil, err
+		}
+	}
+	return category, nil
+}
+
+// categoryProducts counts the products filed directly under a category. The
+// public count leaves out the products that are not active.
+func categoryProducts(private bool) string {
+	query := `(SELECT COUNT(*) FROM product_category JOIN product ON product.id = product_category.product_id
+		WHERE product_category.category_id = category.id`
+	if !private {
+		query += ` AND product.active = 1 AND product.deleted = 0`
+	}
+	return query + `)`
+}
+
+// Categories returns all categories, parents before their children and
+// each level in the order it is shown.
+func (q *CategoryQueries) Categories(ctx context.Context, private bool) ([]*models.Category, error) {
+	categories := []*models.Category{}
+
+	query := `
+		WITH RECURSIVE ordered(id, path) AS (
+			SELECT id, printf('%08d', position) || id FROM category WHERE parent_id IS NULL
+			UNION ALL
+			SELECT category.id, ordered.path || '/' || printf('%08d', category.position) || category.id
+			FROM category JOIN ordered ON category.parent_id = ordered.id
+		)
+		SELECT` + categoryColumns + `, ` + categoryProducts(private) + `
+		FROM category JOIN ordered ON ordered.id = category.id
+		ORDER BY ordered.path
+	`
+	rows, err := q.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+
+	return categories, rows.Err()
+}
+
+// Category returns a category by its id.
+func (q *CategoryQueries) Category(ctx context.Context, id string) (*models.Category, error) {
+	query := `SELECT` + categoryColumns + `, ` + categoryProducts(true) + ` FROM category WHERE id = ?`
+	category, err := scanCategory(q.DB.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrCategoryNotFound
+	}
+	return category, err
+}
+
+// CategoryBySlug returns a category by its slug with the categories nested
+// under it, as it is shown on the site.
+func (q *CategoryQueries) CategoryBySlug(ctx context.Context, slug string) (*models.Category, error) {
+	query := `SELECT` + categoryColumns + `, ` + categoryProducts(false) + ` FROM category WHERE slug = ?`
+	category, err := scanCategory(q.DB.QueryRowContext(ctx, query, slug))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrCategoryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := q.Categories(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, child := range models.CategoryTree(categories) {
+		if found := findCategory(child, category.ID); found != nil {
+			category.Children = found.Children
+			break
+		}
+	}
+	return category, nil
+}
+
+// findCategory looks for a category in a tree.
+func findCategory(category *models.Category, id string) *models.Category {
+	if category.ID == id {
+		return category
+	}
+	for _, child := range category.Children {
+		if found := findCategory(child, id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// checkCategory returns errors.ErrCategorySlugExists if a category other than
+// the given one already uses its slug, errors.ErrCategoryParent if the parent
+// does not exist and errors.ErrCategoryCycle if the parent is the category
+// itself or one of its subcategories.
+func (q *CategoryQueries) checkCategory(ctx context.Context, category *models.Category) error {
+	var taken bool
+	err := q.DB.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM category WHERE slug = ? AND id != ?)`, category.Slug, category.ID).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return errors.ErrCategorySlugExists
+	}
+
+	if category.ParentID == "" {
+		return nil
+	}
+
+	var exists, nested bool
+	err = q.DB.QueryRowContext(ctx, `
+		WITH RECURSIVE tree(id) AS (
+			SELECT ?
+			UNION
+			SELECT category.id FROM category JOIN tree ON category.parent_id = tree.id
+		)
+		SELECT EXISTS(SELECT 1 FROM category WHERE id = ?), EXISTS(SELECT 1 FROM tree WHERE id = ?)
+	`, category.ID, category.ParentID, category.ParentID).Scan(&exists, &nested)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.ErrCategoryParent
+	}
+	if nested {
+		return errors.ErrCategoryCycle
+	}
+	return nil
+}
+
+// AddCategory inserts a new category.
+func (q *CategoryQueries) AddCategory(ctx context.Context, category *models.Category) (*models.Category, error) {
+	category.ID = security.RandomString()
+	if err := q.checkCategory(ctx, category); err != nil {
+		return nil, err
+	}
+
+	seo, err := json.Marshal(category.Seo)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO category (id, parent_id, name, slug, desc, seo, position)
+		VALUES (?, NULLIF(?, ''), ?, ?, ?, ?, ?)
+		RETURNING strftime('%s', created)
+	`
+	err = q.DB.QueryRowContext(ctx, query, category.ID, category.ParentID, category.Name, category.Slug,
+		category.Description, string(seo), category.Position).Scan(&category.Created)
+	if err != nil {
+		return nil, err
+	}
+
+	return category, nil
+}
+
+// UpdateCategory updates a category, moving it under another parent if the
+// parent has changed.
+func (q *CategoryQueries) UpdateCategory(ctx context.Context, category *models.Category) error {
+	if _, err := q.Category(ctx, category.ID); err != nil {
+		return err
+	}
+	if err := q.checkCategory(ctx, category); err != nil {
+		return err
+	}
+
+	seo, err := json.Marshal(category.Seo)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE category
+		SET parent_id = NULLIF(?, ''), name = ?, slug = ?, desc = ?, seo = ?, position = ?, updated = datetime('now')
+		WHERE id = ?
+	`
+	_, err = q.DB.ExecContext(ctx, query, category.ParentID, category.Name, category.Slug, category.Description,
+		string(seo), category.Position, category.ID)
+	return err
+}
+
+// DeleteCategory deletes a category. Its subcategories move up to its parent
+// and its products stay in the other categories they are filed under.
+func (q *CategoryQueries) DeleteCategory(ctx context.Context, id string) error {
+	tx, err := q.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var parentID sql.NullString
+	err = tx.QueryRowContext(ctx, `SELECT parent_id FROM category WHERE id = ?`, id).Scan(&parentID)
+	if err == sql.ErrNoRows {
+		return errors.ErrCategoryNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE category SET parent_id = ? WHERE parent_id = ?`, parentID, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM category WHERE id = ?`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetProductCategories files a product under the given categories, taking it
+// out of any other.
+func (q *CategoryQueries) SetProductCategories(ctx context.Context, productID string, categoryIDs []string) error {
+	categoryIDs = uniqueStrings(categoryIDs)
+
+	tx, err := q.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM product WHERE id = ?)`, productID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return errors.ErrProductNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM product_category WHERE product_id = ?`, productID); err != nil {
+		return err
+	}
+
+	for _, categoryID := range categoryIDs {
+		result, err := tx.ExecContext(ctx, `
+			INSERT INTO product_category (product_id, category_id)
+			SELECT ?, id FROM category WHERE id = ?
+		`, productID, categoryID)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return errors.ErrCategoryNotFound
+		}
+	}
+
+	return tx.Commit()
+}
+
+// uniqueStrings drops the repeated values of a list, keeping the first one.
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := []string{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// productsCategories returns the categories of the listed products by
+// product ID, without their descriptions.
+func (q *ProductQueries) productsCategories(ctx context.Context, productIDs ...string) (map[string][]models.Category, error) {
+	categories := map[string][]models.Category{}
+	if len(productIDs) == 0 {
+		return categories, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT product_category.product_id, category.id, IFNULL(category.parent_id, ''), category.name, category.slug, category.position
+		FROM product_category
+		JOIN category ON category.id = product_category.category_id
+		WHERE product_category.product_id IN (%s)
+		ORDER BY category.position, category.name
+	`, strings.Repeat("?, ", len(productIDs)-1)+"?")
+
+	args := make([]any, len(productIDs))
+	for i, id := range productIDs {
+		args[i] = id
+	}
+
+	rows, err := q.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var productID string
+		category := models.Category{}
+		if err := rows.Scan(&productID, &category.ID, &category.ParentID, &category.Name, &category.Slug, &category.Position); err != nil {
+			return nil, err
+		}
+		categories[productID] = append(categories[productID], category)
+	}
+	return categories, rows.Err()
+}
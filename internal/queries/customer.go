@@ -0,0 +1,288 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/litepay"
+	"github.com/shurco/litecart/pkg/security"
+)
+
+const (
+	// SignInLinkLifetime is how long the sign-in link mailed to a buyer can be used.
+	SignInLinkLifetime = 15 * time.Minute
+	// CustomerSessionLifetime is how long a buyer stays signed in to the portal.
+	CustomerSessionLifetime = 24 * time.Hour
+	// signInLinkInterval is how often a sign-in link can be mailed to the same address.
+	signInLinkInterval = time.Minute
+)
+
+// Keys of the customer rows in the session table. The value of a row is the
+// email of the buyer.
+const (
+	signInLinkSession = "customer_link."
+	customerSession   = "customer."
+)
+
+// CustomerQueries is a struct that embeds a pointer to an sql.DB.
+// This allows for direct access to all the methods of sql.DB through CustomerQueries.
+type CustomerQueries struct {
+	*sql.DB
+}
+
+// customerToken returns a random token that is hard to guess.
+func customerToken() string {
+	return security.RandomString() + security.RandomString()
+}
+
+// AddSignInLink returns a one-time token for the sign-in link of a buyer.
+// No token is returned when the email has no paid or partially refunded
+// carts, or when a link was already made for it within the last minute.
+func (q *CustomerQueries) AddSignInLink(ctx context.Context, email string) (string, error) {
+	now := time.Now()
+	if _, err := q.DB.ExecContext(ctx, `DELETE FROM session WHERE (key LIKE ? OR key LIKE ?) AND expires <= ?`,
+		signInLinkSession+"%", customerSession+"%", now.Unix(),
+	); err != nil {
+		return "", err
+	}
+
+	var orders, recent int
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM cart WHERE email = ? COLLATE NOCASE AND payment_status IN (?, ?)),
+			(SELECT COUNT(*) FROM session WHERE key LIKE ? AND value = ? COLLATE NOCASE AND expires > ?)
+	`
+	err := q.DB.QueryRowContext(ctx, query,
+		email, litepay.PAID, litepay.PARTIALLY_REFUNDED,
+		signInLinkSession+"%", email, now.Add(SignInLinkLifetime-signInLinkInterval).Unix(),
+	).Scan(&orders, &recent)
+	if err != nil {
+		return "", err
+	}
+	if orders == 0 || recent > 0 {
+		return "", nil
+	}
+
+	token := customerToken()
+	if err := db.AddSession(ctx, signInLinkSession+token, email, now.Add(SignInLinkLifetime).Unix()); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// AddCustomerSession uses up a sign-in link and returns the session token of
+// the buyer with its expiry time.
+func (q *CustomerQueries) AddCustomerSession(ctx context.Context, linkToken string) (string, int64, error) {
+	now := time.Now()
+
+	// the link is removed by the statement that reads it, so it works only once
+	var email string
+	err := q.DB.QueryRowContext(ctx, `DELETE FROM session WHERE key = ? AND expires > ? RETURNING value`,
+		signInLinkSession+linkToken, now.Unix(),
+	).Scan(&email)
+	if err == sql.ErrNoRows {
+		return "", 0, errors.ErrTokenInvalid
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	token := customerToken()
+	expires := now.Add(CustomerSessionLifetime).Unix()
+	if err := db.AddSession(ctx, customerSession+token, email, expires); err != nil {
+		return "", 0, err
+	}
+
+	return token, expires, nil
+}
+
+// CustomerEmail returns the email of the buyer signed in with the session token.
+func (q *CustomerQueries) CustomerEmail(ctx context.Context, token string) (string, error) {
+	email, err := db.GetSession(ctx, customerSession+token)
+	if err == sql.ErrNoRows {
+		return "", errors.ErrTokenInvalid
+	}
+	return email, err
+}
+
+// DeleteCustomerSession signs the buyer out.
+func (q *CustomerQueries) DeleteCustomerSession(ctx context.Context, token string) error {
+	return db.DeleteSession(ctx, customerSession+token)
+}
+
+// CustomerOrders returns the paid and partially refunded carts of the email,
+// newest first, with the keys, download links and access the buyer got for
+// each product.
+func (q *CustomerQueries) CustomerOrders(ctx context.Context, email string) ([]*models.CustomerOrder, error) {
+	return q.customerOrders(ctx, email, "")
+}
+
+// CustomerOrder returns a paid cart of the email like CustomerOrders does.
+func (q *CustomerQueries) CustomerOrder(ctx context.Context, email, cartID string) (*models.CustomerOrder, error) {
+	orders, err := q.customerOrders(ctx, email, cartID)
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, errors.ErrNotFound
+	}
+	return orders[0], nil
+}
+
+// customerOrders returns the paid and partially refunded carts of the email,
+// or only the one with cartID if it is not empty. A partially refunded cart
+// keeps what was bought.
+func (q *CustomerQueries) customerOrders(ctx context.Context, email, cartID string) ([]*models.CustomerOrder, error) {
+	query := `
+		SELECT id, cart, amount_total, currency, payment_system, strftime('%s', created),
+			IFNULL(shipping_address, '{}'), shipping_rate, shipping_amount, shipment_status, tracking_number, tracking_url,
+			IFNULL(strftime('%s', shipped), 0)
+		FROM cart
+		WHERE email = ? COLLATE NOCASE AND payment_status IN (?, ?) AND (? = '' OR id = ?)
+		ORDER BY created DESC, rowid DESC
+	`
+	rows, err := q.DB.QueryContext(ctx, query, email, litepay.PAID, litepay.PARTIALLY_REFUNDED, cartID, cartID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	orders := []*models.CustomerOrder{}
+	products := map[string][]models.CartProduct{}
+	for rows.Next() {
+		order := &models.CustomerOrder{Items: []*models.CustomerItem{}}
+		shipping := &models.CartShipping{}
+		var cartJSON, address string
+		if err := rows.Scan(&order.ID, &cartJSON, &order.AmountTotal, &order.Currency, &order.PaymentSystem, &order.Created,
+			&address, &shipping.Rate, &shipping.Amount, &shipping.Status, &shipping.TrackingNumber, &shipping.TrackingURL,
+			&shipping.Shipped); err != nil {
+			return nil, err
+		}
+		if shipping.Status != "" {
+			if err := json.Unmarshal([]byte(address), &shipping.Address); err != nil {
+				return nil, err
+			}
+			order.Shipping = shipping
+		}
+		cart := []models.CartProduct{}
+		if err := json.Unmarshal([]byte(cartJSON), &cart); err != nil {
+			return nil, err
+		}
+		products[order.ID] = cart
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	_ = rows.Close()
+
+	if len(orders) == 0 {
+		return orders, nil
+	}
+
+	setting, err := db.GetSettingByKey(ctx, "domain", "download_secret")
+	if err != nil {
+		return nil, err
+	}
+	domain, _ := setting["domain"].Value.(string)
+	secret, _ := setting["download_secret"].Value.(string)
+
+	freeUpdates, err := db.FreeUpdates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, order := range orders {
+		// a product bought as several variants is one item with what was
+		// delivered for all of them
+		items := map[string]*models.CustomerItem{}
+		for _, product := range products[order.ID] {
+			item, ok := items[product.ProductID]
+			if !ok {
+				var err error
+				item, err = q.customerItem(ctx, order.ID, product, domain, secret, freeUpdates)
+				if err != nil {
+					return nil, err
+				}
+				if item == nil {
+					continue
+				}
+				items[product.ProductID] = item
+				order.Items = append(order.Items, item)
+			} else {
+				item.Quantity += product.Quantity
+			}
+
+			if product.VariantID != "" {
+				var name string
+				err := q.DB.QueryRowContext(ctx, `SELECT name FROM product_variant WHERE id = ?`, product.VariantID).Scan(&name)
+				if err != nil && err != sql.ErrNoRows {
+					return nil, err
+				}
+				if name != "" {
+					item.Variants = append(item.Variants, name)
+				}
+			}
+		}
+	}
+
+	return orders, nil
+}
+
+// customerItem returns a product of a paid cart with what was delivered for
+// it. A product that was deleted since is left out.
+func (q *CustomerQueries) customerItem(ctx context.Context, cartID string, product models.CartProduct, domain, secret string, freeUpdates bool) (*models.CustomerItem, error) {
+	item := &models.CustomerItem{ProductID: product.ProductID, Quantity: product.Quantity}
+	var lifetime int
+	err := q.DB.QueryRowContext(ctx, `SELECT name, slug, IFNULL(digital, ''), download_lifetime FROM product WHERE id = ?`, product.ProductID).
+		Scan(&item.Name, &item.Slug, &item.Digital, &lifetime)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch item.Digital {
+	case "file":
+		files, err := cartFiles(ctx, q.DB, cartID, product.ProductID, freeUpdates)
+		if err != nil {
+			return nil, err
+		}
+		expires := time.Now().Add(DownloadLifetime(lifetime))
+		for _, file := range files {
+			item.Files = append(item.Files, &models.CustomerFile{
+				Name: file.OrigName,
+				URL:  DownloadURL(domain, secret, cartID, file.ID, expires),
+			})
+		}
+	case "data":
+		rows, err := q.DB.QueryContext(ctx, `SELECT content FROM digital_data WHERE cart_id = ? AND product_id = ? AND reserved IS NULL ORDER BY rowid`, cartID, product.ProductID)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = rows.Close() }()
+		for rows.Next() {
+			var key string
+			if err := rows.Scan(&key); err != nil {
+				return nil, err
+			}
+			item.Keys = append(item.Keys, key)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	case "api":
+		err := q.DB.QueryRowContext(ctx, `SELECT content FROM fulfillment WHERE cart_id = ? AND product_id = ?`, cartID, product.ProductID).Scan(&item.Access)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+	}
+
+	return item, nil
+}
@@ -0,0 +1,219 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/security"
+	"github.com/shurco/litecart/pkg/strutil"
+)
+
+// DefaultStockThreshold is the number of unused keys at or below which the
+// admin is alerted, for products that do not set their own threshold.
+const DefaultStockThreshold = 5
+
+// checkDataProduct returns an error unless the product exists and sells keys.
+func checkDataProduct(ctx context.Context, row interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}, productID string,
+) error {
+	var digitalType string
+	err := row.QueryRowContext(ctx, `SELECT IFNULL(digital, '') FROM product WHERE id = ?`, productID).Scan(&digitalType)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.ErrProductNotFound
+		}
+		return err
+	}
+	if digitalType != "data" {
+		return errors.ErrProductNoKey
+	}
+	return nil
+}
+
+// ImportDigitalData adds keys to a "data" product in one transaction.
+// Keys that are too long, repeat an earlier line or are already stored for
+// the product are skipped and listed in the report. A non-empty variantID
+// ties the keys to that variant of the product. A dry run only builds the
+// report.
+func (q *ProductQueries) ImportDigitalData(ctx context.Context, productID, variantID string, lines []models.DataLine, dryRun bool) (*models.DataImport, error) {
+	report := &models.DataImport{
+		DryRun:  dryRun,
+		Total:   len(lines),
+		Skipped: []models.DataLine{},
+	}
+
+	tx, err := q.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := checkDataProduct(ctx, tx, productID); err != nil {
+		return nil, err
+	}
+
+	var variant any
+	if variantID != "" {
+		var exists bool
+		err := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM product_variant WHERE id = ? AND product_id = ?)`, variantID, productID).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, errors.ErrVariantNotFound
+		}
+		variant = variantID
+	}
+
+	stored := map[string]bool{}
+	rows, err := tx.QueryContext(ctx, `SELECT content FROM digital_data WHERE product_id = ?`, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var content string
+		if err := rows.Scan(&content); err != nil {
+			return nil, err
+		}
+		stored[content] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO digital_data (id, product_id, content, variant_id) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = stmt.Close() }()
+
+	seen := map[string]bool{}
+	for _, line := range lines {
+		switch {
+		case len(line.Content) > models.DataContentMaxLength:
+			line.Reason = fmt.Sprintf("longer than %d characters", models.DataContentMaxLength)
+			report.Invalid++
+		case seen[line.Content]:
+			line.Reason = "duplicate in file"
+			report.Duplicates++
+		case stored[line.Content]:
+			line.Reason = "already exists"
+			report.Duplicates++
+		}
+		if line.Reason != "" {
+			report.Skipped = append(report.Skipped, line)
+			continue
+		}
+		seen[line.Content] = true
+
+		if !dryRun {
+			if _, err := stmt.ExecContext(ctx, security.RandomString(), productID, line.Content, variant); err != nil {
+				return nil, err
+			}
+		}
+		report.Added++
+	}
+
+	if dryRun {
+		return report, nil
+	}
+	// the next sale that leaves the product low alerts the admin again
+	if report.Added > 0 {
+		if _, err := tx.ExecContext(ctx, `UPDATE product SET stock_alerted = FALSE WHERE id = ?`, productID); err != nil {
+			return nil, err
+		}
+	}
+	return report, tx.Commit()
+}
+
+// ExportDigitalData returns the keys of a "data" product in the order they
+// were added, with the cart each one went to. A non-empty status keeps only
+// the unused, reserved or sold keys.
+func (q *ProductQueries) ExportDigitalData(ctx context.Context, productID, status string) ([]*models.DataExport, error) {
+	if err := checkDataProduct(ctx, q.DB, productID); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT content, status, cart_id, email FROM (
+			SELECT
+				digital_data.rowid AS position,
+				digital_data.content,
+				CASE
+					WHEN ` + availableData + ` THEN 'unused'
+					WHEN digital_data.reserved IS NOT NULL THEN 'reserved'
+					ELSE 'sold'
+				END AS status,
+				IIF(` + availableData + `, '', digital_data.cart_id) AS cart_id,
+				IIF(` + availableData + `, '', IFNULL(cart.email, '')) AS email
+			FROM digital_data
+			LEFT JOIN cart ON cart.id = digital_data.cart_id
+			WHERE digital_data.product_id = ?
+		)
+		WHERE ? = '' OR status = ?
+		ORDER BY position
+	`
+
+	rows, err := q.DB.QueryContext(ctx, query, productID, status, status)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	keys := []*models.DataExport{}
+	for rows.Next() {
+		key := &models.DataExport{}
+		if err := rows.Scan(&key.Content, &key.Status, &key.CartID, &key.Email); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// ClaimLowDigitalDataStock returns the listed "data" products whose unused
+// keys are at or below their stock threshold and marks them alerted, so each
+// product is reported once until new keys are added.
+func (q *ProductQueries) ClaimLowDigitalDataStock(ctx context.Context, productIDs ...string) ([]*models.DigitalStock, error) {
+	stock := []*models.DigitalStock{}
+	if len(productIDs) == 0 {
+		return stock, nil
+	}
+
+	remaining := `(SELECT COUNT(*) FROM digital_data WHERE digital_data.product_id = product.id AND ` + availableData + `)`
+	threshold := `IIF(product.stock_threshold > 0, product.stock_threshold, ?)`
+	query := fmt.Sprintf(`
+		UPDATE product SET stock_alerted = TRUE
+		WHERE digital = 'data' AND stock_alerted = FALSE AND id IN (%s) AND `+remaining+` <= `+threshold+`
+		RETURNING id, name, `+remaining+`, `+threshold+`
+	`, strings.Repeat("?, ", len(productIDs)-1)+"?")
+
+	args := append(strutil.ToAny(productIDs...), DefaultStockThreshold, DefaultStockThreshold)
+	rows, err := q.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		item := &models.DigitalStock{}
+		if err := rows.Scan(&item.ProductID, &item.Name, &item.Remaining, &item.Threshold); err != nil {
+			return nil, err
+		}
+		stock = append(stock, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(stock, func(a, b *models.DigitalStock) int { return strings.Compare(a.Name, b.Name) })
+	return stock, nil
+}
@@ -0,0 +1,291 @@
+package queries
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/internal/storage"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/security"
+)
+
+const (
+	// DigitalUploadChunkSize is the largest chunk of a resumable upload. It
+	// stays well below the request body limit.
+	DigitalUploadChunkSize = 16 << 20
+	// DigitalUploadLifetime is how long an upload that receives no chunks is
+	// kept before it is removed with its parts.
+	DigitalUploadLifetime = 24 * time.Hour
+)
+
+// AddDigitalUpload starts a resumable upload of a digital file for a product
+// that sells files.
+func (q *ProductQueries) AddDigitalUpload(ctx context.Context, upload *models.DigitalUpload) (*models.DigitalUpload, error) {
+	var digitalType string
+	err := q.DB.QueryRowContext(ctx, `SELECT IFNULL(digital, '') FROM product WHERE id = ?`, upload.ProductID).Scan(&digitalType)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.ErrProductNotFound
+		}
+		return nil, err
+	}
+	if digitalType != "file" {
+		return nil, errors.ErrProductNoFile
+	}
+	if upload.VersionID != "" {
+		if _, err := q.DigitalVersion(ctx, upload.ProductID, upload.VersionID); err != nil {
+			return nil, err
+		}
+	}
+
+	query := `INSERT INTO digital_upload (id, product_id, version_id, orig_name, size, sha256) VALUES (?, ?, ?, ?, ?, ?)`
+	id := security.RandomString()
+	if _, err := q.DB.ExecContext(ctx, query, id, upload.ProductID, upload.VersionID, upload.Name, upload.Size, upload.SHA256); err != nil {
+		return nil, err
+	}
+
+	return q.DigitalUpload(ctx, upload.ProductID, id)
+}
+
+// DigitalUpload returns the progress of an upload.
+func (q *ProductQueries) DigitalUpload(ctx context.Context, productID, uploadID string) (*models.DigitalUpload, error) {
+	upload, _, err := q.digitalUpload(ctx, productID, uploadID)
+	return upload, err
+}
+
+// digitalUpload returns an upload with the keys of its received parts.
+func (q *ProductQueries) digitalUpload(ctx context.Context, productID, uploadID string) (*models.DigitalUpload, []string, error) {
+	upload := &models.DigitalUpload{ChunkSize: DigitalUploadChunkSize}
+	var partsJSON string
+
+	query := `
+		SELECT id, product_id, version_id, orig_name, size, sha256, received, parts, strftime('%s', created), strftime('%s', updated)
+		FROM digital_upload
+		WHERE id = ? AND product_id = ?
+	`
+	err := q.DB.QueryRowContext(ctx, query, uploadID, productID).Scan(
+		&upload.ID, &upload.ProductID, &upload.VersionID, &upload.Name, &upload.Size, &upload.SHA256,
+		&upload.Offset, &partsJSON, &upload.Created, &upload.Updated,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, errors.ErrUploadNotFound
+		}
+		return nil, nil, err
+	}
+
+	parts := []string{}
+	if err := json.Unmarshal([]byte(partsJSON), &parts); err != nil {
+		return nil, nil, err
+	}
+
+	return upload, parts, nil
+}
+
+// AddDigitalUploadPart stores a chunk that starts at offset. The offset must
+// be the number of bytes received so far, so a chunk that was sent twice or
+// out of order is refused with errors.ErrUploadOffset.
+func (q *ProductQueries) AddDigitalUploadPart(ctx context.Context, productID, uploadID string, offset int64, chunk []byte) (*models.DigitalUpload, error) {
+	upload, _, err := q.digitalUpload(ctx, productID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if offset != upload.Offset {
+		return upload, errors.ErrUploadOffset
+	}
+	if offset+int64(len(chunk)) > upload.Size {
+		return upload, errors.ErrUploadTooLarge
+	}
+	if len(chunk) == 0 {
+		return upload, nil
+	}
+
+	key := storage.PartKey(uploadID, fmt.Sprintf("%d_%s", offset, security.RandomString()))
+	if err := storage.Files().Put(ctx, key, bytes.NewReader(chunk), int64(len(chunk)), "application/octet-stream"); err != nil {
+		return nil, err
+	}
+
+	// the offset is checked again while updating, so of two requests racing
+	// for the same offset only one is counted
+	query := `
+		UPDATE digital_upload
+		SET received = received + ?, parts = json_insert(parts, '$[#]', ?), updated = datetime('now')
+		WHERE id = ? AND product_id = ? AND received = ?
+	`
+	result, err := q.DB.ExecContext(ctx, query, len(chunk), key, uploadID, productID, offset)
+	if err == nil {
+		var affected int64
+		if affected, err = result.RowsAffected(); err == nil && affected == 0 {
+			err = errors.ErrUploadOffset
+		}
+	}
+	if err != nil {
+		_ = storage.Files().Delete(ctx, key)
+		if err == errors.ErrUploadOffset {
+			if current, errUpload := q.DigitalUpload(ctx, productID, uploadID); errUpload == nil {
+				return current, err
+			}
+		}
+		return nil, err
+	}
+
+	return q.DigitalUpload(ctx, productID, uploadID)
+}
+
+// CompleteDigitalUpload joins the parts of a fully received upload into the
+// digital file fileUUID.fileExt and adds it to the product. When the upload
+// declared a checksum that the joined file does not match, the upload is
+// dropped and errors.ErrUploadChecksum is returned.
+func (q *ProductQueries) CompleteDigitalUpload(ctx context.Context, productID, uploadID, fileUUID, fileExt string) (*models.File, error) {
+	upload, partKeys, err := q.digitalUpload(ctx, productID, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Offset != upload.Size {
+		return nil, errors.ErrUploadOffset
+	}
+
+	hash := sha256.New()
+	key := storage.DigitalKey(fmt.Sprintf("%s.%s", fileUUID, fileExt))
+	parts := &partsReader{ctx: ctx, keys: partKeys}
+	defer parts.Close()
+	if err := storage.Files().Put(ctx, key, io.TeeReader(parts, hash), upload.Size, ""); err != nil {
+		return nil, err
+	}
+
+	if upload.SHA256 != "" && hex.EncodeToString(hash.Sum(nil)) != upload.SHA256 {
+		_ = storage.Files().Delete(ctx, key)
+		if err := q.DeleteDigitalUpload(ctx, productID, uploadID); err != nil {
+			return nil, err
+		}
+		return nil, errors.ErrUploadChecksum
+	}
+
+	file, err := q.AddDigitalFile(ctx, productID, upload.VersionID, fileUUID, fileExt, upload.Name)
+	if err != nil {
+		_ = storage.Files().Delete(ctx, key)
+		return nil, err
+	}
+
+	if err := q.DeleteDigitalUpload(ctx, productID, uploadID); err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// DeleteDigitalUpload aborts an upload and removes its parts.
+func (q *ProductQueries) DeleteDigitalUpload(ctx context.Context, productID, uploadID string) error {
+	var partsJSON string
+	err := q.DB.QueryRowContext(ctx, `DELETE FROM digital_upload WHERE id = ? AND product_id = ? RETURNING parts`, uploadID, productID).Scan(&partsJSON)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.ErrUploadNotFound
+		}
+		return err
+	}
+
+	return deleteUploadParts(ctx, partsJSON)
+}
+
+// CleanupDigitalUploads removes the uploads that received nothing since
+// before, and those whose product was deleted, with their parts. It returns
+// the number of removed uploads.
+func (q *ProductQueries) CleanupDigitalUploads(ctx context.Context, before time.Time) (int, error) {
+	query := `
+		DELETE FROM digital_upload
+		WHERE updated < datetime(?, 'unixepoch') OR product_id NOT IN (SELECT id FROM product)
+		RETURNING parts
+	`
+	rows, err := q.DB.QueryContext(ctx, query, before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	removed := []string{}
+	for rows.Next() {
+		var partsJSON string
+		if err := rows.Scan(&partsJSON); err != nil {
+			return 0, err
+		}
+		removed = append(removed, partsJSON)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	_ = rows.Close()
+
+	for _, partsJSON := range removed {
+		if err := deleteUploadParts(ctx, partsJSON); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(removed), nil
+}
+
+// deleteUploadParts removes the parts listed in the parts column of an upload.
+func deleteUploadParts(ctx context.Context, partsJSON string) error {
+	parts := []string{}
+	if err := json.Unmarshal([]byte(partsJSON), &parts); err != nil {
+		return err
+	}
+
+	for _, key := range parts {
+		if err := storage.Files().Delete(ctx, key); err != nil {
+			return fmt.Errorf("failed to remove part %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// partsReader reads the parts of an upload one after another, opening each
+// part only when the previous one is used up.
+type partsReader struct {
+	ctx     context.Context
+	keys    []string
+	current io.ReadCloser
+}
+
+func (r *partsReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.keys) == 0 {
+				return 0, io.EOF
+			}
+			object, err := storage.Files().Get(r.ctx, r.keys[0])
+			if err != nil {
+				return 0, fmt.Errorf("part %s: %w", r.keys[0], err)
+			}
+			r.current, r.keys = object.Body, r.keys[1:]
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			_ = r.current.Close()
+			r.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// Close closes the part that is being read.
+func (r *partsReader) Close() {
+	if r.current != nil {
+		_ = r.current.Close()
+		r.current = nil
+	}
+}
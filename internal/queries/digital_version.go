@@ -0,0 +1,323 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/internal/storage"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/litepay"
+	"github.com/shurco/litecart/pkg/security"
+)
+
+// cartVersion selects the version of a product that a paid cart gets: the
+// current version when buyers get free updates, otherwise the newest version
+// released before the cart was paid. It takes the product ID, the free
+// updates flag and the cart ID twice.
+const cartVersion = `
+	SELECT id FROM digital_version
+	WHERE product_id = ? AND released IS NOT NULL
+	ORDER BY
+		CASE WHEN ? THEN current ELSE released <= COALESCE(
+			(SELECT MIN(created) FROM cart_status_history WHERE cart_id = ? AND to_status = 'paid'),
+			(SELECT COALESCE(updated, created) FROM cart WHERE id = ?)
+		) END DESC,
+		released DESC
+	LIMIT 1
+`
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// FreeUpdates reports whether buyers of files get every new version. It is
+// on unless the digital_free_updates setting turns it off.
+func (q *ProductQueries) FreeUpdates(ctx context.Context) (bool, error) {
+	setting, err := db.GetSettingByKey(ctx, "digital_free_updates")
+	if err != nil {
+		return false, err
+	}
+	value, ok := setting["digital_free_updates"]
+	if !ok {
+		return true, nil
+	}
+	free, err := strconv.ParseBool(fmt.Sprint(value.Value))
+	if err != nil {
+		return true, nil
+	}
+	return free, nil
+}
+
+// cartFiles returns the files of a product that a paid cart gets: the
+// shared files and the ones of the variants bought in the cart.
+func cartFiles(ctx context.Context, q queryer, cartID, productID string, freeUpdates bool) ([]models.File, error) {
+	query := `
+		SELECT id, name, ext, orig_name, version_id, IFNULL(variant_id, '') FROM digital_file
+		WHERE version_id = (` + cartVersion + `) AND (variant_id IS NULL OR variant_id IN (` + cartVariants + `))
+		ORDER BY rowid
+	`
+	rows, err := q.QueryContext(ctx, query, productID, freeUpdates, cartID, cartID, cartID, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	files := []models.File{}
+	for rows.Next() {
+		file := models.File{}
+		if err := rows.Scan(&file.ID, &file.Name, &file.Ext, &file.OrigName, &file.VersionID, &file.VariantID); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+// DigitalVersions returns the versions of a product, newest first.
+func (q *ProductQueries) DigitalVersions(ctx context.Context, productID string) ([]models.Version, error) {
+	query := `
+		SELECT id, version, changelog, current,
+			IFNULL(strftime('%s', released), 0), IFNULL(strftime('%s', notified), 0), strftime('%s', created)
+		FROM digital_version
+		WHERE product_id = ?
+		ORDER BY created DESC, rowid DESC
+	`
+	rows, err := q.DB.QueryContext(ctx, query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	versions := []models.Version{}
+	for rows.Next() {
+		version := models.Version{}
+		if err := rows.Scan(&version.ID, &version.Version, &version.Changelog, &version.Current,
+			&version.Released, &version.Notified, &version.Created); err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
+
+// DigitalVersion returns a version of a product.
+func (q *ProductQueries) DigitalVersion(ctx context.Context, productID, versionID string) (*models.Version, error) {
+	versions, err := q.DigitalVersions(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	for _, version := range versions {
+		if version.ID == versionID {
+			return &version, nil
+		}
+	}
+	return nil, errors.ErrVersionNotFound
+}
+
+// AddDigitalVersion adds a draft version to a product that sells files. The
+// files are uploaded to the draft, and buyers get them once it is released.
+// The first version of a product is released right away.
+func (q *ProductQueries) AddDigitalVersion(ctx context.Context, productID string, version *models.Version) (*models.Version, error) {
+	var digitalType string
+	err := q.DB.QueryRowContext(ctx, `SELECT IFNULL(digital, '') FROM product WHERE id = ?`, productID).Scan(&digitalType)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.ErrProductNotFound
+		}
+		return nil, err
+	}
+	if digitalType != "file" {
+		return nil, errors.ErrProductNoFile
+	}
+
+	query := `
+		INSERT INTO digital_version (id, product_id, version, changelog, current, released)
+		SELECT ?, ?, ?, ?, NOT EXISTS(SELECT 1 FROM digital_version WHERE product_id = ? AND current), NULL
+	`
+	id := security.RandomString()
+	if _, err := q.DB.ExecContext(ctx, query, id, productID, version.Version, version.Changelog, productID); err != nil {
+		return nil, err
+	}
+	if _, err := q.DB.ExecContext(ctx, `UPDATE digital_version SET released = datetime('now') WHERE id = ? AND current`, id); err != nil {
+		return nil, err
+	}
+
+	return q.DigitalVersion(ctx, productID, id)
+}
+
+// UpdateDigitalVersion changes the name and the changelog of a version.
+func (q *ProductQueries) UpdateDigitalVersion(ctx context.Context, productID string, version *models.Version) error {
+	result, err := q.DB.ExecContext(ctx, `UPDATE digital_version SET version = ?, changelog = ? WHERE id = ? AND product_id = ?`,
+		version.Version, version.Changelog, version.ID, productID)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		if err != nil {
+			return err
+		}
+		return errors.ErrVersionNotFound
+	}
+	return nil
+}
+
+// ReleaseDigitalVersion makes a version with files the current one. The
+// older versions are kept, so a previous version can be made current again.
+func (q *ProductQueries) ReleaseDigitalVersion(ctx context.Context, productID, versionID string) error {
+	tx, err := q.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var files int
+	err = tx.QueryRowContext(ctx, `
+		SELECT COUNT(digital_file.id)
+		FROM digital_version
+		LEFT JOIN digital_file ON digital_file.version_id = digital_version.id
+		WHERE digital_version.id = ? AND digital_version.product_id = ?
+		GROUP BY digital_version.id
+	`, versionID, productID).Scan(&files)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.ErrVersionNotFound
+		}
+		return err
+	}
+	if files == 0 {
+		return errors.ErrVersionNoFiles
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE digital_version SET current = FALSE WHERE product_id = ? AND current AND id != ?`, productID, versionID); err != nil {
+		return err
+	}
+	query := `UPDATE digital_version SET current = TRUE, released = IFNULL(released, datetime('now')) WHERE id = ?`
+	if _, err := tx.ExecContext(ctx, query, versionID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteDigitalVersion removes a version that is not current with its files.
+func (q *ProductQueries) DeleteDigitalVersion(ctx context.Context, productID, versionID string) error {
+	version, err := q.DigitalVersion(ctx, productID, versionID)
+	if err != nil {
+		return err
+	}
+	if version.Current {
+		return errors.ErrVersionCurrent
+	}
+
+	rows, err := q.DB.QueryContext(ctx, `DELETE FROM digital_file WHERE version_id = ? RETURNING name, ext`, versionID)
+	if err != nil {
+		return err
+	}
+	keys := []string{}
+	for rows.Next() {
+		var name, ext string
+		if err := rows.Scan(&name, &ext); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		keys = append(keys, storage.DigitalKey(fmt.Sprintf("%s.%s", name, ext)))
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return err
+	}
+	_ = rows.Close()
+
+	if _, err := q.DB.ExecContext(ctx, `DELETE FROM digital_version WHERE id = ?`, versionID); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := storage.Files().Delete(ctx, key); err != nil {
+			return fmt.Errorf("failed to remove file %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// uploadVersion returns the version files are uploaded to: the given one,
+// which must belong to the product, or the current version. A product
+// without versions gets its first version.
+func (q *ProductQueries) uploadVersion(ctx context.Context, productID, versionID string) (string, error) {
+	if versionID != "" {
+		if _, err := q.DigitalVersion(ctx, productID, versionID); err != nil {
+			return "", err
+		}
+		return versionID, nil
+	}
+
+	err := q.DB.QueryRowContext(ctx, `SELECT id FROM digital_version WHERE product_id = ? AND current`, productID).Scan(&versionID)
+	if err == nil {
+		return versionID, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", err
+	}
+
+	version, err := q.AddDigitalVersion(ctx, productID, &models.Version{Version: "1"})
+	if err != nil {
+		return "", err
+	}
+	return version.ID, nil
+}
+
+// MarkDigitalVersionNotified records that the buyers were told about the
+// current version of a product, and returns the paid carts to tell, one
+// per email, newest first. It fails unless buyers get free updates.
+func (q *ProductQueries) MarkDigitalVersionNotified(ctx context.Context, productID, versionID string) ([]string, error) {
+	version, err := q.DigitalVersion(ctx, productID, versionID)
+	if err != nil {
+		return nil, err
+	}
+	if !version.Current {
+		return nil, errors.ErrVersionNotCurrent
+	}
+	free, err := q.FreeUpdates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !free {
+		return nil, errors.ErrFreeUpdatesOff
+	}
+
+	query := `
+		SELECT id FROM (
+			SELECT id, ROW_NUMBER() OVER (PARTITION BY lower(email) ORDER BY created DESC, rowid DESC) AS n
+			FROM cart
+			WHERE payment_status = ? AND email IS NOT NULL AND email != ''
+				AND ? IN (SELECT json_extract(value, '$.id') FROM json_each(cart.cart))
+		)
+		WHERE n = 1
+	`
+	rows, err := q.DB.QueryContext(ctx, query, litepay.PAID, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	carts := []string{}
+	for rows.Next() {
+		var cartID string
+		if err := rows.Scan(&cartID); err != nil {
+			return nil, err
+		}
+		carts = append(carts, cartID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := q.DB.ExecContext(ctx, `UPDATE digital_version SET notified = datetime('now') WHERE id = ?`, versionID); err != nil {
+		return nil, err
+	}
+	return carts, nil
+}
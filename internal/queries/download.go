@@ -0,0 +1,172 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/litepay"
+	"github.com/shurco/litecart/pkg/security"
+)
+
+// DownloadLinkLifetime is how long a download link sent to the buyer stays
+// valid when the product does not set its own lifetime.
+const DownloadLinkLifetime = 7 * 24 * time.Hour
+
+// DownloadQueries is a struct that embeds a pointer to an sql.DB.
+// This allows for direct access to all the methods of sql.DB through DownloadQueries.
+type DownloadQueries struct {
+	*sql.DB
+}
+
+// DownloadLifetime converts the link lifetime of a product, in hours, into a duration.
+func DownloadLifetime(hours int) time.Duration {
+	if hours <= 0 {
+		return DownloadLinkLifetime
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// DownloadURL returns a link to a file bought with the cart, signed with the
+// download secret and valid until expires.
+func DownloadURL(domain, secret, cartID, fileID string, expires time.Time) string {
+	return fmt.Sprintf("https://%s/download/%s", domain, security.SignToken(secret, cartID+"."+fileID, expires))
+}
+
+// DownloadFile returns the file a download token points to and the ID of the
+// download it records. The file must belong to a product of a paid or
+// partially refunded cart, and the cart must not have used up the download
+// limit of the product.
+func (q *DownloadQueries) DownloadFile(ctx context.Context, token, ip, userAgent string) (*models.File, string, error) {
+	settings, err := db.GetSettingByKey(ctx, "download_secret")
+	if err != nil {
+		return nil, "", err
+	}
+	secret, _ := settings["download_secret"].Value.(string)
+	if secret == "" {
+		return nil, "", errors.ErrSettingNotFound
+	}
+
+	payload, err := security.ParseToken(secret, token, time.Now())
+	if err != nil {
+		return nil, "", err
+	}
+	cartID, fileID, ok := strings.Cut(payload, ".")
+	if !ok {
+		return nil, "", errors.ErrTokenInvalid
+	}
+
+	query := `
+		SELECT digital_file.id, digital_file.name, digital_file.ext, digital_file.orig_name, product.id, product.download_limit
+		FROM digital_file
+		JOIN product ON product.id = digital_file.product_id
+		JOIN cart ON cart.id = ? AND cart.payment_status IN (?, ?)
+		WHERE digital_file.id = ?
+			AND product.id IN (SELECT json_extract(value, '$.id') FROM json_each(cart.cart))
+	`
+
+	file := &models.File{}
+	var productID string
+	var limit int
+	err = q.DB.QueryRowContext(ctx, query, cartID, litepay.PAID, litepay.PARTIALLY_REFUNDED, fileID).Scan(&file.ID, &file.Name, &file.Ext, &file.OrigName, &productID, &limit)
+	if err == sql.ErrNoRows {
+		return nil, "", errors.ErrFileNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	// only the files of the version and the variants the cart gets can be downloaded
+	freeUpdates, err := db.FreeUpdates(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	files, err := cartFiles(ctx, q.DB, cartID, productID, freeUpdates)
+	if err != nil {
+		return nil, "", err
+	}
+	if !slices.ContainsFunc(files, func(f models.File) bool { return f.ID == file.ID }) {
+		return nil, "", errors.ErrFileNotFound
+	}
+
+	// the limit is checked in the same statement, so parallel requests cannot exceed it
+	downloadID := security.RandomString()
+	result, err := q.DB.ExecContext(ctx, `
+		INSERT INTO download (id, cart_id, file_id, ip, user_agent)
+		SELECT ?, ?, ?, ?, ?
+		WHERE ? = 0 OR (SELECT COUNT(*) FROM download WHERE cart_id = ? AND file_id = ? AND counted) < ?
+	`, downloadID, cartID, fileID, ip, userAgent, limit, cartID, fileID, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	recorded, err := result.RowsAffected()
+	if err != nil {
+		return nil, "", err
+	}
+	if recorded == 0 {
+		return nil, "", errors.ErrDownloadLimitReached
+	}
+
+	return file, downloadID, nil
+}
+
+// CancelDownload removes a download recorded by DownloadFile when the file
+// could not be sent, so it does not count against the download limit.
+func (q *DownloadQueries) CancelDownload(ctx context.Context, id string) error {
+	_, err := q.DB.ExecContext(ctx, `DELETE FROM download WHERE id = ?`, id)
+	return err
+}
+
+// Downloads returns the downloads of a cart, newest first.
+func (q *DownloadQueries) Downloads(ctx context.Context, cartID string) ([]models.Download, error) {
+	downloads := []models.Download{}
+
+	query := `
+		SELECT download.id, download.cart_id, download.file_id, IFNULL(digital_file.orig_name, ''),
+			download.ip, download.user_agent, download.counted, strftime('%s', download.created)
+		FROM download
+		LEFT JOIN digital_file ON digital_file.id = download.file_id
+		WHERE download.cart_id = ?
+		ORDER BY download.created DESC, download.rowid DESC
+	`
+
+	rows, err := q.DB.QueryContext(ctx, query, cartID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		download := models.Download{}
+		if err := rows.Scan(
+			&download.ID,
+			&download.CartID,
+			&download.FileID,
+			&download.FileName,
+			&download.IP,
+			&download.UserAgent,
+			&download.Counted,
+			&download.Created,
+		); err != nil {
+			return nil, err
+		}
+		downloads = append(downloads, download)
+	}
+
+	return downloads, rows.Err()
+}
+
+// ResetDownloads stops counting the past downloads of a cart against the
+// download limit. The downloads stay in the history.
+func (q *DownloadQueries) ResetDownloads(ctx context.Context, cartID string) (int64, error) {
+	result, err := q.DB.ExecContext(ctx, `UPDATE download SET counted = FALSE WHERE cart_id = ? AND counted`, cartID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,88 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/pkg/security"
+)
+
+// FulfillmentQueries is a struct that embeds a pointer to an sql.DB.
+// This allows for direct access to all the methods of sql.DB through FulfillmentQueries.
+type FulfillmentQueries struct {
+	*sql.DB
+}
+
+// Fulfillments returns the fulfillments of the "api" products of a cart.
+func (q *FulfillmentQueries) Fulfillments(ctx context.Context, cartID string) ([]models.Fulfillment, error) {
+	fulfillments := []models.Fulfillment{}
+
+	query := `
+		SELECT id, cart_id, product_id, content, error, attempts, letter, strftime('%s', created), IFNULL(strftime('%s', updated), 0)
+		FROM fulfillment
+		WHERE cart_id = ?
+		ORDER BY created, rowid
+	`
+
+	rows, err := q.DB.QueryContext(ctx, query, cartID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		fulfillment := models.Fulfillment{}
+		if err := rows.Scan(
+			&fulfillment.ID,
+			&fulfillment.CartID,
+			&fulfillment.ProductID,
+			&fulfillment.Content,
+			&fulfillment.Error,
+			&fulfillment.Attempts,
+			&fulfillment.Letter,
+			&fulfillment.Created,
+			&fulfillment.Updated,
+		); err != nil {
+			return nil, err
+		}
+		fulfillments = append(fulfillments, fulfillment)
+	}
+
+	return fulfillments, rows.Err()
+}
+
+// SaveFulfillment records an attempt to fulfill a product of a cart: the
+// content on success or the error on failure.
+func (q *FulfillmentQueries) SaveFulfillment(ctx context.Context, cartID, productID, content, lastError string) error {
+	query := `
+		INSERT INTO fulfillment (id, cart_id, product_id, content, error, attempts)
+		VALUES (?, ?, ?, ?, ?, 1)
+		ON CONFLICT (cart_id, product_id) DO UPDATE SET
+			content = excluded.content,
+			error = excluded.error,
+			attempts = attempts + 1,
+			updated = datetime('now')
+	`
+	_, err := q.DB.ExecContext(ctx, query, security.RandomString(), cartID, productID, content, lastError)
+	return err
+}
+
+// MarkFulfillmentsSent records that the content of the listed products went
+// out in the access letter. Content already sent in the purchase letter is
+// left as it is.
+func (q *FulfillmentQueries) MarkFulfillmentsSent(ctx context.Context, cartID string, productIDs ...string) error {
+	if len(productIDs) == 0 {
+		return nil
+	}
+
+	args := []any{models.FulfillmentLetterAccess, cartID}
+	for _, id := range productIDs {
+		args = append(args, id)
+	}
+	query := fmt.Sprintf(`UPDATE fulfillment SET letter = ? WHERE cart_id = ? AND letter = '' AND product_id IN (%s)`, strings.Repeat("?, ", len(productIDs)-1)+"?")
+	_, err := q.DB.ExecContext(ctx, query, args...)
+	return err
+}
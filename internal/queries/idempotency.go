@@ -0,0 +1,58 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/shurco/litecart/internal/models"
+)
+
+// idempotencyKeyTTL is how long a client may replay a payment request, in SQLite modifier syntax.
+const idempotencyKeyTTL = "-24 hours"
+
+// ReserveIdempotencyKey claims an idempotency key for a request.
+// It returns nil when the key was free and is now held by the caller,
+// otherwise the stored key, which has an empty CartID while the first
+// request is still in progress.
+func (q *CartQueries) ReserveIdempotencyKey(ctx context.Context, key, requestHash string) (*models.IdempotencyKey, error) {
+	if _, err := q.DB.ExecContext(ctx, `DELETE FROM idempotency_key WHERE created < datetime('now', ?)`, idempotencyKeyTTL); err != nil {
+		return nil, err
+	}
+
+	result, err := q.DB.ExecContext(ctx, `INSERT OR IGNORE INTO idempotency_key (key, request_hash) VALUES (?, ?)`, key, requestHash)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected == 1 {
+		return nil, nil
+	}
+
+	stored := &models.IdempotencyKey{Key: key}
+	err = q.DB.QueryRowContext(ctx, `SELECT request_hash, cart_id, payment_url FROM idempotency_key WHERE key = ?`, key).
+		Scan(&stored.RequestHash, &stored.CartID, &stored.PaymentURL)
+	if err == sql.ErrNoRows {
+		// expired and removed between the two statements
+		return q.ReserveIdempotencyKey(ctx, key, requestHash)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return stored, nil
+}
+
+// SaveIdempotencyKey stores the outcome of the request holding the key.
+func (q *CartQueries) SaveIdempotencyKey(ctx context.Context, key, cartID, paymentURL string) error {
+	_, err := q.DB.ExecContext(ctx, `UPDATE idempotency_key SET cart_id = ?, payment_url = ? WHERE key = ?`, cartID, paymentURL, key)
+	return err
+}
+
+// ReleaseIdempotencyKey frees a key whose request failed so the client can retry.
+func (q *CartQueries) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	_, err := q.DB.ExecContext(ctx, `DELETE FROM idempotency_key WHERE key = ? AND cart_id = ''`, key)
+	return err
+}
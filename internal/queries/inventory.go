@@ -0,0 +1,366 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/litepay"
+	"github.com/shurco/litecart/pkg/security"
+)
+
+// inventoryMovements is the number of the latest stock movements returned
+// with the inventory of a product.
+const inventoryMovements = 100
+
+// activeReservation matches the stock_reservation rows that still hold stock:
+// the ones that have not expired, and the ones of carts whose payment is
+// being processed, which have no reservation time.
+var activeReservation = "(stock_reservation.reserved IS NULL OR stock_reservation.reserved >= " + reservationExpired + ")"
+
+// productStockLeft is the tracked stock of a product less the units held by
+// unpaid carts, NULL if the stock is not tracked.
+var productStockLeft = `(product.stock - (SELECT IFNULL(SUM(quantity), 0) FROM stock_reservation
+	WHERE stock_reservation.product_id = product.id AND ` + activeReservation + `))`
+
+// variantStockLeft is the same for a variant of a product.
+var variantStockLeft = `(product_variant.stock - (SELECT IFNULL(SUM(quantity), 0) FROM stock_reservation
+	WHERE stock_reservation.variant_id = product_variant.id AND ` + activeReservation + `))`
+
+// stockLeft returns the lowest of the limits on the units that can be bought,
+// never below 0, or nil if none of them is set.
+func stockLeft(limits ...*int) *int {
+	var left *int
+	for _, limit := range limits {
+		if limit != nil && (left == nil || *limit < *left) {
+			n := max(*limit, 0)
+			left = &n
+		}
+	}
+	return left
+}
+
+// productInStock reports whether a product, or one of its variants if it has
+// any, can still be bought.
+func productInStock(product *models.Product) bool {
+	if len(product.Variants) == 0 {
+		return product.Stock == nil || *product.Stock > 0
+	}
+	for _, variant := range product.Variants {
+		if variant.Stock == nil || *variant.Stock > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Inventory returns the stock of a product and its variants with the latest
+// stock movements.
+func (q *ProductQueries) Inventory(ctx context.Context, productID string) (*models.Inventory, error) {
+	inventory := &models.Inventory{
+		Levels:    []models.StockLevel{},
+		Movements: []models.StockMovement{},
+	}
+
+	reserved := `(SELECT IFNULL(SUM(quantity), 0) FROM stock_reservation WHERE %s AND ` + activeReservation + `)`
+
+	level := models.StockLevel{}
+	var stock sql.NullInt64
+	err := q.DB.QueryRowContext(ctx, `SELECT name, stock, `+fmt.Sprintf(reserved, "stock_reservation.product_id = product.id")+` FROM product WHERE id = ?`, productID).
+		Scan(&level.Name, &stock, &level.Reserved)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.ErrProductNotFound
+		}
+		return nil, err
+	}
+	level.Stock = nullableInt(stock)
+	inventory.Levels = append(inventory.Levels, level)
+
+	rows, err := q.DB.QueryContext(ctx, `
+		SELECT id, name, stock, `+fmt.Sprintf(reserved, "stock_reservation.variant_id = product_variant.id")+`
+		FROM product_variant WHERE product_id = ?
+		ORDER BY position, rowid
+	`, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		level := models.StockLevel{}
+		if err := rows.Scan(&level.VariantID, &level.Name, &stock, &level.Reserved); err != nil {
+			return nil, err
+		}
+		level.Stock = nullableInt(stock)
+		inventory.Levels = append(inventory.Levels, level)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	movements, err := q.DB.QueryContext(ctx, `
+		SELECT id, product_id, variant_id, change, stock, reason, cart_id, note, strftime('%s', created)
+		FROM stock_movement WHERE product_id = ?
+		ORDER BY created DESC, rowid DESC
+		LIMIT ?
+	`, productID, inventoryMovements)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = movements.Close() }()
+
+	for movements.Next() {
+		movement := models.StockMovement{}
+		if err := movements.Scan(&movement.ID, &movement.ProductID, &movement.VariantID, &movement.Change, &movement.Stock,
+			&movement.Reason, &movement.CartID, &movement.Note, &movement.Created); err != nil {
+			return nil, err
+		}
+		inventory.Movements = append(inventory.Movements, movement)
+	}
+
+	return inventory, movements.Err()
+}
+
+// AdjustStock changes the stock of a product, or of one of its variants, by
+// hand and logs the movement. Stock that is not tracked yet starts from 0.
+func (q *ProductQueries) AdjustStock(ctx context.Context, productID string, adjustment *models.StockAdjustment) (*models.StockMovement, error) {
+	tx, err := q.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var stock int
+	if adjustment.VariantID == "" {
+		err = tx.QueryRowContext(ctx, `UPDATE product SET stock = IFNULL(stock, 0) + ? WHERE id = ? RETURNING stock`,
+			adjustment.Change, productID).Scan(&stock)
+		if err == sql.ErrNoRows {
+			return nil, errors.ErrProductNotFound
+		}
+	} else {
+		err = tx.QueryRowContext(ctx, `UPDATE product_variant SET stock = IFNULL(stock, 0) + ? WHERE id = ? AND product_id = ? RETURNING stock`,
+			adjustment.Change, adjustment.VariantID, productID).Scan(&stock)
+		if err == sql.ErrNoRows {
+			return nil, errors.ErrVariantNotFound
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stock < 0 {
+		return nil, errors.ErrStockNegative
+	}
+
+	movement := &models.StockMovement{
+		ProductID: productID,
+		VariantID: adjustment.VariantID,
+		Change:    adjustment.Change,
+		Stock:     stock,
+		Reason:    models.StockMovementAdjustment,
+		Note:      adjustment.Note,
+	}
+	if err := addStockMovement(ctx, tx, movement); err != nil {
+		return nil, err
+	}
+
+	return movement, tx.Commit()
+}
+
+// UntrackStock stops tracking the stock of a product, or of one of its
+// variants, so it can be bought without a limit.
+func (q *ProductQueries) UntrackStock(ctx context.Context, productID, variantID string) error {
+	var result sql.Result
+	var err error
+	if variantID == "" {
+		result, err = q.DB.ExecContext(ctx, `UPDATE product SET stock = NULL WHERE id = ?`, productID)
+	} else {
+		result, err = q.DB.ExecContext(ctx, `UPDATE product_variant SET stock = NULL WHERE id = ? AND product_id = ?`, variantID, productID)
+	}
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		if variantID != "" {
+			return errors.ErrVariantNotFound
+		}
+		return errors.ErrProductNotFound
+	}
+	return nil
+}
+
+// addStockMovement logs a change of stock.
+func addStockMovement(ctx context.Context, q queryer, movement *models.StockMovement) error {
+	movement.ID = security.RandomString()
+	return q.QueryRowContext(ctx, `
+		INSERT INTO stock_movement (id, product_id, variant_id, change, stock, reason, cart_id, note)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING strftime('%s', created)
+	`, movement.ID, movement.ProductID, movement.VariantID, movement.Change, movement.Stock,
+		movement.Reason, movement.CartID, movement.Note).Scan(&movement.Created)
+}
+
+// ReserveStock holds the units of the products and variants of a cart whose
+// stock is tracked until the cart is paid, canceled or the reservation
+// expires. Either the whole cart fits in the stock left or nothing is
+// reserved and errors.ErrItemsOutOfStock is returned.
+func (q *CartQueries) ReserveStock(ctx context.Context, cartID string, products ...models.CartProduct) error {
+	index := map[models.CartProduct]int{}
+	lines := []models.CartProduct{}
+	for _, product := range products {
+		key := models.CartProduct{ProductID: product.ProductID, VariantID: product.VariantID}
+		i, ok := index[key]
+		if !ok {
+			i = len(lines)
+			index[key] = i
+			lines = append(lines, key)
+		}
+		lines[i].Quantity += product.Quantity
+	}
+
+	tx, err := q.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// the first write locks the database, so the stock checked below can
+	// not be reserved by another cart before this one commits
+	for _, line := range lines {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO stock_reservation (cart_id, product_id, variant_id, quantity)
+			SELECT ?, ?, ?, ?
+			WHERE EXISTS(SELECT 1 FROM product WHERE id = ? AND stock IS NOT NULL)
+				OR EXISTS(SELECT 1 FROM product_variant WHERE id = ? AND stock IS NOT NULL)
+		`, cartID, line.ProductID, line.VariantID, line.Quantity, line.ProductID, line.VariantID)
+		if err != nil {
+			return err
+		}
+	}
+
+	var short bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM product
+			WHERE id IN (SELECT product_id FROM stock_reservation WHERE cart_id = ?) AND `+productStockLeft+` < 0
+		) OR EXISTS(
+			SELECT 1 FROM product_variant
+			WHERE id IN (SELECT variant_id FROM stock_reservation WHERE cart_id = ?) AND `+variantStockLeft+` < 0
+		)
+	`, cartID, cartID).Scan(&short)
+	if err != nil {
+		return err
+	}
+	if short {
+		return errors.ErrItemsOutOfStock
+	}
+
+	return tx.Commit()
+}
+
+// ReleaseStock returns the units reserved by a cart that is not paid to the
+// stock.
+func (q *CartQueries) ReleaseStock(ctx context.Context, cartID string) error {
+	_, err := q.DB.ExecContext(ctx, `DELETE FROM stock_reservation WHERE cart_id = ?`, cartID)
+	return err
+}
+
+// settleStock keeps the units reserved by a cart without an expiry while its
+// payment is being processed and returns them to the stock when the cart is
+// canceled or has failed. Once the cart is paid its products and variants are
+// taken out of the stock and the sale is logged.
+func settleStock(ctx context.Context, tx *sql.Tx, cartID string, status litepay.Status) error {
+	switch status {
+	case litepay.PROCESSED:
+		_, err := tx.ExecContext(ctx, `UPDATE stock_reservation SET reserved = NULL WHERE cart_id = ?`, cartID)
+		return err
+	case litepay.CANCELED, litepay.FAILED:
+		_, err := tx.ExecContext(ctx, `DELETE FROM stock_reservation WHERE cart_id = ?`, cartID)
+		return err
+	}
+	if status != litepay.PAID {
+		return nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT json_extract(value, '$.id'), IFNULL(json_extract(value, '$.variant_id'), ''),
+			SUM(json_extract(value, '$.quantity'))
+		FROM json_each((SELECT cart FROM cart WHERE id = ?))
+		WHERE json_extract(value, '$.id') IS NOT NULL
+		GROUP BY 1, 2
+	`, cartID)
+	if err != nil {
+		return err
+	}
+	lines := []models.CartProduct{}
+	for rows.Next() {
+		line := models.CartProduct{}
+		if err := rows.Scan(&line.ProductID, &line.VariantID, &line.Quantity); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		lines = append(lines, line)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// a product bought as several variants takes the units of all of them
+	// out of its own stock
+	totals := map[string]int{}
+	order := []string{}
+	for _, line := range lines {
+		if _, ok := totals[line.ProductID]; !ok {
+			order = append(order, line.ProductID)
+		}
+		totals[line.ProductID] += line.Quantity
+	}
+
+	sell := func(query string, productID, variantID string, quantity int, args ...any) error {
+		var stock int
+		err := tx.QueryRowContext(ctx, query, append([]any{quantity}, args...)...).Scan(&stock)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return addStockMovement(ctx, tx, &models.StockMovement{
+			ProductID: productID,
+			VariantID: variantID,
+			Change:    -quantity,
+			Stock:     stock,
+			Reason:    models.StockMovementSale,
+			CartID:    cartID,
+		})
+	}
+
+	for _, productID := range order {
+		err := sell(`UPDATE product SET stock = MAX(stock - ?, 0) WHERE id = ? AND stock IS NOT NULL RETURNING stock`,
+			productID, "", totals[productID], productID)
+		if err != nil {
+			return err
+		}
+	}
+	for _, line := range lines {
+		if line.VariantID == "" {
+			continue
+		}
+		err := sell(`UPDATE product_variant SET stock = MAX(stock - ?, 0) WHERE id = ? AND product_id = ? AND stock IS NOT NULL RETURNING stock`,
+			line.ProductID, line.VariantID, line.Quantity, line.VariantID, line.ProductID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM stock_reservation WHERE cart_id = ?`, cartID)
+	return err
+}
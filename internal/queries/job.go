@@ -0,0 +1,204 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/security"
+)
+
+// JobRetention is how long a done job is kept for the job list before it is removed.
+const JobRetention = 7 * 24 * time.Hour
+
+// JobQueries is a struct that embeds a pointer to an sql.DB.
+// This allows for direct access to all the methods of sql.DB through JobQueries.
+type JobQueries struct {
+	*sql.DB
+}
+
+const jobColumns = `
+	id,
+	kind,
+	payload,
+	status,
+	attempts,
+	max_attempts,
+	last_error,
+	strftime('%s', run_at),
+	strftime('%s', created),
+	IFNULL(strftime('%s', updated), 0)
+`
+
+// scanJob reads a row selected with jobColumns.
+func scanJob(row interface{ Scan(...any) error }) (*models.Job, error) {
+	job := &models.Job{}
+	err := row.Scan(
+		&job.ID,
+		&job.Kind,
+		&job.Payload,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.LastError,
+		&job.RunAt,
+		&job.Created,
+		&job.Updated,
+	)
+	return job, err
+}
+
+// AddJob stores a new pending job that becomes due immediately.
+func (q *JobQueries) AddJob(ctx context.Context, job *models.Job) error {
+	if job.ID == "" {
+		job.ID = security.RandomString()
+	}
+	job.Status = models.JobPending
+
+	query := `INSERT INTO job (id, kind, payload, status, max_attempts) VALUES (?, ?, ?, ?, ?) RETURNING strftime('%s', run_at), strftime('%s', created)`
+	return q.DB.QueryRowContext(ctx, query, job.ID, job.Kind, job.Payload, job.Status, job.MaxAttempts).Scan(&job.RunAt, &job.Created)
+}
+
+// ClaimJob marks the oldest due pending job as running and returns it,
+// counting the attempt. It returns nil when no job is due.
+func (q *JobQueries) ClaimJob(ctx context.Context) (*models.Job, error) {
+	query := `
+		UPDATE job
+		SET status = 'running', attempts = attempts + 1, updated = datetime('now')
+		WHERE id = (
+			SELECT id FROM job
+			WHERE status = 'pending' AND run_at <= datetime('now')
+			ORDER BY run_at, rowid
+			LIMIT 1
+		) AND status = 'pending'
+		RETURNING` + jobColumns
+
+	job, err := scanJob(q.DB.QueryRowContext(ctx, query))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// CompleteJob marks a running job as done.
+func (q *JobQueries) CompleteJob(ctx context.Context, id string) error {
+	_, err := q.DB.ExecContext(ctx, `UPDATE job SET status = 'done', last_error = '', updated = datetime('now') WHERE id = ?`, id)
+	return err
+}
+
+// FailJob records a failed attempt. The job is scheduled again after delay,
+// or becomes dead when it has used all of its attempts.
+func (q *JobQueries) FailJob(ctx context.Context, id, lastError string, delay time.Duration) error {
+	query := `
+		UPDATE job
+		SET status = CASE WHEN attempts >= max_attempts THEN 'dead' ELSE 'pending' END,
+			last_error = ?,
+			run_at = datetime('now', ?),
+			updated = datetime('now')
+		WHERE id = ?
+	`
+	_, err := q.DB.ExecContext(ctx, query, lastError, fmt.Sprintf("+%d seconds", int(delay.Seconds())), id)
+	return err
+}
+
+// CleanupJobs removes the jobs that were done before the given time and
+// returns how many were removed. Pending and dead jobs are kept.
+func (q *JobQueries) CleanupJobs(ctx context.Context, before time.Time) (int64, error) {
+	result, err := q.DB.ExecContext(ctx, `DELETE FROM job WHERE status = 'done' AND updated < datetime(?, 'unixepoch')`, before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ResetRunningJobs returns jobs left running by a stopped process to the queue.
+func (q *JobQueries) ResetRunningJobs(ctx context.Context) error {
+	_, err := q.DB.ExecContext(ctx, `UPDATE job SET status = 'pending', updated = datetime('now') WHERE status = 'running'`)
+	return err
+}
+
+// RetryJob makes a pending or dead job due now with a fresh set of attempts.
+func (q *JobQueries) RetryJob(ctx context.Context, id string) (*models.Job, error) {
+	query := `
+		UPDATE job
+		SET status = 'pending', attempts = 0, run_at = datetime('now'), updated = datetime('now')
+		WHERE id = ? AND status IN ('pending', 'dead')
+		RETURNING` + jobColumns
+
+	job, err := scanJob(q.DB.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		if _, err := q.Job(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, errors.ErrJobNotRetryable
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// Job returns a job by its id.
+func (q *JobQueries) Job(ctx context.Context, id string) (*models.Job, error) {
+	job, err := scanJob(q.DB.QueryRowContext(ctx, `SELECT`+jobColumns+`FROM job WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// Jobs returns jobs, newest first, optionally filtered by status,
+// together with the total number of matching jobs.
+func (q *JobQueries) Jobs(ctx context.Context, status models.JobStatus, limit, offset int) ([]*models.Job, int, error) {
+	jobs := []*models.Job{}
+
+	where := ""
+	var params []any
+	if status != "" {
+		where = " WHERE status = ?"
+		params = append(params, status)
+	}
+
+	var total int
+	if err := q.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM job`+where, params...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT` + jobColumns + `FROM job` + where + ` ORDER BY created DESC, rowid DESC`
+	if limit > 0 {
+		query += " LIMIT ?"
+		params = append(params, limit)
+		if offset > 0 {
+			query += " OFFSET ?"
+			params = append(params, offset)
+		}
+	}
+
+	rows, err := q.DB.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, total, rows.Err()
+}
@@ -0,0 +1,312 @@
+package queries
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/litepay"
+	"github.com/shurco/litecart/pkg/security"
+)
+
+// LicenseQueries is a struct that embeds a pointer to an sql.DB.
+// This allows for direct access to all the methods of sql.DB through LicenseQueries.
+type LicenseQueries struct {
+	*sql.DB
+}
+
+// licenseKey is a sold key that can be activated.
+type licenseKey struct {
+	dataID          string
+	productID       string
+	activationLimit int
+}
+
+// soldKey finds a key that was sold in a paid cart. Keys of refunded carts
+// are no longer found.
+func (q *LicenseQueries) soldKey(ctx context.Context, request *models.LicenseRequest) (*licenseKey, error) {
+	key := &licenseKey{}
+	query := `
+		SELECT digital_data.id, digital_data.product_id, product.activation_limit
+		FROM digital_data
+		JOIN cart ON cart.id = digital_data.cart_id AND cart.payment_status = ?
+		JOIN product ON product.id = digital_data.product_id AND product.digital = 'data'
+		WHERE digital_data.content = ? AND digital_data.reserved IS NULL AND (? = '' OR digital_data.product_id = ?)
+		ORDER BY digital_data.rowid
+		LIMIT 1
+	`
+	err := q.DB.QueryRowContext(ctx, query, litepay.PAID, request.Key, request.ProductID, request.ProductID).
+		Scan(&key.dataID, &key.productID, &key.activationLimit)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrLicenseNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// license returns the state of a key activated on the machine.
+func (q *LicenseQueries) license(ctx context.Context, key *licenseKey, request *models.LicenseRequest) (*models.License, error) {
+	license := &models.License{
+		Key:             request.Key,
+		ProductID:       key.productID,
+		Fingerprint:     request.Fingerprint,
+		ActivationLimit: key.activationLimit,
+		Issued:          time.Now().Unix(),
+	}
+
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM license_activation WHERE data_id = ?),
+			strftime('%s', created)
+		FROM license_activation
+		WHERE data_id = ? AND fingerprint = ?
+	`
+	err := q.DB.QueryRowContext(ctx, query, key.dataID, key.dataID, request.Fingerprint).Scan(&license.Activations, &license.Activated)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrActivationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return license, nil
+}
+
+// ActivateLicense activates a sold key on the machine. Activating it again
+// on the same machine only refreshes the activation. A new machine is
+// rejected with errors.ErrActivationLimitReached once the product limit is used up.
+func (q *LicenseQueries) ActivateLicense(ctx context.Context, request *models.LicenseRequest, ip string) (*models.License, error) {
+	key, err := q.soldKey(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	// the limit is checked in the same statement that adds the machine,
+	// so concurrent activations can not exceed it
+	query := `
+		INSERT INTO license_activation (id, data_id, fingerprint, name, ip)
+		SELECT ?, ?, ?, ?, ?
+		WHERE ? = 0
+			OR EXISTS (SELECT 1 FROM license_activation WHERE data_id = ? AND fingerprint = ?)
+			OR (SELECT COUNT(*) FROM license_activation WHERE data_id = ?) < ?
+		ON CONFLICT (data_id, fingerprint) DO UPDATE SET
+			name = excluded.name,
+			ip = excluded.ip,
+			validated = datetime('now')
+	`
+	result, err := q.DB.ExecContext(ctx, query,
+		security.RandomString(), key.dataID, request.Fingerprint, request.Name, ip,
+		key.activationLimit,
+		key.dataID, request.Fingerprint,
+		key.dataID, key.activationLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	added, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if added == 0 {
+		return nil, errors.ErrActivationLimitReached
+	}
+
+	return q.license(ctx, key, request)
+}
+
+// ValidateLicense checks that a sold key is activated on the machine.
+func (q *LicenseQueries) ValidateLicense(ctx context.Context, request *models.LicenseRequest) (*models.License, error) {
+	key, err := q.soldKey(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := q.DB.ExecContext(ctx,
+		`UPDATE license_activation SET validated = datetime('now') WHERE data_id = ? AND fingerprint = ?`,
+		key.dataID, request.Fingerprint,
+	)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if updated == 0 {
+		return nil, errors.ErrActivationNotFound
+	}
+
+	return q.license(ctx, key, request)
+}
+
+// DeactivateLicense frees the activation of a key on the machine.
+func (q *LicenseQueries) DeactivateLicense(ctx context.Context, request *models.LicenseRequest) error {
+	key, err := q.soldKey(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	result, err := q.DB.ExecContext(ctx, `DELETE FROM license_activation WHERE data_id = ? AND fingerprint = ?`, key.dataID, request.Fingerprint)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return errors.ErrActivationNotFound
+	}
+
+	return nil
+}
+
+// LicenseActivations returns the machines a key of the product is activated on.
+func (q *LicenseQueries) LicenseActivations(ctx context.Context, productID, dataID string) ([]models.LicenseActivation, error) {
+	activations := []models.LicenseActivation{}
+
+	query := `
+		SELECT
+			license_activation.id,
+			license_activation.data_id,
+			license_activation.fingerprint,
+			license_activation.name,
+			license_activation.ip,
+			strftime('%s', license_activation.created),
+			strftime('%s', license_activation.validated)
+		FROM license_activation
+		JOIN digital_data ON digital_data.id = license_activation.data_id AND digital_data.product_id = ?
+		WHERE license_activation.data_id = ?
+		ORDER BY license_activation.created, license_activation.rowid
+	`
+
+	rows, err := q.DB.QueryContext(ctx, query, productID, dataID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		activation := models.LicenseActivation{}
+		if err := rows.Scan(
+			&activation.ID,
+			&activation.DataID,
+			&activation.Fingerprint,
+			&activation.Name,
+			&activation.IP,
+			&activation.Created,
+			&activation.Validated,
+		); err != nil {
+			return nil, err
+		}
+		activations = append(activations, activation)
+	}
+
+	return activations, rows.Err()
+}
+
+// RevokeActivation removes an activation of a key of the product. The
+// machine has to be activated again, which counts against the limit.
+func (q *LicenseQueries) RevokeActivation(ctx context.Context, productID, dataID, activationID string) error {
+	query := `
+		DELETE FROM license_activation
+		WHERE id = ? AND data_id = ? AND data_id IN (SELECT id FROM digital_data WHERE product_id = ?)
+	`
+	result, err := q.DB.ExecContext(ctx, query, activationID, dataID, productID)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return errors.ErrActivationNotFound
+	}
+
+	return nil
+}
+
+// SignLicense signs the license with the store key.
+func (q *LicenseQueries) SignLicense(ctx context.Context, license *models.License) (*models.SignedLicense, error) {
+	key, err := q.signingKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(license)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SignedLicense{
+		License:   license,
+		Payload:   base64.StdEncoding.EncodeToString(payload),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload)),
+	}, nil
+}
+
+// LicensePublicKey returns the base64 public half of the store key, which
+// clients use to verify signed licenses.
+func (q *LicenseQueries) LicensePublicKey(ctx context.Context) (string, error) {
+	key, err := q.signingKey(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)), nil
+}
+
+// signingKey returns the Ed25519 store key kept in the license_private_key
+// setting, generating it on first use.
+func (q *LicenseQueries) signingKey(ctx context.Context) (ed25519.PrivateKey, error) {
+	var value string
+	query := `SELECT value FROM setting WHERE key = 'license_private_key'`
+	if err := q.DB.QueryRowContext(ctx, query).Scan(&value); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.ErrSettingNotFound
+		}
+		return nil, err
+	}
+
+	if value == "" {
+		seed := make([]byte, ed25519.SeedSize)
+		if _, err := rand.Read(seed); err != nil {
+			return nil, err
+		}
+
+		// of two concurrent first uses only one stores its key
+		_, err := q.DB.ExecContext(ctx,
+			`UPDATE setting SET value = ? WHERE key = 'license_private_key' AND value = ''`,
+			base64.StdEncoding.EncodeToString(seed),
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := q.DB.QueryRowContext(ctx, query).Scan(&value); err != nil {
+			return nil, err
+		}
+	}
+
+	seed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("license_private_key must be a base64 Ed25519 seed of %d bytes", ed25519.SeedSize)
+	}
+
+	return ed25519.NewKeyFromSeed(seed), nil
+}
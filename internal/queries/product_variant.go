@@ -0,0 +1,207 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/security"
+)
+
+// cartVariants selects the variants of a product bought in a cart. It takes
+// the cart ID and the product ID. Digital content tied to one of them, or
+// to no variant, goes to the cart.
+const cartVariants = `
+	SELECT json_extract(value, '$.variant_id') FROM json_each((SELECT cart FROM cart WHERE id = ?))
+	WHERE json_extract(value, '$.id') = ?
+`
+
+// ProductVariants returns the variants of a product in the order they are
+// shown, with the units left to buy of each one.
+func (q *ProductQueries) ProductVariants(ctx context.Context, productID string) ([]models.Variant, error) {
+	variants, err := q.productsVariants(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	if variants[productID] == nil {
+		return []models.Variant{}, nil
+	}
+	return variants[productID], nil
+}
+
+// productsVariants returns the variants of the listed products by product ID.
+func (q *ProductQueries) productsVariants(ctx context.Context, productIDs ...string) (map[string][]models.Variant, error) {
+	variants := map[string][]models.Variant{}
+	if len(productIDs) == 0 {
+		return variants, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT product_variant.id, product_variant.product_id, product_variant.name, product_variant.amount,
+			product_variant.sku, product_variant.position, strftime('%%s', product_variant.created),
+			IFNULL(product.digital, '') = 'data', `+variantStockLeft+`, `+productStockLeft+`,
+			(SELECT COUNT(*) FROM digital_data WHERE digital_data.product_id = product_variant.product_id
+				AND (digital_data.variant_id IS NULL OR digital_data.variant_id = product_variant.id) AND `+availableData+`)
+		FROM product_variant
+		JOIN product ON product.id = product_variant.product_id
+		WHERE product_variant.product_id IN (%s)
+		ORDER BY product_variant.position, product_variant.rowid
+	`, strings.Repeat("?, ", len(productIDs)-1)+"?")
+
+	args := make([]any, len(productIDs))
+	for i, id := range productIDs {
+		args[i] = id
+	}
+
+	rows, err := q.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var productID string
+		var sellsKeys bool
+		var variantStock, productStock sql.NullInt64
+		var keys int
+		variant := models.Variant{}
+		if err := rows.Scan(&variant.ID, &productID, &variant.Name, &variant.Amount,
+			&variant.SKU, &variant.Position, &variant.Created, &sellsKeys, &variantStock, &productStock, &keys); err != nil {
+			return nil, err
+		}
+		variant.Stock = stockLeft(nullableInt(variantStock), nullableInt(productStock))
+		if sellsKeys {
+			variant.Stock = stockLeft(variant.Stock, &keys)
+		}
+		variants[productID] = append(variants[productID], variant)
+	}
+	return variants, rows.Err()
+}
+
+// ProductVariant returns a variant of a product.
+func (q *ProductQueries) ProductVariant(ctx context.Context, productID, variantID string) (*models.Variant, error) {
+	variants, err := q.ProductVariants(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	for _, variant := range variants {
+		if variant.ID == variantID {
+			return &variant, nil
+		}
+	}
+	return nil, errors.ErrVariantNotFound
+}
+
+// AddProductVariant adds a variant to a product.
+func (q *ProductQueries) AddProductVariant(ctx context.Context, productID string, variant *models.Variant) (*models.Variant, error) {
+	var exists bool
+	if err := q.DB.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM product WHERE id = ?)`, productID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.ErrProductNotFound
+	}
+	if err := q.checkVariantSKU(ctx, "", variant.SKU); err != nil {
+		return nil, err
+	}
+
+	variant.ID = security.RandomString()
+	query := `INSERT INTO product_variant (id, product_id, name, amount, sku, position) VALUES (?, ?, ?, ?, ?, ?)`
+	if _, err := q.DB.ExecContext(ctx, query, variant.ID, productID, variant.Name, variant.Amount, variant.SKU, variant.Position); err != nil {
+		return nil, err
+	}
+
+	return q.ProductVariant(ctx, productID, variant.ID)
+}
+
+// UpdateProductVariant changes the name, price, SKU and position of a variant.
+func (q *ProductQueries) UpdateProductVariant(ctx context.Context, productID string, variant *models.Variant) error {
+	if err := q.checkVariantSKU(ctx, variant.ID, variant.SKU); err != nil {
+		return err
+	}
+
+	result, err := q.DB.ExecContext(ctx, `UPDATE product_variant SET name = ?, amount = ?, sku = ?, position = ? WHERE id = ? AND product_id = ?`,
+		variant.Name, variant.Amount, variant.SKU, variant.Position, variant.ID, productID)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		if err != nil {
+			return err
+		}
+		return errors.ErrVariantNotFound
+	}
+	return nil
+}
+
+// DeleteProductVariant removes a variant with no files and no unsold keys
+// tied to it. Sold keys keep the variant they were sold as.
+func (q *ProductQueries) DeleteProductVariant(ctx context.Context, productID, variantID string) error {
+	if _, err := q.ProductVariant(ctx, productID, variantID); err != nil {
+		return err
+	}
+
+	var inUse bool
+	err := q.DB.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM digital_file WHERE variant_id = ?) OR
+			EXISTS(SELECT 1 FROM digital_data WHERE variant_id = ? AND (cart_id IS NULL OR reserved IS NOT NULL))
+	`, variantID, variantID).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return errors.ErrVariantInUse
+	}
+
+	_, err = q.DB.ExecContext(ctx, `DELETE FROM product_variant WHERE id = ? AND product_id = ?`, variantID, productID)
+	return err
+}
+
+// SetDigitalVariant ties a file or a key of a product to one of its
+// variants. An empty variantID shares it with every variant.
+func (q *ProductQueries) SetDigitalVariant(ctx context.Context, productID, digitalID, variantID string) error {
+	var variant any
+	if variantID != "" {
+		if _, err := q.ProductVariant(ctx, productID, variantID); err != nil {
+			return err
+		}
+		variant = variantID
+	}
+
+	var affected int64
+	for _, table := range []string{"digital_file", "digital_data"} {
+		result, err := q.DB.ExecContext(ctx, `UPDATE `+table+` SET variant_id = ? WHERE id = ? AND product_id = ?`, variant, digitalID, productID)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		affected += n
+	}
+	if affected == 0 {
+		return errors.ErrNotFound
+	}
+	return nil
+}
+
+// checkVariantSKU returns errors.ErrVariantSKUExists if a variant other than
+// variantID already uses the SKU. An empty SKU is never taken.
+func (q *ProductQueries) checkVariantSKU(ctx context.Context, variantID, sku string) error {
+	if sku == "" {
+		return nil
+	}
+	var taken bool
+	err := q.DB.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM product_variant WHERE sku = ? AND id != ?)`, sku, variantID).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return errors.ErrVariantSKUExists
+	}
+	return nil
+}
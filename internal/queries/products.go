@@ -5,12 +5,14 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"os"
+	"math"
 	"strings"
 
 	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/internal/storage"
 	"github.com/shurco/litecart/pkg/errors"
 	"github.com/shurco/litecart/pkg/security"
+	"github.com/shurco/litecart/pkg/strutil"
 )
 
 // ProductQueries is a struct that embeds a pointer to an sql.DB.
@@ -20,9 +22,9 @@ type ProductQueries struct {
 	*sql.DB
 }
 
-// ListProducts retrieves a list of products from the database.
+// ListProducts retrieves a list of products from the database, narrowed by the filter if it is not nil.
 // If cartID is provided, it will also include digital products that were purchased in that cart.
-func (q *ProductQueries) ListProducts(ctx context.Context, private bool, limit, offset int, cartID string, idList ...models.CartProduct) (*models.Products, error) {
+func (q *ProductQueries) ListProducts(ctx context.Context, private bool, filter *models.ProductFilter, limit, offset int, cartID string, idList ...models.CartProduct) (*models.Products, error) {
 	currency, err := db.GetSettingByKey(ctx, "currency")
 	if err != nil {
 		return nil, err
@@ -41,8 +43,13 @@ func (q *ProductQueries) ListProducts(ctx context.Context, private bool, limit,
 				product.amount,
 				product.active,
 				product.digital,
-				EXISTS(SELECT 1 FROM digital_data WHERE digital_data.product_id = product.id AND digital_data.cart_id IS NULL) OR
-				EXISTS(SELECT 1 FROM digital_file WHERE digital_file.product_id = product.id) AS digital_filled,
+				product.physical,
+				product.weight,
+				` + productStockLeft + `,
+				EXISTS(SELECT 1 FROM digital_data WHERE digital_data.product_id = product.id AND ` + availableData + `) OR
+				EXISTS(SELECT 1 FROM digital_file WHERE digital_file.product_id = product.id) OR
+				(product.digital = 'api' AND product.fulfillment_url != '') AS digital_filled,
+				(SELECT COUNT(*) FROM digital_data WHERE digital_data.product_id = product.id AND ` + availableData + `) AS stock,
 				(SELECT json_group_array(json_object('id', product_image.id, 'name', product_image.name, 'ext', product_image.ext)) as images FROM product_image WHERE product_id = product.id GROUP BY id LIMIT 1) as image,
 				strftime('%s', created)
 			FROM product
@@ -50,52 +57,71 @@ func (q *ProductQueries) ListProducts(ctx context.Context, private bool, limit,
 
 	// For public queries, filter by available digital products
 	// If cartID is provided, also include products purchased in that cart
-	var queryPublic string
+	var joins string
+	var where []string
 	var params []any
-	var countParams []any
-	
+
 	if !private {
+		joins = `
+			LEFT JOIN digital_data ON digital_data.product_id = product.id
+			LEFT JOIN digital_file ON digital_file.product_id = product.id
+		`
 		if cartID != "" {
 			// Include products with available digital data OR products purchased in this cart
-			queryPublic = ` 
-				LEFT JOIN digital_data ON digital_data.product_id = product.id
-				LEFT JOIN digital_file ON digital_file.product_id = product.id
-				WHERE (
-					(digital_data.content IS NOT NULL AND digital_data.cart_id IS NULL) OR 
-					(digital_data.content IS NOT NULL AND digital_data.cart_id = ?) OR
-					digital_file.orig_name IS NOT NULL
-				) 
-				AND product.deleted = 0 AND product.active = 1
-			`
+			where = append(where, `(
+				(digital_data.content IS NOT NULL AND `+availableData+`) OR
+				(digital_data.content IS NOT NULL AND digital_data.cart_id = ?) OR
+				digital_file.orig_name IS NOT NULL OR
+				(product.digital = 'api' AND product.fulfillment_url != '') OR
+				product.physical
+			)`)
 			params = append(params, cartID)
-			countParams = append(countParams, cartID)
 		} else {
 			// Only include products with available digital data
-			queryPublic = ` 
-				LEFT JOIN digital_data ON digital_data.product_id = product.id
-				LEFT JOIN digital_file ON digital_file.product_id = product.id
-				WHERE (
-					(digital_data.content IS NOT NULL AND digital_data.cart_id IS NULL) OR
-					digital_file.orig_name IS NOT NULL
-				) 
-				AND product.deleted = 0 AND product.active = 1
-			`
+			where = append(where, `(
+				(digital_data.content IS NOT NULL AND `+availableData+`) OR
+				digital_file.orig_name IS NOT NULL OR
+				(product.digital = 'api' AND product.fulfillment_url != '') OR
+				product.physical
+			)`)
+		}
+		where = append(where, `product.deleted = 0 AND product.active = 1`)
+	}
+
+	if filter != nil {
+		if filter.Category != "" {
+			where = append(where, `product.id IN (SELECT product_id FROM product_category WHERE category_id IN (`+categoryTree+`))`)
+			params = append(params, filter.Category)
+		}
+		if filter.Tag != "" {
+			where = append(where, `product.id IN (SELECT product_tag.product_id FROM product_tag JOIN tag ON tag.id = product_tag.tag_id WHERE tag.slug = ?)`)
+			params = append(params, filter.Tag)
+		}
+		if filter.MinAmount > 0 || filter.MaxAmount > 0 {
+			// a product matches if its own price or the price of one of its variants is in the range
+			maxAmount := filter.MaxAmount
+			if maxAmount == 0 {
+				maxAmount = math.MaxInt64
+			}
+			where = append(where, `(product.amount BETWEEN ? AND ? OR
+				EXISTS(SELECT 1 FROM product_variant WHERE product_variant.product_id = product.id AND product_variant.amount BETWEEN ? AND ?))`)
+			params = append(params, filter.MinAmount, maxAmount, filter.MinAmount, maxAmount)
 		}
 	}
-	
-	var queryAddon string
-	
+
 	if len(idList) > 0 {
+		where = append(where, fmt.Sprintf("product.id IN (%s)", strings.Repeat("?, ", len(idList)-1)+"?"))
 		for _, item := range idList {
 			params = append(params, item.ProductID)
-			countParams = append(countParams, item.ProductID)
 		}
-		queryAddon = fmt.Sprintf("AND product.id IN (%s)", strings.Repeat("?, ", len(idList)-1)+"?")
 	}
 
-	if !private {
-		query += queryPublic
+	queryWhere := joins
+	if len(where) > 0 {
+		queryWhere += " WHERE " + strings.Join(where, " AND ")
 	}
+	query += queryWhere
+	countParams := append([]any{}, params...)
 
 	// Add pagination
 	if limit > 0 {
@@ -107,7 +133,7 @@ func (q *ProductQueries) ListProducts(ctx context.Context, private bool, limit,
 		}
 	}
 
-	rows, err := q.DB.QueryContext(ctx, query+queryAddon, params...)
+	rows, err := q.DB.QueryContext(ctx, query, params...)
 	if err != nil {
 		return nil, err
 	}
@@ -116,6 +142,8 @@ func (q *ProductQueries) ListProducts(ctx context.Context, private bool, limit,
 	for rows.Next() {
 		var image, digitalType sql.NullString
 		var digitalFilled sql.NullBool
+		var keys int
+		var tracked sql.NullInt64
 		product := models.Product{}
 		err := rows.Scan(
 			&product.ID,
@@ -125,7 +153,11 @@ func (q *ProductQueries) ListProducts(ctx context.Context, private bool, limit,
 			&product.Amount,
 			&product.Active,
 			&digitalType,
+			&product.Physical,
+			&product.Weight,
+			&tracked,
 			&digitalFilled,
+			&keys,
 			&image,
 			&product.Created,
 		)
@@ -147,6 +179,10 @@ func (q *ProductQueries) ListProducts(ctx context.Context, private bool, limit,
 				product.Digital.Filled = false
 			}
 		}
+		product.Stock = nullableInt(tracked)
+		if product.Digital.Type == "data" {
+			product.Stock = stockLeft(product.Stock, &keys)
+		}
 
 		products.Products = append(products.Products, product)
 	}
@@ -155,12 +191,32 @@ func (q *ProductQueries) ListProducts(ctx context.Context, private bool, limit,
 		return nil, err
 	}
 
-	// Count total records (without pagination params)
-	countQuery := `SELECT COUNT(DISTINCT product.id) FROM product`
-	if !private {
-		countQuery += queryPublic
+	productIDs := make([]string, len(products.Products))
+	for i, product := range products.Products {
+		productIDs[i] = product.ID
 	}
-	err = q.DB.QueryRowContext(ctx, countQuery+queryAddon, countParams...).Scan(&products.Total)
+	variants, err := q.productsVariants(ctx, productIDs...)
+	if err != nil {
+		return nil, err
+	}
+	categories, err := q.productsCategories(ctx, productIDs...)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := q.productsTags(ctx, productIDs...)
+	if err != nil {
+		return nil, err
+	}
+	for i := range products.Products {
+		products.Products[i].Variants = variants[products.Products[i].ID]
+		products.Products[i].Categories = categories[products.Products[i].ID]
+		products.Products[i].Tags = tags[products.Products[i].ID]
+		products.Products[i].InStock = productInStock(&products.Products[i])
+	}
+
+	// Count total records (without pagination params)
+	countQuery := `SELECT COUNT(DISTINCT product.id) FROM product` + queryWhere
+	err = q.DB.QueryRowContext(ctx, countQuery, countParams...).Scan(&products.Total)
 	if err != nil && err != sql.ErrNoRows {
 		return nil, err
 	}
@@ -184,6 +240,16 @@ func (q *ProductQueries) Product(ctx context.Context, private bool, id string) (
 				product.metadata, 
 				product.attribute, 
 				product.digital,
+				product.download_limit,
+				product.download_lifetime,
+				product.stock_threshold,
+				product.activation_limit,
+				product.fulfillment_url,
+				product.fulfillment_secret,
+				product.physical,
+				product.weight,
+				` + productStockLeft + `,
+				(SELECT COUNT(*) FROM digital_data WHERE digital_data.product_id = product.id AND ` + availableData + `) AS stock,
 				product.seo, 
 				json_group_array(json_object('id', pi.id, 'name', pi.name, 'ext', pi.ext)) as images,
 				strftime('%s', product.created), 
@@ -192,8 +258,9 @@ func (q *ProductQueries) Product(ctx context.Context, private bool, id string) (
 
 	// Добавляем вычисление digital_filled для приватных запросов
 	if private {
-		query += `, EXISTS(SELECT 1 FROM digital_data WHERE digital_data.product_id = product.id AND digital_data.cart_id IS NULL) OR
-				EXISTS(SELECT 1 FROM digital_file WHERE digital_file.product_id = product.id) AS digital_filled
+		query += `, EXISTS(SELECT 1 FROM digital_data WHERE digital_data.product_id = product.id AND ` + availableData + `) OR
+				EXISTS(SELECT 1 FROM digital_file WHERE digital_file.product_id = product.id) OR
+				(product.digital = 'api' AND product.fulfillment_url != '') AS digital_filled
 			FROM product 
 			LEFT JOIN product_image pi ON product.id = pi.product_id
 			WHERE product.id = ?`
@@ -203,12 +270,15 @@ func (q *ProductQueries) Product(ctx context.Context, private bool, id string) (
 			LEFT JOIN product_image pi ON product.id = pi.product_id
 			LEFT JOIN digital_data ON digital_data.product_id = product.id   
 			LEFT JOIN digital_file ON digital_file.product_id = product.id 
-			WHERE (digital_data.content IS NOT NULL AND digital_data.cart_id IS NULL OR digital_file.orig_name IS NOT NULL) AND
+			WHERE (digital_data.content IS NOT NULL AND ` + availableData + ` OR digital_file.orig_name IS NOT NULL OR
+				product.digital = 'api' AND product.fulfillment_url != '' OR product.physical) AND
 			product.slug = ? AND product.active = 1`
 	}
 
 	var images, metadata, attributes, digitalType, seo sql.NullString
-	var updated sql.NullInt64
+	var fulfillmentURL, fulfillmentSecret string
+	var keys int
+	var updated, tracked sql.NullInt64
 	var digitalFilled sql.NullBool
 
 	scanArgs := []any{
@@ -222,6 +292,16 @@ func (q *ProductQueries) Product(ctx context.Context, private bool, id string) (
 		&metadata,
 		&attributes,
 		&digitalType,
+		&product.Digital.DownloadLimit,
+		&product.Digital.DownloadLifetime,
+		&product.Digital.StockThreshold,
+		&product.Digital.ActivationLimit,
+		&fulfillmentURL,
+		&fulfillmentSecret,
+		&product.Physical,
+		&product.Weight,
+		&tracked,
+		&keys,
 		&seo,
 		&images,
 		&product.Created,
@@ -264,6 +344,16 @@ func (q *ProductQueries) Product(ctx context.Context, private bool, id string) (
 	}
 
 	product.Digital.Type = digitalType.String
+	product.Stock = nullableInt(tracked)
+	if product.Digital.Type == "data" {
+		product.Stock = stockLeft(product.Stock, &keys)
+	}
+
+	// the fulfillment endpoint and its secret are only shown in the admin panel
+	if private {
+		product.Digital.FulfillmentURL = fulfillmentURL
+		product.Digital.FulfillmentSecret = fulfillmentSecret
+	}
 
 	// Устанавливаем digital.filled для приватных запросов
 	if private && digitalType.Valid {
@@ -280,6 +370,25 @@ func (q *ProductQueries) Product(ctx context.Context, private bool, id string) (
 		}
 	}
 
+	variants, err := q.productsVariants(ctx, product.ID)
+	if err != nil {
+		return nil, err
+	}
+	product.Variants = variants[product.ID]
+	product.InStock = productInStock(product)
+
+	categories, err := q.productsCategories(ctx, product.ID)
+	if err != nil {
+		return nil, err
+	}
+	product.Categories = categories[product.ID]
+
+	tags, err := q.productsTags(ctx, product.ID)
+	if err != nil {
+		return nil, err
+	}
+	product.Tags = tags[product.ID]
+
 	return product, nil
 }
 
@@ -299,25 +408,43 @@ func (q *ProductQueries) AddProduct(ctx context.Context, product *models.Product
 
 	query := `
 			INSERT INTO product (
-					id, name, amount, slug, metadata, attribute, brief, desc, digital, active
-			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, FALSE)
+					id, name, amount, slug, metadata, attribute, brief, desc, digital, download_limit, download_lifetime,
+					stock_threshold, activation_limit, fulfillment_url, fulfillment_secret, physical, weight, stock, active
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?, ?, ?, IIF(? = '', lower(hex(randomblob(32))), ?), ?, ?, ?, FALSE)
 			RETURNING strftime('%s', created)
 	`
-	stmt, err := q.DB.PrepareContext(ctx, query)
+	tx, err := q.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
-	defer func() { _ = stmt.Close() }()
+	defer func() { _ = tx.Rollback() }()
 
-	err = stmt.QueryRowContext(ctx,
+	err = tx.QueryRowContext(ctx, query,
 		product.ID, product.Name, product.Amount, product.Slug,
 		metadata, attributes, product.Brief, product.Description, product.Digital.Type,
+		product.Digital.DownloadLimit, product.Digital.DownloadLifetime, product.Digital.StockThreshold, product.Digital.ActivationLimit,
+		product.Digital.FulfillmentURL, product.Digital.FulfillmentSecret, product.Digital.FulfillmentSecret,
+		product.Physical, product.Weight, product.Stock,
 	).Scan(&product.Created)
 	if err != nil {
 		return nil, err
 	}
 
-	return product, nil
+	// the stock a product starts with is the first movement of its log
+	if product.Stock != nil {
+		err := addStockMovement(ctx, tx, &models.StockMovement{
+			ProductID: product.ID,
+			Change:    *product.Stock,
+			Stock:     *product.Stock,
+			Reason:    models.StockMovementAdjustment,
+			Note:      "initial stock",
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return product, tx.Commit()
 }
 
 // UpdateProduct updates an existing product in the database with new values.
@@ -347,6 +474,13 @@ func (q *ProductQueries) UpdateProduct(ctx context.Context, product *models.Prod
 				metadata = ?, 
 				attribute = ?, 
 				seo = ?, 
+				download_limit = ?,
+				download_lifetime = ?,
+				stock_threshold = ?,
+				activation_limit = ?,
+				fulfillment_url = ?,
+				fulfillment_secret = IIF(? = '', fulfillment_secret, ?),
+				weight = ?,
 				updated = datetime('now') 
 			WHERE id = ?
 		`)
@@ -364,6 +498,14 @@ func (q *ProductQueries) UpdateProduct(ctx context.Context, product *models.Prod
 		metadata,
 		attributes,
 		seo,
+		product.Digital.DownloadLimit,
+		product.Digital.DownloadLifetime,
+		product.Digital.StockThreshold,
+		product.Digital.ActivationLimit,
+		product.Digital.FulfillmentURL,
+		product.Digital.FulfillmentSecret,
+		product.Digital.FulfillmentSecret,
+		product.Weight,
 		product.ID,
 	)
 	return err
@@ -375,25 +517,31 @@ func (q *ProductQueries) DeleteProduct(ctx context.Context, id string) error {
 	return err
 }
 
-// IsProduct checks if a product with the given slug exists and is active,
-// and also has associated digital data or file that meets certain conditions.
-func (q *ProductQueries) IsProduct(ctx context.Context, slug string) bool {
-	var exists bool
-	query := `
-			SELECT EXISTS (
-				SELECT 1 FROM product 
-				WHERE product.slug = ? AND product.active = 1 AND (
+// productListed holds for the products shown in the shop: active and with
+// something to sell.
+var productListed = `product.active = 1 AND (
 					EXISTS (
 						SELECT 1 FROM digital_data 
 						WHERE digital_data.product_id = product.id 
 						AND digital_data.content IS NOT NULL 
-						AND digital_data.cart_id IS NULL
+						AND ` + availableData + `
 					) OR EXISTS (
 						SELECT 1 FROM digital_file 
 						WHERE digital_file.product_id = product.id 
 						AND digital_file.orig_name IS NOT NULL
-					)
-				)
+					) OR (
+						product.digital = 'api' AND product.fulfillment_url != ''
+					) OR product.physical
+				)`
+
+// IsProduct checks if a product with the given slug exists and is active,
+// and also has associated digital data or file that meets certain conditions.
+func (q *ProductQueries) IsProduct(ctx context.Context, slug string) bool {
+	var exists bool
+	query := `
+			SELECT EXISTS (
+				SELECT 1 FROM product 
+				WHERE product.slug = ? AND ` + productListed + `
 			)
 	`
 	err := q.DB.QueryRowContext(ctx, query, slug).Scan(&exists)
@@ -488,7 +636,7 @@ func (q *ProductQueries) DeleteImage(ctx context.Context, productID, imageID str
 	}
 
 	// Delete physical files
-	if err := q.deleteImageFiles(imageInfo.name, imageInfo.ext); err != nil {
+	if err := q.deleteImageFiles(ctx, imageInfo.name, imageInfo.ext); err != nil {
 		return fmt.Errorf("deleting image files: %w", err)
 	}
 
@@ -530,17 +678,18 @@ func (q *ProductQueries) deleteImageRecord(ctx context.Context, productID, image
 	return info, nil
 }
 
-func (q *ProductQueries) deleteImageFiles(name, ext string) error {
-	filePaths := []string{
-		fmt.Sprintf("./lc_uploads/%s.%s", name, ext),
-		fmt.Sprintf("./lc_uploads/%s_sm.%s", name, ext),
+func (q *ProductQueries) deleteImageFiles(ctx context.Context, name, ext string) error {
+	keys := []string{
+		storage.UploadKey(fmt.Sprintf("%s.%s", name, ext)),
+		storage.UploadKey(fmt.Sprintf("%s_sm.%s", name, ext)),
+		storage.UploadKey(fmt.Sprintf("%s_md.%s", name, ext)),
 	}
 
 	var removeErrors []string
-	for _, filePath := range filePaths {
-		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+	for _, key := range keys {
+		if err := storage.Files().Delete(ctx, key); err != nil {
 			removeErrors = append(removeErrors,
-				fmt.Sprintf("failed to remove %s: %v", filePath, err))
+				fmt.Sprintf("failed to remove %s: %v", key, err))
 		}
 	}
 
@@ -559,8 +708,9 @@ func (q *ProductQueries) ProductDigital(ctx context.Context, productID string) (
 	query := `
 			SELECT 
 					p.digital,
-					df.id, df.name, df.ext,
-					dd.id, dd.content, dd.cart_id
+					df.id, df.name, df.ext, df.orig_name, df.version_id, df.variant_id,
+					dd.id, dd.content, dd.cart_id, dd.variant_id,
+					(SELECT COUNT(*) FROM license_activation WHERE license_activation.data_id = dd.id)
 			FROM product p
 			LEFT JOIN digital_file df ON p.id = df.product_id
 			LEFT JOIN digital_data dd ON p.id = dd.product_id
@@ -575,13 +725,15 @@ func (q *ProductQueries) ProductDigital(ctx context.Context, productID string) (
 
 	var digitalType sql.NullString
 	for rows.Next() {
-		var fileID, fileName, fileExt sql.NullString
-		var dataID, dataContent, cartID sql.NullString
+		var fileID, fileName, fileExt, fileOrigName, fileVersionID, fileVariantID sql.NullString
+		var dataID, dataContent, cartID, dataVariantID sql.NullString
+		var activations int
 
 		err := rows.Scan(
 			&digitalType,
-			&fileID, &fileName, &fileExt,
-			&dataID, &dataContent, &cartID,
+			&fileID, &fileName, &fileExt, &fileOrigName, &fileVersionID, &fileVariantID,
+			&dataID, &dataContent, &cartID, &dataVariantID,
+			&activations,
 		)
 		if err != nil {
 			return nil, err
@@ -593,17 +745,22 @@ func (q *ProductQueries) ProductDigital(ctx context.Context, productID string) (
 
 		if fileID.Valid {
 			file := models.File{
-				ID:   fileID.String,
-				Name: fileName.String,
-				Ext:  fileExt.String,
+				ID:        fileID.String,
+				Name:      fileName.String,
+				Ext:       fileExt.String,
+				OrigName:  fileOrigName.String,
+				VersionID: fileVersionID.String,
+				VariantID: fileVariantID.String,
 			}
 			digital.Files = append(digital.Files, file)
 		}
 		if dataID.Valid {
 			data := models.Data{
-				ID:      dataID.String,
-				Content: dataContent.String,
-				CartID:  cartID.String,
+				ID:          dataID.String,
+				Content:     dataContent.String,
+				CartID:      cartID.String,
+				VariantID:   dataVariantID.String,
+				Activations: activations,
 			}
 			digital.Data = append(digital.Data, data)
 		}
@@ -613,19 +770,50 @@ func (q *ProductQueries) ProductDigital(ctx context.Context, productID string) (
 		return nil, err
 	}
 
+	if digital.Type == "file" {
+		versions, err := q.DigitalVersions(ctx, productID)
+		if err != nil {
+			return nil, err
+		}
+		digital.Versions = versions
+	}
+
 	return digital, nil
 }
 
-// AddDigitalFile associates a digital file with a product in the database.
-func (q *ProductQueries) AddDigitalFile(ctx context.Context, productID, fileUUID, fileExt, origName string) (*models.File, error) {
+// DigitalFile returns a digital file of a product.
+func (q *ProductQueries) DigitalFile(ctx context.Context, productID, fileID string) (*models.File, error) {
+	file := &models.File{}
+	query := `SELECT id, name, ext, orig_name FROM digital_file WHERE id = ? AND product_id = ?`
+	err := q.DB.QueryRowContext(ctx, query, fileID, productID).Scan(&file.ID, &file.Name, &file.Ext, &file.OrigName)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// AddDigitalFile associates a digital file with a version of a product in the
+// database. An empty versionID adds the file to the current version.
+func (q *ProductQueries) AddDigitalFile(ctx context.Context, productID, versionID, fileUUID, fileExt, origName string) (*models.File, error) {
+	versionID, err := q.uploadVersion(ctx, productID, versionID)
+	if err != nil {
+		return nil, err
+	}
+
 	file := &models.File{
-		ID:   security.RandomString(),
-		Name: fileUUID,
-		Ext:  fileExt,
+		ID:        security.RandomString(),
+		Name:      fileUUID,
+		Ext:       fileExt,
+		OrigName:  origName,
+		VersionID: versionID,
 	}
 
-	query := `INSERT INTO digital_file (id, product_id, name, ext, orig_name) VALUES (?, ?, ?, ?, ?)`
-	_, err := q.DB.ExecContext(ctx, query, file.ID, productID, file.Name, file.Ext, origName)
+	query := `INSERT INTO digital_file (id, product_id, name, ext, orig_name, version_id) VALUES (?, ?, ?, ?, ?, ?)`
+	_, err = q.DB.ExecContext(ctx, query, file.ID, productID, file.Name, file.Ext, origName, versionID)
 	if err != nil {
 		return nil, err
 	}
@@ -646,6 +834,11 @@ func (q *ProductQueries) AddDigitalData(ctx context.Context, productID, content
 		return nil, err
 	}
 
+	// a new key rearms the low stock alert, like an import
+	if _, err := q.DB.ExecContext(ctx, `UPDATE product SET stock_alerted = FALSE WHERE id = ?`, productID); err != nil {
+		return nil, err
+	}
+
 	return file, nil
 }
 
@@ -661,7 +854,7 @@ func (q *ProductQueries) DeleteDigital(ctx context.Context, productID, digitalID
 	var name, ext sql.NullString
 
 	query := `
-				SELECT p.digital, df.name, df.ext
+				SELECT IFNULL(p.digital, ''), df.name, df.ext
 				FROM product p
 				LEFT JOIN digital_file df ON df.id = ? AND df.product_id = p.id
 				WHERE p.id = ?
@@ -679,9 +872,9 @@ func (q *ProductQueries) DeleteDigital(ctx context.Context, productID, digitalID
 			return fmt.Errorf("deleting from digital_file: %w", err)
 		}
 
-		filePath := fmt.Sprintf("./lc_digitals/%s.%s", name.String, ext.String)
-		if err := os.Remove(filePath); err != nil {
-			return fmt.Errorf("failed to remove file %s: %w", filePath, err)
+		key := storage.DigitalKey(fmt.Sprintf("%s.%s", name.String, ext.String))
+		if err := storage.Files().Delete(ctx, key); err != nil {
+			return fmt.Errorf("failed to remove file %s: %w", key, err)
 		}
 
 	case "data":
@@ -693,3 +886,47 @@ func (q *ProductQueries) DeleteDigital(ctx context.Context, productID, digitalID
 
 	return nil
 }
+
+// DigitalDataStock returns the number of unsold keys of each listed product
+// that sells keys. Products of other digital types are left out.
+func (q *ProductQueries) DigitalDataStock(ctx context.Context, productIDs ...string) (map[string]int, error) {
+	stock := map[string]int{}
+	if len(productIDs) == 0 {
+		return stock, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT product.id, COUNT(digital_data.id)
+		FROM product
+		LEFT JOIN digital_data ON digital_data.product_id = product.id AND ` + availableData + `
+		WHERE product.digital = 'data' AND product.id IN (%s)
+		GROUP BY product.id
+	`, strings.Repeat("?, ", len(productIDs)-1)+"?")
+
+	rows, err := q.DB.QueryContext(ctx, query, strutil.ToAny(productIDs...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var id string
+		var count int
+		if err := rows.Scan(&id, &count); err != nil {
+			return nil, err
+		}
+		stock[id] = count
+	}
+
+	return stock, rows.Err()
+}
+
+// nullableInt returns nil for a NULL column, such as the stock of a product
+// that is not tracked.
+func nullableInt(value sql.NullInt64) *int {
+	if !value.Valid {
+		return nil
+	}
+	n := int(value.Int64)
+	return &n
+}
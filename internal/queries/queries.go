@@ -5,13 +5,14 @@ import (
 	"embed"
 
 	"github.com/shurco/litecart/internal/base"
+	_ "github.com/shurco/litecart/internal/providers"
 	_ "modernc.org/sqlite"
 )
 
 var db *Base
 
 // Define the structure 'Base' that aggregates various queries related to different modules like
-// settings, authentication, installation, pages, products, and cart management.
+// settings, authentication, installation, pages, products, cart management, background jobs, webhook deliveries, downloads, fulfillments, licenses, customers, shipping, categories and tags.
 type Base struct {
 	SettingQueries
 	AuthQueries
@@ -19,6 +20,15 @@ type Base struct {
 	PageQueries
 	ProductQueries
 	CartQueries
+	JobQueries
+	WebhookQueries
+	DownloadQueries
+	FulfillmentQueries
+	LicenseQueries
+	CustomerQueries
+	ShippingQueries
+	CategoryQueries
+	TagQueries
 }
 
 // New initializes the application's database and returns an error if any occurs during the process.
@@ -31,12 +41,21 @@ func New(embed embed.FS) (err error) {
 	}
 
 	db = &Base{
-		AuthQueries:    AuthQueries{DB: sqlite},
-		InstallQueries: InstallQueries{DB: sqlite},
-		SettingQueries: SettingQueries{DB: sqlite},
-		PageQueries:    PageQueries{DB: sqlite},
-		ProductQueries: ProductQueries{DB: sqlite},
-		CartQueries:    CartQueries{DB: sqlite},
+		AuthQueries:        AuthQueries{DB: sqlite},
+		InstallQueries:     InstallQueries{DB: sqlite},
+		SettingQueries:     SettingQueries{DB: sqlite},
+		PageQueries:        PageQueries{DB: sqlite},
+		ProductQueries:     ProductQueries{DB: sqlite},
+		CartQueries:        CartQueries{DB: sqlite},
+		JobQueries:         JobQueries{DB: sqlite},
+		WebhookQueries:     WebhookQueries{DB: sqlite},
+		DownloadQueries:    DownloadQueries{DB: sqlite},
+		FulfillmentQueries: FulfillmentQueries{DB: sqlite},
+		LicenseQueries:     LicenseQueries{DB: sqlite},
+		CustomerQueries:    CustomerQueries{DB: sqlite},
+		ShippingQueries:    ShippingQueries{DB: sqlite},
+		CategoryQueries:    CategoryQueries{DB: sqlite},
+		TagQueries:         TagQueries{DB: sqlite},
 	}
 	return
 }
@@ -2,12 +2,21 @@ package queries
 
 import (
 	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
 	"os"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/shurco/litecart/internal/models"
 	"github.com/shurco/litecart/migrations"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/litepay"
+	"github.com/shurco/litecart/pkg/security"
 )
 
 func withTempBase(t *testing.T) func() {
@@ -76,3 +85,1472 @@ func Test_queries_page_crud(t *testing.T) {
 }
 
 func ptr[T any](v T) *T { return &v }
+
+func Test_queries_payment_list(t *testing.T) {
+	cleanup := withTempBase(t)
+	defer cleanup()
+	if err := New(migrations.Embed()); err != nil {
+		t.Fatalf("init queries: %v", err)
+	}
+	db := DB()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	payments, err := db.PaymentList(ctx)
+	if err != nil {
+		t.Fatalf("payment list: %v", err)
+	}
+	for _, name := range []string{"stripe", "paypal", "spectrocoin", "dummy"} {
+		if _, ok := payments[name]; !ok {
+			t.Fatalf("provider %s not listed", name)
+		}
+	}
+	if !payments["dummy"] || payments["stripe"] {
+		t.Fatalf("unexpected provider state: %v", payments)
+	}
+
+	if _, _, err := db.PaymentProvider(ctx, "unknown"); err != errors.ErrProviderNotFound {
+		t.Fatalf("expected provider not found, got %v", err)
+	}
+}
+
+func Test_queries_cart_transitions(t *testing.T) {
+	cleanup := withTempBase(t)
+	defer cleanup()
+	if err := New(migrations.Embed()); err != nil {
+		t.Fatalf("init queries: %v", err)
+	}
+	db := DB()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cartID := "cart00000000001"
+	if err := db.AddCart(ctx, &models.Cart{Core: models.Core{ID: cartID}, AmountTotal: 100, Currency: "USD", PaymentStatus: litepay.NEW}); err != nil {
+		t.Fatalf("add cart: %v", err)
+	}
+
+	steps := []struct {
+		status  litepay.Status
+		source  models.CartStatusSource
+		legal   bool
+		changed bool
+	}{
+		{litepay.PROCESSED, models.CartSourceCallback, true, true},
+		{litepay.PAID, models.CartSourceSuccess, true, true},
+		{litepay.PAID, models.CartSourceCallback, true, false}, // repeated, not recorded
+		{litepay.CANCELED, models.CartSourceCancel, false, false},
+		{litepay.NEW, models.CartSourceAdmin, false, false},
+		{litepay.REFUNDED, models.CartSourceAdmin, true, true},
+		{litepay.PAID, models.CartSourceCallback, false, false},
+	}
+	for _, step := range steps {
+		changed, err := db.UpdateCart(ctx, &models.Cart{Core: models.Core{ID: cartID}, PaymentStatus: step.status}, step.source)
+		if step.legal && err != nil {
+			t.Fatalf("move to %s: %v", step.status, err)
+		}
+		if changed != step.changed {
+			t.Fatalf("move to %s: changed %t, want %t", step.status, changed, step.changed)
+		}
+		if !step.legal {
+			if _, ok := err.(*CartTransitionError); !ok {
+				t.Fatalf("move to %s: expected transition error, got %v", step.status, err)
+			}
+		}
+	}
+
+	cart, err := db.Cart(ctx, cartID)
+	if err != nil {
+		t.Fatalf("cart: %v", err)
+	}
+	if cart.PaymentStatus != litepay.REFUNDED {
+		t.Fatalf("unexpected status %s", cart.PaymentStatus)
+	}
+
+	history, err := db.CartStatusHistory(ctx, cartID)
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	expected := []models.CartStatusHistory{
+		{From: litepay.NEW, To: litepay.PROCESSED, Source: models.CartSourceCallback},
+		{From: litepay.PROCESSED, To: litepay.PAID, Source: models.CartSourceSuccess},
+		{From: litepay.PAID, To: litepay.REFUNDED, Source: models.CartSourceAdmin},
+	}
+	if len(history) != len(expected) {
+		t.Fatalf("expected %d history entries, got %d", len(expected), len(history))
+	}
+	for i, item := range history {
+		if item.From != expected[i].From || item.To != expected[i].To || item.Source != expected[i].Source || item.Created == 0 {
+			t.Fatalf("history %d: unexpected %+v", i, item)
+		}
+	}
+
+	_, err = db.UpdateCart(ctx, &models.Cart{Core: models.Core{ID: "cart00000000002"}, PaymentStatus: litepay.PAID}, models.CartSourceCallback)
+	if err != errors.ErrCartNotFound {
+		t.Fatalf("expected cart not found, got %v", err)
+	}
+}
+
+func Test_queries_cart_canceled_then_paid(t *testing.T) {
+	cleanup := withTempBase(t)
+	defer cleanup()
+	if err := New(migrations.Embed()); err != nil {
+		t.Fatalf("init queries: %v", err)
+	}
+	db := DB()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	keys, err := db.AddProduct(ctx, &models.Product{Name: "Keys", Slug: "keys", Amount: 100, Digital: models.Digital{Type: "data"}})
+	if err != nil {
+		t.Fatalf("add product: %v", err)
+	}
+	if _, err := db.AddDigitalData(ctx, keys.ID, "KEY-AFTER-CANCEL"); err != nil {
+		t.Fatalf("add key: %v", err)
+	}
+
+	cartID := "cart00000000021"
+	products := []models.CartProduct{{ProductID: keys.ID, Quantity: 1}}
+	if err := db.AddCart(ctx, &models.Cart{Core: models.Core{ID: cartID}, Email: "user@mail.com", Cart: products, AmountTotal: 100, Currency: "USD", PaymentStatus: litepay.NEW}); err != nil {
+		t.Fatalf("add cart: %v", err)
+	}
+	if err := db.ReserveDigitalData(ctx, cartID, products...); err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+
+	// the buyer backs out of checkout, then pays in the session that is still open
+	if _, err := db.UpdateCart(ctx, &models.Cart{Core: models.Core{ID: cartID}, PaymentStatus: litepay.CANCELED}, models.CartSourceCancel); err != nil {
+		t.Fatalf("cancel cart: %v", err)
+	}
+	if _, err := db.UpdateCart(ctx, &models.Cart{Core: models.Core{ID: cartID}, PaymentStatus: litepay.PAID}, models.CartSourceAdmin); err == nil {
+		t.Fatalf("the admin must not mark a canceled cart paid")
+	}
+	changed, err := db.UpdateCart(ctx, &models.Cart{Core: models.Core{ID: cartID}, PaymentStatus: litepay.PAID}, models.CartSourceCallback)
+	if err != nil || !changed {
+		t.Fatalf("pay canceled cart: changed %t, %v", changed, err)
+	}
+
+	// the key given back on cancel is taken again for the letter
+	letter, err := db.CartLetterPurchase(ctx, cartID)
+	if err != nil {
+		t.Fatalf("purchase letter: %v", err)
+	}
+	if !strings.Contains(letter.Data["Purchases"], "KEY-AFTER-CANCEL") {
+		t.Fatalf("the letter misses the key: %q", letter.Data["Purchases"])
+	}
+}
+
+func Test_queries_cart_paid_once(t *testing.T) {
+	cleanup := withTempBase(t)
+	defer cleanup()
+	if err := New(migrations.Embed()); err != nil {
+		t.Fatalf("init queries: %v", err)
+	}
+	db := DB()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cartID := "cart00000000003"
+	if err := db.AddCart(ctx, &models.Cart{Core: models.Core{ID: cartID}, AmountTotal: 100, Currency: "USD", PaymentStatus: litepay.NEW}); err != nil {
+		t.Fatalf("add cart: %v", err)
+	}
+
+	// the success redirect and the provider notification race each other
+	var wg sync.WaitGroup
+	results := make(chan bool, 4)
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			changed, err := db.UpdateCart(ctx, &models.Cart{Core: models.Core{ID: cartID}, PaymentStatus: litepay.PAID}, models.CartSourceCallback)
+			if err != nil {
+				t.Errorf("update cart: %v", err)
+			}
+			results <- changed
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	changes := 0
+	for changed := range results {
+		if changed {
+			changes++
+		}
+	}
+	if changes != 1 {
+		t.Fatalf("paid transition applied %d times, want 1", changes)
+	}
+
+	// a late notification of the first partial refund keeps the second one
+	for _, refunded := range []int{60, 30} {
+		if _, err := db.UpdateCart(ctx, &models.Cart{Core: models.Core{ID: cartID}, PaymentStatus: litepay.PARTIALLY_REFUNDED, AmountRefunded: refunded}, models.CartSourceCallback); err != nil {
+			t.Fatalf("refund cart: %v", err)
+		}
+	}
+	cart, err := db.Cart(ctx, cartID)
+	if err != nil {
+		t.Fatalf("cart: %v", err)
+	}
+	if cart.AmountRefunded != 60 {
+		t.Fatalf("amount refunded: got %d want 60", cart.AmountRefunded)
+	}
+}
+
+func Test_queries_check_cart_payment(t *testing.T) {
+	cleanup := withTempBase(t)
+	defer cleanup()
+	if err := New(migrations.Embed()); err != nil {
+		t.Fatalf("init queries: %v", err)
+	}
+	db := DB()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cartID := "cart00000000004"
+	if err := db.AddCart(ctx, &models.Cart{Core: models.Core{ID: cartID}, AmountTotal: 1500, Currency: "EUR", PaymentStatus: litepay.NEW}); err != nil {
+		t.Fatalf("add cart: %v", err)
+	}
+
+	cases := []struct {
+		payment  litepay.Payment
+		expected error
+	}{
+		{litepay.Payment{CartID: cartID, AmountTotal: 1500, Currency: "eur"}, nil},
+		{litepay.Payment{CartID: cartID}, nil},
+		{litepay.Payment{CartID: cartID, AmountTotal: 1, Currency: "EUR"}, errors.ErrPaymentMismatch},
+		{litepay.Payment{CartID: cartID, AmountTotal: 1500, Currency: "USD"}, errors.ErrPaymentMismatch},
+		{litepay.Payment{CartID: "cart00000000099", AmountTotal: 1500, Currency: "EUR"}, errors.ErrCartNotFound},
+	}
+	for i, tt := range cases {
+		if err := db.CheckCartPayment(ctx, &tt.payment); err != tt.expected {
+			t.Fatalf("case %d: got %v want %v", i, err, tt.expected)
+		}
+	}
+}
+
+func Test_queries_idempotency_key(t *testing.T) {
+	cleanup := withTempBase(t)
+	defer cleanup()
+	if err := New(migrations.Embed()); err != nil {
+		t.Fatalf("init queries: %v", err)
+	}
+	db := DB()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stored, err := db.ReserveIdempotencyKey(ctx, "key-1", "hash")
+	if err != nil || stored != nil {
+		t.Fatalf("first reserve: %+v, %v", stored, err)
+	}
+
+	stored, err = db.ReserveIdempotencyKey(ctx, "key-1", "hash")
+	if err != nil || stored == nil || stored.CartID != "" {
+		t.Fatalf("reserve in progress: %+v, %v", stored, err)
+	}
+
+	if err := db.ReleaseIdempotencyKey(ctx, "key-1"); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if stored, err = db.ReserveIdempotencyKey(ctx, "key-1", "hash"); err != nil || stored != nil {
+		t.Fatalf("reserve after release: %+v, %v", stored, err)
+	}
+
+	if err := db.SaveIdempotencyKey(ctx, "key-1", "cart00000000004", "https://pay.example/1"); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	// a completed key is kept so retries replay the result
+	if err := db.ReleaseIdempotencyKey(ctx, "key-1"); err != nil {
+		t.Fatalf("release completed: %v", err)
+	}
+	stored, err = db.ReserveIdempotencyKey(ctx, "key-1", "other")
+	if err != nil || stored == nil {
+		t.Fatalf("reserve completed: %+v, %v", stored, err)
+	}
+	if stored.RequestHash != "hash" || stored.CartID != "cart00000000004" || stored.PaymentURL != "https://pay.example/1" {
+		t.Fatalf("unexpected stored key: %+v", stored)
+	}
+}
+
+func Test_queries_digital_data_stock(t *testing.T) {
+	cleanup := withTempBase(t)
+	defer cleanup()
+	if err := New(migrations.Embed()); err != nil {
+		t.Fatalf("init queries: %v", err)
+	}
+	db := DB()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	keys, err := db.AddProduct(ctx, &models.Product{Name: "Keys", Slug: "keys", Amount: 100, Digital: models.Digital{Type: "data"}})
+	if err != nil {
+		t.Fatalf("add product: %v", err)
+	}
+	files, err := db.AddProduct(ctx, &models.Product{Name: "Files", Slug: "files", Amount: 100, Digital: models.Digital{Type: "file"}})
+	if err != nil {
+		t.Fatalf("add product: %v", err)
+	}
+	for range 3 {
+		if _, err := db.AddDigitalData(ctx, keys.ID, "key"); err != nil {
+			t.Fatalf("add key: %v", err)
+		}
+	}
+
+	stock, err := db.DigitalDataStock(ctx, keys.ID, files.ID)
+	if err != nil {
+		t.Fatalf("stock: %v", err)
+	}
+	if len(stock) != 1 || stock[keys.ID] != 3 {
+		t.Fatalf("unexpected stock %v", stock)
+	}
+
+	// 3 keys are low for the default threshold but not for a threshold of 2
+	stocked, err := db.AddProduct(ctx, &models.Product{Name: "Stocked", Slug: "stocked", Amount: 100, Digital: models.Digital{Type: "data", StockThreshold: 2}})
+	if err != nil {
+		t.Fatalf("add product: %v", err)
+	}
+	for range 3 {
+		if _, err := db.AddDigitalData(ctx, stocked.ID, "key"); err != nil {
+			t.Fatalf("add key: %v", err)
+		}
+	}
+	low, err := db.ClaimLowDigitalDataStock(ctx, keys.ID, files.ID, stocked.ID)
+	if err != nil {
+		t.Fatalf("low stock: %v", err)
+	}
+	if len(low) != 1 || low[0].ProductID != keys.ID || low[0].Remaining != 3 || low[0].Threshold != DefaultStockThreshold {
+		t.Fatalf("unexpected low stock %+v", low)
+	}
+
+	// the admin is alerted once, until new keys come in
+	if low, err := db.ClaimLowDigitalDataStock(ctx, keys.ID); err != nil || len(low) != 0 {
+		t.Fatalf("alerted twice: %+v, %v", low, err)
+	}
+	if _, err := db.ImportDigitalData(ctx, keys.ID, "", []models.DataLine{{Line: 1, Content: "new key"}}, false); err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if low, err := db.ClaimLowDigitalDataStock(ctx, keys.ID); err != nil || len(low) != 1 || low[0].Remaining != 4 {
+		t.Fatalf("import did not rearm the alert: %+v, %v", low, err)
+	}
+}
+
+func Test_queries_digital_data_reservation(t *testing.T) {
+	cleanup := withTempBase(t)
+	defer cleanup()
+	if err := New(migrations.Embed()); err != nil {
+		t.Fatalf("init queries: %v", err)
+	}
+	db := DB()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	keys, err := db.AddProduct(ctx, &models.Product{Name: "Keys", Slug: "keys", Amount: 100, Digital: models.Digital{Type: "data"}})
+	if err != nil {
+		t.Fatalf("add product: %v", err)
+	}
+	for range 3 {
+		if _, err := db.AddDigitalData(ctx, keys.ID, "key"); err != nil {
+			t.Fatalf("add key: %v", err)
+		}
+	}
+	stock := func() int {
+		t.Helper()
+		product, err := db.Product(ctx, true, keys.ID)
+		if err != nil {
+			t.Fatalf("product: %v", err)
+		}
+		if product.Stock == nil {
+			t.Fatalf("no stock reported")
+		}
+		return *product.Stock
+	}
+	addCart := func(id string, quantity int) []models.CartProduct {
+		t.Helper()
+		products := []models.CartProduct{{ProductID: keys.ID, Quantity: quantity}}
+		if err := db.AddCart(ctx, &models.Cart{Core: models.Core{ID: id}, Email: "user@mail.com", Cart: products, AmountTotal: 100 * quantity, Currency: "USD", PaymentStatus: litepay.NEW}); err != nil {
+			t.Fatalf("add cart: %v", err)
+		}
+		return products
+	}
+
+	first := addCart("cart00000000011", 2)
+	if err := db.ReserveDigitalData(ctx, "cart00000000011", first...); err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	if got := stock(); got != 1 {
+		t.Fatalf("stock after reserve: got %d want 1", got)
+	}
+
+	second := addCart("cart00000000012", 2)
+	if err := db.ReserveDigitalData(ctx, "cart00000000012", second...); err != errors.ErrOutOfStock {
+		t.Fatalf("reserve over stock: got %v want %v", err, errors.ErrOutOfStock)
+	}
+	if got := stock(); got != 1 {
+		t.Fatalf("stock after rejected reserve: got %d want 1", got)
+	}
+
+	// a canceled cart gives its keys back
+	if _, err := db.UpdateCart(ctx, &models.Cart{Core: models.Core{ID: "cart00000000011"}, PaymentStatus: litepay.CANCELED}, models.CartSourceCancel); err != nil {
+		t.Fatalf("cancel cart: %v", err)
+	}
+	if got := stock(); got != 3 {
+		t.Fatalf("stock after cancel: got %d want 3", got)
+	}
+
+	// so does a reservation nobody paid for in time
+	if err := db.ReserveDigitalData(ctx, "cart00000000012", second...); err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	if _, err := db.CartQueries.ExecContext(ctx, `UPDATE digital_data SET reserved = datetime('now', '-2 hours') WHERE cart_id = ?`, "cart00000000012"); err != nil {
+		t.Fatalf("age reservation: %v", err)
+	}
+	if got := stock(); got != 3 {
+		t.Fatalf("stock after expiry: got %d want 3", got)
+	}
+
+	// buyers racing for the last key: exactly one gets it
+	third := addCart("cart00000000013", 2)
+	if err := db.ReserveDigitalData(ctx, "cart00000000013", third...); err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	var wg sync.WaitGroup
+	results := make(chan error, 4)
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id := fmt.Sprintf("cart0000000010%d", i)
+			results <- db.ReserveDigitalData(ctx, id, addCart(id, 1)...)
+		}()
+	}
+	wg.Wait()
+	close(results)
+	reserved := 0
+	for err := range results {
+		switch err {
+		case nil:
+			reserved++
+		case errors.ErrOutOfStock:
+		default:
+			t.Fatalf("concurrent reserve: %v", err)
+		}
+	}
+	if reserved != 1 || stock() != 0 {
+		t.Fatalf("concurrent reserve: %d carts got a key, stock %d", reserved, stock())
+	}
+
+	// the paid cart gets the keys it reserved
+	if _, err := db.UpdateCart(ctx, &models.Cart{Core: models.Core{ID: "cart00000000013"}, PaymentStatus: litepay.PAID}, models.CartSourceCallback); err != nil {
+		t.Fatalf("pay cart: %v", err)
+	}
+	if _, err := db.CartLetterPurchase(ctx, "cart00000000013"); err != nil {
+		t.Fatalf("purchase letter: %v", err)
+	}
+	var sold int
+	if err := db.CartQueries.QueryRowContext(ctx, `SELECT COUNT(*) FROM digital_data WHERE cart_id = ? AND reserved IS NULL`, "cart00000000013").Scan(&sold); err != nil {
+		t.Fatalf("count sold: %v", err)
+	}
+	if sold != 2 {
+		t.Fatalf("sold keys: got %d want 2", sold)
+	}
+
+	// the cart whose reservation expired was outbid and can not be filled
+	if _, err := db.UpdateCart(ctx, &models.Cart{Core: models.Core{ID: "cart00000000012"}, PaymentStatus: litepay.PAID}, models.CartSourceCallback); err != nil {
+		t.Fatalf("pay cart: %v", err)
+	}
+	if _, err := db.CartLetterPurchase(ctx, "cart00000000012"); err != errors.ErrOutOfStock {
+		t.Fatalf("letter without stock: got %v want %v", err, errors.ErrOutOfStock)
+	}
+	shortage, err := db.DigitalDataShortage(ctx, "cart00000000012")
+	if err != nil {
+		t.Fatalf("shortage: %v", err)
+	}
+	if len(shortage) != 1 || shortage[0].ProductID != keys.ID || shortage[0].Name != "Keys" || shortage[0].Missing != 2 {
+		t.Fatalf("unexpected shortage %+v", shortage)
+	}
+	if shortage, err := db.DigitalDataShortage(ctx, "cart00000000013"); err != nil || len(shortage) != 0 {
+		t.Fatalf("a filled cart is short: %+v, %v", shortage, err)
+	}
+}
+
+func Test_queries_download_file(t *testing.T) {
+	cleanup := withTempBase(t)
+	defer cleanup()
+	if err := New(migrations.Embed()); err != nil {
+		t.Fatalf("init queries: %v", err)
+	}
+	db := DB()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	bought, err := db.AddProduct(ctx, &models.Product{Name: "Guide", Slug: "guide", Amount: 100, Digital: models.Digital{Type: "file", DownloadLimit: 2}})
+	if err != nil {
+		t.Fatalf("add product: %v", err)
+	}
+	other, err := db.AddProduct(ctx, &models.Product{Name: "Other", Slug: "other", Amount: 100, Digital: models.Digital{Type: "file"}})
+	if err != nil {
+		t.Fatalf("add product: %v", err)
+	}
+	file, err := db.AddDigitalFile(ctx, bought.ID, "", "uuid-guide", "pdf", "guide.pdf")
+	if err != nil {
+		t.Fatalf("add file: %v", err)
+	}
+	otherFile, err := db.AddDigitalFile(ctx, other.ID, "", "uuid-other", "pdf", "other.pdf")
+	if err != nil {
+		t.Fatalf("add file: %v", err)
+	}
+
+	cartID := "cart00000000001"
+	cart := &models.Cart{Core: models.Core{ID: cartID}, Cart: []models.CartProduct{{ProductID: bought.ID, Quantity: 1}}, AmountTotal: 100, Currency: "USD", PaymentStatus: litepay.NEW}
+	if err := db.AddCart(ctx, cart); err != nil {
+		t.Fatalf("add cart: %v", err)
+	}
+
+	settings, err := db.GetSettingByKey(ctx, "download_secret")
+	if err != nil {
+		t.Fatalf("download secret: %v", err)
+	}
+	secret := settings["download_secret"].Value.(string)
+	token := func(fileID string, expires time.Time) string {
+		return security.SignToken(secret, cartID+"."+fileID, expires)
+	}
+	valid := time.Now().Add(time.Hour)
+
+	if _, _, err := db.DownloadFile(ctx, token(file.ID, valid), "127.0.0.1", "test"); err != errors.ErrFileNotFound {
+		t.Fatalf("unpaid cart: got %v want %v", err, errors.ErrFileNotFound)
+	}
+
+	for _, status := range []litepay.Status{litepay.PROCESSED, litepay.PAID} {
+		if _, err := db.UpdateCart(ctx, &models.Cart{Core: models.Core{ID: cartID}, PaymentStatus: status}, models.CartSourceCallback); err != nil {
+			t.Fatalf("move to %s: %v", status, err)
+		}
+	}
+
+	got, downloadID, err := db.DownloadFile(ctx, token(file.ID, valid), "127.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if got.Name != "uuid-guide" || got.OrigName != "guide.pdf" {
+		t.Fatalf("unexpected file %+v", got)
+	}
+
+	// a download whose file could not be sent is not counted
+	if err := db.CancelDownload(ctx, downloadID); err != nil {
+		t.Fatalf("cancel download: %v", err)
+	}
+	if downloads, err := db.Downloads(ctx, cartID); err != nil || len(downloads) != 0 {
+		t.Fatalf("canceled download is kept: %+v, %v", downloads, err)
+	}
+	if _, _, err := db.DownloadFile(ctx, token(file.ID, valid), "127.0.0.1", "test"); err != nil {
+		t.Fatalf("download after cancel: %v", err)
+	}
+
+	if _, _, err := db.DownloadFile(ctx, token(otherFile.ID, valid), "127.0.0.1", "test"); err != errors.ErrFileNotFound {
+		t.Fatalf("file not in cart: got %v want %v", err, errors.ErrFileNotFound)
+	}
+	if _, _, err := db.DownloadFile(ctx, token(file.ID, time.Now().Add(-time.Second)), "127.0.0.1", "test"); err != errors.ErrTokenExpired {
+		t.Fatalf("expired link: got %v want %v", err, errors.ErrTokenExpired)
+	}
+	if _, _, err := db.DownloadFile(ctx, security.SignToken("guess", cartID+"."+file.ID, valid), "127.0.0.1", "test"); err != errors.ErrTokenInvalid {
+		t.Fatalf("foreign secret: got %v want %v", err, errors.ErrTokenInvalid)
+	}
+
+	// the limit of 2 is used up by the download above and this one
+	if _, _, err := db.DownloadFile(ctx, token(file.ID, valid), "127.0.0.1", "test"); err != nil {
+		t.Fatalf("second download: %v", err)
+	}
+	if _, _, err := db.DownloadFile(ctx, token(file.ID, valid), "127.0.0.1", "test"); err != errors.ErrDownloadLimitReached {
+		t.Fatalf("third download: got %v want %v", err, errors.ErrDownloadLimitReached)
+	}
+
+	reset, err := db.ResetDownloads(ctx, cartID)
+	if err != nil || reset != 2 {
+		t.Fatalf("reset downloads: %d, %v", reset, err)
+	}
+	if _, _, err := db.DownloadFile(ctx, token(file.ID, valid), "10.0.0.1", "curl"); err != nil {
+		t.Fatalf("download after reset: %v", err)
+	}
+
+	downloads, err := db.Downloads(ctx, cartID)
+	if err != nil {
+		t.Fatalf("downloads: %v", err)
+	}
+	if len(downloads) != 3 || downloads[0].IP != "10.0.0.1" || !downloads[0].Counted || downloads[2].Counted || downloads[0].FileName != "guide.pdf" {
+		t.Fatalf("unexpected downloads %+v", downloads)
+	}
+}
+
+func Test_queries_digital_versions(t *testing.T) {
+	cleanup := withTempBase(t)
+	defer cleanup()
+	if err := New(migrations.Embed()); err != nil {
+		t.Fatalf("init queries: %v", err)
+	}
+	db := DB()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	product, err := db.AddProduct(ctx, &models.Product{Name: "Guide", Slug: "guide", Amount: 100, Digital: models.Digital{Type: "file"}})
+	if err != nil {
+		t.Fatalf("add product: %v", err)
+	}
+	first, err := db.AddDigitalFile(ctx, product.ID, "", "uuid-v1", "pdf", "guide-v1.pdf")
+	if err != nil {
+		t.Fatalf("add file: %v", err)
+	}
+
+	pay := func(cartID, email string) {
+		t.Helper()
+		cart := &models.Cart{Core: models.Core{ID: cartID}, Email: email, Cart: []models.CartProduct{{ProductID: product.ID, Quantity: 1}}, AmountTotal: 100, Currency: "USD", PaymentStatus: litepay.NEW}
+		if err := db.AddCart(ctx, cart); err != nil {
+			t.Fatalf("add cart: %v", err)
+		}
+		if _, err := db.UpdateCart(ctx, &models.Cart{Core: models.Core{ID: cartID}, PaymentStatus: litepay.PAID}, models.CartSourceCallback); err != nil {
+			t.Fatalf("pay cart: %v", err)
+		}
+	}
+	files := func(cartID string, free bool) []string {
+		t.Helper()
+		got, err := cartFiles(ctx, db.ProductQueries.DB, cartID, product.ID, free)
+		if err != nil {
+			t.Fatalf("cart files: %v", err)
+		}
+		names := []string{}
+		for _, file := range got {
+			names = append(names, file.OrigName)
+		}
+		return names
+	}
+
+	pay("cart00000000001", "old@mail.com")
+	pay("cart00000000002", "OLD@mail.com")
+	// the first buyers paid a day before the next version is released
+	if _, err := db.CartQueries.ExecContext(ctx, `UPDATE cart_status_history SET created = datetime('now', '-1 day')`); err != nil {
+		t.Fatalf("move payments: %v", err)
+	}
+	if _, err := db.CartQueries.ExecContext(ctx, `UPDATE digital_version SET released = datetime('now', '-2 day')`); err != nil {
+		t.Fatalf("move release: %v", err)
+	}
+
+	draft, err := db.AddDigitalVersion(ctx, product.ID, &models.Version{Version: "2.0", Changelog: "New chapters"})
+	if err != nil || draft.Current || draft.Released != 0 {
+		t.Fatalf("add draft: %+v, %v", draft, err)
+	}
+	if err := db.ReleaseDigitalVersion(ctx, product.ID, draft.ID); err != errors.ErrVersionNoFiles {
+		t.Fatalf("release without files: got %v want %v", err, errors.ErrVersionNoFiles)
+	}
+	if _, err := db.AddDigitalFile(ctx, product.ID, draft.ID, "uuid-v2", "pdf", "guide-v2.pdf"); err != nil {
+		t.Fatalf("add file to draft: %v", err)
+	}
+	if got := files("cart00000000001", true); len(got) != 1 || got[0] != "guide-v1.pdf" {
+		t.Fatalf("files before release: %v", got)
+	}
+	if err := db.ReleaseDigitalVersion(ctx, product.ID, draft.ID); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	pay("cart00000000003", "new@mail.com")
+
+	// with free updates everybody gets the current version, without them
+	// the version that was current at payment
+	if got := files("cart00000000001", true); len(got) != 1 || got[0] != "guide-v2.pdf" {
+		t.Fatalf("free update files: %v", got)
+	}
+	if got := files("cart00000000001", false); len(got) != 1 || got[0] != "guide-v1.pdf" {
+		t.Fatalf("paid version files: %v", got)
+	}
+	if got := files("cart00000000003", false); len(got) != 1 || got[0] != "guide-v2.pdf" {
+		t.Fatalf("new buyer files: %v", got)
+	}
+
+	versions, err := db.DigitalVersions(ctx, product.ID)
+	if err != nil || len(versions) != 2 || !versions[0].Current || versions[1].Current {
+		t.Fatalf("versions: %+v, %v", versions, err)
+	}
+	if err := db.DeleteDigitalVersion(ctx, product.ID, draft.ID); err != errors.ErrVersionCurrent {
+		t.Fatalf("delete current: got %v want %v", err, errors.ErrVersionCurrent)
+	}
+	if _, err := db.MarkDigitalVersionNotified(ctx, product.ID, versions[1].ID); err != errors.ErrVersionNotCurrent {
+		t.Fatalf("notify old version: got %v want %v", err, errors.ErrVersionNotCurrent)
+	}
+
+	// one letter per buyer, for the latest cart of each email
+	carts, err := db.MarkDigitalVersionNotified(ctx, product.ID, draft.ID)
+	if err != nil || len(carts) != 2 {
+		t.Fatalf("notify: %v, %v", carts, err)
+	}
+	letter, err := db.CartLetterUpdate(ctx, "cart00000000001", product.ID)
+	if err != nil {
+		t.Fatalf("update letter: %v", err)
+	}
+	if letter.Data["Version"] != "2.0" || !strings.Contains(letter.Data["Files"], "guide-v2.pdf") {
+		t.Fatalf("unexpected letter data %+v", letter.Data)
+	}
+
+	if err := db.UpdateSettingByKey(ctx, &models.SettingName{Key: "digital_free_updates", Value: "false"}); err != nil {
+		t.Fatalf("turn off free updates: %v", err)
+	}
+	if _, err := db.MarkDigitalVersionNotified(ctx, product.ID, draft.ID); err != errors.ErrFreeUpdatesOff {
+		t.Fatalf("notify without free updates: got %v want %v", err, errors.ErrFreeUpdatesOff)
+	}
+
+	// an old version can be removed once another one is current
+	if err := db.DeleteDigitalVersion(ctx, product.ID, first.VersionID); err != nil {
+		t.Fatalf("delete old version: %v", err)
+	}
+	if _, err := db.DigitalFile(ctx, product.ID, first.ID); err == nil {
+		t.Fatal("file of the deleted version is still there")
+	}
+}
+
+func Test_queries_license(t *testing.T) {
+	cleanup := withTempBase(t)
+	defer cleanup()
+	if err := New(migrations.Embed()); err != nil {
+		t.Fatalf("init queries: %v", err)
+	}
+	db := DB()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	product, err := db.AddProduct(ctx, &models.Product{Name: "App", Slug: "app", Amount: 100, Digital: models.Digital{Type: "data", ActivationLimit: 2}})
+	if err != nil {
+		t.Fatalf("add product: %v", err)
+	}
+	for _, key := range []string{"SOLD-KEY", "FREE-KEY"} {
+		if _, err := db.AddDigitalData(ctx, product.ID, key); err != nil {
+			t.Fatalf("add key: %v", err)
+		}
+	}
+
+	cartID := "cartlicense0001"
+	products := []models.CartProduct{{ProductID: product.ID, Quantity: 1}}
+	if err := db.AddCart(ctx, &models.Cart{Core: models.Core{ID: cartID}, Cart: products, AmountTotal: 100, Currency: "USD", PaymentStatus: litepay.NEW}); err != nil {
+		t.Fatalf("add cart: %v", err)
+	}
+	if err := db.ReserveDigitalData(ctx, cartID, products...); err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+
+	request := func(fingerprint string) *models.LicenseRequest {
+		return &models.LicenseRequest{Key: "SOLD-KEY", Fingerprint: fingerprint}
+	}
+
+	// a key is not a license until its cart is paid
+	if _, err := db.ActivateLicense(ctx, request("pc-1"), "127.0.0.1"); err != errors.ErrLicenseNotFound {
+		t.Fatalf("unpaid key: got %v want %v", err, errors.ErrLicenseNotFound)
+	}
+	if _, err := db.UpdateCart(ctx, &models.Cart{Core: models.Core{ID: cartID}, PaymentStatus: litepay.PAID}, models.CartSourceCallback); err != nil {
+		t.Fatalf("pay cart: %v", err)
+	}
+	if _, err := db.ActivateLicense(ctx, &models.LicenseRequest{Key: "FREE-KEY", Fingerprint: "pc-1"}, "127.0.0.1"); err != errors.ErrLicenseNotFound {
+		t.Fatalf("unsold key: got %v want %v", err, errors.ErrLicenseNotFound)
+	}
+
+	for _, fingerprint := range []string{"pc-1", "pc-1", "pc-2"} {
+		if _, err := db.ActivateLicense(ctx, request(fingerprint), "127.0.0.1"); err != nil {
+			t.Fatalf("activate %s: %v", fingerprint, err)
+		}
+	}
+	if _, err := db.ActivateLicense(ctx, request("pc-3"), "127.0.0.1"); err != errors.ErrActivationLimitReached {
+		t.Fatalf("over the limit: got %v want %v", err, errors.ErrActivationLimitReached)
+	}
+
+	license, err := db.ValidateLicense(ctx, request("pc-1"))
+	if err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if license.ProductID != product.ID || license.Activations != 2 || license.ActivationLimit != 2 || license.Activated == 0 {
+		t.Fatalf("unexpected license %+v", license)
+	}
+	if _, err := db.ValidateLicense(ctx, request("pc-3")); err != errors.ErrActivationNotFound {
+		t.Fatalf("validate inactive machine: got %v want %v", err, errors.ErrActivationNotFound)
+	}
+
+	signed, err := db.SignLicense(ctx, license)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	publicKey, err := db.LicensePublicKey(ctx)
+	if err != nil {
+		t.Fatalf("public key: %v", err)
+	}
+	key, _ := base64.StdEncoding.DecodeString(publicKey)
+	payload, _ := base64.StdEncoding.DecodeString(signed.Payload)
+	signature, _ := base64.StdEncoding.DecodeString(signed.Signature)
+	if !ed25519.Verify(key, payload, signature) {
+		t.Fatalf("signature does not verify")
+	}
+
+	// a deactivated or revoked machine frees a place
+	if err := db.DeactivateLicense(ctx, request("pc-2")); err != nil {
+		t.Fatalf("deactivate: %v", err)
+	}
+	if _, err := db.ActivateLicense(ctx, request("pc-3"), "127.0.0.1"); err != nil {
+		t.Fatalf("activate after deactivate: %v", err)
+	}
+
+	digital, err := db.ProductDigital(ctx, product.ID)
+	if err != nil {
+		t.Fatalf("product digital: %v", err)
+	}
+	dataID := digital.Data[0].ID
+	if digital.Data[0].Activations != 2 {
+		t.Fatalf("unexpected key %+v", digital.Data[0])
+	}
+	activations, err := db.LicenseActivations(ctx, product.ID, dataID)
+	if err != nil || len(activations) != 2 || activations[1].Fingerprint != "pc-3" {
+		t.Fatalf("activations: %+v, %v", activations, err)
+	}
+	if err := db.RevokeActivation(ctx, product.ID, dataID, activations[0].ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, err := db.ValidateLicense(ctx, request("pc-1")); err != errors.ErrActivationNotFound {
+		t.Fatalf("validate revoked machine: got %v want %v", err, errors.ErrActivationNotFound)
+	}
+	if err := db.RevokeActivation(ctx, product.ID, dataID, activations[0].ID); err != errors.ErrActivationNotFound {
+		t.Fatalf("revoke twice: got %v want %v", err, errors.ErrActivationNotFound)
+	}
+}
+
+func Test_queries_customer_portal(t *testing.T) {
+	cleanup := withTempBase(t)
+	defer cleanup()
+	if err := New(migrations.Embed()); err != nil {
+		t.Fatalf("init queries: %v", err)
+	}
+	db := DB()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	product, err := db.AddProduct(ctx, &models.Product{Name: "App", Slug: "app", Amount: 100, Digital: models.Digital{Type: "data"}})
+	if err != nil {
+		t.Fatalf("add product: %v", err)
+	}
+	if _, err := db.AddDigitalData(ctx, product.ID, "PORTAL-KEY"); err != nil {
+		t.Fatalf("add key: %v", err)
+	}
+
+	products := []models.CartProduct{{ProductID: product.ID, Quantity: 1}}
+	for _, cart := range []*models.Cart{
+		{Core: models.Core{ID: "cartportal00001"}, Email: "Buyer@mail.com", Cart: products, AmountTotal: 100, Currency: "USD", PaymentStatus: litepay.NEW},
+		{Core: models.Core{ID: "cartportal00002"}, Email: "buyer@mail.com", Cart: products, AmountTotal: 100, Currency: "USD", PaymentStatus: litepay.NEW},
+	} {
+		if err := db.AddCart(ctx, cart); err != nil {
+			t.Fatalf("add cart: %v", err)
+		}
+	}
+
+	// no link is made for an email without paid carts
+	if token, err := db.AddSignInLink(ctx, "buyer@mail.com"); err != nil || token != "" {
+		t.Fatalf("link without orders: got %q, %v", token, err)
+	}
+
+	if err := db.ReserveDigitalData(ctx, "cartportal00001", products...); err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	if _, err := db.UpdateCart(ctx, &models.Cart{Core: models.Core{ID: "cartportal00001"}, PaymentStatus: litepay.PAID}, models.CartSourceCallback); err != nil {
+		t.Fatalf("pay cart: %v", err)
+	}
+
+	link, err := db.AddSignInLink(ctx, "buyer@mail.com")
+	if err != nil || link == "" {
+		t.Fatalf("link: got %q, %v", link, err)
+	}
+	if again, err := db.AddSignInLink(ctx, "BUYER@mail.com"); err != nil || again != "" {
+		t.Fatalf("second link within a minute: got %q, %v", again, err)
+	}
+
+	token, expires, err := db.AddCustomerSession(ctx, link)
+	if err != nil || token == "" || expires <= time.Now().Unix() {
+		t.Fatalf("session: got %q %d, %v", token, expires, err)
+	}
+	if _, _, err := db.AddCustomerSession(ctx, link); err != errors.ErrTokenInvalid {
+		t.Fatalf("link used twice: got %v want %v", err, errors.ErrTokenInvalid)
+	}
+
+	email, err := db.CustomerEmail(ctx, token)
+	if err != nil || email != "buyer@mail.com" {
+		t.Fatalf("email: got %q, %v", email, err)
+	}
+
+	orders, err := db.CustomerOrders(ctx, email)
+	if err != nil {
+		t.Fatalf("orders: %v", err)
+	}
+	if len(orders) != 1 || orders[0].ID != "cartportal00001" || len(orders[0].Items) != 1 {
+		t.Fatalf("unexpected orders %+v", orders)
+	}
+	if keys := orders[0].Items[0].Keys; len(keys) != 1 || keys[0] != "PORTAL-KEY" {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+	if _, err := db.CustomerOrder(ctx, email, "cartportal00002"); err != errors.ErrNotFound {
+		t.Fatalf("unpaid order: got %v want %v", err, errors.ErrNotFound)
+	}
+
+	// a partially refunded order keeps what was bought
+	if _, err := db.UpdateCart(ctx, &models.Cart{Core: models.Core{ID: "cartportal00001"}, PaymentStatus: litepay.PARTIALLY_REFUNDED, AmountRefunded: 50}, models.CartSourceCallback); err != nil {
+		t.Fatalf("refund part: %v", err)
+	}
+	if order, err := db.CustomerOrder(ctx, email, "cartportal00001"); err != nil || len(order.Items) != 1 || len(order.Items[0].Keys) != 1 {
+		t.Fatalf("partially refunded order: %+v, %v", order, err)
+	}
+	if link, err := db.AddSignInLink(ctx, "buyer@mail.com"); err != nil || link == "" {
+		t.Fatalf("link for a partially refunded order: got %q, %v", link, err)
+	}
+
+	if err := db.DeleteCustomerSession(ctx, token); err != nil {
+		t.Fatalf("sign out: %v", err)
+	}
+	if _, err := db.CustomerEmail(ctx, token); err != errors.ErrTokenInvalid {
+		t.Fatalf("signed out: got %v want %v", err, errors.ErrTokenInvalid)
+	}
+}
+
+func Test_queries_product_variants(t *testing.T) {
+	cleanup := withTempBase(t)
+	defer cleanup()
+	if err := New(migrations.Embed()); err != nil {
+		t.Fatalf("init queries: %v", err)
+	}
+	db := DB()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	book, err := db.AddProduct(ctx, &models.Product{Name: "Book", Slug: "book", Amount: 100, Digital: models.Digital{Type: "file"}})
+	if err != nil {
+		t.Fatalf("add product: %v", err)
+	}
+	pdf, err := db.AddProductVariant(ctx, book.ID, &models.Variant{Name: "PDF", Amount: 100, SKU: "BOOK-PDF"})
+	if err != nil {
+		t.Fatalf("add variant: %v", err)
+	}
+	epub, err := db.AddProductVariant(ctx, book.ID, &models.Variant{Name: "EPUB", Amount: 150, SKU: "BOOK-EPUB", Position: 1})
+	if err != nil {
+		t.Fatalf("add variant: %v", err)
+	}
+	if _, err := db.AddProductVariant(ctx, book.ID, &models.Variant{Name: "Copy", Amount: 100, SKU: "BOOK-PDF"}); err != errors.ErrVariantSKUExists {
+		t.Fatalf("duplicate sku: got %v want %v", err, errors.ErrVariantSKUExists)
+	}
+
+	product, err := db.Product(ctx, true, book.ID)
+	if err != nil || len(product.Variants) != 2 || product.Variants[0].ID != pdf.ID || product.Variants[1].Amount != 150 {
+		t.Fatalf("product variants: %+v, %v", product, err)
+	}
+
+	for name, variantID := range map[string]string{"readme.txt": "", "book.pdf": pdf.ID, "book.epub": epub.ID} {
+		file, err := db.AddDigitalFile(ctx, book.ID, "", "uuid-"+name, "bin", name)
+		if err != nil {
+			t.Fatalf("add file: %v", err)
+		}
+		if err := db.SetDigitalVariant(ctx, book.ID, file.ID, variantID); err != nil {
+			t.Fatalf("set variant: %v", err)
+		}
+	}
+
+	pay := func(cartID string, lines ...models.CartProduct) {
+		t.Helper()
+		cart := &models.Cart{Core: models.Core{ID: cartID}, Email: "buyer@mail.com", Cart: lines, AmountTotal: 100, Currency: "USD", PaymentStatus: litepay.NEW}
+		if err := db.AddCart(ctx, cart); err != nil {
+			t.Fatalf("add cart: %v", err)
+		}
+		if _, err := db.UpdateCart(ctx, &models.Cart{Core: models.Core{ID: cartID}, PaymentStatus: litepay.PAID}, models.CartSourceCallback); err != nil {
+			t.Fatalf("pay cart: %v", err)
+		}
+	}
+	files := func(cartID string) []string {
+		t.Helper()
+		got, err := cartFiles(ctx, db.ProductQueries.DB, cartID, book.ID, true)
+		if err != nil {
+			t.Fatalf("cart files: %v", err)
+		}
+		names := []string{}
+		for _, file := range got {
+			names = append(names, file.OrigName)
+		}
+		slices.Sort(names)
+		return names
+	}
+
+	// a buyer gets the shared files and the ones of the variants bought
+	pay("cart00000000001", models.CartProduct{ProductID: book.ID, VariantID: pdf.ID, Quantity: 1})
+	if got := files("cart00000000001"); !slices.Equal(got, []string{"book.pdf", "readme.txt"}) {
+		t.Fatalf("pdf files: %v", got)
+	}
+	pay("cart00000000002", models.CartProduct{ProductID: book.ID, VariantID: pdf.ID, Quantity: 1}, models.CartProduct{ProductID: book.ID, VariantID: epub.ID, Quantity: 1})
+	if got := files("cart00000000002"); !slices.Equal(got, []string{"book.epub", "book.pdf", "readme.txt"}) {
+		t.Fatalf("both variants files: %v", got)
+	}
+	if err := db.DeleteProductVariant(ctx, book.ID, epub.ID); err != errors.ErrVariantInUse {
+		t.Fatalf("delete variant with files: got %v want %v", err, errors.ErrVariantInUse)
+	}
+
+	// keys of a variant are sold first, then the shared ones
+	license, err := db.AddProduct(ctx, &models.Product{Name: "License", Slug: "license", Amount: 100, Digital: models.Digital{Type: "data"}})
+	if err != nil {
+		t.Fatalf("add product: %v", err)
+	}
+	personal, err := db.AddProductVariant(ctx, license.ID, &models.Variant{Name: "Personal", Amount: 100})
+	if err != nil {
+		t.Fatalf("add variant: %v", err)
+	}
+	team, err := db.AddProductVariant(ctx, license.ID, &models.Variant{Name: "Team", Amount: 500})
+	if err != nil {
+		t.Fatalf("add variant: %v", err)
+	}
+	if _, err := db.ImportDigitalData(ctx, license.ID, personal.ID, []models.DataLine{{Line: 1, Content: "PERSONAL-1"}}, false); err != nil {
+		t.Fatalf("import keys: %v", err)
+	}
+	if _, err := db.ImportDigitalData(ctx, license.ID, "", []models.DataLine{{Line: 1, Content: "SHARED-1"}}, false); err != nil {
+		t.Fatalf("import keys: %v", err)
+	}
+
+	variants, err := db.ProductVariants(ctx, license.ID)
+	if err != nil || len(variants) != 2 || *variants[0].Stock != 2 || *variants[1].Stock != 1 {
+		t.Fatalf("variant stock: %+v, %v", variants, err)
+	}
+
+	if err := db.ReserveDigitalData(ctx, "cart00000000003", models.CartProduct{ProductID: license.ID, VariantID: personal.ID, Quantity: 1}); err != nil {
+		t.Fatalf("reserve personal: %v", err)
+	}
+	var content string
+	if err := db.CartQueries.QueryRowContext(ctx, `SELECT content FROM digital_data WHERE cart_id = ?`, "cart00000000003").Scan(&content); err != nil || content != "PERSONAL-1" {
+		t.Fatalf("reserved key: %q, %v", content, err)
+	}
+	if err := db.ReserveDigitalData(ctx, "cart00000000004", models.CartProduct{ProductID: license.ID, VariantID: team.ID, Quantity: 1}); err != nil {
+		t.Fatalf("reserve team: %v", err)
+	}
+	if err := db.ReserveDigitalData(ctx, "cart00000000005", models.CartProduct{ProductID: license.ID, VariantID: team.ID, Quantity: 1}); err != errors.ErrOutOfStock {
+		t.Fatalf("reserve without stock: got %v want %v", err, errors.ErrOutOfStock)
+	}
+}
+
+func Test_queries_physical_goods(t *testing.T) {
+	cleanup := withTempBase(t)
+	defer cleanup()
+	if err := New(migrations.Embed()); err != nil {
+		t.Fatalf("init queries: %v", err)
+	}
+	db := DB()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stock := 5
+	shirt, err := db.AddProduct(ctx, &models.Product{Name: "Shirt", Slug: "shirt", Amount: 2000, Physical: true, Weight: 300, Stock: &stock})
+	if err != nil {
+		t.Fatalf("add product: %v", err)
+	}
+	if err := db.UpdateActive(ctx, shirt.ID); err != nil {
+		t.Fatalf("activate product: %v", err)
+	}
+	if !db.IsProduct(ctx, "shirt") {
+		t.Fatal("a physical product without digital content must be on sale")
+	}
+
+	flat, err := db.AddShippingRate(ctx, &models.ShippingRate{Name: "Flat", Amount: 500, Active: true})
+	if err != nil {
+		t.Fatalf("add rate: %v", err)
+	}
+	heavy, err := db.AddShippingRate(ctx, &models.ShippingRate{Name: "Heavy", MinWeight: 1000, Amount: 1500, Position: 1, Active: true})
+	if err != nil {
+		t.Fatalf("add rate: %v", err)
+	}
+	if _, err := db.AddShippingRate(ctx, &models.ShippingRate{Name: "Germany", Countries: []string{"DE"}, Amount: 300, Position: 2, Active: true}); err != nil {
+		t.Fatalf("add rate: %v", err)
+	}
+
+	rates, err := db.ShippingRatesFor(ctx, "US", 600)
+	if err != nil || len(rates) != 1 || rates[0].ID != flat.ID {
+		t.Fatalf("rates for US: %+v, %v", rates, err)
+	}
+	rates, err = db.ShippingRatesFor(ctx, "DE", 1200)
+	if err != nil || len(rates) != 3 {
+		t.Fatalf("rates for DE: %+v, %v", rates, err)
+	}
+	if _, err := db.ShippingRateFor(ctx, heavy.ID, "US", 600); err != errors.ErrShippingRateNotApplies {
+		t.Fatalf("heavy rate for a light cart: got %v want %v", err, errors.ErrShippingRateNotApplies)
+	}
+
+	address := models.Address{Name: "John Doe", Line1: "1 Main St", City: "Springfield", PostalCode: "12345", Country: "US"}
+	cart := &models.Cart{
+		Core:          models.Core{ID: "cart00000000001"},
+		Email:         "buyer@mail.com",
+		Cart:          []models.CartProduct{{ProductID: shirt.ID, Quantity: 2}},
+		AmountTotal:   4500,
+		Currency:      "USD",
+		PaymentStatus: litepay.NEW,
+		Shipping:      &models.CartShipping{Address: address, Rate: flat.Name, Amount: flat.Amount, Status: models.ShipmentPending},
+	}
+	if err := db.AddCart(ctx, cart); err != nil {
+		t.Fatalf("add cart: %v", err)
+	}
+
+	shipment := &models.CartShipment{Status: models.ShipmentShipped, TrackingNumber: "1Z999"}
+	if _, err := db.UpdateCartShipment(ctx, cart.ID, shipment); err != errors.ErrCartNotPaid {
+		t.Fatalf("ship unpaid cart: got %v want %v", err, errors.ErrCartNotPaid)
+	}
+
+	if _, err := db.UpdateCart(ctx, &models.Cart{Core: models.Core{ID: cart.ID}, PaymentStatus: litepay.PAID}, models.CartSourceCallback); err != nil {
+		t.Fatalf("pay cart: %v", err)
+	}
+	product, err := db.Product(ctx, true, shirt.ID)
+	if err != nil || product.Stock == nil || *product.Stock != 3 {
+		t.Fatalf("stock after payment: %+v, %v", product, err)
+	}
+
+	shipped, err := db.UpdateCartShipment(ctx, cart.ID, shipment)
+	if err != nil || !shipped {
+		t.Fatalf("ship cart: %v, %v", shipped, err)
+	}
+	if shipped, err := db.UpdateCartShipment(ctx, cart.ID, shipment); err != nil || shipped {
+		t.Fatalf("ship cart again: %v, %v", shipped, err)
+	}
+
+	got, err := db.Cart(ctx, cart.ID)
+	if err != nil || got.Shipping == nil || got.Shipping.Address.City != "Springfield" || got.Shipping.TrackingNumber != "1Z999" || got.Shipping.Shipped == 0 {
+		t.Fatalf("cart shipping: %+v, %v", got.Shipping, err)
+	}
+
+	letter, err := db.CartLetterShipped(ctx, cart.ID)
+	if err != nil || letter.To != "buyer@mail.com" || letter.Data["Tracking_Number"] != "1Z999" {
+		t.Fatalf("shipped letter: %+v, %v", letter, err)
+	}
+}
+
+func Test_queries_inventory(t *testing.T) {
+	cleanup := withTempBase(t)
+	defer cleanup()
+	if err := New(migrations.Embed()); err != nil {
+		t.Fatalf("init queries: %v", err)
+	}
+	db := DB()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	mug, err := db.AddProduct(ctx, &models.Product{Name: "Mug", Slug: "mug", Amount: 1200, Physical: true})
+	if err != nil {
+		t.Fatalf("add product: %v", err)
+	}
+	red, err := db.AddProductVariant(ctx, mug.ID, &models.Variant{Name: "Red", Amount: 1200})
+	if err != nil {
+		t.Fatalf("add variant: %v", err)
+	}
+	blue, err := db.AddProductVariant(ctx, mug.ID, &models.Variant{Name: "Blue", Amount: 1200})
+	if err != nil {
+		t.Fatalf("add variant: %v", err)
+	}
+
+	product, err := db.Product(ctx, true, mug.ID)
+	if err != nil || product.Stock != nil || !product.InStock {
+		t.Fatalf("untracked stock: %+v, %v", product, err)
+	}
+
+	if _, err := db.AdjustStock(ctx, mug.ID, &models.StockAdjustment{Change: -1}); err != errors.ErrStockNegative {
+		t.Fatalf("negative stock: got %v want %v", err, errors.ErrStockNegative)
+	}
+	if _, err := db.AdjustStock(ctx, mug.ID, &models.StockAdjustment{Change: 3, Note: "delivery"}); err != nil {
+		t.Fatalf("adjust product stock: %v", err)
+	}
+	if _, err := db.AdjustStock(ctx, mug.ID, &models.StockAdjustment{VariantID: red.ID, Change: 1}); err != nil {
+		t.Fatalf("adjust variant stock: %v", err)
+	}
+
+	variants, err := db.ProductVariants(ctx, mug.ID)
+	if err != nil || *variants[0].Stock != 1 || *variants[1].Stock != 3 {
+		t.Fatalf("variant stock: %+v, %v", variants, err)
+	}
+
+	// the last red mug is held by the first cart
+	if err := db.ReserveStock(ctx, "cart00000000001", models.CartProduct{ProductID: mug.ID, VariantID: red.ID, Quantity: 1}); err != nil {
+		t.Fatalf("reserve stock: %v", err)
+	}
+	err = db.ReserveStock(ctx, "cart00000000002", models.CartProduct{ProductID: mug.ID, VariantID: red.ID, Quantity: 1})
+	if err != errors.ErrItemsOutOfStock {
+		t.Fatalf("reserve sold out variant: got %v want %v", err, errors.ErrItemsOutOfStock)
+	}
+	err = db.ReserveStock(ctx, "cart00000000002", models.CartProduct{ProductID: mug.ID, VariantID: blue.ID, Quantity: 3})
+	if err != errors.ErrItemsOutOfStock {
+		t.Fatalf("reserve more than the product stock: got %v want %v", err, errors.ErrItemsOutOfStock)
+	}
+	if err := db.ReserveStock(ctx, "cart00000000002", models.CartProduct{ProductID: mug.ID, VariantID: blue.ID, Quantity: 2}); err != nil {
+		t.Fatalf("reserve stock: %v", err)
+	}
+
+	product, err = db.Product(ctx, true, mug.ID)
+	if err != nil || *product.Stock != 0 || product.InStock {
+		t.Fatalf("stock with reservations: %+v, %v", product, err)
+	}
+
+	// an expired reservation gives the stock back
+	if _, err := db.CartQueries.ExecContext(ctx, `UPDATE stock_reservation SET reserved = datetime('now', '-2 hours') WHERE cart_id = ?`, "cart00000000002"); err != nil {
+		t.Fatalf("expire reservation: %v", err)
+	}
+	product, err = db.Product(ctx, true, mug.ID)
+	if err != nil || *product.Stock != 2 || !product.InStock {
+		t.Fatalf("stock after expiry: %+v, %v", product, err)
+	}
+
+	cart := &models.Cart{
+		Core:          models.Core{ID: "cart00000000001"},
+		Email:         "buyer@mail.com",
+		Cart:          []models.CartProduct{{ProductID: mug.ID, VariantID: red.ID, Quantity: 1}},
+		AmountTotal:   1200,
+		Currency:      "USD",
+		PaymentStatus: litepay.NEW,
+	}
+	if err := db.AddCart(ctx, cart); err != nil {
+		t.Fatalf("add cart: %v", err)
+	}
+	if _, err := db.UpdateCart(ctx, &models.Cart{Core: models.Core{ID: cart.ID}, PaymentStatus: litepay.PAID}, models.CartSourceCallback); err != nil {
+		t.Fatalf("pay cart: %v", err)
+	}
+
+	inventory, err := db.Inventory(ctx, mug.ID)
+	if err != nil || len(inventory.Levels) != 3 {
+		t.Fatalf("inventory: %+v, %v", inventory, err)
+	}
+	if *inventory.Levels[0].Stock != 2 || inventory.Levels[0].Reserved != 0 || *inventory.Levels[1].Stock != 0 {
+		t.Fatalf("stock after payment: %+v", inventory.Levels)
+	}
+	if len(inventory.Movements) != 4 || inventory.Movements[0].Reason != models.StockMovementSale || inventory.Movements[0].CartID != cart.ID {
+		t.Fatalf("stock movements: %+v", inventory.Movements)
+	}
+
+	if err := db.UntrackStock(ctx, mug.ID, red.ID); err != nil {
+		t.Fatalf("untrack variant stock: %v", err)
+	}
+	variants, err = db.ProductVariants(ctx, mug.ID)
+	if err != nil || *variants[0].Stock != 2 {
+		t.Fatalf("untracked variant is limited by the product stock: %+v, %v", variants, err)
+	}
+}
+
+func Test_queries_categories_and_tags(t *testing.T) {
+	cleanup := withTempBase(t)
+	defer cleanup()
+	if err := New(migrations.Embed()); err != nil {
+		t.Fatalf("init queries: %v", err)
+	}
+	db := DB()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	kitchen, err := db.AddCategory(ctx, &models.Category{Name: "Kitchen", Slug: "kitchen", Seo: &models.Seo{Title: "Kitchen"}})
+	if err != nil {
+		t.Fatalf("add category: %v", err)
+	}
+	mugs, err := db.AddCategory(ctx, &models.Category{ParentID: kitchen.ID, Name: "Mugs", Slug: "mugs"})
+	if err != nil {
+		t.Fatalf("add subcategory: %v", err)
+	}
+	if _, err := db.AddCategory(ctx, &models.Category{Name: "Mugs", Slug: "mugs"}); err != errors.ErrCategorySlugExists {
+		t.Fatalf("taken slug: got %v want %v", err, errors.ErrCategorySlugExists)
+	}
+	kitchen.ParentID = mugs.ID
+	if err := db.UpdateCategory(ctx, kitchen); err != errors.ErrCategoryCycle {
+		t.Fatalf("nest under a subcategory: got %v want %v", err, errors.ErrCategoryCycle)
+	}
+	kitchen.ParentID = ""
+
+	mug, err := db.AddProduct(ctx, &models.Product{Name: "Mug", Slug: "mug", Amount: 1200, Physical: true})
+	if err != nil {
+		t.Fatalf("add product: %v", err)
+	}
+	plate, err := db.AddProduct(ctx, &models.Product{Name: "Plate", Slug: "plate", Amount: 3000, Physical: true})
+	if err != nil {
+		t.Fatalf("add product: %v", err)
+	}
+	if _, err := db.AddProductVariant(ctx, mug.ID, &models.Variant{Name: "Large", Amount: 2500}); err != nil {
+		t.Fatalf("add variant: %v", err)
+	}
+	for _, id := range []string{mug.ID, plate.ID} {
+		if err := db.UpdateActive(ctx, id); err != nil {
+			t.Fatalf("activate product: %v", err)
+		}
+	}
+
+	if err := db.SetProductCategories(ctx, mug.ID, []string{mugs.ID, mugs.ID}); err != nil {
+		t.Fatalf("set categories: %v", err)
+	}
+	if err := db.SetProductCategories(ctx, plate.ID, []string{kitchen.ID}); err != nil {
+		t.Fatalf("set categories: %v", err)
+	}
+	if err := db.SetProductCategories(ctx, plate.ID, []string{"missing00000000"}); err != errors.ErrCategoryNotFound {
+		t.Fatalf("unknown category: got %v want %v", err, errors.ErrCategoryNotFound)
+	}
+	if err := db.SetProductTags(ctx, mug.ID, []string{"Gift Idea", "gift-idea", " Coffee "}); err != nil {
+		t.Fatalf("set tags: %v", err)
+	}
+
+	product, err := db.Product(ctx, false, "mug")
+	if err != nil || len(product.Categories) != 1 || product.Categories[0].Slug != "mugs" || len(product.Tags) != 2 {
+		t.Fatalf("product categories and tags: %+v, %v", product, err)
+	}
+	if product.Tags[0].Name != "Coffee" || product.Tags[1].Slug != "gift-idea" {
+		t.Fatalf("product tags: %+v", product.Tags)
+	}
+
+	tests := []struct {
+		name   string
+		filter models.ProductFilter
+		want   []string
+	}{
+		{"parent category lists subcategories", models.ProductFilter{Category: "kitchen"}, []string{"mug", "plate"}},
+		{"subcategory", models.ProductFilter{Category: "mugs"}, []string{"mug"}},
+		{"unknown category", models.ProductFilter{Category: "garden"}, nil},
+		{"tag", models.ProductFilter{Tag: "gift-idea"}, []string{"mug"}},
+		{"price of the product", models.ProductFilter{MinAmount: 2800}, []string{"plate"}},
+		{"price of a variant", models.ProductFilter{MinAmount: 2000, MaxAmount: 2600}, []string{"mug"}},
+		{"category and price", models.ProductFilter{Category: "kitchen", MaxAmount: 1500}, []string{"mug"}},
+	}
+	for _, tt := range tests {
+		products, err := db.ListProducts(ctx, false, &tt.filter, 20, 0, "")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var got []string
+		for _, product := range products.Products {
+			got = append(got, product.Slug)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) || products.Total != len(tt.want) {
+			t.Errorf("%s: got %v (total %d) want %v", tt.name, got, products.Total, tt.want)
+		}
+	}
+
+	category, err := db.CategoryBySlug(ctx, "kitchen")
+	if err != nil || category.Seo.Title != "Kitchen" || category.Products != 1 || len(category.Children) != 1 {
+		t.Fatalf("category by slug: %+v, %v", category, err)
+	}
+
+	// the subcategories of a deleted category move up to its parent
+	if err := db.DeleteCategory(ctx, kitchen.ID); err != nil {
+		t.Fatalf("delete category: %v", err)
+	}
+	categories, err := db.Categories(ctx, false)
+	if err != nil || len(categories) != 1 || categories[0].ParentID != "" || categories[0].Products != 1 {
+		t.Fatalf("categories after delete: %+v, %v", categories, err)
+	}
+
+	tags, err := db.Tags(ctx)
+	if err != nil || len(tags) != 2 {
+		t.Fatalf("tags: %+v, %v", tags, err)
+	}
+	if err := db.UpdateTag(ctx, &models.Tag{ID: tags[0].ID, Name: "Gift idea"}); err != errors.ErrTagExists {
+		t.Fatalf("rename to a taken name: got %v want %v", err, errors.ErrTagExists)
+	}
+	if err := db.DeleteTag(ctx, tags[1].ID); err != nil {
+		t.Fatalf("delete tag: %v", err)
+	}
+	product, err = db.Product(ctx, true, mug.ID)
+	if err != nil || len(product.Tags) != 1 || product.Tags[0].Name != "Coffee" {
+		t.Fatalf("tags after delete: %+v, %v", product, err)
+	}
+}
+
+func Test_queries_search_products(t *testing.T) {
+	cleanup := withTempBase(t)
+	defer cleanup()
+	if err := New(migrations.Embed()); err != nil {
+		t.Fatalf("init queries: %v", err)
+	}
+	db := DB()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	mug, err := db.AddProduct(ctx, &models.Product{
+		Name:        "Coffee mug",
+		Slug:        "mug",
+		Amount:      1200,
+		Description: "<p>Holds <strong>350&nbsp;ml</strong> of tea &amp; more</p>",
+		Metadata:    []models.Metadata{{Key: "material", Value: "Porcelain"}},
+		Physical:    true,
+	})
+	if err != nil {
+		t.Fatalf("add product: %v", err)
+	}
+	beans, err := db.AddProduct(ctx, &models.Product{
+		Name:        "Beans",
+		Slug:        "beans",
+		Amount:      900,
+		Brief:       "Fresh coffee <b>beans</b>",
+		Description: "Roasted weekly",
+		Attributes:  []string{"Arabica"},
+		Physical:    true,
+	})
+	if err != nil {
+		t.Fatalf("add product: %v", err)
+	}
+	if _, err := db.AddProduct(ctx, &models.Product{Name: "Coffee grinder", Slug: "grinder", Amount: 5000, Physical: true}); err != nil {
+		t.Fatalf("add product: %v", err)
+	}
+	for _, id := range []string{mug.ID, beans.ID} {
+		if err := db.UpdateActive(ctx, id); err != nil {
+			t.Fatalf("activate product: %v", err)
+		}
+	}
+
+	search := func(private bool, query string) []string {
+		t.Helper()
+		matches, err := db.SearchProducts(ctx, private, query, 20, 0)
+		if err != nil {
+			t.Fatalf("search %q: %v", query, err)
+		}
+		slugs := []string{}
+		for _, product := range matches.Products {
+			slugs = append(slugs, product.Slug)
+		}
+		if matches.Total != len(slugs) {
+			t.Fatalf("search %q: total %d for %v", query, matches.Total, slugs)
+		}
+		return slugs
+	}
+
+	tests := []struct {
+		name    string
+		private bool
+		query   string
+		want    []string
+	}{
+		{"a match in the name ranks first", false, "coffee", []string{"mug", "beans"}},
+		{"inactive products are not listed", false, "grinder", []string{}},
+		{"inactive products are found by the admin", true, "grinder", []string{"grinder"}},
+		{"prefix", false, "porc", []string{"mug"}},
+		{"entities are decoded", false, "tea & more", []string{"mug"}},
+		{"html tags are not indexed", false, "strong", []string{}},
+		{"attributes", false, "ARABICA", []string{"beans"}},
+		{"every word has to match", false, "coffee roasted", []string{"beans"}},
+		{"quotes are plain text", false, `"mug`, []string{"mug"}},
+	}
+	for _, tt := range tests {
+		if got := search(tt.private, tt.query); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v want %v", tt.name, got, tt.want)
+		}
+	}
+
+	matches, err := db.SearchProducts(ctx, false, "porcel", 20, 0)
+	if err != nil || len(matches.Products) != 1 || matches.Products[0].Snippet != "<mark>Porcelain</mark>" {
+		t.Fatalf("snippet: %+v, %v", matches, err)
+	}
+	matches, err = db.SearchProducts(ctx, false, "fresh", 20, 0)
+	if err != nil || len(matches.Products) != 1 || matches.Products[0].Snippet != "<mark>Fresh</mark> coffee &lt;b&gt;beans&lt;/b&gt;" {
+		t.Fatalf("escaped snippet: %+v, %v", matches, err)
+	}
+
+	if _, err := db.SearchProducts(ctx, false, " -- ", 20, 0); err != errors.ErrSearchQueryEmpty {
+		t.Fatalf("query without words: got %v want %v", err, errors.ErrSearchQueryEmpty)
+	}
+
+	// the index follows the product as it changes
+	mug.Name = "Tea cup"
+	if err := db.UpdateProduct(ctx, mug); err != nil {
+		t.Fatalf("update product: %v", err)
+	}
+	if got := search(false, "coffee"); !slices.Equal(got, []string{"beans"}) {
+		t.Errorf("after rename: got %v", got)
+	}
+	if err := db.DeleteProduct(ctx, beans.ID); err != nil {
+		t.Fatalf("delete product: %v", err)
+	}
+	if got := search(true, "coffee"); !slices.Equal(got, []string{"grinder"}) {
+		t.Errorf("after delete: got %v", got)
+	}
+}
@@ -0,0 +1,119 @@
+package queries
+
+import (
+	"context"
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/pkg/errors"
+)
+
+// searchTerms caps the words of a search query.
+const searchTerms = 10
+
+// searchRank orders matches by bm25 with the columns of product_search
+// weighted: name, brief, description, metadata, attributes.
+const searchRank = `bm25(product_search, 0, 10, 5, 1, 2, 3)`
+
+// searchSnippet marks matched words with control characters that can not come
+// from the index, they are swapped for <mark> once the text is escaped.
+const searchSnippet = `snippet(product_search, -1, char(2), char(3), '…', 16)`
+
+// searchMatch builds an FTS5 query from what a customer typed: every word has
+// to match, the last letters of a word may be missing.
+func searchMatch(query string) string {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) > searchTerms {
+		words = words[:searchTerms]
+	}
+
+	terms := make([]string, len(words))
+	for i, word := range words {
+		terms[i] = `"` + word + `"*`
+	}
+	return strings.Join(terms, " ")
+}
+
+// SearchProducts finds products by their name, brief, description, metadata
+// values and attributes, best match first. The public search only finds the
+// products that are listed in the shop.
+func (q *ProductQueries) SearchProducts(ctx context.Context, private bool, query string, limit, offset int) (*models.ProductMatches, error) {
+	match := searchMatch(query)
+	if match == "" {
+		return nil, errors.ErrSearchQueryEmpty
+	}
+
+	where := `product_search MATCH ?`
+	if !private {
+		where += ` AND product.deleted = 0 AND ` + productListed
+	}
+
+	matches := &models.ProductMatches{Products: []models.ProductMatch{}}
+	err := q.DB.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM product_search
+			JOIN product ON product.id = product_search.product_id
+			WHERE `+where, match).Scan(&matches.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.DB.QueryContext(ctx, `
+			SELECT product_search.product_id, `+searchSnippet+`
+			FROM product_search
+			JOIN product ON product.id = product_search.product_id
+			WHERE `+where+`
+			ORDER BY `+searchRank+`
+			LIMIT ? OFFSET ?
+		`, match, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	idList := []models.CartProduct{}
+	snippets := map[string]string{}
+	for rows.Next() {
+		var id, snippet string
+		if err := rows.Scan(&id, &snippet); err != nil {
+			return nil, err
+		}
+		idList = append(idList, models.CartProduct{ProductID: id})
+		snippets[id] = strings.NewReplacer("\x02", "<mark>", "\x03", "</mark>").Replace(html.EscapeString(snippet))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// an empty list of ids would load every product
+	if len(idList) == 0 {
+		currency, err := db.GetSettingByKey(ctx, "currency")
+		if err != nil {
+			return nil, err
+		}
+		matches.Currency = currency["currency"].Value.(string)
+		return matches, nil
+	}
+
+	products, err := q.ListProducts(ctx, private, nil, 0, 0, "", idList...)
+	if err != nil {
+		return nil, err
+	}
+	matches.Currency = products.Currency
+
+	// the list comes back in its own order, the matches keep the rank
+	found := make(map[string]models.Product, len(products.Products))
+	for _, product := range products.Products {
+		found[product.ID] = product
+	}
+	for _, item := range idList {
+		if product, ok := found[item.ProductID]; ok {
+			matches.Products = append(matches.Products, models.ProductMatch{Product: product, Snippet: snippets[item.ProductID]})
+		}
+	}
+
+	return matches, nil
+}
@@ -19,13 +19,20 @@ type SettingQueries struct {
 	*sql.DB
 }
 
+// SettingFields is implemented by settings models that GroupFieldMap does not
+// know about, such as the settings of custom payment providers.
+type SettingFields interface {
+	SettingFields() map[string]any
+}
+
 // GroupFieldMap generates a map of fields based on the type of settings.
 func (q *SettingQueries) GroupFieldMap(settings any) map[string]any {
 	switch s := settings.(type) {
 	case *models.Main:
 		return map[string]any{
-			"site_name": &s.SiteName,
-			"domain":    &s.Domain,
+			"site_name":            &s.SiteName,
+			"domain":               &s.Domain,
+			"digital_free_updates": &s.FreeUpdates,
 		}
 	case *models.Auth:
 		return map[string]any{
@@ -48,17 +55,20 @@ func (q *SettingQueries) GroupFieldMap(settings any) map[string]any {
 		}
 	case *models.Payment:
 		return map[string]any{
-			"currency": &s.Currency,
+			"currency":          &s.Currency,
+			"stock_reservation": &s.StockReservation,
 		}
 	case *models.Stripe:
 		return map[string]any{
-			"stripe_secret_key": &s.SecretKey,
-			"stripe_active":     &s.Active,
+			"stripe_secret_key":         &s.SecretKey,
+			"stripe_webhook_secret_key": &s.WebhookSecret,
+			"stripe_active":             &s.Active,
 		}
 	case *models.Paypal:
 		return map[string]any{
 			"paypal_client_id":  &s.ClientID,
 			"paypal_secret_key": &s.SecretKey,
+			"paypal_webhook_id": &s.WebhookID,
 			"paypal_active":     &s.Active,
 		}
 	case *models.Spectrocoin:
@@ -66,16 +76,13 @@ func (q *SettingQueries) GroupFieldMap(settings any) map[string]any {
 			"spectrocoin_merchant_id": &s.MerchantID,
 			"spectrocoin_project_id":  &s.ProjectID,
 			"spectrocoin_private_key": &s.PrivateKey,
+			"spectrocoin_public_key":  &s.PublicKey,
 			"spectrocoin_active":      &s.Active,
 		}
 	case *models.Dummy:
 		return map[string]any{
 			"dummy_active": &s.Active,
 		}
-	case *models.Webhook:
-		return map[string]any{
-			"webhook_url": &s.Url,
-		}
 	case *models.Mail:
 		return map[string]any{
 			"mail_sender_name":  &s.SenderName,
@@ -86,6 +93,8 @@ func (q *SettingQueries) GroupFieldMap(settings any) map[string]any {
 			"smtp_password":     &s.SMTP.Password,
 			"smtp_encryption":   &s.SMTP.Encryption,
 		}
+	case SettingFields:
+		return s.SettingFields()
 	default:
 		return nil
 	}
@@ -0,0 +1,269 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/litepay"
+	"github.com/shurco/litecart/pkg/security"
+)
+
+// ShippingQueries is a struct that embeds a pointer to an sql.DB.
+// This allows for direct access to all the methods of sql.DB through ShippingQueries.
+type ShippingQueries struct {
+	*sql.DB
+}
+
+const shippingRateColumns = `
+	id,
+	name,
+	countries,
+	min_weight,
+	max_weight,
+	amount,
+	position,
+	active,
+	strftime('%s', created),
+	IFNULL(strftime('%s', updated), 0)
+`
+
+// scanShippingRate reads a row selected with shippingRateColumns.
+func scanShippingRate(row interface{ Scan(...any) error }) (*models.ShippingRate, error) {
+	rate := &models.ShippingRate{}
+	var countries string
+	err := row.Scan(
+		&rate.ID,
+		&rate.Name,
+		&countries,
+		&rate.MinWeight,
+		&rate.MaxWeight,
+		&rate.Amount,
+		&rate.Position,
+		&rate.Active,
+		&rate.Created,
+		&rate.Updated,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(countries), &rate.Countries); err != nil {
+		return nil, err
+	}
+	return rate, nil
+}
+
+// ShippingRates returns all shipping rates in the order they are offered.
+func (q *ShippingQueries) ShippingRates(ctx context.Context) ([]*models.ShippingRate, error) {
+	rates := []*models.ShippingRate{}
+
+	rows, err := q.DB.QueryContext(ctx, `SELECT`+shippingRateColumns+`FROM shipping_rate ORDER BY position, rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		rate, err := scanShippingRate(rows)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+
+	return rates, rows.Err()
+}
+
+// ShippingRate returns a shipping rate by its id.
+func (q *ShippingQueries) ShippingRate(ctx context.Context, id string) (*models.ShippingRate, error) {
+	rate, err := scanShippingRate(q.DB.QueryRowContext(ctx, `SELECT`+shippingRateColumns+`FROM shipping_rate WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrShippingRateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return rate, nil
+}
+
+// AddShippingRate inserts a new shipping rate.
+func (q *ShippingQueries) AddShippingRate(ctx context.Context, rate *models.ShippingRate) (*models.ShippingRate, error) {
+	rate.ID = security.RandomString()
+	if rate.Countries == nil {
+		rate.Countries = []string{}
+	}
+
+	countries, err := json.Marshal(rate.Countries)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO shipping_rate (id, name, countries, min_weight, max_weight, amount, position, active)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING strftime('%s', created)
+	`
+	err = q.DB.QueryRowContext(ctx, query, rate.ID, rate.Name, string(countries), rate.MinWeight, rate.MaxWeight,
+		rate.Amount, rate.Position, rate.Active).Scan(&rate.Created)
+	if err != nil {
+		return nil, err
+	}
+
+	return rate, nil
+}
+
+// UpdateShippingRate updates a shipping rate. Carts that already use it keep
+// the name and the amount they were paid with.
+func (q *ShippingQueries) UpdateShippingRate(ctx context.Context, rate *models.ShippingRate) error {
+	if rate.Countries == nil {
+		rate.Countries = []string{}
+	}
+
+	countries, err := json.Marshal(rate.Countries)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE shipping_rate
+		SET name = ?, countries = ?, min_weight = ?, max_weight = ?, amount = ?, position = ?, active = ?, updated = datetime('now')
+		WHERE id = ?
+	`
+	result, err := q.DB.ExecContext(ctx, query, rate.Name, string(countries), rate.MinWeight, rate.MaxWeight,
+		rate.Amount, rate.Position, rate.Active, rate.ID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.ErrShippingRateNotFound
+	}
+	return nil
+}
+
+// DeleteShippingRate removes a shipping rate.
+func (q *ShippingQueries) DeleteShippingRate(ctx context.Context, id string) error {
+	result, err := q.DB.ExecContext(ctx, `DELETE FROM shipping_rate WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.ErrShippingRateNotFound
+	}
+	return nil
+}
+
+// ShippingRatesFor returns the active rates that ship a cart of the given
+// weight in grams to the country.
+func (q *ShippingQueries) ShippingRatesFor(ctx context.Context, country string, weight int) ([]*models.ShippingRate, error) {
+	rates, err := q.ShippingRates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	applies := []*models.ShippingRate{}
+	for _, rate := range rates {
+		if rate.Applies(country, weight) {
+			applies = append(applies, rate)
+		}
+	}
+	return applies, nil
+}
+
+// ShippingRateFor returns the rate the buyer picked, or
+// errors.ErrShippingRateNotApplies if it does not ship the cart to the country.
+func (q *ShippingQueries) ShippingRateFor(ctx context.Context, id, country string, weight int) (*models.ShippingRate, error) {
+	rate, err := q.ShippingRate(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !rate.Applies(country, weight) {
+		return nil, errors.ErrShippingRateNotApplies
+	}
+	return rate, nil
+}
+
+// UpdateCartShipment sets the shipment status and tracking of a paid cart
+// with physical products. It reports whether the cart has just been marked
+// as shipped, so the shipped letter goes out once.
+func (q *ShippingQueries) UpdateCartShipment(ctx context.Context, cartID string, shipment *models.CartShipment) (bool, error) {
+	var status, paymentStatus sql.NullString
+	err := q.DB.QueryRowContext(ctx, `SELECT shipment_status, payment_status FROM cart WHERE id = ?`, cartID).Scan(&status, &paymentStatus)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, errors.ErrProductNotFound
+		}
+		return false, err
+	}
+	if status.String == "" {
+		return false, errors.ErrCartNotShippable
+	}
+	if litepay.Status(paymentStatus.String) != litepay.PAID {
+		return false, errors.ErrCartNotPaid
+	}
+
+	// the status checked above must not have changed, so of two concurrent
+	// updates only one marks the cart as shipped
+	result, err := q.DB.ExecContext(ctx, `
+		UPDATE cart SET
+			shipment_status = ?,
+			tracking_number = ?,
+			tracking_url = ?,
+			shipped = IIF(? = 'shipped', IFNULL(shipped, datetime('now')), shipped),
+			updated = datetime('now')
+		WHERE id = ? AND shipment_status = ?
+	`, shipment.Status, shipment.TrackingNumber, shipment.TrackingURL, shipment.Status, cartID, status.String)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0 && status.String != models.ShipmentShipped && shipment.Status == models.ShipmentShipped, nil
+}
+
+// CartLetterShipped builds the letter that tells the buyer the physical
+// products of a cart have been shipped.
+func (q *ShippingQueries) CartLetterShipped(ctx context.Context, cartID string) (*models.MessageMail, error) {
+	cart, err := db.Cart(ctx, cartID)
+	if err != nil {
+		return nil, err
+	}
+	if cart.Shipping == nil {
+		return nil, errors.ErrCartNotShippable
+	}
+
+	mailLetter, err := db.GetSettingByKey(ctx, "site_name", "email", "mail_letter_shipped")
+	if err != nil {
+		return nil, err
+	}
+
+	mail := &models.MessageMail{To: cart.Email}
+	if err := json.Unmarshal([]byte(mailLetter["mail_letter_shipped"].Value.(string)), &mail.Letter); err != nil {
+		return nil, err
+	}
+
+	mail.Data = map[string]string{
+		"Site_Name":        mailLetter["site_name"].Value.(string),
+		"Admin_Email":      mailLetter["email"].Value.(string),
+		"Shipping_Address": cart.Shipping.Address.String(),
+		"Shipping_Rate":    cart.Shipping.Rate,
+		"Tracking_Number":  cart.Shipping.TrackingNumber,
+		"Tracking_URL":     cart.Shipping.TrackingURL,
+	}
+
+	return mail, nil
+}
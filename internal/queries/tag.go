@@ -0,0 +1,194 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/security"
+	"github.com/shurco/litecart/pkg/strutil"
+)
+
+// TagQueries is a struct that embeds a pointer to an sql.DB.
+// This allows for direct access to all the methods of sql.DB through TagQueries.
+type TagQueries struct {
+	*sql.DB
+}
+
+// Tags returns all tags by name with the number of products they label.
+func (q *TagQueries) Tags(ctx context.Context) ([]*models.Tag, error) {
+	tags := []*models.Tag{}
+
+	query := `
+		SELECT id, name, slug, (SELECT COUNT(*) FROM product_tag WHERE tag_id = tag.id), strftime('%s', created)
+		FROM tag
+		ORDER BY name
+	`
+	rows, err := q.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		tag := &models.Tag{}
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Slug, &tag.Products, &tag.Created); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// checkTag returns errors.ErrTagExists if a tag other than the given one
+// already has the same slug.
+func (q *TagQueries) checkTag(ctx context.Context, tag *models.Tag) error {
+	var taken bool
+	if err := q.DB.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM tag WHERE slug = ? AND id != ?)`, tag.Slug, tag.ID).Scan(&taken); err != nil {
+		return err
+	}
+	if taken {
+		return errors.ErrTagExists
+	}
+	return nil
+}
+
+// AddTag inserts a new tag.
+func (q *TagQueries) AddTag(ctx context.Context, tag *models.Tag) (*models.Tag, error) {
+	tag.ID = security.RandomString()
+	tag.Name = strings.TrimSpace(tag.Name)
+	tag.Slug = strutil.Slugify(tag.Name)
+	if err := q.checkTag(ctx, tag); err != nil {
+		return nil, err
+	}
+
+	query := `INSERT INTO tag (id, name, slug) VALUES (?, ?, ?) RETURNING strftime('%s', created)`
+	if err := q.DB.QueryRowContext(ctx, query, tag.ID, tag.Name, tag.Slug).Scan(&tag.Created); err != nil {
+		return nil, err
+	}
+
+	return tag, nil
+}
+
+// UpdateTag renames a tag on every product it labels.
+func (q *TagQueries) UpdateTag(ctx context.Context, tag *models.Tag) error {
+	tag.Name = strings.TrimSpace(tag.Name)
+	tag.Slug = strutil.Slugify(tag.Name)
+	if err := q.checkTag(ctx, tag); err != nil {
+		return err
+	}
+
+	result, err := q.DB.ExecContext(ctx, `UPDATE tag SET name = ?, slug = ? WHERE id = ?`, tag.Name, tag.Slug, tag.ID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.ErrTagNotFound
+	}
+	return nil
+}
+
+// DeleteTag deletes a tag and takes it off every product.
+func (q *TagQueries) DeleteTag(ctx context.Context, id string) error {
+	result, err := q.DB.ExecContext(ctx, `DELETE FROM tag WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.ErrTagNotFound
+	}
+	return nil
+}
+
+// SetProductTags labels a product with the given tags, taking off any other.
+// Tags that do not exist yet are created, a name matching the slug of an
+// existing tag reuses that tag.
+func (q *TagQueries) SetProductTags(ctx context.Context, productID string, names []string) error {
+	tx, err := q.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM product WHERE id = ?)`, productID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return errors.ErrProductNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM product_tag WHERE product_id = ?`, productID); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		slug := strutil.Slugify(name)
+
+		_, err := tx.ExecContext(ctx, `INSERT INTO tag (id, name, slug) VALUES (?, ?, ?) ON CONFLICT DO NOTHING`,
+			security.RandomString(), name, slug)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO product_tag (product_id, tag_id)
+			SELECT ?, id FROM tag WHERE slug = ?
+		`, productID, slug)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// productsTags returns the tags of the listed products by product ID.
+func (q *ProductQueries) productsTags(ctx context.Context, productIDs ...string) (map[string][]models.Tag, error) {
+	tags := map[string][]models.Tag{}
+	if len(productIDs) == 0 {
+		return tags, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT product_tag.product_id, tag.id, tag.name, tag.slug
+		FROM product_tag
+		JOIN tag ON tag.id = product_tag.tag_id
+		WHERE product_tag.product_id IN (%s)
+		ORDER BY tag.name
+	`, strings.Repeat("?, ", len(productIDs)-1)+"?")
+
+	args := make([]any, len(productIDs))
+	for i, id := range productIDs {
+		args[i] = id
+	}
+
+	rows, err := q.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var productID string
+		tag := models.Tag{}
+		if err := rows.Scan(&productID, &tag.ID, &tag.Name, &tag.Slug); err != nil {
+			return nil, err
+		}
+		tags[productID] = append(tags[productID], tag)
+	}
+	return tags, rows.Err()
+}
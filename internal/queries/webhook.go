@@ -0,0 +1,281 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/security"
+)
+
+// WebhookQueries is a struct that embeds a pointer to an sql.DB.
+// This allows for direct access to all the methods of sql.DB through WebhookQueries.
+type WebhookQueries struct {
+	*sql.DB
+}
+
+const webhookEndpointColumns = `
+	id,
+	url,
+	secret,
+	active,
+	events,
+	strftime('%s', created),
+	IFNULL(strftime('%s', updated), 0)
+`
+
+// scanWebhookEndpoint reads a row selected with webhookEndpointColumns.
+func scanWebhookEndpoint(row interface{ Scan(...any) error }) (*models.WebhookEndpoint, error) {
+	endpoint := &models.WebhookEndpoint{}
+	var events string
+	err := row.Scan(
+		&endpoint.ID,
+		&endpoint.Url,
+		&endpoint.Secret,
+		&endpoint.Active,
+		&events,
+		&endpoint.Created,
+		&endpoint.Updated,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(events), &endpoint.Events); err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
+
+// WebhookEndpoints returns all webhook endpoints, oldest first.
+func (q *WebhookQueries) WebhookEndpoints(ctx context.Context) ([]*models.WebhookEndpoint, error) {
+	endpoints := []*models.WebhookEndpoint{}
+
+	rows, err := q.DB.QueryContext(ctx, `SELECT`+webhookEndpointColumns+`FROM webhook_endpoint ORDER BY created, rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		endpoint, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	return endpoints, rows.Err()
+}
+
+// SubscribedWebhookEndpoints returns the active endpoints that receive the event.
+func (q *WebhookQueries) SubscribedWebhookEndpoints(ctx context.Context, event string) ([]*models.WebhookEndpoint, error) {
+	endpoints, err := q.WebhookEndpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	subscribed := []*models.WebhookEndpoint{}
+	for _, endpoint := range endpoints {
+		if endpoint.Active && endpoint.Subscribed(event) {
+			subscribed = append(subscribed, endpoint)
+		}
+	}
+	return subscribed, nil
+}
+
+// WebhookEndpoint returns a webhook endpoint by its id.
+func (q *WebhookQueries) WebhookEndpoint(ctx context.Context, id string) (*models.WebhookEndpoint, error) {
+	endpoint, err := scanWebhookEndpoint(q.DB.QueryRowContext(ctx, `SELECT`+webhookEndpointColumns+`FROM webhook_endpoint WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrWebhookEndpointNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return endpoint, nil
+}
+
+// AddWebhookEndpoint inserts a new webhook endpoint.
+func (q *WebhookQueries) AddWebhookEndpoint(ctx context.Context, endpoint *models.WebhookEndpoint) (*models.WebhookEndpoint, error) {
+	endpoint.ID = security.RandomString()
+
+	events, err := json.Marshal(endpoint.Events)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `INSERT INTO webhook_endpoint (id, url, secret, active, events) VALUES (?, ?, ?, ?, ?) RETURNING strftime('%s', created)`
+	err = q.DB.QueryRowContext(ctx, query, endpoint.ID, endpoint.Url, endpoint.Secret, endpoint.Active, string(events)).Scan(&endpoint.Created)
+	if err != nil {
+		return nil, err
+	}
+
+	return endpoint, nil
+}
+
+// UpdateWebhookEndpoint updates a webhook endpoint. An empty secret keeps the current one.
+func (q *WebhookQueries) UpdateWebhookEndpoint(ctx context.Context, endpoint *models.WebhookEndpoint) error {
+	events, err := json.Marshal(endpoint.Events)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE webhook_endpoint
+		SET url = ?, secret = IIF(? = '', secret, ?), active = ?, events = ?, updated = datetime('now')
+		WHERE id = ?
+	`
+	result, err := q.DB.ExecContext(ctx, query, endpoint.Url, endpoint.Secret, endpoint.Secret, endpoint.Active, string(events), endpoint.ID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.ErrWebhookEndpointNotFound
+	}
+	return nil
+}
+
+// DeleteWebhookEndpoint removes a webhook endpoint. Its delivery log is kept.
+func (q *WebhookQueries) DeleteWebhookEndpoint(ctx context.Context, id string) error {
+	result, err := q.DB.ExecContext(ctx, `DELETE FROM webhook_endpoint WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.ErrWebhookEndpointNotFound
+	}
+	return nil
+}
+
+const webhookDeliveryColumns = `
+	id,
+	event_id,
+	event,
+	endpoint_id,
+	url,
+	request,
+	response_code,
+	response_body,
+	error,
+	strftime('%s', created)
+`
+
+// scanWebhookDelivery reads a row selected with webhookDeliveryColumns.
+func scanWebhookDelivery(row interface{ Scan(...any) error }) (*models.WebhookDelivery, error) {
+	delivery := &models.WebhookDelivery{}
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.EventID,
+		&delivery.Event,
+		&delivery.EndpointID,
+		&delivery.Url,
+		&delivery.Request,
+		&delivery.ResponseCode,
+		&delivery.ResponseBody,
+		&delivery.Error,
+		&delivery.Created,
+	)
+	return delivery, err
+}
+
+// AddWebhookDelivery records one delivery attempt of a webhook event.
+func (q *WebhookQueries) AddWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	if delivery.ID == "" {
+		delivery.ID = security.RandomString()
+	}
+
+	query := `
+		INSERT INTO webhook_delivery (id, event_id, event, endpoint_id, url, request, response_code, response_body, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING strftime('%s', created)
+	`
+	return q.DB.QueryRowContext(ctx, query,
+		delivery.ID,
+		delivery.EventID,
+		delivery.Event,
+		delivery.EndpointID,
+		delivery.Url,
+		delivery.Request,
+		delivery.ResponseCode,
+		delivery.ResponseBody,
+		delivery.Error,
+	).Scan(&delivery.Created)
+}
+
+// WebhookDelivery returns a delivery attempt by its id.
+func (q *WebhookQueries) WebhookDelivery(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	delivery, err := scanWebhookDelivery(q.DB.QueryRowContext(ctx, `SELECT`+webhookDeliveryColumns+`FROM webhook_delivery WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrWebhookDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+// WebhookDeliveries returns delivery attempts, newest first, optionally
+// limited to one event or endpoint, together with the total number of matching attempts.
+func (q *WebhookQueries) WebhookDeliveries(ctx context.Context, eventID, endpointID string, limit, offset int) ([]*models.WebhookDelivery, int, error) {
+	deliveries := []*models.WebhookDelivery{}
+
+	conditions := []string{}
+	var params []any
+	if eventID != "" {
+		conditions = append(conditions, "event_id = ?")
+		params = append(params, eventID)
+	}
+	if endpointID != "" {
+		conditions = append(conditions, "endpoint_id = ?")
+		params = append(params, endpointID)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := q.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM webhook_delivery`+where, params...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT` + webhookDeliveryColumns + `FROM webhook_delivery` + where + ` ORDER BY created DESC, rowid DESC`
+	if limit > 0 {
+		query += " LIMIT ?"
+		params = append(params, limit)
+		if offset > 0 {
+			query += " OFFSET ?"
+			params = append(params, offset)
+		}
+	}
+
+	rows, err := q.DB.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, total, rows.Err()
+}
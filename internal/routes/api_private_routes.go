@@ -35,24 +35,93 @@ func ApiPrivateRoutes(c *fiber.App) {
 
 	product := c.Group("/api/_/products", middleware.JWTProtected())
 	product.Get("/", handlers.Products)
+	product.Get("/search", handlers.SearchProducts)
 	product.Post("/", handlers.AddProduct)
 	product.Get("/:product_id<len(15)>", handlers.Product)
 	product.Patch("/:product_id<len(15)>", handlers.UpdateProduct)
 	product.Delete("/:product_id<len(15)>", handlers.DeleteProduct)
 	product.Patch("/:product_id<len(15)>/active", handlers.UpdateProductActive)
 
+	product.Get("/:product_id<len(15)>/variants", handlers.ProductVariants)
+	product.Post("/:product_id<len(15)>/variants", handlers.AddProductVariant)
+	product.Patch("/:product_id<len(15)>/variants/:variant_id<len(15)>", handlers.UpdateProductVariant)
+	product.Delete("/:product_id<len(15)>/variants/:variant_id<len(15)>", handlers.DeleteProductVariant)
+
+	product.Patch("/:product_id<len(15)>/categories", handlers.UpdateProductCategories)
+	product.Patch("/:product_id<len(15)>/tags", handlers.UpdateProductTags)
+
+	product.Get("/:product_id<len(15)>/stock", handlers.ProductInventory)
+	product.Post("/:product_id<len(15)>/stock", handlers.AdjustProductStock)
+	product.Delete("/:product_id<len(15)>/stock", handlers.UntrackProductStock)
+
 	product.Get("/:product_id<len(15)>/digital", handlers.ProductDigital)
 	product.Post("/:product_id<len(15)>/digital", handlers.AddProductDigital)
+	product.Post("/:product_id<len(15)>/digital/import", handlers.ImportProductDigital)
+	product.Get("/:product_id<len(15)>/digital/export", handlers.ExportProductDigital)
+	product.Post("/:product_id<len(15)>/digital/uploads", handlers.AddProductDigitalUpload)
+	product.Get("/:product_id<len(15)>/digital/uploads/:upload_id<len(15)>", handlers.ProductDigitalUpload)
+	product.Patch("/:product_id<len(15)>/digital/uploads/:upload_id<len(15)>", handlers.AddProductDigitalUploadPart)
+	product.Delete("/:product_id<len(15)>/digital/uploads/:upload_id<len(15)>", handlers.DeleteProductDigitalUpload)
+	product.Post("/:product_id<len(15)>/digital/versions", handlers.AddProductDigitalVersion)
+	product.Patch("/:product_id<len(15)>/digital/versions/:version_id<len(15)>", handlers.UpdateProductDigitalVersion)
+	product.Delete("/:product_id<len(15)>/digital/versions/:version_id<len(15)>", handlers.DeleteProductDigitalVersion)
+	product.Post("/:product_id<len(15)>/digital/versions/:version_id<len(15)>/release", handlers.ReleaseProductDigitalVersion)
+	product.Post("/:product_id<len(15)>/digital/versions/:version_id<len(15)>/notify", handlers.NotifyProductDigitalVersion)
+	product.Get("/:product_id<len(15)>/digital/:digital_id<len(15)>", handlers.ProductDigitalFile)
 	product.Patch("/:product_id<len(15)>/digital/:digital_id<len(15)>", handlers.UpdateProductDigital)
 	product.Delete("/:product_id<len(15)>/digital/:digital_id<len(15)>", handlers.DeleteProductDigital)
+	product.Patch("/:product_id<len(15)>/digital/:digital_id<len(15)>/variant", handlers.UpdateProductDigitalVariant)
+	product.Get("/:product_id<len(15)>/digital/:digital_id<len(15)>/activations", handlers.ProductDigitalActivations)
+	product.Delete("/:product_id<len(15)>/digital/:digital_id<len(15)>/activations/:activation_id<len(15)>", handlers.RevokeProductDigitalActivation)
 
 	product.Get("/:product_id<len(15)>/image", handlers.ProductImages)
 	product.Post("/:product_id<len(15)>/image", handlers.AddProductImage)
 	product.Delete("/:product_id<len(15)>/image/:image_id<len(15)>", handlers.DeleteProductImage)
 
+	// categories and tags
+	categories := c.Group("/api/_/categories", middleware.JWTProtected())
+	categories.Get("/", handlers.Categories)
+	categories.Post("/", handlers.AddCategory)
+	categories.Patch("/:category_id<len(15)>", handlers.UpdateCategory)
+	categories.Delete("/:category_id<len(15)>", handlers.DeleteCategory)
+
+	tags := c.Group("/api/_/tags", middleware.JWTProtected())
+	tags.Get("/", handlers.Tags)
+	tags.Post("/", handlers.AddTag)
+	tags.Patch("/:tag_id<len(15)>", handlers.UpdateTag)
+	tags.Delete("/:tag_id<len(15)>", handlers.DeleteTag)
+
 	// carts
 	carts := c.Group("/api/_/carts", middleware.JWTProtected())
 	carts.Get("/", handlers.Carts)
 	carts.Get("/:cart_id<len(15)>", handlers.Cart)
+	carts.Get("/:cart_id<len(15)>/history", handlers.CartStatusHistory)
 	carts.Post("/:cart_id<len(15)>/mail", handlers.CartSendMail)
+	carts.Post("/:cart_id<len(15)>/refund", handlers.CartRefund)
+	carts.Post("/:cart_id<len(15)>/downloads/reset", handlers.CartResetDownloads)
+	carts.Patch("/:cart_id<len(15)>/shipment", handlers.UpdateCartShipment)
+
+	// shipping rates
+	shipping := c.Group("/api/_/shipping", middleware.JWTProtected())
+	shipping.Get("/", handlers.ShippingRates)
+	shipping.Post("/", handlers.AddShippingRate)
+	shipping.Patch("/:rate_id<len(15)>", handlers.UpdateShippingRate)
+	shipping.Delete("/:rate_id<len(15)>", handlers.DeleteShippingRate)
+
+	// background jobs
+	jobs := c.Group("/api/_/jobs", middleware.JWTProtected())
+	jobs.Get("/", handlers.Jobs)
+	jobs.Get("/:job_id<len(15)>", handlers.Job)
+	jobs.Post("/:job_id<len(15)>/retry", handlers.RetryJob)
+
+	// webhooks
+	webhooks := c.Group("/api/_/webhooks", middleware.JWTProtected())
+	webhooks.Get("/", handlers.WebhookEndpoints)
+	webhooks.Post("/", handlers.AddWebhookEndpoint)
+	webhooks.Get("/:webhook_id<len(15)>", handlers.WebhookEndpoint)
+	webhooks.Patch("/:webhook_id<len(15)>", handlers.UpdateWebhookEndpoint)
+	webhooks.Delete("/:webhook_id<len(15)>", handlers.DeleteWebhookEndpoint)
+	webhooks.Get("/deliveries", handlers.WebhookDeliveries)
+	webhooks.Get("/deliveries/:delivery_id<len(15)>", handlers.WebhookDelivery)
+	webhooks.Post("/deliveries/:delivery_id<len(15)>/redeliver", handlers.RedeliverWebhook)
 }
@@ -15,12 +15,32 @@ func ApiPublicRoutes(c *fiber.App) {
 
 	product := c.Group("/api/products")
 	product.Get("/", handlers.Products)
+	product.Get("/search", handlers.SearchProducts)
 	product.Get("/:product_id", handlers.Product)
 
+	c.Get("/api/categories", handlers.Categories)
+	c.Get("/api/categories/:category_slug", handlers.Category)
+
 	cart := c.Group("/cart")
 	cart.Post("/payment", handlers.Payment)
 	cart.Post("/payment/callback", handlers.PaymentCallback)
+	cart.Post("/payment/callback/:payment_system", handlers.PaymentCallback)
+
+	c.Get("/download/:token", handlers.Download)
+
+	license := c.Group("/api/license")
+	license.Get("/public-key", handlers.LicensePublicKey)
+	license.Post("/activate", handlers.ActivateLicense)
+	license.Post("/validate", handlers.ValidateLicense)
+	license.Post("/deactivate", handlers.DeactivateLicense)
+
+	customer := c.Group("/api/customer")
+	customer.Post("/sign-in", handlers.CustomerSignIn)
+	customer.Post("/session", handlers.CustomerSession)
+	customer.Get("/orders", handlers.CustomerOrders)
+	customer.Post("/sign-out", handlers.CustomerSignOut)
 
 	c.Get("/api/cart/payment", handlers.PaymentList)
+	c.Post("/api/cart/shipping", handlers.ShippingRates)
 	c.Get("/api/cart/:cart_id", handlers.GetCart)
 }
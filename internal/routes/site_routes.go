@@ -20,13 +20,14 @@ func SiteRoutes(c *fiber.App) {
 	c.Use("/cart/payment/success", handlers.PaymentSuccess)
 	c.Use("/cart/payment/cancel", handlers.PaymentCancel)
 
-	// Skip API routes, admin routes (/_ but not /_app), uploads
+	// Skip API routes, admin routes (/_ but not /_app), uploads, downloads
 	// Note: /cart/payment/success and /cart/payment/cancel are NOT skipped
 	// because they need to be handled by SPA after payment processing
 	skipPaths := func(path string) bool {
 		return strings.HasPrefix(path, "/api") ||
 			(path == "/_" || (strings.HasPrefix(path, "/_/") && !strings.HasPrefix(path, "/_app"))) ||
-			strings.HasPrefix(path, "/uploads")
+			strings.HasPrefix(path, "/uploads") ||
+			strings.HasPrefix(path, "/download/")
 	}
 
 	c.Use("/", setupSPAHandler(embedSite, skipPaths))
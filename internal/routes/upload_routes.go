@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	handlers "github.com/shurco/litecart/internal/handlers/public"
+)
+
+// UploadRoutes serves the uploaded product images from the file storage.
+func UploadRoutes(c *fiber.App) {
+	c.Get("/uploads/:file_name", handlers.Upload)
+}
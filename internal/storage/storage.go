@@ -0,0 +1,131 @@
+// Package storage keeps the uploaded images and the digital files of the
+// store. Files are stored on the local disk by default, or in an
+// S3-compatible bucket so that several instances can share them.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Directories the files are kept in. On the local disk they are relative to
+// the working directory, in a bucket they are key prefixes.
+const (
+	UploadsDir  = "lc_uploads"
+	DigitalsDir = "lc_digitals"
+	PartsDir    = "lc_parts"
+)
+
+// ErrNotFound is returned when a file does not exist.
+var ErrNotFound = errors.New("file not found in storage")
+
+// Storage reads and writes files by key. A key is a slash-separated path
+// such as "lc_uploads/<name>.png".
+type Storage interface {
+	// Put stores size bytes read from r under the key, replacing any file
+	// that is already there.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the file stored under the key. The caller closes the body.
+	Get(ctx context.Context, key string) (*Object, error)
+	// Delete removes the file stored under the key. A missing file is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Object is an opened file.
+type Object struct {
+	Body        io.ReadCloser
+	Size        int64
+	ContentType string
+}
+
+// Config selects and configures the storage backend.
+type Config struct {
+	Backend string // "local" or "s3"
+	S3      S3Config
+}
+
+var (
+	mu    sync.RWMutex
+	files Storage = NewLocal(".")
+)
+
+// ConfigFromEnv reads the storage configuration from the environment:
+//
+//	LITECART_STORAGE        local (default) or s3
+//	LITECART_S3_ENDPOINT    https://s3.<region>.amazonaws.com by default
+//	LITECART_S3_REGION      us-east-1 by default
+//	LITECART_S3_BUCKET      bucket name
+//	LITECART_S3_ACCESS_KEY  access key ID
+//	LITECART_S3_SECRET_KEY  secret access key
+//	LITECART_S3_PREFIX      optional prefix of all keys
+//	LITECART_S3_PATH_STYLE  true to put the bucket in the path, as MinIO expects
+func ConfigFromEnv() (*Config, error) {
+	cfg := &Config{
+		Backend: os.Getenv("LITECART_STORAGE"),
+		S3: S3Config{
+			Endpoint:  os.Getenv("LITECART_S3_ENDPOINT"),
+			Region:    os.Getenv("LITECART_S3_REGION"),
+			Bucket:    os.Getenv("LITECART_S3_BUCKET"),
+			AccessKey: os.Getenv("LITECART_S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("LITECART_S3_SECRET_KEY"),
+			Prefix:    os.Getenv("LITECART_S3_PREFIX"),
+		},
+	}
+
+	if pathStyle := os.Getenv("LITECART_S3_PATH_STYLE"); pathStyle != "" {
+		value, err := strconv.ParseBool(pathStyle)
+		if err != nil {
+			return nil, fmt.Errorf("LITECART_S3_PATH_STYLE: %w", err)
+		}
+		cfg.S3.PathStyle = value
+	}
+
+	return cfg, nil
+}
+
+// New creates the storage backend described by the configuration.
+func New(cfg *Config) (Storage, error) {
+	switch cfg.Backend {
+	case "", "local":
+		return NewLocal("."), nil
+	case "s3":
+		return NewS3(cfg.S3)
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+}
+
+// Set makes s the storage used by the application.
+func Set(s Storage) {
+	mu.Lock()
+	defer mu.Unlock()
+	files = s
+}
+
+// Files returns the storage used by the application. Until Set is called
+// it is the local disk.
+func Files() Storage {
+	mu.RLock()
+	defer mu.RUnlock()
+	return files
+}
+
+// UploadKey returns the key of an uploaded image.
+func UploadKey(fileName string) string {
+	return UploadsDir + "/" + fileName
+}
+
+// DigitalKey returns the key of a digital file.
+func DigitalKey(fileName string) string {
+	return DigitalsDir + "/" + fileName
+}
+
+// PartKey returns the key of a received chunk of a digital file that is
+// still being uploaded.
+func PartKey(uploadID, partName string) string {
+	return PartsDir + "/" + uploadID + "/" + partName
+}
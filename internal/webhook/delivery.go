@@ -0,0 +1,142 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/shurco/litecart/internal/jobs"
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/internal/queries"
+	"github.com/shurco/litecart/pkg/errors"
+	"github.com/shurco/litecart/pkg/logging"
+	"github.com/shurco/litecart/pkg/security"
+)
+
+// JobDelivery is the job kind that delivers a webhook event.
+const JobDelivery = "webhook.delivery"
+
+// deliveryJob is the job payload, one per endpoint. Redeliveries keep the
+// event id so the receiver can drop events it has already processed.
+type deliveryJob struct {
+	EventID    string          `json:"event_id"`
+	Event      Event           `json:"event"`
+	EndpointID string          `json:"endpoint_id"`
+	Body       json.RawMessage `json:"body"`
+}
+
+func init() {
+	jobs.Register(JobDelivery, deliver)
+}
+
+// queue schedules the delivery of a new event to every subscribed endpoint.
+func queue(event Event, data any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	endpoints, err := queries.DB().SubscribedWebhookEndpoints(ctx, string(event))
+	if err != nil || len(endpoints) == 0 {
+		return err
+	}
+
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	eventID := security.RandomString()
+	for _, endpoint := range endpoints {
+		if err := jobs.Enqueue(JobDelivery, &deliveryJob{
+			EventID:    eventID,
+			Event:      event,
+			EndpointID: endpoint.ID,
+			Body:       body,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Redeliver schedules the event of a recorded delivery once more to the same endpoint.
+func Redeliver(delivery *models.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := queries.DB().WebhookEndpoint(ctx, delivery.EndpointID); err != nil {
+		return err
+	}
+
+	return jobs.Enqueue(JobDelivery, &deliveryJob{
+		EventID:    delivery.EventID,
+		Event:      Event(delivery.Event),
+		EndpointID: delivery.EndpointID,
+		Body:       json.RawMessage(delivery.Request),
+	})
+}
+
+// deliver posts a queued event, records the attempt and fails unless the
+// receiver answers with a 2xx status, so the job queue retries it.
+// Events for deleted or deactivated endpoints are dropped.
+func deliver(ctx context.Context, payload []byte) error {
+	db := queries.DB()
+
+	job := &deliveryJob{}
+	if err := json.Unmarshal(payload, job); err != nil {
+		return err
+	}
+
+	endpoint, err := db.WebhookEndpoint(ctx, job.EndpointID)
+	if err == errors.ErrWebhookEndpointNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !endpoint.Active {
+		return nil
+	}
+
+	status, body, err := Send(ctx, endpoint.Url, job.EventID, endpoint.Secret, job.Body)
+	if err == nil && (status < 200 || status > 299) {
+		err = fmt.Errorf("webhook returned status %d", status)
+	}
+
+	delivery := &models.WebhookDelivery{
+		EventID:      job.EventID,
+		Event:        string(job.Event),
+		EndpointID:   endpoint.ID,
+		Url:          endpoint.Url,
+		Request:      string(job.Body),
+		ResponseCode: status,
+		ResponseBody: string(body),
+	}
+	if err != nil {
+		delivery.Error = err.Error()
+		logWebhookError(err, endpoint.Url, job.Event, status, body)
+	}
+
+	if dbErr := db.AddWebhookDelivery(context.Background(), delivery); dbErr != nil {
+		return dbErr
+	}
+
+	return err
+}
+
+// logWebhookError logs a failed webhook delivery.
+func logWebhookError(err error, url string, event Event, statusCode int, bodyBytes []byte) {
+	log := logging.New()
+	errorLog := log.Error().
+		Str("url", url).
+		Str("event", string(event))
+
+	if statusCode != 0 {
+		errorLog.Int("status", statusCode)
+		if len(bodyBytes) > 0 {
+			errorLog.Str("response", string(bodyBytes))
+		}
+	}
+
+	errorLog.Err(err).Msg("webhook delivery failed")
+}
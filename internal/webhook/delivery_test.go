@@ -0,0 +1,141 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shurco/litecart/internal/models"
+	"github.com/shurco/litecart/internal/queries"
+	"github.com/shurco/litecart/internal/testutil"
+	"github.com/shurco/litecart/migrations"
+)
+
+func setupEndpoints(t *testing.T, url string, endpoints ...*models.WebhookEndpoint) func() {
+	cleanup := testutil.WithCmdTestDir(t)
+	if err := queries.New(migrations.Embed()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, endpoint := range endpoints {
+		endpoint.Url = url
+		endpoint.Secret = NewSecret()
+		if _, err := queries.DB().AddWebhookEndpoint(context.Background(), endpoint); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cleanup
+}
+
+func queuedDeliveries(t *testing.T) []*deliveryJob {
+	t.Helper()
+	jobs, _, err := queries.DB().Jobs(context.Background(), models.JobPending, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries := []*deliveryJob{}
+	for _, job := range jobs {
+		delivery := &deliveryJob{}
+		if err := json.Unmarshal([]byte(job.Payload), delivery); err != nil {
+			t.Fatal(err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries
+}
+
+func Test_queue_fans_out(t *testing.T) {
+	all := &models.WebhookEndpoint{Active: true, Events: []string{"*"}}
+	products := &models.WebhookEndpoint{Active: true, Events: []string{string(PRODUCT_CREATED), string(PRODUCT_DELETED)}}
+	inactive := &models.WebhookEndpoint{Active: false, Events: []string{"*"}}
+	defer setupEndpoints(t, "http://127.0.0.1", all, products, inactive)()
+
+	if err := QueuePaymentHook(&Payment{Event: PAYMENT_SUCCESS}); err != nil {
+		t.Fatal(err)
+	}
+	if deliveries := queuedDeliveries(t); len(deliveries) != 1 || deliveries[0].EndpointID != all.ID {
+		t.Fatalf("payment event queued for %d endpoints", len(deliveries))
+	}
+
+	if err := Queue(PRODUCT_CREATED, map[string]string{"id": "product00000001"}); err != nil {
+		t.Fatal(err)
+	}
+	deliveries := queuedDeliveries(t)
+	if len(deliveries) != 3 {
+		t.Fatalf("%d deliveries queued, want 3", len(deliveries))
+	}
+	// both endpoints get the same event id
+	if deliveries[0].EventID != deliveries[1].EventID || deliveries[0].EndpointID == deliveries[1].EndpointID {
+		t.Fatalf("unexpected fan-out %+v, %+v", deliveries[0], deliveries[1])
+	}
+
+	if err := Queue(PAGE_UPDATED, nil); err != nil {
+		t.Fatal(err)
+	}
+	if deliveries := queuedDeliveries(t); len(deliveries) != 4 {
+		t.Fatalf("%d deliveries queued, want 4", len(deliveries))
+	}
+}
+
+func Test_deliver_records_attempts(t *testing.T) {
+	status := http.StatusInternalServerError
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("busy"))
+	}))
+	defer srv.Close()
+
+	endpoint := &models.WebhookEndpoint{Active: true, Events: []string{"*"}}
+	defer setupEndpoints(t, srv.URL, endpoint)()
+	db := queries.DB()
+	ctx := context.Background()
+
+	if err := QueuePaymentHook(&Payment{Event: PAYMENT_SUCCESS, Data: Data{CartID: "cart00000000001"}}); err != nil {
+		t.Fatal(err)
+	}
+	jobs, _, err := db.Jobs(ctx, models.JobPending, 0, 0)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("queued jobs: %d, %v", len(jobs), err)
+	}
+
+	if err := deliver(ctx, []byte(jobs[0].Payload)); err == nil {
+		t.Fatalf("a 500 response must fail the job")
+	}
+	status = http.StatusNoContent
+	if err := deliver(ctx, []byte(jobs[0].Payload)); err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries, total, err := db.WebhookDeliveries(ctx, "", endpoint.ID, 0, 0)
+	if err != nil || total != 2 {
+		t.Fatalf("deliveries: %d, %v", total, err)
+	}
+	ok, failed := deliveries[0], deliveries[1]
+	if failed.ResponseCode != 500 || failed.ResponseBody != "busy" || failed.Error == "" {
+		t.Fatalf("unexpected failed delivery %+v", failed)
+	}
+	if ok.ResponseCode != 204 || ok.Error != "" || ok.EventID != failed.EventID || ok.Event != string(PAYMENT_SUCCESS) {
+		t.Fatalf("unexpected delivery %+v", ok)
+	}
+
+	if err := Redeliver(ok); err != nil {
+		t.Fatal(err)
+	}
+	if _, total, _ := db.Jobs(ctx, models.JobPending, 0, 0); total != 2 {
+		t.Fatalf("redelivery was not queued")
+	}
+
+	// a deleted endpoint gets nothing
+	if err := db.DeleteWebhookEndpoint(ctx, endpoint.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := deliver(ctx, []byte(jobs[0].Payload)); err != nil {
+		t.Fatal(err)
+	}
+	if _, total, _ := db.WebhookDeliveries(ctx, "", "", 0, 0); total != 2 {
+		t.Fatalf("delivered to a deleted endpoint")
+	}
+}
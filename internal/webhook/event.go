@@ -0,0 +1,56 @@
+package webhook
+
+import (
+	"slices"
+	"time"
+)
+
+// Event names the kind of a webhook notification.
+type Event string
+
+const (
+	PRODUCT_CREATED     Event = "product.created"
+	PRODUCT_UPDATED     Event = "product.updated"
+	PRODUCT_DELETED     Event = "product.deleted"
+	PAGE_UPDATED        Event = "page.updated"
+	DIGITAL_STOCK_LOW   Event = "digital.stock_low"
+	DIGITAL_STOCK_SHORT Event = "digital.stock_short"
+)
+
+// Events lists every event an endpoint can subscribe to.
+var Events = []Event{
+	PAYMENT_INITIATION,
+	PAYMENT_CALLBACK,
+	PAYMENT_SUCCESS,
+	PAYMENT_CANCEL,
+	PAYMENT_ERROR,
+	PAYMENT_REFUND,
+	PRODUCT_CREATED,
+	PRODUCT_UPDATED,
+	PRODUCT_DELETED,
+	PAGE_UPDATED,
+	DIGITAL_STOCK_LOW,
+	DIGITAL_STOCK_SHORT,
+}
+
+// KnownEvent reports whether an endpoint can subscribe to the event.
+// "*" stands for every event.
+func KnownEvent(event string) bool {
+	return event == "*" || slices.Contains(Events, Event(event))
+}
+
+// Message is the body of a webhook request for events other than payments.
+type Message struct {
+	Event     Event `json:"event"`
+	TimeStamp int64 `json:"timestamp"`
+	Data      any   `json:"data"`
+}
+
+// Queue schedules an event for every active endpoint subscribed to it.
+func Queue(event Event, data any) error {
+	return queue(event, &Message{
+		Event:     event,
+		TimeStamp: time.Now().Unix(),
+		Data:      data,
+	})
+}
@@ -1,9 +1,11 @@
 package webhook
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"sync/atomic"
 	"testing"
 
@@ -28,12 +30,12 @@ func Test_send_payment_hook(t *testing.T) {
 		Event: PAYMENT_INITIATION,
 		Data:  Data{PaymentSystem: litepay.STRIPE, PaymentStatus: litepay.NEW},
 	}
-	resp, err := Send(srv.URL, mustJSON(p))
+	status, _, err := Send(context.Background(), srv.URL, "event0000000001", "secret", mustJSON(p))
 	if err != nil {
 		t.Fatal(err)
 	}
-	if resp.StatusCode != 200 {
-		t.Fatalf("status %d", resp.StatusCode)
+	if status != 200 {
+		t.Fatalf("status %d", status)
 	}
 
 	v := got.Load()
@@ -46,6 +48,36 @@ func Test_send_payment_hook(t *testing.T) {
 	}
 }
 
+func Test_send_signature(t *testing.T) {
+	payload := mustJSON(&Payment{Event: PAYMENT_CALLBACK})
+
+	var header atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header.Store(r.Header.Clone())
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	if _, _, err := Send(context.Background(), srv.URL, "event0000000001", "secret", payload); err != nil {
+		t.Fatal(err)
+	}
+
+	h := header.Load().(http.Header)
+	if h.Get(HeaderEventID) != "event0000000001" {
+		t.Fatalf("event id %q", h.Get(HeaderEventID))
+	}
+	timestamp, err := strconv.ParseInt(h.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		t.Fatalf("timestamp %q", h.Get(HeaderTimestamp))
+	}
+	if h.Get(HeaderSignature) != Sign("secret", timestamp, payload) {
+		t.Fatalf("signature %q does not match the payload", h.Get(HeaderSignature))
+	}
+	if Sign("other", timestamp, payload) == Sign("secret", timestamp, payload) {
+		t.Fatalf("signature does not depend on the secret")
+	}
+}
+
 func mustJSON(v any) []byte {
 	b, _ := json.Marshal(v)
 	return b
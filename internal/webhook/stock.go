@@ -0,0 +1,27 @@
+package webhook
+
+import (
+	"github.com/shurco/litecart/internal/models"
+)
+
+// QueueDigitalStockLow raises digital.stock_low for each product that is
+// running out of keys.
+func QueueDigitalStockLow(stock ...*models.DigitalStock) error {
+	for _, item := range stock {
+		if err := Queue(DIGITAL_STOCK_LOW, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QueueDigitalStockShort raises digital.stock_short for each product a paid
+// cart is still waiting for keys of.
+func QueueDigitalStockShort(shortage ...*models.DigitalShortage) error {
+	for _, item := range shortage {
+		if err := Queue(DIGITAL_STOCK_SHORT, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
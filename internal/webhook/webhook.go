@@ -2,24 +2,78 @@ package webhook
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"time"
 )
 
-// Send sends an HTTP POST request to the specified URL with the given payload.
-func Send(url string, payload []byte) (*http.Response, error) {
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payload))
+// Headers sent with every delivery. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook secret, prefixed with "sha256=".
+const (
+	HeaderEventID   = "X-Litecart-Event-Id"
+	HeaderTimestamp = "X-Litecart-Timestamp"
+	HeaderSignature = "X-Litecart-Signature"
+)
+
+const (
+	// sendTimeout bounds one delivery attempt
+	sendTimeout = 15 * time.Second
+	// maxResponseBody is how much of a response is kept in the delivery log
+	maxResponseBody = 4096
+)
+
+// NewSecret returns a random signing secret for a new endpoint.
+func NewSecret() string {
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+	return hex.EncodeToString(secret)
+}
+
+// Sign returns the signature header value for a payload sent at timestamp.
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send sends an HTTP POST request to the specified URL with the given payload,
+// signed with secret and tagged with the event id. It returns the response
+// status code and up to maxResponseBody bytes of the response body.
+func Send(ctx context.Context, url, eventID, secret string, payload []byte) (int, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(payload))
 	if err != nil {
-		return nil, fmt.Errorf("error creating request: %v", err)
+		return 0, nil, fmt.Errorf("error creating request: %v", err)
 	}
 
+	timestamp := time.Now().Unix()
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEventID, eventID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, payload))
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("error making request: %v", err)
+		return 0, nil, fmt.Errorf("error making request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	if err != nil {
+		return resp.StatusCode, nil, fmt.Errorf("error reading response: %v", err)
 	}
 
-	return resp, nil
+	return resp.StatusCode, body, nil
 }
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT OR IGNORE INTO setting VALUES ('hzmhlamxdwo6ca3', 'stripe_webhook_secret_key', '');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM setting WHERE id = 'hzmhlamxdwo6ca3';
+-- +goose StatementEnd
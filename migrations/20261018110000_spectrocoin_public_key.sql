@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO setting VALUES ('r7Wq2sNcY4kZp0d', 'spectrocoin_public_key', '');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM setting WHERE id = 'r7Wq2sNcY4kZp0d';
+-- +goose StatementEnd
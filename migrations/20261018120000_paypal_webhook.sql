@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT OR IGNORE INTO setting VALUES ('t3vKq8yLm2Xa9Wd', 'paypal_webhook_id', '');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM setting WHERE id = 't3vKq8yLm2Xa9Wd';
+-- +goose StatementEnd
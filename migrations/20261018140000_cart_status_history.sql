@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE cart_status_history (
+	id          TEXT PRIMARY KEY NOT NULL,
+	cart_id     TEXT NOT NULL,
+	from_status TEXT NOT NULL,
+	to_status   TEXT NOT NULL,
+	source      TEXT NOT NULL,
+	created     TIMESTAMP DEFAULT (datetime('now')),
+	FOREIGN KEY (cart_id) REFERENCES cart(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX idx_cart_status_history_cart_id ON cart_status_history (cart_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE cart_status_history;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE idempotency_key (
+	key          TEXT PRIMARY KEY NOT NULL,
+	request_hash TEXT NOT NULL,
+	cart_id      TEXT NOT NULL DEFAULT '',
+	payment_url  TEXT NOT NULL DEFAULT '',
+	created      TIMESTAMP DEFAULT (datetime('now'))
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE idempotency_key;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE job (
+	id           TEXT PRIMARY KEY NOT NULL,
+	kind         TEXT NOT NULL,
+	payload      TEXT NOT NULL DEFAULT '{}',
+	status       TEXT NOT NULL DEFAULT 'pending',
+	attempts     INTEGER NOT NULL DEFAULT 0,
+	max_attempts INTEGER NOT NULL DEFAULT 8,
+	last_error   TEXT NOT NULL DEFAULT '',
+	run_at       TIMESTAMP DEFAULT (datetime('now')),
+	created      TIMESTAMP DEFAULT (datetime('now')),
+	updated      TIMESTAMP
+);
+CREATE INDEX idx_job_status_run_at ON job (status, run_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE job;
+-- +goose StatementEnd
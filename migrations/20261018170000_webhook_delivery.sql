@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT OR IGNORE INTO setting VALUES ('w8Hs2Kd5Vq1Lx7N', 'webhook_secret', lower(hex(randomblob(32))));
+
+CREATE TABLE webhook_delivery (
+	id            TEXT PRIMARY KEY NOT NULL,
+	event_id      TEXT NOT NULL,
+	event         TEXT NOT NULL,
+	url           TEXT NOT NULL,
+	request       TEXT NOT NULL,
+	response_code INTEGER NOT NULL DEFAULT 0,
+	response_body TEXT NOT NULL DEFAULT '',
+	error         TEXT NOT NULL DEFAULT '',
+	created       TIMESTAMP DEFAULT (datetime('now'))
+);
+CREATE INDEX idx_webhook_delivery_event_id ON webhook_delivery (event_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE webhook_delivery;
+DELETE FROM setting WHERE id = 'w8Hs2Kd5Vq1Lx7N';
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE webhook_endpoint (
+	id      TEXT PRIMARY KEY NOT NULL,
+	url     TEXT NOT NULL,
+	secret  TEXT NOT NULL,
+	active  BOOLEAN NOT NULL DEFAULT TRUE,
+	events  TEXT NOT NULL DEFAULT '["*"]',
+	created TIMESTAMP DEFAULT (datetime('now')),
+	updated TIMESTAMP
+);
+
+-- the single webhook URL becomes an endpoint subscribed to every event
+INSERT INTO webhook_endpoint (id, url, secret)
+SELECT url.id, url.value, IFNULL(secret.value, lower(hex(randomblob(32))))
+FROM setting url
+LEFT JOIN setting secret ON secret.key = 'webhook_secret'
+WHERE url.key = 'webhook_url' AND url.value != '';
+
+DELETE FROM setting WHERE key IN ('webhook_url', 'webhook_secret');
+
+ALTER TABLE webhook_delivery ADD COLUMN endpoint_id TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE webhook_delivery DROP COLUMN endpoint_id;
+
+INSERT INTO setting VALUES ('7HkP2nYgR4sL8Qo', 'webhook_url', IFNULL((SELECT url FROM webhook_endpoint ORDER BY created LIMIT 1), ''));
+INSERT INTO setting VALUES ('w8Hs2Kd5Vq1Lx7N', 'webhook_secret', IFNULL((SELECT secret FROM webhook_endpoint ORDER BY created LIMIT 1), lower(hex(randomblob(32)))));
+
+DROP TABLE webhook_endpoint;
+-- +goose StatementEnd
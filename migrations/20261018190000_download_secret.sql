@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT OR IGNORE INTO setting VALUES ('Dl7Kq2Zs9Xv4Nb1', 'download_secret', lower(hex(randomblob(32))));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM setting WHERE id = 'Dl7Kq2Zs9Xv4Nb1';
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE product ADD COLUMN download_limit INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE product ADD COLUMN download_lifetime INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE download (
+	id         TEXT PRIMARY KEY NOT NULL,
+	cart_id    TEXT NOT NULL,
+	file_id    TEXT NOT NULL,
+	ip         TEXT NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT '',
+	counted    BOOLEAN NOT NULL DEFAULT TRUE,
+	created    TIMESTAMP DEFAULT (datetime('now')),
+	FOREIGN KEY (cart_id) REFERENCES cart(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX idx_download_cart_id_file_id ON download (cart_id, file_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE download;
+
+ALTER TABLE product DROP COLUMN download_lifetime;
+ALTER TABLE product DROP COLUMN download_limit;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE product ADD COLUMN fulfillment_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE product ADD COLUMN fulfillment_secret TEXT NOT NULL DEFAULT '';
+UPDATE product SET fulfillment_secret = lower(hex(randomblob(32)));
+
+CREATE TABLE fulfillment (
+	id         TEXT PRIMARY KEY NOT NULL,
+	cart_id    TEXT NOT NULL,
+	product_id TEXT NOT NULL,
+	content    TEXT NOT NULL DEFAULT '',
+	error      TEXT NOT NULL DEFAULT '',
+	attempts   INTEGER NOT NULL DEFAULT 0,
+	created    TIMESTAMP DEFAULT (datetime('now')),
+	updated    TIMESTAMP,
+	UNIQUE (cart_id, product_id),
+	FOREIGN KEY (cart_id) REFERENCES cart(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE fulfillment;
+
+ALTER TABLE product DROP COLUMN fulfillment_secret;
+ALTER TABLE product DROP COLUMN fulfillment_url;
+-- +goose StatementEnd
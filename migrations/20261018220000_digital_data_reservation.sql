@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE digital_data ADD COLUMN reserved TIMESTAMP DEFAULT NULL;
+CREATE INDEX idx_digital_data_cart_id ON digital_data (cart_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idx_digital_data_cart_id;
+UPDATE digital_data SET cart_id = NULL WHERE reserved IS NOT NULL;
+ALTER TABLE digital_data DROP COLUMN reserved;
+-- +goose StatementEnd
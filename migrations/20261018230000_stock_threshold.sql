@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE product ADD COLUMN stock_threshold INTEGER NOT NULL DEFAULT 0;
+INSERT INTO setting VALUES ('Ms4Lw7Tq1Zc8Vb3', 'mail_letter_stock_low', '{"subject":"Running out of keys","text":"Hello,\n\nThe product \"{{.Product_Name}}\" on the [{{.Site_Name}}] website has {{.Remaining}} unused keys left.\n\nPlease import new keys before it sells out.\n\nBest regards,","html":""}');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM setting WHERE id = 'Ms4Lw7Tq1Zc8Vb3';
+ALTER TABLE product DROP COLUMN stock_threshold;
+-- +goose StatementEnd
@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE product ADD COLUMN activation_limit INTEGER NOT NULL DEFAULT 0;
+INSERT INTO setting VALUES ('Lk8Pz3Wd6Qm1Hs5', 'license_private_key', '');
+
+CREATE TABLE license_activation (
+	id          TEXT PRIMARY KEY NOT NULL,
+	data_id     TEXT NOT NULL,
+	fingerprint TEXT NOT NULL,
+	name        TEXT NOT NULL DEFAULT '',
+	ip          TEXT NOT NULL DEFAULT '',
+	created     TIMESTAMP DEFAULT (datetime('now')),
+	validated   TIMESTAMP DEFAULT (datetime('now')),
+	UNIQUE (data_id, fingerprint),
+	FOREIGN KEY (data_id) REFERENCES digital_data(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX idx_digital_data_content ON digital_data (content);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idx_digital_data_content;
+DROP TABLE license_activation;
+
+DELETE FROM setting WHERE id = 'Lk8Pz3Wd6Qm1Hs5';
+ALTER TABLE product DROP COLUMN activation_limit;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+INSERT INTO setting VALUES ('Pq7Hm2Xs9Cv4Nk6', 'mail_letter_sign_in', '{"subject":"Your sign-in link","text":"Hello,\n\nUse this link to see your orders on the [{{.Site_Name}}] website:\n\n{{.Sign_In_URL}}\n\nThe link works once and expires in 15 minutes. If you did not ask for it, you can ignore this letter.\n\nBest regards,","html":""}');
+CREATE INDEX idx_cart_email ON cart (email COLLATE NOCASE);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idx_cart_email;
+DELETE FROM setting WHERE id = 'Pq7Hm2Xs9Cv4Nk6';
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE digital_upload (
+	id         TEXT PRIMARY KEY NOT NULL,
+	product_id TEXT NOT NULL,
+	orig_name  TEXT NOT NULL,
+	size       INTEGER NOT NULL,
+	sha256     TEXT NOT NULL DEFAULT '',
+	received   INTEGER NOT NULL DEFAULT 0,
+	parts      JSON NOT NULL DEFAULT '[]',
+	created    TIMESTAMP DEFAULT (datetime('now')),
+	updated    TIMESTAMP DEFAULT (datetime('now'))
+);
+CREATE INDEX idx_digital_upload_product_id ON digital_upload (product_id);
+CREATE INDEX idx_digital_upload_updated ON digital_upload (updated);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE digital_upload;
+-- +goose StatementEnd
@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE digital_version (
+	id         TEXT PRIMARY KEY NOT NULL,
+	product_id TEXT NOT NULL,
+	version    TEXT NOT NULL,
+	changelog  TEXT NOT NULL DEFAULT '',
+	current    BOOLEAN NOT NULL DEFAULT FALSE,
+	released   TIMESTAMP DEFAULT NULL,
+	notified   TIMESTAMP DEFAULT NULL,
+	created    TIMESTAMP DEFAULT (datetime('now')),
+	FOREIGN KEY (product_id) REFERENCES product(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX idx_digital_version_product_id ON digital_version (product_id);
+CREATE UNIQUE INDEX idx_digital_version_current ON digital_version (product_id) WHERE current;
+
+ALTER TABLE digital_file ADD COLUMN version_id TEXT DEFAULT NULL;
+CREATE INDEX idx_digital_file_version_id ON digital_file (version_id);
+ALTER TABLE digital_upload ADD COLUMN version_id TEXT NOT NULL DEFAULT '';
+
+-- the files already on sale become the first version of their product
+INSERT INTO digital_version (id, product_id, version, current, released)
+SELECT substr(lower(hex(randomblob(8))), 1, 15), product.id, '1', TRUE, product.created
+FROM product
+WHERE product.id IN (SELECT product_id FROM digital_file);
+UPDATE digital_file SET version_id = (SELECT id FROM digital_version WHERE digital_version.product_id = digital_file.product_id);
+
+INSERT INTO setting VALUES ('Fu3Vx8Rk1Lm6Qz2', 'digital_free_updates', 'true');
+INSERT INTO setting VALUES ('Uv5Nt9Bw2Hs7Kd4', 'mail_letter_update', '{"subject":"{{.Product_Name}} {{.Version}} is available","text":"Hello,\n\nA new version of \"{{.Product_Name}}\" that you bought on the [{{.Site_Name}}] website is available.\n\nWhat is new in {{.Version}}:\n{{.Changelog}}\n\nDownload it here:\n{{.Files}}\nBest regards,","html":""}');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM setting WHERE id IN ('Fu3Vx8Rk1Lm6Qz2', 'Uv5Nt9Bw2Hs7Kd4');
+ALTER TABLE digital_upload DROP COLUMN version_id;
+DROP INDEX idx_digital_file_version_id;
+ALTER TABLE digital_file DROP COLUMN version_id;
+DROP TABLE digital_version;
+-- +goose StatementEnd
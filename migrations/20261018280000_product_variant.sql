@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE product_variant (
+	id         TEXT PRIMARY KEY NOT NULL,
+	product_id TEXT NOT NULL,
+	name       TEXT NOT NULL,
+	amount     NUMERIC NOT NULL,
+	sku        TEXT NOT NULL DEFAULT '',
+	position   INTEGER NOT NULL DEFAULT 0,
+	created    TIMESTAMP DEFAULT (datetime('now')),
+	FOREIGN KEY (product_id) REFERENCES product(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX idx_product_variant_product_id ON product_variant (product_id);
+CREATE UNIQUE INDEX idx_product_variant_sku ON product_variant (sku) WHERE sku != '';
+
+ALTER TABLE digital_file ADD COLUMN variant_id TEXT DEFAULT NULL;
+ALTER TABLE digital_data ADD COLUMN variant_id TEXT DEFAULT NULL;
+CREATE INDEX idx_digital_data_variant_id ON digital_data (variant_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idx_digital_data_variant_id;
+ALTER TABLE digital_data DROP COLUMN variant_id;
+ALTER TABLE digital_file DROP COLUMN variant_id;
+DROP TABLE product_variant;
+-- +goose StatementEnd
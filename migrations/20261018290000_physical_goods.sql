@@ -0,0 +1,47 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE product ADD COLUMN physical BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE product ADD COLUMN weight INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE product ADD COLUMN stock INTEGER DEFAULT NULL;
+
+CREATE TABLE shipping_rate (
+	id         TEXT PRIMARY KEY NOT NULL,
+	name       TEXT NOT NULL,
+	countries  JSON DEFAULT '[]' NOT NULL,
+	min_weight INTEGER NOT NULL DEFAULT 0,
+	max_weight INTEGER NOT NULL DEFAULT 0,
+	amount     NUMERIC NOT NULL,
+	position   INTEGER NOT NULL DEFAULT 0,
+	active     BOOLEAN NOT NULL DEFAULT TRUE,
+	created    TIMESTAMP DEFAULT (datetime('now')),
+	updated    TIMESTAMP
+);
+
+ALTER TABLE cart ADD COLUMN shipping_address JSON DEFAULT NULL;
+ALTER TABLE cart ADD COLUMN shipping_rate TEXT NOT NULL DEFAULT '';
+ALTER TABLE cart ADD COLUMN shipping_amount NUMERIC NOT NULL DEFAULT 0;
+ALTER TABLE cart ADD COLUMN shipment_status TEXT NOT NULL DEFAULT '';
+ALTER TABLE cart ADD COLUMN tracking_number TEXT NOT NULL DEFAULT '';
+ALTER TABLE cart ADD COLUMN tracking_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE cart ADD COLUMN shipped TIMESTAMP DEFAULT NULL;
+CREATE INDEX idx_cart_shipment_status ON cart (shipment_status);
+
+INSERT INTO setting VALUES ('Sh4Wp8Zt2Kd6Mq1', 'mail_letter_shipped', '{"subject":"Your order from {{.Site_Name}} is on its way","text":"Hello,\n\nYour order on the [{{.Site_Name}}] website has been shipped to:\n{{.Shipping_Address}}\n\nTracking number: {{.Tracking_Number}}\n{{.Tracking_URL}}\n\nBest regards,","html":""}');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM setting WHERE id = 'Sh4Wp8Zt2Kd6Mq1';
+DROP INDEX idx_cart_shipment_status;
+ALTER TABLE cart DROP COLUMN shipped;
+ALTER TABLE cart DROP COLUMN tracking_url;
+ALTER TABLE cart DROP COLUMN tracking_number;
+ALTER TABLE cart DROP COLUMN shipment_status;
+ALTER TABLE cart DROP COLUMN shipping_amount;
+ALTER TABLE cart DROP COLUMN shipping_rate;
+ALTER TABLE cart DROP COLUMN shipping_address;
+DROP TABLE shipping_rate;
+ALTER TABLE product DROP COLUMN stock;
+ALTER TABLE product DROP COLUMN weight;
+ALTER TABLE product DROP COLUMN physical;
+-- +goose StatementEnd
@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE product_variant ADD COLUMN stock INTEGER DEFAULT NULL;
+
+CREATE TABLE stock_reservation (
+	cart_id    TEXT NOT NULL,
+	product_id TEXT NOT NULL,
+	variant_id TEXT NOT NULL DEFAULT '',
+	quantity   INTEGER NOT NULL,
+	reserved   TIMESTAMP DEFAULT (datetime('now')),
+	PRIMARY KEY (cart_id, product_id, variant_id)
+);
+CREATE INDEX idx_stock_reservation_product_id ON stock_reservation (product_id);
+
+CREATE TABLE stock_movement (
+	id         TEXT PRIMARY KEY NOT NULL,
+	product_id TEXT NOT NULL,
+	variant_id TEXT NOT NULL DEFAULT '',
+	change     INTEGER NOT NULL,
+	stock      INTEGER NOT NULL,
+	reason     TEXT NOT NULL,
+	cart_id    TEXT NOT NULL DEFAULT '',
+	note       TEXT NOT NULL DEFAULT '',
+	created    TIMESTAMP DEFAULT (datetime('now'))
+);
+CREATE INDEX idx_stock_movement_product_id ON stock_movement (product_id);
+
+INSERT INTO stock_movement (id, product_id, change, stock, reason, note)
+SELECT substr(lower(hex(randomblob(8))), 1, 15), id, stock, stock, 'adjustment', 'stock before tracking movements' FROM product WHERE stock IS NOT NULL;
+
+INSERT INTO setting VALUES ('Rv7Ks2Mn9Tb4Xq6', 'stock_reservation', '60');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM setting WHERE id = 'Rv7Ks2Mn9Tb4Xq6';
+DROP INDEX idx_stock_movement_product_id;
+DROP TABLE stock_movement;
+DROP INDEX idx_stock_reservation_product_id;
+DROP TABLE stock_reservation;
+ALTER TABLE product_variant DROP COLUMN stock;
+-- +goose StatementEnd
@@ -0,0 +1,52 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE category (
+	id        TEXT PRIMARY KEY NOT NULL,
+	parent_id TEXT DEFAULT NULL,
+	name      TEXT NOT NULL,
+	slug      TEXT UNIQUE NOT NULL,
+	desc      TEXT NOT NULL DEFAULT '',
+	seo       JSON DEFAULT NULL,
+	position  INTEGER NOT NULL DEFAULT 0,
+	created   TIMESTAMP DEFAULT (datetime('now')),
+	updated   TIMESTAMP,
+	FOREIGN KEY (parent_id) REFERENCES category(id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+CREATE INDEX idx_category_parent_id ON category (parent_id);
+
+CREATE TABLE product_category (
+	product_id  TEXT NOT NULL,
+	category_id TEXT NOT NULL,
+	PRIMARY KEY (product_id, category_id),
+	FOREIGN KEY (product_id) REFERENCES product(id) ON UPDATE CASCADE ON DELETE CASCADE,
+	FOREIGN KEY (category_id) REFERENCES category(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX idx_product_category_category_id ON product_category (category_id);
+
+CREATE TABLE tag (
+	id      TEXT PRIMARY KEY NOT NULL,
+	name    TEXT UNIQUE NOT NULL,
+	slug    TEXT UNIQUE NOT NULL,
+	created TIMESTAMP DEFAULT (datetime('now'))
+);
+
+CREATE TABLE product_tag (
+	product_id TEXT NOT NULL,
+	tag_id     TEXT NOT NULL,
+	PRIMARY KEY (product_id, tag_id),
+	FOREIGN KEY (product_id) REFERENCES product(id) ON UPDATE CASCADE ON DELETE CASCADE,
+	FOREIGN KEY (tag_id) REFERENCES tag(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+CREATE INDEX idx_product_tag_tag_id ON product_tag (tag_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idx_product_tag_tag_id;
+DROP TABLE product_tag;
+DROP TABLE tag;
+DROP INDEX idx_product_category_category_id;
+DROP TABLE product_category;
+DROP INDEX idx_category_parent_id;
+DROP TABLE category;
+-- +goose StatementEnd
@@ -0,0 +1,61 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE VIRTUAL TABLE product_search USING fts5 (
+	product_id UNINDEXED,
+	name,
+	brief,
+	description,
+	metadata,
+	attributes,
+	prefix = '2 3',
+	tokenize = 'unicode61 remove_diacritics 2'
+);
+
+-- the text of a product as it is indexed: tags are cut out of the description,
+-- the common entities are decoded, metadata gives its values only
+CREATE VIEW product_search_source AS
+SELECT
+	product.id,
+	product.name,
+	product.brief,
+	replace(replace(replace(replace(replace(replace((
+		WITH RECURSIVE strip(txt) AS (
+			SELECT product.desc
+			UNION ALL
+			SELECT substr(txt, 1, instr(txt, '<') - 1) || ' ' || substr(txt, instr(txt, '<') + instr(substr(txt, instr(txt, '<')), '>'))
+			FROM strip
+			WHERE instr(txt, '<') > 0 AND instr(substr(txt, instr(txt, '<')), '>') > 0
+		)
+		SELECT txt FROM strip ORDER BY length(txt) LIMIT 1
+	), '&nbsp;', ' '), '&lt;', '<'), '&gt;', '>'), '&quot;', '"'), '&#39;', ''''), '&amp;', '&'),
+	(SELECT group_concat(json_extract(value, '$.value'), ' ') FROM json_each(product.metadata)),
+	(SELECT group_concat(value, ' ') FROM json_each(product.attribute))
+FROM product;
+
+CREATE TRIGGER product_search_insert AFTER INSERT ON product
+BEGIN
+	INSERT INTO product_search SELECT * FROM product_search_source WHERE id = new.id;
+END;
+
+CREATE TRIGGER product_search_update AFTER UPDATE OF id, name, brief, desc, metadata, attribute ON product
+BEGIN
+	DELETE FROM product_search WHERE product_id = old.id;
+	INSERT INTO product_search SELECT * FROM product_search_source WHERE id = new.id;
+END;
+
+CREATE TRIGGER product_search_delete AFTER DELETE ON product
+BEGIN
+	DELETE FROM product_search WHERE product_id = old.id;
+END;
+
+INSERT INTO product_search SELECT * FROM product_search_source;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TRIGGER product_search_delete;
+DROP TRIGGER product_search_update;
+DROP TRIGGER product_search_insert;
+DROP VIEW product_search_source;
+DROP TABLE product_search;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE fulfillment ADD COLUMN letter TEXT NOT NULL DEFAULT '';
+-- the purchase letter used to wait for every fulfillment
+UPDATE fulfillment SET letter = 'purchase' WHERE content != '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE fulfillment DROP COLUMN letter;
+-- +goose StatementEnd
@@ -13,6 +13,64 @@ const (
 	MsgProductNotFound = "product not found"
 	MsgPageNotFound    = "page not found"
 	MsgSettingNotFound = "setting not found"
+
+	MsgProviderNotFound = "payment provider not found"
+	MsgCartNotFound     = "cart not found"
+	MsgPaymentMismatch  = "payment does not match the cart"
+
+	MsgJobNotFound     = "job not found"
+	MsgJobNotRetryable = "only pending and dead jobs can be retried"
+
+	MsgWebhookDeliveryNotFound = "webhook delivery not found"
+	MsgWebhookEndpointNotFound = "webhook endpoint not found"
+
+	MsgTokenInvalid = "token is invalid"
+	MsgTokenExpired = "token has expired"
+	MsgFileNotFound = "file not found"
+
+	MsgDownloadLimitReached = "download limit reached"
+
+	MsgOutOfStock    = "not enough keys in stock"
+	MsgProductNoKey  = "product does not sell keys"
+	MsgProductNoFile = "product does not sell files"
+
+	MsgLicenseNotFound        = "license key not found"
+	MsgActivationNotFound     = "license activation not found"
+	MsgActivationLimitReached = "activation limit reached"
+
+	MsgUploadNotFound = "upload not found"
+	MsgUploadOffset   = "upload offset does not match"
+	MsgUploadTooLarge = "chunk goes past the end of the upload"
+	MsgUploadChecksum = "checksum does not match"
+
+	MsgVersionNotFound   = "version not found"
+	MsgVersionCurrent    = "the current version cannot be deleted"
+	MsgVersionNotCurrent = "only the current version can be announced"
+	MsgVersionNoFiles    = "version has no files"
+	MsgFreeUpdatesOff    = "buyers do not get free updates"
+
+	MsgVariantNotFound  = "variant not found"
+	MsgVariantRequired  = "product has variants, variant_id is required"
+	MsgVariantSKUExists = "sku is already used by another variant"
+	MsgVariantInUse     = "variant still has digital content"
+
+	MsgShippingRateNotFound   = "shipping rate not found"
+	MsgShippingRateNotApplies = "shipping rate does not apply to the address"
+	MsgShippingAddressMissing = "shipping address is required"
+	MsgItemsOutOfStock        = "not enough items in stock"
+	MsgCartNotShippable       = "cart has no physical products"
+	MsgCartNotPaid            = "only paid carts can be shipped"
+
+	MsgStockNegative = "stock can not go below zero"
+
+	MsgCategoryNotFound   = "category not found"
+	MsgCategorySlugExists = "slug is already used by another category"
+	MsgCategoryParent     = "parent category not found"
+	MsgCategoryCycle      = "category can not be nested under itself or its subcategories"
+	MsgTagNotFound        = "tag not found"
+	MsgTagExists          = "tag already exists"
+
+	MsgSearchQueryEmpty = "search query has no words"
 )
 
 var (
@@ -26,4 +84,62 @@ var (
 	ErrProductNotFound = errors.New(MsgProductNotFound)
 	ErrPageNotFound    = errors.New(MsgPageNotFound)
 	ErrSettingNotFound = errors.New(MsgSettingNotFound)
+
+	ErrProviderNotFound = errors.New(MsgProviderNotFound)
+	ErrCartNotFound     = errors.New(MsgCartNotFound)
+	ErrPaymentMismatch  = errors.New(MsgPaymentMismatch)
+
+	ErrJobNotFound     = errors.New(MsgJobNotFound)
+	ErrJobNotRetryable = errors.New(MsgJobNotRetryable)
+
+	ErrWebhookDeliveryNotFound = errors.New(MsgWebhookDeliveryNotFound)
+	ErrWebhookEndpointNotFound = errors.New(MsgWebhookEndpointNotFound)
+
+	ErrTokenInvalid = errors.New(MsgTokenInvalid)
+	ErrTokenExpired = errors.New(MsgTokenExpired)
+	ErrFileNotFound = errors.New(MsgFileNotFound)
+
+	ErrDownloadLimitReached = errors.New(MsgDownloadLimitReached)
+
+	ErrOutOfStock    = errors.New(MsgOutOfStock)
+	ErrProductNoKey  = errors.New(MsgProductNoKey)
+	ErrProductNoFile = errors.New(MsgProductNoFile)
+
+	ErrLicenseNotFound        = errors.New(MsgLicenseNotFound)
+	ErrActivationNotFound     = errors.New(MsgActivationNotFound)
+	ErrActivationLimitReached = errors.New(MsgActivationLimitReached)
+
+	ErrUploadNotFound = errors.New(MsgUploadNotFound)
+	ErrUploadOffset   = errors.New(MsgUploadOffset)
+	ErrUploadTooLarge = errors.New(MsgUploadTooLarge)
+	ErrUploadChecksum = errors.New(MsgUploadChecksum)
+
+	ErrVersionNotFound   = errors.New(MsgVersionNotFound)
+	ErrVersionCurrent    = errors.New(MsgVersionCurrent)
+	ErrVersionNotCurrent = errors.New(MsgVersionNotCurrent)
+	ErrVersionNoFiles    = errors.New(MsgVersionNoFiles)
+	ErrFreeUpdatesOff    = errors.New(MsgFreeUpdatesOff)
+
+	ErrVariantNotFound  = errors.New(MsgVariantNotFound)
+	ErrVariantRequired  = errors.New(MsgVariantRequired)
+	ErrVariantSKUExists = errors.New(MsgVariantSKUExists)
+	ErrVariantInUse     = errors.New(MsgVariantInUse)
+
+	ErrShippingRateNotFound   = errors.New(MsgShippingRateNotFound)
+	ErrShippingRateNotApplies = errors.New(MsgShippingRateNotApplies)
+	ErrShippingAddressMissing = errors.New(MsgShippingAddressMissing)
+	ErrItemsOutOfStock        = errors.New(MsgItemsOutOfStock)
+	ErrCartNotShippable       = errors.New(MsgCartNotShippable)
+	ErrCartNotPaid            = errors.New(MsgCartNotPaid)
+
+	ErrStockNegative = errors.New(MsgStockNegative)
+
+	ErrCategoryNotFound   = errors.New(MsgCategoryNotFound)
+	ErrCategorySlugExists = errors.New(MsgCategorySlugExists)
+	ErrCategoryParent     = errors.New(MsgCategoryParent)
+	ErrCategoryCycle      = errors.New(MsgCategoryCycle)
+	ErrTagNotFound        = errors.New(MsgTagNotFound)
+	ErrTagExists          = errors.New(MsgTagExists)
+
+	ErrSearchQueryEmpty = errors.New(MsgSearchQueryEmpty)
 )
@@ -30,14 +30,15 @@ type Product struct {
 
 // Payment represents a payment transaction.
 type Payment struct {
-	PaymentSystem PaymentSystem `json:"provider"`     // Payment provider used
-	MerchantID    string        `json:"merchant_id"`  // Transaction ID from the provider
-	CartID        string        `json:"cart_id"`      // Associated cart ID
-	AmountTotal   int           `json:"amount_total"` // Total amount in smallest currency unit
-	Currency      string        `json:"currency"`     // ISO currency code
-	Status        Status        `json:"status"`       // Current payment status
-	URL           string        `json:"url,omitempty"` // Checkout URL to redirect user (if applicable)
-	Coin          *Coin         `json:"coin,omitempty"` // Cryptocurrency payment details (if applicable)
+	PaymentSystem  PaymentSystem `json:"provider"`                  // Payment provider used
+	MerchantID     string        `json:"merchant_id"`               // Transaction ID from the provider
+	CartID         string        `json:"cart_id"`                   // Associated cart ID
+	AmountTotal    int           `json:"amount_total"`              // Total amount in smallest currency unit
+	AmountRefunded int           `json:"amount_refunded,omitempty"` // Refunded amount in smallest currency unit
+	Currency       string        `json:"currency"`                  // ISO currency code
+	Status         Status        `json:"status"`                    // Current payment status
+	URL            string        `json:"url,omitempty"`             // Checkout URL to redirect user (if applicable)
+	Coin           *Coin         `json:"coin,omitempty"`            // Cryptocurrency payment details (if applicable)
 }
 
 // Validate validates the Payment structure.
@@ -10,6 +10,7 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"io"
 )
 
@@ -47,6 +48,52 @@ func signMessage(message, privKey string) (string, error) {
 	return base64.StdEncoding.EncodeToString(signature), nil
 }
 
+// refundKey is the idempotency key of a refund. It changes with the amount
+// already refunded, so a repeated request for the same refund is not paid
+// out twice while the next refund of the cart gets a key of its own.
+func refundKey(payment *Payment) string {
+	return fmt.Sprintf("%s-refund-%d", payment.CartID, payment.AmountRefunded)
+}
+
+func verifyMessage(message, signature, pubKey string) error {
+	publicKey, err := parsePublicKey(pubKey)
+	if err != nil {
+		return err
+	}
+	return verifySignature(message, signature, publicKey)
+}
+
+// parsePublicKey reads an RSA public key in PEM format, PKIX or PKCS #1.
+func parsePublicKey(pubKey string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pubKey))
+	if block == nil {
+		return nil, errors.New("invalid public key")
+	}
+
+	if parsedKey, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		key, ok := parsedKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("key is not a valid RSA public key")
+		}
+		return key, nil
+	}
+	return x509.ParsePKCS1PublicKey(block.Bytes)
+}
+
+func verifySignature(message, signature string, publicKey *rsa.PublicKey) error {
+	sign, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return ErrSignature
+	}
+
+	hash := sha1.Sum([]byte(message))
+	if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA1, hash[:], sign); err != nil {
+		return ErrSignature
+	}
+
+	return nil
+}
+
 func parseBody(r io.Reader) (map[string]any, error) {
 	var data map[string]any
 
@@ -111,6 +158,8 @@ func StatusPayment(system PaymentSystem, status string) Status {
 			"VOIDED":                CANCELED,
 			"COMPLETED":             PAID,
 			"PAYER_ACTION_REQUIRED": PROCESSED,
+			"REFUNDED":              REFUNDED,
+			"PARTIALLY_REFUNDED":    PARTIALLY_REFUNDED,
 		}
 
 	case SPECTROCOIN:
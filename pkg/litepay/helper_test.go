@@ -59,6 +59,35 @@ func Test_sign_message(t *testing.T) {
 	}
 }
 
+func Test_verify_message(t *testing.T) {
+	privKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	privKeyBytes, _ := x509.MarshalPKCS8PrivateKey(privKey)
+	privKeyPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privKeyBytes})
+	pubKeyBytes, _ := x509.MarshalPKIXPublicKey(&privKey.PublicKey)
+	pubKeyPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubKeyBytes})
+	pubKey1Pem := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&privKey.PublicKey)})
+
+	signature, _ := signMessage("Hello, World!", string(privKeyPem))
+
+	cases := []struct {
+		message   string
+		signature string
+		pubKey    string
+		err       error
+	}{
+		{"Hello, World!", signature, string(pubKeyPem), nil},
+		{"Hello, World!", signature, string(pubKey1Pem), nil},
+		{"Hello, World?", signature, string(pubKeyPem), ErrSignature},
+		{"Hello, World!", "not base64", string(pubKeyPem), ErrSignature},
+		{"Hello, World!", signature, "", errors.New("invalid public key")},
+	}
+
+	for _, tt := range cases {
+		err := verifyMessage(tt.message, tt.signature, tt.pubKey)
+		assert.Equal(t, tt.err, err)
+	}
+}
+
 func Test_parse_body(t *testing.T) {
 	cases := []struct {
 		body     string
@@ -6,8 +6,25 @@
 //	pay := litepay.New(callbackURL, successURL, cancelURL)
 //	stripe := pay.Stripe("sk_test_...")
 //	payment, err := stripe.Pay(cart)
+//
+// Providers can also be registered with Register and resolved by name with
+// Lookup, which lets applications add payment systems without changing
+// their checkout handlers.
 package litepay
 
+import "errors"
+
+var (
+	// ErrSignature is returned when a provider notification fails signature verification.
+	ErrSignature = errors.New("invalid signature")
+
+	// ErrMerchant is returned when a signed notification belongs to another merchant account.
+	ErrMerchant = errors.New("notification is for another merchant")
+
+	// ErrRefundNotSupported is returned by providers that cannot refund payments.
+	ErrRefundNotSupported = errors.New("refunds are not supported by this payment system")
+)
+
 // Status represents the internal payment status.
 type Status string
 
@@ -18,7 +35,10 @@ const (
 	CANCELED  Status = "canceled"  // Payment has been canceled (final)
 	FAILED    Status = "failed"    // Payment has failed (final)
 	PROCESSED Status = "processed" // Payment is being processed
+	REFUNDED  Status = "refunded"  // Payment has been refunded (final)
 	TEST      Status = "test"      // Test payment
+
+	PARTIALLY_REFUNDED Status = "partially_refunded" // Part of the payment has been refunded
 )
 
 // Cfg holds the configuration for payment providers.
@@ -42,6 +62,12 @@ type LitePay interface {
 	// Checkout verifies and updates the payment status with the provider.
 	// The session parameter contains the provider-specific session ID.
 	Checkout(payment *Payment, session string) (*Payment, error)
+
+	// Refund returns money for a completed payment identified by payment.MerchantID.
+	// The amount is in the smallest currency unit; 0 refunds the remaining amount.
+	// The returned payment carries the total refunded amount and the REFUNDED or
+	// PARTIALLY_REFUNDED status.
+	Refund(payment *Payment, amount int) (*Payment, error)
 }
 
 // New creates a new payment configuration with callback URLs.
@@ -62,3 +62,17 @@ func (c *dummy) Checkout(payment *Payment, session string) (*Payment, error) {
 	payment.MerchantID = "dummy_" + payment.CartID
 	return payment, nil
 }
+
+func (c *dummy) Refund(payment *Payment, amount int) (*Payment, error) {
+	remaining := payment.AmountTotal - payment.AmountRefunded
+	if amount == 0 || amount > remaining {
+		amount = remaining
+	}
+
+	payment.AmountRefunded += amount
+	payment.Status = PARTIALLY_REFUNDED
+	if payment.AmountRefunded >= payment.AmountTotal {
+		payment.Status = REFUNDED
+	}
+	return payment, nil
+}
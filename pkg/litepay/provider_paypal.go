@@ -4,11 +4,19 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
 )
 
+// paypalAPI is the PayPal REST API base URL.
+var paypalAPI = "https://api.sandbox.paypal.com" // https://api.paypal.com
+
+// errPaypalUnprocessable is returned when PayPal refuses to capture an order,
+// for example because it has already been captured.
+var errPaypalUnprocessable = errors.New("unprocessable entity")
+
 type paypal struct {
 	Cfg
 	clientID  string
@@ -26,7 +34,7 @@ type paypal struct {
 //
 // Supported currencies: EUR, USD, GBP, AUD, CAD, JPY, CNY, SEK
 //
-// Note: Currently configured for sandbox mode. Change c.api to "https://api.paypal.com" for production.
+// Note: Currently configured for sandbox mode. Change paypalAPI to "https://api.paypal.com" for production.
 //
 // Example:
 //
@@ -35,7 +43,7 @@ type paypal struct {
 //	payment, err := paypal.Pay(cart)
 func (c Cfg) Paypal(clientID, secretKey string) LitePay {
 	c.paymentSystem = PAYPAL
-	c.api = "https://api.sandbox.paypal.com" // https://api.paypal.com
+	c.api = paypalAPI
 	c.currency = []string{"EUR", "USD", "GBP", "AUD", "CAD", "JPY", "CNY", "SEK"}
 	return &paypal{
 		Cfg:       c,
@@ -65,6 +73,7 @@ func (c *paypal) Pay(cart Cart) (*Payment, error) {
 		"intent": "CAPTURE",
 		"purchase_units": []map[string]any{
 			{
+				"custom_id": cart.ID,
 				"amount": map[string]any{
 					"currency_code": currency,
 					"value":         fmt.Sprintf("%.2f", totalAmount),
@@ -136,6 +145,68 @@ func (c *paypal) Pay(cart Cart) (*Payment, error) {
 }
 
 func (c *paypal) Checkout(payment *Payment, token string) (*Payment, error) {
+	order, err := c.captureOrder(token)
+	if err != nil {
+		return nil, err
+	}
+
+	payment.AmountTotal = order.PurchaseUnits[0].Payments.Captures[0].Amount.cents()
+	payment.Currency = order.PurchaseUnits[0].Payments.Captures[0].Amount.CurrencyCode
+	payment.MerchantID = order.ID
+	payment.Status = StatusPayment(PAYPAL, order.Status)
+
+	return payment, nil
+}
+
+// paypalOrder is the part of a captured PayPal order used by litepay.
+type paypalOrder struct {
+	ID            string `json:"id"`
+	Status        string `json:"status"`
+	PurchaseUnits []struct {
+		CustomID string `json:"custom_id"`
+		Payments struct {
+			Captures []struct {
+				ID     string       `json:"id"`
+				Status string       `json:"status"`
+				Amount paypalAmount `json:"amount"`
+			} `json:"captures"`
+			Refunds []struct {
+				Status string       `json:"status"`
+				Amount paypalAmount `json:"amount"`
+			} `json:"refunds"`
+		} `json:"payments"`
+	} `json:"purchase_units"`
+}
+
+// refunded returns the amount refunded from the order's first capture.
+func (o *paypalOrder) refunded() (int, Status) {
+	payments := o.PurchaseUnits[0].Payments
+
+	var refunded int
+	for _, refund := range payments.Refunds {
+		if refund.Status != "CANCELLED" && refund.Status != "FAILED" {
+			refunded += refund.Amount.cents()
+		}
+	}
+
+	if refunded >= payments.Captures[0].Amount.cents() {
+		return refunded, REFUNDED
+	}
+	return refunded, PARTIALLY_REFUNDED
+}
+
+type paypalAmount struct {
+	CurrencyCode string `json:"currency_code"`
+	Value        string `json:"value"`
+}
+
+// cents converts the decimal amount to minor units.
+func (a paypalAmount) cents() int {
+	value, _ := strconv.ParseFloat(a.Value, 64)
+	return int(math.Round(value * 100))
+}
+
+func (c *paypal) captureOrder(orderID string) (*paypalOrder, error) {
 	accessToken, err := c.paypalAccessToken()
 	if err != nil {
 		return nil, err
@@ -143,7 +214,7 @@ func (c *paypal) Checkout(payment *Payment, token string) (*Payment, error) {
 
 	req, err := http.NewRequest(
 		http.MethodPost,
-		c.api+"/v2/checkout/orders/"+token+"/capture",
+		c.api+"/v2/checkout/orders/"+orderID+"/capture",
 		nil,
 	)
 	if err != nil {
@@ -159,41 +230,370 @@ func (c *paypal) Checkout(payment *Payment, token string) (*Payment, error) {
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode == 422 {
-		return nil, errors.New("unprocessable entity")
+		return nil, errPaypalUnprocessable
 	}
 
 	if resp.StatusCode != 200 && resp.StatusCode != 201 {
 		return nil, errors.New("the server returned an error")
 	}
 
-	var data struct {
-		ID            string `json:"id"`
-		Status        string `json:"status"`
-		PurchaseUnits []struct {
-			Payments struct {
-				Captures []struct {
-					Amount struct {
-						CurrencyCode string `json:"currency_code"`
-						Value        string `json:"value"`
-					} `json:"amount"`
-				} `json:"captures"`
-			} `json:"payments"`
-		} `json:"purchase_units"`
+	order := &paypalOrder{}
+	if err := json.NewDecoder(resp.Body).Decode(order); err != nil {
+		return nil, err
+	}
+
+	if len(order.PurchaseUnits) == 0 || len(order.PurchaseUnits[0].Payments.Captures) == 0 {
+		return nil, errors.New("order has no captures")
+	}
+
+	return order, nil
+}
+
+func (c *paypal) Refund(payment *Payment, amount int) (*Payment, error) {
+	if payment.MerchantID == "" {
+		return nil, errors.New("payment has no order")
+	}
+
+	order, err := c.order(payment.MerchantID)
+	if err != nil {
+		return nil, err
+	}
+	capture := order.PurchaseUnits[0].Payments.Captures[0]
+
+	refund := map[string]any{}
+	if amount > 0 {
+		refund["amount"] = paypalAmount{
+			CurrencyCode: capture.Amount.CurrencyCode,
+			Value:        fmt.Sprintf("%.2f", float64(amount)/100),
+		}
+	}
+	if payment.CartID != "" {
+		refund["custom_id"] = payment.CartID
+	}
+
+	refundJson, err := json.Marshal(refund)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := c.paypalAccessToken()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(
+		http.MethodPost,
+		c.api+"/v2/payments/captures/"+capture.ID+"/refund",
+		strings.NewReader(string(refundJson)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	req.Header.Add("Content-Type", "application/json")
+	if payment.CartID != "" {
+		req.Header.Add("PayPal-Request-Id", refundKey(payment))
 	}
 
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == 422 {
+		return nil, errPaypalUnprocessable
+	}
+
+	if resp.StatusCode != 200 && resp.StatusCode != 201 {
+		return nil, errors.New("the server returned an error")
+	}
+
+	var data struct {
+		Status string `json:"status"`
+	}
 	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
 		return nil, err
 	}
 
-	receiveAmount, _ := strconv.ParseFloat(data.PurchaseUnits[0].Payments.Captures[0].Amount.Value, 64)
-	payment.AmountTotal = int(receiveAmount * 100)
-	payment.Currency = data.PurchaseUnits[0].Payments.Captures[0].Amount.CurrencyCode
-	payment.MerchantID = data.ID
-	payment.Status = StatusPayment(PAYPAL, data.Status)
+	if data.Status == "CANCELLED" || data.Status == "FAILED" {
+		return nil, errors.New("refund " + strings.ToLower(data.Status))
+	}
+
+	// the order is reloaded to count refunds made earlier or in the dashboard
+	order, err = c.order(payment.MerchantID)
+	if err != nil {
+		return nil, err
+	}
+
+	payment.AmountTotal = capture.Amount.cents()
+	payment.Currency = capture.Amount.CurrencyCode
+	payment.AmountRefunded, payment.Status = order.refunded()
+
+	return payment, nil
+}
+
+// order loads an order with its captures and refunds.
+func (c *paypal) order(orderID string) (*paypalOrder, error) {
+	accessToken, err := c.paypalAccessToken()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, c.api+"/v2/checkout/orders/"+orderID, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != 200 {
+		return nil, errors.New("the server returned an error")
+	}
+
+	order := &paypalOrder{}
+	if err := json.NewDecoder(resp.Body).Decode(order); err != nil {
+		return nil, err
+	}
+
+	if len(order.PurchaseUnits) == 0 || len(order.PurchaseUnits[0].Payments.Captures) == 0 {
+		return nil, errors.New("order has no captures")
+	}
+
+	return order, nil
+}
+
+// PaypalWebhook verifies a PayPal webhook notification through the
+// verify-webhook-signature API and converts the event into a Payment.
+//
+// Parameters:
+//   - n: The received notification
+//   - clientID, secretKey: PayPal REST API credentials
+//   - webhookID: The ID of the webhook as shown in the PayPal developer dashboard
+//
+// Handled events:
+//   - CHECKOUT.ORDER.APPROVED: the order is captured, so carts are paid even if
+//     the customer never returns to the success URL
+//   - PAYMENT.CAPTURE.COMPLETED: PAID
+//   - PAYMENT.CAPTURE.REFUNDED: REFUNDED or PARTIALLY_REFUNDED
+//   - PAYMENT.CAPTURE.DENIED: FAILED
+//
+// Other events are acknowledged with a nil Payment and nil error.
+func PaypalWebhook(n *Notification, clientID, secretKey, webhookID string) (*Payment, error) {
+	c := &paypal{
+		Cfg:       Cfg{paymentSystem: PAYPAL, api: paypalAPI},
+		clientID:  clientID,
+		secretKey: secretKey,
+	}
+
+	if err := c.verifyWebhook(n, webhookID); err != nil {
+		return nil, err
+	}
+
+	var event struct {
+		EventType string `json:"event_type"`
+		Resource  struct {
+			ID            string        `json:"id"`
+			Status        string        `json:"status"`
+			CustomID      string        `json:"custom_id"`
+			Amount        *paypalAmount `json:"amount"`
+			PurchaseUnits []struct {
+				CustomID string `json:"custom_id"`
+			} `json:"purchase_units"`
+			SupplementaryData struct {
+				RelatedIDs struct {
+					OrderID string `json:"order_id"`
+				} `json:"related_ids"`
+			} `json:"supplementary_data"`
+			Links []struct {
+				Href string `json:"href"`
+				Rel  string `json:"rel"`
+			} `json:"links"`
+		} `json:"resource"`
+	}
+	if err := json.Unmarshal(n.Body, &event); err != nil {
+		return nil, errors.New("error decoding request body")
+	}
+
+	resource := event.Resource
+	payment := &Payment{
+		PaymentSystem: PAYPAL,
+		CartID:        resource.CustomID,
+		MerchantID:    resource.SupplementaryData.RelatedIDs.OrderID,
+	}
+	if resource.Amount != nil {
+		payment.AmountTotal = resource.Amount.cents()
+		payment.Currency = resource.Amount.CurrencyCode
+	}
+
+	switch event.EventType {
+	case "CHECKOUT.ORDER.APPROVED":
+		order, err := c.captureOrder(resource.ID)
+		if err != nil {
+			// the customer has already been redirected and the order captured
+			if err == errPaypalUnprocessable {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if len(resource.PurchaseUnits) > 0 {
+			payment.CartID = resource.PurchaseUnits[0].CustomID
+		}
+		capture := order.PurchaseUnits[0].Payments.Captures[0]
+		payment.AmountTotal = capture.Amount.cents()
+		payment.Currency = capture.Amount.CurrencyCode
+		payment.MerchantID = order.ID
+		payment.Status = StatusPayment(PAYPAL, order.Status)
+	case "PAYMENT.CAPTURE.COMPLETED":
+		payment.Status = PAID
+	case "PAYMENT.CAPTURE.DENIED":
+		payment.Status = FAILED
+	case "PAYMENT.CAPTURE.REFUNDED":
+		// the resource is the refund, the cart is found through the refunded capture
+		for _, link := range resource.Links {
+			if link.Rel == "up" {
+				capture, err := c.capture(link.Href)
+				if err != nil {
+					return nil, err
+				}
+				if payment.CartID == "" {
+					payment.CartID = capture.CustomID
+				}
+				payment.MerchantID = capture.SupplementaryData.RelatedIDs.OrderID
+				break
+			}
+		}
+		if payment.MerchantID == "" {
+			return nil, errors.New("refund has no capture")
+		}
+
+		order, err := c.order(payment.MerchantID)
+		if err != nil {
+			return nil, err
+		}
+		capture := order.PurchaseUnits[0].Payments.Captures[0]
+		payment.AmountTotal = capture.Amount.cents()
+		payment.Currency = capture.Amount.CurrencyCode
+		payment.AmountRefunded, payment.Status = order.refunded()
+	default:
+		return nil, nil
+	}
 
 	return payment, nil
 }
 
+// paypalCapture is the part of a PayPal capture used by litepay.
+type paypalCapture struct {
+	CustomID          string `json:"custom_id"`
+	SupplementaryData struct {
+		RelatedIDs struct {
+			OrderID string `json:"order_id"`
+		} `json:"related_ids"`
+	} `json:"supplementary_data"`
+}
+
+// capture loads a capture by its API link.
+func (c *paypal) capture(href string) (*paypalCapture, error) {
+	if !strings.HasPrefix(href, c.api+"/") {
+		return nil, errors.New("unexpected capture link")
+	}
+
+	accessToken, err := c.paypalAccessToken()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, href, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != 200 {
+		return nil, errors.New("the server returned an error")
+	}
+
+	capture := &paypalCapture{}
+	if err := json.NewDecoder(resp.Body).Decode(capture); err != nil {
+		return nil, err
+	}
+
+	return capture, nil
+}
+
+// verifyWebhook asks PayPal to verify the transmission headers of a webhook event.
+func (c *paypal) verifyWebhook(n *Notification, webhookID string) error {
+	if webhookID == "" {
+		return errors.New("webhook id is not configured")
+	}
+	if !json.Valid(n.Body) {
+		return errors.New("error decoding request body")
+	}
+
+	accessToken, err := c.paypalAccessToken()
+	if err != nil {
+		return err
+	}
+
+	verification, err := json.Marshal(map[string]any{
+		"auth_algo":         n.Header.Get("Paypal-Auth-Algo"),
+		"cert_url":          n.Header.Get("Paypal-Cert-Url"),
+		"transmission_id":   n.Header.Get("Paypal-Transmission-Id"),
+		"transmission_sig":  n.Header.Get("Paypal-Transmission-Sig"),
+		"transmission_time": n.Header.Get("Paypal-Transmission-Time"),
+		"webhook_id":        webhookID,
+		"webhook_event":     json.RawMessage(n.Body),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(
+		http.MethodPost,
+		c.api+"/v1/notifications/verify-webhook-signature",
+		strings.NewReader(string(verification)),
+	)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != 200 {
+		return errors.New("the server returned an error")
+	}
+
+	var data struct {
+		VerificationStatus string `json:"verification_status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return err
+	}
+
+	if data.VerificationStatus != "SUCCESS" {
+		return ErrSignature
+	}
+
+	return nil
+}
+
 func (c *paypal) paypalAccessToken() (string, error) {
 	req, err := http.NewRequest(
 		"POST",
@@ -0,0 +1,222 @@
+package litepay
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testPaypalWebhookID = "8PT597110X687430LKGECATA"
+
+// paypalServer is a stand-in for the PayPal REST API.
+// Refunded amounts are kept in refunds in minor units.
+func paypalServer(t *testing.T, refunds *[]int) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "client" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"token","token_type":"Bearer"}`))
+	})
+	mux.HandleFunc("POST /v1/notifications/verify-webhook-signature", func(w http.ResponseWriter, r *http.Request) {
+		var data struct {
+			TransmissionSig string          `json:"transmission_sig"`
+			WebhookID       string          `json:"webhook_id"`
+			WebhookEvent    json.RawMessage `json:"webhook_event"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&data)
+
+		status := "FAILURE"
+		if data.TransmissionSig == "valid" && data.WebhookID == testPaypalWebhookID && len(data.WebhookEvent) > 0 {
+			status = "SUCCESS"
+		}
+		_, _ = w.Write([]byte(`{"verification_status":"` + status + `"}`))
+	})
+	mux.HandleFunc("POST /v2/checkout/orders/{id}/capture", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") == "ORDER_CAPTURED" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":"` + r.PathValue("id") + `","status":"COMPLETED","purchase_units":[{"custom_id":"ABC123XYZ456789","payments":{"captures":[{"id":"CAPTURE_1","status":"COMPLETED","amount":{"currency_code":"EUR","value":"19.99"}}]}}]}`))
+	})
+	mux.HandleFunc("GET /v2/checkout/orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		refundList := []map[string]any{}
+		for _, amount := range *refunds {
+			refundList = append(refundList, map[string]any{
+				"status": "COMPLETED",
+				"amount": map[string]string{"currency_code": "EUR", "value": fmt.Sprintf("%.2f", float64(amount)/100)},
+			})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id":     r.PathValue("id"),
+			"status": "COMPLETED",
+			"purchase_units": []map[string]any{{
+				"custom_id": "ABC123XYZ456789",
+				"payments": map[string]any{
+					"captures": []map[string]any{{
+						"id":     "CAPTURE_1",
+						"status": "COMPLETED",
+						"amount": map[string]string{"currency_code": "EUR", "value": "19.99"},
+					}},
+					"refunds": refundList,
+				},
+			}},
+		})
+	})
+	mux.HandleFunc("GET /v2/payments/captures/{id}", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"custom_id":"ABC123XYZ456789","supplementary_data":{"related_ids":{"order_id":"ORDER_1"}}}`))
+	})
+	mux.HandleFunc("POST /v2/payments/captures/{id}/refund", func(w http.ResponseWriter, r *http.Request) {
+		var data struct {
+			Amount *paypalAmount `json:"amount"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&data)
+
+		var refunded int
+		for _, amount := range *refunds {
+			refunded += amount
+		}
+		amount := 1999 - refunded
+		if data.Amount != nil {
+			amount = data.Amount.cents()
+		}
+		if amount <= 0 || refunded+amount > 1999 {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		*refunds = append(*refunds, amount)
+
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":"REFUND_1","status":"COMPLETED"}`))
+	})
+
+	server := httptest.NewServer(mux)
+	defaultAPI := paypalAPI
+	paypalAPI = server.URL
+	t.Cleanup(func() {
+		paypalAPI = defaultAPI
+		server.Close()
+	})
+
+	return server
+}
+
+func paypalNotification(sig, payload string) *Notification {
+	header := http.Header{}
+	header.Set("Paypal-Auth-Algo", "SHA256withRSA")
+	header.Set("Paypal-Cert-Url", "https://api.sandbox.paypal.com/v1/notifications/certs/CERT-360caa42-fca2a594-1d93a270")
+	header.Set("Paypal-Transmission-Id", "69cd13f0-d67a-11e5-baa3-778b53f4ae55")
+	header.Set("Paypal-Transmission-Sig", sig)
+	header.Set("Paypal-Transmission-Time", "2016-02-18T20:01:35Z")
+	return &Notification{Header: header, Body: []byte(payload)}
+}
+
+func Test_paypal_webhook(t *testing.T) {
+	server := paypalServer(t, &[]int{1999})
+
+	cases := []struct {
+		payload    string
+		merchantID string
+		amount     int
+		status     Status
+	}{
+		{
+			payload:    `{"event_type":"CHECKOUT.ORDER.APPROVED","resource":{"id":"ORDER_1","status":"APPROVED","purchase_units":[{"custom_id":"ABC123XYZ456789"}]}}`,
+			merchantID: "ORDER_1",
+			amount:     1999,
+			status:     PAID,
+		},
+		{
+			payload:    `{"event_type":"PAYMENT.CAPTURE.COMPLETED","resource":{"id":"CAPTURE_1","status":"COMPLETED","custom_id":"ABC123XYZ456789","amount":{"currency_code":"EUR","value":"19.99"},"supplementary_data":{"related_ids":{"order_id":"ORDER_1"}}}}`,
+			merchantID: "ORDER_1",
+			amount:     1999,
+			status:     PAID,
+		},
+		{
+			payload:    `{"event_type":"PAYMENT.CAPTURE.DENIED","resource":{"id":"CAPTURE_1","status":"DENIED","custom_id":"ABC123XYZ456789","amount":{"currency_code":"EUR","value":"19.99"},"supplementary_data":{"related_ids":{"order_id":"ORDER_1"}}}}`,
+			merchantID: "ORDER_1",
+			amount:     1999,
+			status:     FAILED,
+		},
+		{
+			payload:    `{"event_type":"PAYMENT.CAPTURE.REFUNDED","resource":{"id":"REFUND_1","status":"COMPLETED","amount":{"currency_code":"EUR","value":"19.99"},"links":[{"href":"` + server.URL + `/v2/payments/captures/CAPTURE_1","rel":"up"}]}}`,
+			merchantID: "ORDER_1",
+			amount:     1999,
+			status:     REFUNDED,
+		},
+	}
+
+	for _, tt := range cases {
+		payment, err := PaypalWebhook(paypalNotification("valid", tt.payload), "client", "secret", testPaypalWebhookID)
+		assert.NoError(t, err)
+		assert.Equal(t, "ABC123XYZ456789", payment.CartID)
+		assert.Equal(t, tt.merchantID, payment.MerchantID)
+		assert.Equal(t, tt.amount, payment.AmountTotal)
+		assert.Equal(t, "EUR", payment.Currency)
+		assert.Equal(t, tt.status, payment.Status)
+	}
+
+	// order captured on the success redirect first
+	payment, err := PaypalWebhook(paypalNotification("valid", `{"event_type":"CHECKOUT.ORDER.APPROVED","resource":{"id":"ORDER_CAPTURED","status":"APPROVED"}}`), "client", "secret", testPaypalWebhookID)
+	assert.NoError(t, err)
+	assert.Nil(t, payment)
+
+	// unhandled event
+	payment, err = PaypalWebhook(paypalNotification("valid", `{"event_type":"PAYMENT.CAPTURE.PENDING","resource":{}}`), "client", "secret", testPaypalWebhookID)
+	assert.NoError(t, err)
+	assert.Nil(t, payment)
+
+	// refund linking outside of the PayPal API
+	_, err = PaypalWebhook(paypalNotification("valid", `{"event_type":"PAYMENT.CAPTURE.REFUNDED","resource":{"links":[{"href":"https://example.com/capture","rel":"up"}]}}`), "client", "secret", testPaypalWebhookID)
+	assert.Error(t, err)
+}
+
+func Test_paypal_webhook_verification(t *testing.T) {
+	paypalServer(t, &[]int{})
+	payload := `{"event_type":"PAYMENT.CAPTURE.COMPLETED","resource":{"custom_id":"ABC123XYZ456789"}}`
+
+	_, err := PaypalWebhook(paypalNotification("forged", payload), "client", "secret", testPaypalWebhookID)
+	assert.ErrorIs(t, err, ErrSignature)
+
+	_, err = PaypalWebhook(paypalNotification("valid", payload), "client", "secret", "another")
+	assert.ErrorIs(t, err, ErrSignature)
+
+	_, err = PaypalWebhook(paypalNotification("valid", payload), "client", "secret", "")
+	assert.Error(t, err)
+
+	_, err = PaypalWebhook(paypalNotification("valid", "{"), "client", "secret", testPaypalWebhookID)
+	assert.Error(t, err)
+}
+
+func Test_paypal_refund(t *testing.T) {
+	refunds := []int{}
+	paypalServer(t, &refunds)
+	paypal := New("", "", "").Paypal("client", "secret")
+
+	payment, err := paypal.Refund(&Payment{MerchantID: "ORDER_1", CartID: "ABC123XYZ456789"}, 500)
+	assert.NoError(t, err)
+	assert.Equal(t, PARTIALLY_REFUNDED, payment.Status)
+	assert.Equal(t, 500, payment.AmountRefunded)
+	assert.Equal(t, 1999, payment.AmountTotal)
+	assert.Equal(t, "EUR", payment.Currency)
+
+	payment, err = paypal.Refund(&Payment{MerchantID: "ORDER_1", CartID: "ABC123XYZ456789"}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, REFUNDED, payment.Status)
+	assert.Equal(t, 1999, payment.AmountRefunded)
+	assert.Equal(t, []int{500, 1499}, refunds)
+
+	_, err = paypal.Refund(&Payment{MerchantID: "ORDER_1"}, 100)
+	assert.Error(t, err)
+
+	_, err = paypal.Refund(&Payment{}, 100)
+	assert.Error(t, err)
+}
@@ -2,12 +2,18 @@ package litepay
 
 import (
 	"bytes"
+	"crypto/rsa"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // CallbackSpectrocoin represents the webhook callback data from SpectroCoin.
@@ -131,3 +137,155 @@ func (c *spectrocoin) Pay(cart Cart) (*Payment, error) {
 func (c *spectrocoin) Checkout(payment *Payment, session string) (*Payment, error) {
 	return nil, nil
 }
+
+// Refund is not available: SpectroCoin merchant API has no refunds.
+func (c *spectrocoin) Refund(payment *Payment, amount int) (*Payment, error) {
+	return nil, ErrRefundNotSupported
+}
+
+// spectrocoinPublicKeyURL is the location of the key SpectroCoin signs callbacks with.
+var spectrocoinPublicKeyURL = "https://spectrocoin.com/files/merchant.public.pem"
+
+// spectrocoinClient downloads the public key, a slow SpectroCoin host must not
+// hold callback requests up.
+var spectrocoinClient = &http.Client{Timeout: 10 * time.Second}
+
+// spectrocoinKey caches the last key callbacks were verified with, parsed.
+var spectrocoinKey struct {
+	sync.Mutex
+	pem string // as configured, empty for the downloaded key
+	key *rsa.PublicKey
+}
+
+// SpectrocoinCallback verifies the signature of a SpectroCoin callback
+// notification and converts it into a Payment.
+// SpectroCoin posts callbacks as form data; JSON bodies are accepted as well.
+//
+// SpectroCoin signs the callbacks of every merchant with the same key, so
+// the merchant and project of the callback are checked as well.
+//
+// Parameters:
+//   - n: The received notification
+//   - merchantID, projectID: the merchant and project the shop pays into
+//   - publicKey: SpectroCoin public key in PEM format; if empty, the key is
+//     downloaded from SpectroCoin and cached
+//
+// Returns:
+//   - *Payment: Payment with cart ID, merchant ID, status and the amount to receive
+//   - error: ErrSignature if the "sign" field does not match, ErrMerchant if
+//     the callback is for another merchant or project, or a decoding error
+func SpectrocoinCallback(n *Notification, merchantID, projectID, publicKey string) (*Payment, error) {
+	form := url.Values{}
+
+	if strings.HasPrefix(n.Header.Get("Content-Type"), "application/json") {
+		var data map[string]any
+		decoder := json.NewDecoder(bytes.NewReader(n.Body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&data); err != nil {
+			return nil, errors.New("error decoding request body")
+		}
+		for key, value := range data {
+			if value != nil {
+				form.Set(key, fmt.Sprint(value))
+			}
+		}
+	} else {
+		values, err := url.ParseQuery(string(n.Body))
+		if err != nil {
+			return nil, errors.New("error decoding request body")
+		}
+		form = values
+	}
+
+	key, err := spectrocoinPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// the signed message keeps the values exactly as SpectroCoin sent them
+	message := "merchantId=" + form.Get("merchantId") +
+		"&apiId=" + form.Get("apiId") +
+		"&orderId=" + form.Get("orderId") +
+		"&payCurrency=" + form.Get("payCurrency") +
+		"&payAmount=" + form.Get("payAmount") +
+		"&receiveCurrency=" + form.Get("receiveCurrency") +
+		"&receiveAmount=" + form.Get("receiveAmount") +
+		"&receivedAmount=" + form.Get("receivedAmount") +
+		"&description=" + form.Get("description") +
+		"&orderRequestId=" + form.Get("orderRequestId") +
+		"&status=" + form.Get("status")
+	if err := verifySignature(message, form.Get("sign"), key); err != nil {
+		return nil, err
+	}
+	if form.Get("merchantId") != merchantID || form.Get("apiId") != projectID {
+		return nil, ErrMerchant
+	}
+
+	callback := &CallbackSpectrocoin{}
+	callback.MerchantID, _ = strconv.Atoi(form.Get("merchantId"))
+	callback.ApiID, _ = strconv.Atoi(form.Get("apiId"))
+	callback.UserID = form.Get("userId")
+	callback.MerchantApiID = form.Get("merchantApiId")
+	callback.OrderID = form.Get("orderId")
+	callback.PayCurrency = form.Get("payCurrency")
+	callback.PayAmount, _ = strconv.ParseFloat(form.Get("payAmount"), 64)
+	callback.ReceiveCurrency = form.Get("receiveCurrency")
+	callback.ReceiveAmount, _ = strconv.ParseFloat(form.Get("receiveAmount"), 64)
+	callback.ReceivedAmount, _ = strconv.Atoi(form.Get("receivedAmount"))
+	callback.Description = form.Get("description")
+	callback.OrderRequestID, _ = strconv.Atoi(form.Get("orderRequestId"))
+	callback.Status, _ = strconv.Atoi(form.Get("status"))
+	callback.Sign = form.Get("sign")
+
+	return &Payment{
+		PaymentSystem: SPECTROCOIN,
+		CartID:        callback.OrderID,
+		MerchantID:    callback.MerchantApiID,
+		AmountTotal:   int(math.Round(callback.ReceiveAmount * 100)),
+		Currency:      strings.ToUpper(callback.ReceiveCurrency),
+		Status:        StatusPayment(SPECTROCOIN, strconv.Itoa(callback.Status)),
+		Coin: &Coin{
+			AmountTotal: callback.ReceiveAmount,
+			Currency:    callback.ReceiveCurrency,
+		},
+	}, nil
+}
+
+// spectrocoinPublicKey returns the parsed key in PEM format, an empty one is
+// downloaded from SpectroCoin. The key is cached until another one is passed.
+func spectrocoinPublicKey(publicKey string) (*rsa.PublicKey, error) {
+	spectrocoinKey.Lock()
+	defer spectrocoinKey.Unlock()
+
+	if spectrocoinKey.key != nil && spectrocoinKey.pem == publicKey {
+		return spectrocoinKey.key, nil
+	}
+
+	data := publicKey
+	if data == "" {
+		resp, err := spectrocoinClient.Get(spectrocoinPublicKeyURL)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = resp.Body.Close() }()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, errors.New("failed to download public key")
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		data = string(body)
+	}
+
+	key, err := parsePublicKey(data)
+	if err != nil {
+		return nil, err
+	}
+
+	spectrocoinKey.pem = publicKey
+	spectrocoinKey.key = key
+	return key, nil
+}
@@ -0,0 +1,165 @@
+package litepay
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func spectrocoinKeys(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	privBytes, _ := x509.MarshalPKCS8PrivateKey(key)
+	pubBytes, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privBytes})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes}))
+}
+
+func spectrocoinForm(t *testing.T, privKey, status string) url.Values {
+	t.Helper()
+	form := url.Values{
+		"merchantId":      {"1"},
+		"apiId":           {"2"},
+		"merchantApiId":   {"api"},
+		"orderId":         {"ABC123XYZ456789"},
+		"payCurrency":     {"BTC"},
+		"payAmount":       {"0.0001"},
+		"receiveCurrency": {"EUR"},
+		"receiveAmount":   {"1.5"},
+		"receivedAmount":  {"0"},
+		"description":     {"order"},
+		"orderRequestId":  {"3"},
+		"status":          {status},
+	}
+	message := "merchantId=1&apiId=2&orderId=ABC123XYZ456789&payCurrency=BTC&payAmount=0.0001" +
+		"&receiveCurrency=EUR&receiveAmount=1.5&receivedAmount=0&description=order&orderRequestId=3&status=" + status
+	sign, err := signMessage(message, privKey)
+	assert.NoError(t, err)
+	form.Set("sign", sign)
+	return form
+}
+
+func Test_spectrocoin_callback(t *testing.T) {
+	privKey, pubKey := spectrocoinKeys(t)
+
+	formHeader := http.Header{}
+	formHeader.Set("Content-Type", "application/x-www-form-urlencoded")
+	jsonHeader := http.Header{}
+	jsonHeader.Set("Content-Type", "application/json")
+
+	jsonBody := func(form url.Values) []byte {
+		data := map[string]any{}
+		for key := range form {
+			data[key] = json.RawMessage(form.Get(key))
+		}
+		for _, key := range []string{"merchantApiId", "orderId", "payCurrency", "receiveCurrency", "description", "sign"} {
+			data[key] = form.Get(key)
+		}
+		body, _ := json.Marshal(data)
+		return body
+	}
+
+	cases := []struct {
+		header   http.Header
+		body     []byte
+		expected Status
+	}{
+		{formHeader, []byte(spectrocoinForm(t, privKey, "3").Encode()), PAID},
+		{jsonHeader, jsonBody(spectrocoinForm(t, privKey, "5")), FAILED},
+	}
+
+	for _, tt := range cases {
+		payment, err := SpectrocoinCallback(&Notification{Header: tt.header, Body: tt.body}, "1", "2", pubKey)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, payment.Status)
+		assert.Equal(t, "ABC123XYZ456789", payment.CartID)
+		assert.Equal(t, "api", payment.MerchantID)
+		assert.Equal(t, 1.5, payment.Coin.AmountTotal)
+		assert.Equal(t, 150, payment.AmountTotal)
+		assert.Equal(t, "EUR", payment.Currency)
+	}
+
+	// tampered status
+	form := spectrocoinForm(t, privKey, "4")
+	form.Set("status", "3")
+	_, err := SpectrocoinCallback(&Notification{Header: formHeader, Body: []byte(form.Encode())}, "1", "2", pubKey)
+	assert.ErrorIs(t, err, ErrSignature)
+
+	// signed with another key
+	_, otherPubKey := spectrocoinKeys(t)
+	form = spectrocoinForm(t, privKey, "3")
+	_, err = SpectrocoinCallback(&Notification{Header: formHeader, Body: []byte(form.Encode())}, "1", "2", otherPubKey)
+	assert.ErrorIs(t, err, ErrSignature)
+
+	_, err = SpectrocoinCallback(&Notification{Header: jsonHeader, Body: []byte("{")}, "1", "2", pubKey)
+	assert.Error(t, err)
+
+	// signed by SpectroCoin, but for another merchant or project
+	form = spectrocoinForm(t, privKey, "3")
+	_, err = SpectrocoinCallback(&Notification{Header: formHeader, Body: []byte(form.Encode())}, "7", "2", pubKey)
+	assert.ErrorIs(t, err, ErrMerchant)
+	_, err = SpectrocoinCallback(&Notification{Header: formHeader, Body: []byte(form.Encode())}, "1", "7", pubKey)
+	assert.ErrorIs(t, err, ErrMerchant)
+}
+
+func Test_spectrocoin_public_key(t *testing.T) {
+	privKey, pubKey := spectrocoinKeys(t)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		_, _ = w.Write([]byte(pubKey))
+	}))
+	defer server.Close()
+
+	defaultURL := spectrocoinPublicKeyURL
+	spectrocoinPublicKeyURL = server.URL
+	spectrocoinKey.pem, spectrocoinKey.key = "", nil
+	defer func() {
+		spectrocoinPublicKeyURL = defaultURL
+		spectrocoinKey.pem, spectrocoinKey.key = "", nil
+	}()
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for range 2 {
+		payment, err := SpectrocoinCallback(&Notification{Header: header, Body: []byte(spectrocoinForm(t, privKey, "3").Encode())}, "1", "2", "")
+		assert.NoError(t, err)
+		assert.Equal(t, PAID, payment.Status)
+	}
+	assert.Equal(t, 1, requests)
+}
+
+func Test_spectrocoin_public_key_timeout(t *testing.T) {
+	privKey, _ := spectrocoinKeys(t)
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	defaultURL, defaultClient := spectrocoinPublicKeyURL, spectrocoinClient
+	spectrocoinPublicKeyURL = server.URL
+	spectrocoinClient = &http.Client{Timeout: 50 * time.Millisecond}
+	spectrocoinKey.pem, spectrocoinKey.key = "", nil
+	defer func() {
+		spectrocoinPublicKeyURL, spectrocoinClient = defaultURL, defaultClient
+	}()
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err := SpectrocoinCallback(&Notification{Header: header, Body: []byte(spectrocoinForm(t, privKey, "3").Encode())}, "1", "2", "")
+	assert.Error(t, err)
+}
@@ -1,14 +1,25 @@
 package litepay
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// stripeSignatureTolerance is the maximum age of a signed webhook event.
+const stripeSignatureTolerance = 5 * time.Minute
+
+// stripeAPI is the Stripe REST API base URL.
+var stripeAPI = "https://api.stripe.com"
+
 type stripe struct {
 	Cfg
 	apiToken   string
@@ -33,7 +44,7 @@ type stripe struct {
 //	payment, err := stripe.Pay(cart)
 func (c Cfg) Stripe(apiToken string) LitePay {
 	c.paymentSystem = STRIPE
-	c.api = "https://api.stripe.com"
+	c.api = stripeAPI
 	c.currency = []string{"EUR", "USD", "GBP", "AUD", "CAD", "JPY", "CNY", "SEK"}
 	return &stripe{
 		Cfg:        c,
@@ -63,6 +74,9 @@ func (c *stripe) Pay(cart Cart) (*Payment, error) {
 	params.Add("success_url", fmt.Sprintf("%s/?payment_system=%s&cart_id=%s&session={CHECKOUT_SESSION_ID}", c.successURL, c.paymentSystem, cart.ID))
 	params.Add("cancel_url", fmt.Sprintf("%s/?payment_system=%s&cart_id=%s", c.cancelURL, c.paymentSystem, cart.ID))
 	params.Add("mode", `payment`)
+	params.Add("client_reference_id", cart.ID)
+	params.Add("metadata[cart_id]", cart.ID)
+	params.Add("payment_intent_data[metadata][cart_id]", cart.ID)
 	body := strings.NewReader(params.Encode())
 
 	req, err := http.NewRequest(
@@ -131,3 +145,193 @@ func (c *stripe) Checkout(payment *Payment, session string) (*Payment, error) {
 
 	return payment, nil
 }
+
+func (c *stripe) Refund(payment *Payment, amount int) (*Payment, error) {
+	if payment.MerchantID == "" {
+		return nil, errors.New("payment has no payment intent")
+	}
+
+	params := url.Values{}
+	params.Add("payment_intent", payment.MerchantID)
+	if amount > 0 {
+		params.Add("amount", strconv.Itoa(amount))
+	}
+	if payment.CartID != "" {
+		params.Add("metadata[cart_id]", payment.CartID)
+	}
+	params.Add("expand[]", "charge")
+
+	req, err := http.NewRequest(
+		http.MethodPost,
+		c.api+"/v1/refunds",
+		strings.NewReader(params.Encode()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(c.apiToken, "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if payment.CartID != "" {
+		req.Header.Set("Idempotency-Key", refundKey(payment))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var data struct {
+		Status   string `json:"status"`
+		Currency string `json:"currency"`
+		Charge   struct {
+			Amount         int  `json:"amount"`
+			AmountRefunded int  `json:"amount_refunded"`
+			Refunded       bool `json:"refunded"`
+		} `json:"charge"`
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != 200 {
+		if data.Error.Message != "" {
+			return nil, errors.New(data.Error.Message)
+		}
+		return nil, errors.New("the server returned an error")
+	}
+
+	if data.Status == "failed" || data.Status == "canceled" {
+		return nil, errors.New("refund " + data.Status)
+	}
+
+	payment.AmountTotal = data.Charge.Amount
+	payment.AmountRefunded = data.Charge.AmountRefunded
+	payment.Currency = strings.ToUpper(data.Currency)
+	payment.Status = PARTIALLY_REFUNDED
+	if data.Charge.Refunded {
+		payment.Status = REFUNDED
+	}
+
+	return payment, nil
+}
+
+// StripeWebhook verifies the Stripe-Signature header of a webhook notification
+// and converts the event into a Payment.
+//
+// Parameters:
+//   - n: The received notification
+//   - secret: The signing secret of the webhook endpoint (starts with "whsec_")
+//
+// Handled events:
+//   - checkout.session.completed: payment status of the session (paid or unpaid)
+//   - checkout.session.expired: CANCELED
+//   - charge.refunded: REFUNDED or PARTIALLY_REFUNDED
+//
+// Other events are acknowledged with a nil Payment and nil error.
+func StripeWebhook(n *Notification, secret string) (*Payment, error) {
+	if err := verifyStripeSignature(n.Body, n.Header.Get("Stripe-Signature"), secret, time.Now()); err != nil {
+		return nil, err
+	}
+
+	var event struct {
+		Type string `json:"type"`
+		Data struct {
+			Object struct {
+				ClientReferenceID string            `json:"client_reference_id"`
+				PaymentIntent     string            `json:"payment_intent"`
+				PaymentStatus     string            `json:"payment_status"`
+				AmountTotal       int               `json:"amount_total"`
+				Amount            int               `json:"amount"`
+				AmountRefunded    int               `json:"amount_refunded"`
+				Refunded          bool              `json:"refunded"`
+				Currency          string            `json:"currency"`
+				Metadata          map[string]string `json:"metadata"`
+			} `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(n.Body, &event); err != nil {
+		return nil, errors.New("error decoding request body")
+	}
+
+	object := event.Data.Object
+	payment := &Payment{
+		PaymentSystem: STRIPE,
+		CartID:        object.ClientReferenceID,
+		MerchantID:    object.PaymentIntent,
+		Currency:      strings.ToUpper(object.Currency),
+	}
+	if payment.CartID == "" {
+		payment.CartID = object.Metadata["cart_id"]
+	}
+
+	switch event.Type {
+	case "checkout.session.completed":
+		payment.AmountTotal = object.AmountTotal
+		payment.Status = StatusPayment(STRIPE, object.PaymentStatus)
+	case "checkout.session.expired":
+		payment.AmountTotal = object.AmountTotal
+		payment.Status = CANCELED
+	case "charge.refunded":
+		payment.AmountTotal = object.Amount
+		payment.AmountRefunded = object.AmountRefunded
+		payment.Status = PARTIALLY_REFUNDED
+		if object.Refunded {
+			payment.Status = REFUNDED
+		}
+	default:
+		return nil, nil
+	}
+
+	return payment, nil
+}
+
+// verifyStripeSignature checks the HMAC-SHA256 signature of a Stripe webhook payload.
+// The header has the form "t=<timestamp>,v1=<signature>[,v1=<signature>]".
+func verifyStripeSignature(payload []byte, header, secret string, now time.Time) error {
+	if secret == "" {
+		return errors.New("webhook secret is not configured")
+	}
+
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrSignature
+	}
+
+	if age := now.Sub(time.Unix(unix, 0)); age > stripeSignatureTolerance || age < -stripeSignatureTolerance {
+		return ErrSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+
+	for _, signature := range signatures {
+		sig, err := hex.DecodeString(signature)
+		if err == nil && hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+
+	return ErrSignature
+}
@@ -0,0 +1,148 @@
+package litepay
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testStripeSecret = "whsec_test_0123456789abcdefghijklmnop"
+
+func stripeNotification(payload string, timestamp int64, secret string) *Notification {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%d.%s", timestamp, payload)))
+
+	header := http.Header{}
+	header.Set("Stripe-Signature", fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil))))
+	return &Notification{Header: header, Body: []byte(payload)}
+}
+
+func Test_stripe_webhook(t *testing.T) {
+	now := time.Now().Unix()
+	cases := []struct {
+		payload    string
+		cartID     string
+		merchantID string
+		status     Status
+	}{
+		{
+			payload:    `{"type":"checkout.session.completed","data":{"object":{"client_reference_id":"ABC123XYZ456789","payment_intent":"pi_1","payment_status":"paid","amount_total":1999,"currency":"usd"}}}`,
+			cartID:     "ABC123XYZ456789",
+			merchantID: "pi_1",
+			status:     PAID,
+		},
+		{
+			payload: `{"type":"checkout.session.expired","data":{"object":{"client_reference_id":"ABC123XYZ456789","payment_intent":null,"payment_status":"unpaid","amount_total":1999,"currency":"usd"}}}`,
+			cartID:  "ABC123XYZ456789",
+			status:  CANCELED,
+		},
+		{
+			payload:    `{"type":"charge.refunded","data":{"object":{"payment_intent":"pi_1","amount":1999,"amount_refunded":1999,"refunded":true,"currency":"usd","metadata":{"cart_id":"ABC123XYZ456789"}}}}`,
+			cartID:     "ABC123XYZ456789",
+			merchantID: "pi_1",
+			status:     REFUNDED,
+		},
+		{
+			payload:    `{"type":"charge.refunded","data":{"object":{"payment_intent":"pi_1","amount":1999,"amount_refunded":500,"refunded":false,"currency":"usd","metadata":{"cart_id":"ABC123XYZ456789"}}}}`,
+			cartID:     "ABC123XYZ456789",
+			merchantID: "pi_1",
+			status:     PARTIALLY_REFUNDED,
+		},
+	}
+
+	for _, tt := range cases {
+		payment, err := StripeWebhook(stripeNotification(tt.payload, now, testStripeSecret), testStripeSecret)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.cartID, payment.CartID)
+		assert.Equal(t, tt.merchantID, payment.MerchantID)
+		assert.Equal(t, tt.status, payment.Status)
+		assert.Equal(t, "USD", payment.Currency)
+	}
+
+	// events without a cart status change are acknowledged
+	payment, err := StripeWebhook(stripeNotification(`{"type":"customer.created","data":{"object":{}}}`, now, testStripeSecret), testStripeSecret)
+	assert.NoError(t, err)
+	assert.Nil(t, payment)
+}
+
+func Test_stripe_webhook_signature(t *testing.T) {
+	payload := `{"type":"checkout.session.completed","data":{"object":{"client_reference_id":"ABC123XYZ456789","payment_status":"paid"}}}`
+	now := time.Now().Unix()
+
+	cases := []struct {
+		name         string
+		notification *Notification
+		secret       string
+	}{
+		{"wrong secret", stripeNotification(payload, now, "whsec_other"), testStripeSecret},
+		{"expired timestamp", stripeNotification(payload, now-600, testStripeSecret), testStripeSecret},
+		{"missing header", &Notification{Header: http.Header{}, Body: []byte(payload)}, testStripeSecret},
+	}
+
+	for _, tt := range cases {
+		_, err := StripeWebhook(tt.notification, tt.secret)
+		assert.ErrorIs(t, err, ErrSignature, tt.name)
+	}
+
+	tampered := stripeNotification(payload, now, testStripeSecret)
+	tampered.Body = []byte(`{"type":"checkout.session.completed","data":{"object":{"client_reference_id":"OTHER1234567890","payment_status":"paid"}}}`)
+	_, err := StripeWebhook(tampered, testStripeSecret)
+	assert.ErrorIs(t, err, ErrSignature)
+
+	_, err = StripeWebhook(stripeNotification(payload, now, testStripeSecret), "")
+	assert.Error(t, err)
+}
+
+func Test_stripe_refund(t *testing.T) {
+	var refunded int
+	keys := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if r.URL.Path != "/v1/refunds" || r.FormValue("payment_intent") != "pi_1" || r.FormValue("expand[]") != "charge" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":{"message":"No such payment_intent"}}`))
+			return
+		}
+
+		amount := 1999 - refunded
+		if r.FormValue("amount") != "" {
+			fmt.Sscan(r.FormValue("amount"), &amount)
+		}
+		refunded += amount
+		fmt.Fprintf(w, `{"status":"succeeded","currency":"usd","charge":{"amount":1999,"amount_refunded":%d,"refunded":%t}}`, refunded, refunded == 1999)
+	}))
+	defer server.Close()
+
+	defaultAPI := stripeAPI
+	stripeAPI = server.URL
+	defer func() { stripeAPI = defaultAPI }()
+
+	stripe := New("", "", "").Stripe("sk_test")
+
+	payment, err := stripe.Refund(&Payment{MerchantID: "pi_1", CartID: "ABC123XYZ456789"}, 500)
+	assert.NoError(t, err)
+	assert.Equal(t, PARTIALLY_REFUNDED, payment.Status)
+	assert.Equal(t, 500, payment.AmountRefunded)
+	assert.Equal(t, "USD", payment.Currency)
+
+	payment, err = stripe.Refund(&Payment{MerchantID: "pi_1", CartID: "ABC123XYZ456789", AmountRefunded: 500}, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, REFUNDED, payment.Status)
+	assert.Equal(t, 1999, payment.AmountRefunded)
+
+	// each refund of the cart has its own key, a repeated one reuses it
+	assert.Equal(t, []string{"ABC123XYZ456789-refund-0", "ABC123XYZ456789-refund-500"}, keys)
+
+	_, err = stripe.Refund(&Payment{MerchantID: "pi_2"}, 0)
+	assert.EqualError(t, err, "No such payment_intent")
+
+	_, err = stripe.Refund(&Payment{}, 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,93 @@
+package litepay
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// Settings is the configuration model of a registered provider.
+// The application loads the model and hands it back to the provider hooks.
+type Settings interface {
+	// Enabled reports whether the provider is switched on.
+	Enabled() bool
+}
+
+// Notification is an asynchronous callback received from a payment provider.
+type Notification struct {
+	Query  url.Values  // Query parameters of the callback URL
+	Header http.Header // Request headers
+	Body   []byte      // Raw request body
+}
+
+// Provider describes a payment provider available through the registry.
+//
+// Callback and Checkout are optional: a provider without Callback does not
+// accept asynchronous notifications, and a provider without Checkout confirms
+// payments through callbacks only. Callback may return a nil Payment and nil
+// error for notifications that are acknowledged but carry no status change.
+type Provider struct {
+	Name     PaymentSystem                                                               // Unique provider name
+	Settings func() Settings                                                             // Returns an empty settings model
+	New      func(cfg Cfg, settings Settings) LitePay                                    // Creates a payment session from settings
+	Callback func(settings Settings, n *Notification) (*Payment, error)                  // Parses provider notifications
+	Checkout func(session LitePay, payment *Payment, query url.Values) (*Payment, error) // Confirms payment on success redirect
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []Provider
+)
+
+// Register makes a payment provider available by its name.
+// It panics if the provider is incomplete or a provider with the same name
+// is already registered.
+//
+// Example:
+//
+//	litepay.Register(litepay.Provider{
+//		Name:     "inhouse",
+//		Settings: func() litepay.Settings { return &InHouse{} },
+//		New: func(cfg litepay.Cfg, s litepay.Settings) litepay.LitePay {
+//			return newInHouse(cfg, s.(*InHouse))
+//		},
+//	})
+func Register(provider Provider) {
+	if provider.Name == "" || provider.Settings == nil || provider.New == nil {
+		panic("litepay: Register provider is incomplete")
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for _, p := range registry {
+		if p.Name == provider.Name {
+			panic(fmt.Sprintf("litepay: Register called twice for provider %s", provider.Name))
+		}
+	}
+	registry = append(registry, provider)
+}
+
+// Lookup returns the provider registered under the given name.
+func Lookup(name PaymentSystem) (Provider, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	for _, p := range registry {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Provider{}, false
+}
+
+// Providers returns all registered providers in registration order.
+func Providers() []Provider {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	providers := make([]Provider, len(registry))
+	copy(providers, registry)
+	return providers
+}
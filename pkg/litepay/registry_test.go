@@ -0,0 +1,39 @@
+package litepay
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testSettings struct {
+	active bool
+}
+
+func (s *testSettings) Enabled() bool { return s.active }
+
+func Test_register_lookup(t *testing.T) {
+	provider := Provider{
+		Name:     "test_registry",
+		Settings: func() Settings { return &testSettings{active: true} },
+		New:      func(cfg Cfg, _ Settings) LitePay { return cfg.Dummy() },
+	}
+	Register(provider)
+
+	found, ok := Lookup("test_registry")
+	assert.True(t, ok)
+	assert.Equal(t, provider.Name, found.Name)
+	assert.True(t, found.Settings().Enabled())
+
+	_, ok = Lookup("test_unknown")
+	assert.False(t, ok)
+
+	var names []PaymentSystem
+	for _, p := range Providers() {
+		names = append(names, p.Name)
+	}
+	assert.Contains(t, names, PaymentSystem("test_registry"))
+
+	assert.Panics(t, func() { Register(provider) })
+	assert.Panics(t, func() { Register(Provider{Name: "test_incomplete"}) })
+}
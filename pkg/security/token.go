@@ -0,0 +1,58 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shurco/litecart/pkg/errors"
+)
+
+// SignToken returns a URL-safe token that carries payload until expires.
+// The token is signed with HMAC-SHA256 keyed with secret.
+func SignToken(secret, payload string, expires time.Time) string {
+	body := base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(expires.Unix(), 10) + "." + payload))
+	return body + "." + base64.RawURLEncoding.EncodeToString(tokenMAC(secret, body))
+}
+
+// ParseToken checks the signature and the expiry of a token made by SignToken
+// and returns its payload.
+func ParseToken(secret, token string, now time.Time) (string, error) {
+	body, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", errors.ErrTokenInvalid
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, tokenMAC(secret, body)) {
+		return "", errors.ErrTokenInvalid
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return "", errors.ErrTokenInvalid
+	}
+
+	expires, payload, ok := strings.Cut(string(data), ".")
+	if !ok {
+		return "", errors.ErrTokenInvalid
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return "", errors.ErrTokenInvalid
+	}
+	if !now.Before(time.Unix(unix, 0)) {
+		return "", errors.ErrTokenExpired
+	}
+
+	return payload, nil
+}
+
+func tokenMAC(secret, body string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,42 @@
+package security
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shurco/litecart/pkg/errors"
+)
+
+func Test_sign_and_parse_token(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	token := SignToken("secret", "cart.file", now.Add(time.Hour))
+
+	payload, err := ParseToken("secret", token, now)
+	if err != nil {
+		t.Fatalf("parse token: %v", err)
+	}
+	if payload != "cart.file" {
+		t.Fatalf("unexpected payload: got %q want %q", payload, "cart.file")
+	}
+
+	if _, err := ParseToken("secret", token, now.Add(time.Hour)); err != errors.ErrTokenExpired {
+		t.Fatalf("expired token: got %v want %v", err, errors.ErrTokenExpired)
+	}
+	if _, err := ParseToken("other", token, now); err != errors.ErrTokenInvalid {
+		t.Fatalf("wrong secret: got %v want %v", err, errors.ErrTokenInvalid)
+	}
+
+	forged := SignToken("secret", "cart.other", now.Add(time.Hour))
+	body, _, _ := strings.Cut(forged, ".")
+	_, signature, _ := strings.Cut(token, ".")
+	if _, err := ParseToken("secret", body+"."+signature, now); err != errors.ErrTokenInvalid {
+		t.Fatalf("forged token: got %v want %v", err, errors.ErrTokenInvalid)
+	}
+
+	for _, bad := range []string{"", "abc", "abc.def", "." + signature} {
+		if _, err := ParseToken("secret", bad, now); err != errors.ErrTokenInvalid {
+			t.Fatalf("token %q: got %v want %v", bad, err, errors.ErrTokenInvalid)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package strutil
 
-import "strings"
+import (
+	"strings"
+	"unicode"
+)
 
 // ToSlice split string to array.
 func ToSlice(s string, sep ...string) []string {
@@ -18,3 +21,12 @@ func ToAny(key ...string) []any {
 	}
 	return keys
 }
+
+// Slugify lowercases s and joins its words with dashes, dropping everything
+// that is not a letter or a digit.
+func Slugify(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, "-")
+}
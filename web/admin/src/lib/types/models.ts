@@ -6,13 +6,26 @@ export interface Product {
   description?: string
   amount: number | string
   active: boolean
+  stock?: number
+  in_stock?: boolean
+  physical?: boolean
+  weight?: number
   created?: string
   updated?: string
   metadata?: Array<{ key: string; value: string }>
   attributes?: string[]
+  variants?: ProductVariant[]
+  categories?: Category[]
+  tags?: Tag[]
   digital?: {
     type: 'file' | 'data' | 'api' | ''
     filled?: boolean
+    download_limit?: number
+    download_lifetime?: number
+    stock_threshold?: number
+    activation_limit?: number
+    fulfillment_url?: string
+    fulfillment_secret?: string
   }
   images?: Array<{
     id: string
@@ -25,6 +38,7 @@ export interface Product {
     keywords?: string
     description?: string
   }
+  snippet?: string // escaped html of a search result, matched words in <mark>
 }
 
 export interface Page {
@@ -47,8 +61,9 @@ export interface Cart {
   id: string
   email: string
   amount_total: number
+  amount_refunded?: number
   currency: string
-  payment_status: 'paid' | 'pending' | 'failed'
+  payment_status: 'paid' | 'pending' | 'failed' | 'refunded' | 'partially_refunded'
   payment_system?: string
   payment_id?: string
   created?: string
@@ -71,21 +86,114 @@ export interface CartItem {
 
 export interface CartDetail extends Cart {
   items?: CartItem[]
+  downloads?: CartDownload[]
+  fulfillments?: CartFulfillment[]
+  shipping?: CartShipping
+}
+
+export interface Address {
+  name: string
+  line1: string
+  line2?: string
+  city: string
+  state?: string
+  postal_code: string
+  country: string
+  phone?: string
+}
+
+export interface CartShipping {
+  address: Address
+  rate: string
+  amount: number
+  status: 'pending' | 'shipped' | 'delivered'
+  tracking_number?: string
+  tracking_url?: string
+  shipped?: number
+}
+
+export interface ShippingRate {
+  id: string
+  name: string
+  countries: string[]
+  min_weight: number
+  max_weight: number
+  amount: number
+  position: number
+  active: boolean
+  created?: number
+  updated?: number
+}
+
+export interface CartFulfillment {
+  id: string
+  cart_id: string
+  product_id: string
+  content: string
+  error?: string
+  attempts: number
+  created: number
+  updated?: number
+}
+
+export interface CartDownload {
+  id: string
+  cart_id: string
+  file_id: string
+  file_name: string
+  ip: string
+  user_agent: string
+  counted: boolean
+  created: number
+}
+
+export interface CartStatusHistory {
+  id: string
+  from: Cart['payment_status']
+  to: Cart['payment_status']
+  source: 'callback' | 'success' | 'cancel' | 'admin'
+  created: number
+}
+
+export interface WebhookEndpoint {
+  id: string
+  url: string
+  secret: string
+  active: boolean
+  events: string[]
+  created?: number
+  updated?: number
+}
+
+export interface WebhookDelivery {
+  id: string
+  event_id: string
+  endpoint_id: string
+  event: string
+  url: string
+  request: string
+  response_code: number
+  response_body: string
+  error?: string
+  created: number
 }
 
 export interface PaymentSettings {
   currency: string
+  stock_reservation: number
 }
 
 export interface StripeSettings {
   active: boolean
   secret_key: string
+  webhook_secret_key: string
 }
 
 export interface PaypalSettings {
   active: boolean
   client_id: string
   secret_key: string
+  webhook_id: string
 }
 
 export interface SpectrocoinSettings {
@@ -93,6 +201,7 @@ export interface SpectrocoinSettings {
   merchant_id: string
   project_id: string
   private_key: string
+  public_key: string
 }
 
 export interface SmtpSettings {
@@ -114,3 +223,82 @@ export interface LetterContent {
   text: string
   html: string
 }
+
+export interface LicenseActivation {
+  id: string
+  data_id: string
+  fingerprint: string
+  name: string
+  ip: string
+  created: number
+  validated: number
+}
+
+export interface Category {
+  id: string
+  parent_id?: string
+  name: string
+  slug: string
+  description?: string
+  position: number
+  products: number
+  seo?: {
+    title?: string
+    keywords?: string
+    description?: string
+  }
+  created?: number
+  updated?: number
+}
+
+export interface Tag {
+  id: string
+  name: string
+  slug: string
+  products?: number
+  created?: number
+}
+
+export interface StockLevel {
+  variant_id?: string
+  name: string
+  stock: number | null
+  reserved: number
+}
+
+export interface StockMovement {
+  id: string
+  product_id: string
+  variant_id?: string
+  change: number
+  stock: number
+  reason: 'sale' | 'adjustment'
+  cart_id?: string
+  note?: string
+  created: number
+}
+
+export interface Inventory {
+  levels: StockLevel[]
+  movements: StockMovement[]
+}
+
+export interface ProductVariant {
+  id: string
+  name: string
+  amount: number
+  sku?: string
+  position: number
+  stock?: number
+  created?: number
+}
+
+export interface DigitalVersion {
+  id: string
+  version: string
+  changelog: string
+  current: boolean
+  released?: number
+  notified?: number
+  created: number
+}
@@ -0,0 +1,107 @@
+import type { ApiResponse } from '$lib/types/api'
+import { extractErrorMessage } from './errorExtractor'
+
+export interface DigitalUpload {
+  id: string
+  product_id: string
+  version_id?: string
+  name: string
+  size: number
+  offset: number
+  chunk_size: number
+  file?: any
+}
+
+// uploadKey identifies a file across page reloads, so that an interrupted
+// upload of the same file goes on where it stopped.
+function uploadKey(productId: string, versionId: string, file: File): string {
+  return `upload:${productId}:${versionId}:${file.name}:${file.size}:${file.lastModified}`
+}
+
+async function request(url: string, init: RequestInit): Promise<{ status: number; data: any }> {
+  const response = await fetch(url, { credentials: 'include', ...init })
+  const text = await response.text()
+  return { status: response.status, data: text ? JSON.parse(text) : {} }
+}
+
+async function chunkChecksum(chunk: ArrayBuffer): Promise<string | undefined> {
+  // crypto.subtle is only available on https and localhost
+  if (!globalThis.crypto?.subtle) return undefined
+  const digest = new Uint8Array(await crypto.subtle.digest('SHA-256', chunk))
+  return 'sha256 ' + btoa(String.fromCharCode(...digest))
+}
+
+// uploadDigitalFile sends a digital file in chunks through the resumable
+// upload API and reports the uploaded share from 0 to 1. The file is added to
+// the given version, or to the current one. The result holds the added file
+// once the last chunk is accepted.
+export async function uploadDigitalFile(
+  productId: string,
+  file: File,
+  versionId?: string,
+  onprogress?: (progress: number) => void
+): Promise<ApiResponse> {
+  const base = `/api/_/products/${productId}/digital/uploads`
+  const key = uploadKey(productId, versionId || '', file)
+
+  try {
+    let upload: DigitalUpload | undefined
+    const savedId = localStorage.getItem(key)
+    if (savedId) {
+      const saved = await request(`${base}/${savedId}`, { method: 'GET' })
+      if (saved.status === 200) upload = saved.data.result
+    }
+
+    if (!upload) {
+      const created = await request(base, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ name: file.name, size: file.size, version_id: versionId })
+      })
+      if (created.status !== 201) {
+        return { success: false, message: extractErrorMessage(created.data) }
+      }
+      upload = created.data.result as DigitalUpload
+      localStorage.setItem(key, upload.id)
+    }
+
+    let offset = upload.offset
+    onprogress?.(offset / file.size)
+
+    // when every byte was received before, an empty chunk finishes the upload
+    for (let finishing = false; !finishing; ) {
+      finishing = offset + upload.chunk_size >= file.size
+      const chunk = await file.slice(offset, offset + upload.chunk_size).arrayBuffer()
+      const headers: Record<string, string> = {
+        'Content-Type': 'application/offset+octet-stream',
+        'Upload-Offset': String(offset)
+      }
+      const checksum = await chunkChecksum(chunk)
+      if (checksum) headers['Upload-Checksum'] = checksum
+
+      const res = await request(`${base}/${upload.id}`, { method: 'PATCH', headers, body: chunk })
+      if (res.status === 409 && res.data.result) {
+        // the server holds a different offset, go on from there
+        offset = res.data.result.offset
+        finishing = false
+        continue
+      }
+      if (res.status !== 200) {
+        if (res.status === 404) localStorage.removeItem(key)
+        return { success: false, message: extractErrorMessage(res.data) }
+      }
+
+      offset = res.data.result.offset
+      onprogress?.(offset / file.size)
+
+      if (res.data.result.file) {
+        localStorage.removeItem(key)
+        return { success: true, result: res.data.result.file }
+      }
+    }
+
+    return { success: false, message: 'Upload was not completed' }
+  } catch (error) {
+    return { success: false, message: (error as Error).message }
+  }
+}
@@ -4,6 +4,13 @@ import { isBrowser, getLocalStorage, setLocalStorage } from '$lib/utils/browser'
 
 const CART_STORAGE_KEY = 'cart'
 
+/**
+ * A product bought as different variants takes a cart line for each one
+ */
+export function isSameItem(item: CartItem, id: string, variantId?: string): boolean {
+  return item.id === id && (item.variant_id || '') === (variantId || '')
+}
+
 function createCartStore() {
   const loadFromStorage = (): CartItem[] => {
     if (!isBrowser()) return []
@@ -28,7 +35,7 @@ function createCartStore() {
     subscribe,
     add: (item: CartItem) => {
       update((items) => {
-        if (items.find((i) => i.id === item.id)) {
+        if (items.find((i) => isSameItem(i, item.id, item.variant_id))) {
           return items
         }
         const newItems = [...items, item]
@@ -36,9 +43,9 @@ function createCartStore() {
         return newItems
       })
     },
-    remove: (id: string) => {
+    remove: (id: string, variantId?: string) => {
       update((items) => {
-        const newItems = items.filter((item) => item.id !== id)
+        const newItems = items.filter((item) => !isSameItem(item, id, variantId))
         saveToStorage(newItems)
         return newItems
       })
@@ -7,20 +7,87 @@ export interface Product {
   description?: string
   images?: Array<{ name: string; ext: string }>
   attributes?: string[]
+  variants?: Variant[]
+  categories?: Category[]
+  tags?: Tag[]
+  stock?: number
+  in_stock?: boolean
+  physical?: boolean
+  weight?: number
   seo?: {
     title?: string
     keywords?: string
     description?: string
   }
   inCart?: boolean
+  snippet?: string // escaped html of a search result, matched words in <mark>
+}
+
+export interface Category {
+  id: string
+  parent_id?: string
+  name: string
+  slug: string
+  description?: string
+  products?: number
+  children?: Category[]
+  seo?: {
+    title?: string
+    keywords?: string
+    description?: string
+  }
+}
+
+export interface Tag {
+  id: string
+  name: string
+  slug: string
+}
+
+export interface Variant {
+  id: string
+  name: string
+  amount: number
+  sku?: string
+  stock?: number
 }
 
 export interface CartItem {
   id: string
+  variant_id?: string
+  variant?: string
   name: string
   slug: string
   amount: number
   image?: { name: string; ext: string } | null
+  physical?: boolean
+}
+
+export interface Address {
+  name: string
+  line1: string
+  line2?: string
+  city: string
+  state?: string
+  postal_code: string
+  country: string
+  phone?: string
+}
+
+export interface ShippingOption {
+  id: string
+  name: string
+  amount: number
+}
+
+export interface OrderShipping {
+  address: Address
+  rate: string
+  amount: number
+  status: string
+  tracking_number?: string
+  tracking_url?: string
+  shipped?: number
 }
 
 export interface Settings {
@@ -51,3 +118,25 @@ export interface PaymentMethods {
   paypal?: boolean
   spectrocoin?: boolean
 }
+
+export interface CustomerItem {
+  product_id: string
+  name: string
+  slug: string
+  quantity: number
+  variants?: string[]
+  digital: string
+  keys?: string[]
+  files?: Array<{ name: string; url: string }>
+  access?: string
+}
+
+export interface CustomerOrder {
+  id: string
+  amount_total: number
+  currency: string
+  payment_system: string
+  created: number
+  items: CustomerItem[]
+  shipping?: OrderShipping
+}
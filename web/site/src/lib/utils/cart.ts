@@ -2,19 +2,20 @@
  * Utility for working with cart
  */
 
-import { cartStore } from '$lib/stores/cart'
-import type { Product, CartItem } from '$lib/types/models'
+import { cartStore, isSameItem } from '$lib/stores/cart'
+import type { Product, CartItem, Variant } from '$lib/types/models'
 
 /**
  * Toggles product in cart (adds or removes)
  * @param product - Product to add/remove
  * @param cartItems - Current cart items to check availability
+ * @param variant - Variant of the product to add/remove, if it has variants
  */
-export function toggleCartItem(product: Product, cartItems: CartItem[]): void {
-  const inCart = cartItems.some((item) => item.id === product.id)
+export function toggleCartItem(product: Product, cartItems: CartItem[], variant?: Variant): void {
+  const inCart = cartItems.some((item) => isSameItem(item, product.id, variant?.id))
 
   if (inCart) {
-    cartStore.remove(product.id)
+    cartStore.remove(product.id, variant?.id)
   } else {
     const image = product.images?.[0] ? { name: product.images[0].name, ext: product.images[0].ext } : null
 
@@ -22,10 +23,26 @@ export function toggleCartItem(product: Product, cartItems: CartItem[]): void {
       id: product.id,
       name: product.name,
       slug: product.slug,
-      amount: product.amount,
+      amount: variant ? variant.amount : product.amount,
       image
     }
+    if (product.physical) {
+      cartItem.physical = true
+    }
+    if (variant) {
+      cartItem.variant_id = variant.id
+      cartItem.variant = variant.name
+    }
 
     cartStore.add(cartItem)
   }
 }
+
+/**
+ * Returns the lowest price of a product, which is the price of its cheapest variant if it has variants
+ * @param product - Product to get the price of
+ */
+export function lowestAmount(product: Product): number {
+  if (!product.variants || product.variants.length === 0) return product.amount
+  return Math.min(...product.variants.map((variant) => variant.amount))
+}